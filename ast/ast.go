@@ -2,6 +2,7 @@ package ast
 
 import (
 	"bytes"
+	"path"
 	"strings"
 
 	"github.com/marmotini/ngiri-lang/token"
@@ -9,6 +10,7 @@ import (
 
 type Node interface {
 	TokenLiteral() string
+	Pos() token.Position
 
 	String() string
 }
@@ -35,6 +37,14 @@ func (p *Program) TokenLiteral() string {
 	return ""
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 
@@ -45,18 +55,36 @@ func (p *Program) String() string {
 	return out.String()
 }
 
+// LetStatement binds Value to Name or, for `let [a, b] = pair;`, to the
+// identifiers of the destructuring Pattern. Exactly one of Name and Pattern
+// is set. Statements starting with const bind names that can not be
+// assigned, see Const. Annotation is the optional type in `let x: int = 5;`.
 type LetStatement struct {
-	Token token.Token
-	Name  *Identifier
-	Value Expression
+	Token      token.Token
+	Name       *Identifier
+	Pattern    Expression
+	Annotation TypeExpression
+	Value      Expression
 }
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Pos() token.Position  { return ls.Token.Pos }
+
+// Const reports whether ls is a const declaration.
+func (ls *LetStatement) Const() bool { return ls.Token.Type == token.CONST }
+
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String())
+	if ls.Pattern != nil {
+		out.WriteString(ls.Pattern.String())
+	} else {
+		out.WriteString(ls.Name.String())
+	}
+	if ls.Annotation != nil {
+		out.WriteString(": " + ls.Annotation.String())
+	}
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
@@ -75,6 +103,7 @@ type Identifier struct {
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Pos() token.Position  { return i.Token.Pos }
 func (i *Identifier) String() string {
 	return i.Value
 }
@@ -86,6 +115,7 @@ type Boolean struct {
 
 func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) Pos() token.Position  { return b.Token.Pos }
 func (b *Boolean) String() string {
 	return b.Token.Literal
 }
@@ -97,6 +127,7 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos }
 func (sl *StringLiteral) String() string {
 	return sl.Token.Literal
 }
@@ -108,6 +139,7 @@ type ReturnStatement struct {
 
 func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Position  { return rs.Token.Pos }
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(rs.TokenLiteral() + " ")
@@ -128,6 +160,7 @@ type ExpressionStatement struct {
 
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position  { return es.Token.Pos }
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -143,6 +176,7 @@ type IntegerLiteral struct {
 
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position  { return il.Token.Pos }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
 type PrefixExpression struct {
@@ -153,6 +187,7 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position  { return pe.Token.Pos }
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -173,6 +208,7 @@ type InfixExpression struct {
 
 func (ie *InfixExpression) expressionNode()      {}
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *InfixExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -185,6 +221,21 @@ func (ie *InfixExpression) String() string {
 	return out.String()
 }
 
+// AssignExpression stores Value in the variable Name, which a let statement
+// has to have declared, e.g. `x = x + 1`. It evaluates to Value.
+type AssignExpression struct {
+	Token token.Token // the = token
+	Name  *Identifier
+	Value Expression
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) Pos() token.Position  { return ae.Token.Pos }
+func (ae *AssignExpression) String() string {
+	return "(" + ae.Name.String() + " = " + ae.Value.String() + ")"
+}
+
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
@@ -192,6 +243,7 @@ type BlockStatement struct {
 
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Pos }
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -211,6 +263,7 @@ type IfExpression struct {
 
 func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -229,19 +282,34 @@ func (ie *IfExpression) String() string {
 
 type FunctionExpression struct {
 	Token token.Token
-
-	Parameters []*Identifier
+	// Name is the name a let statement binds the function to, used in
+	// stack traces. It is empty for anonymous functions.
+	Name string
+
+	// Parameters are identifiers or destructuring patterns, see
+	// LetStatement.
+	Parameters []Expression
+	// ParameterTypes holds the annotation of each parameter, nil where a
+	// parameter has none. The slice is nil when no parameter is annotated.
+	ParameterTypes []TypeExpression
+	// ReturnType is the annotation after `->`, or nil.
+	ReturnType TypeExpression
 	Body       *BlockStatement
 }
 
 func (fe *FunctionExpression) expressionNode()      {}
 func (fe *FunctionExpression) TokenLiteral() string { return fe.Token.Literal }
+func (fe *FunctionExpression) Pos() token.Position  { return fe.Token.Pos }
 func (fe *FunctionExpression) String() string {
 	var out bytes.Buffer
 
 	params := []string{}
 
-	for _, p := range fe.Parameters {
+	for i, p := range fe.Parameters {
+		if fe.ParameterTypes != nil && fe.ParameterTypes[i] != nil {
+			params = append(params, annotate(p, fe.ParameterTypes[i]))
+			continue
+		}
 		params = append(params, p.String())
 	}
 
@@ -249,11 +317,42 @@ func (fe *FunctionExpression) String() string {
 	out.WriteString("( ")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") ")
+	if fe.ReturnType != nil {
+		out.WriteString("-> " + fe.ReturnType.String() + " ")
+	}
 	out.WriteString(fe.Body.String())
 
 	return out.String()
 }
 
+type MacroLiteral struct {
+	Token token.Token
+
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (ml *MacroLiteral) expressionNode()      {}
+func (ml *MacroLiteral) TokenLiteral() string { return ml.Token.Literal }
+func (ml *MacroLiteral) Pos() token.Position  { return ml.Token.Pos }
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+
+	for _, p := range ml.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString(ml.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(ml.Body.String())
+
+	return out.String()
+}
+
 type CallExpression struct {
 	Token     token.Token
 	Function  Expression
@@ -262,6 +361,7 @@ type CallExpression struct {
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Position  { return ce.Token.Pos }
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -286,6 +386,7 @@ type ListLiteral struct {
 
 func (ll *ListLiteral) expressionNode()      {}
 func (ll *ListLiteral) TokenLiteral() string { return ll.Token.Literal }
+func (ll *ListLiteral) Pos() token.Position  { return ll.Token.Pos }
 func (ll *ListLiteral) String() string {
 	var out bytes.Buffer
 
@@ -310,6 +411,7 @@ type IndexExpression struct {
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 
@@ -326,3 +428,483 @@ type ArrayLiteral struct {
 	Token    token.Token
 	Elements []Expression
 }
+
+func (al *ArrayLiteral) expressionNode()      {}
+func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Pos }
+func (al *ArrayLiteral) String() string {
+	var out bytes.Buffer
+
+	elem := []string{}
+
+	for _, e := range al.Elements {
+		elem = append(elem, e.String())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elem, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// ImportStatement loads a module. Without Names the module is bound to its
+// namespace, `import "lib/math"` binds `math`; with Names only the listed
+// exports are bound, `import {sum} from "lib/math"`.
+type ImportStatement struct {
+	Token token.Token
+	Names []*Identifier
+	Path  *StringLiteral
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) Pos() token.Position  { return is.Token.Pos }
+func (is *ImportStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(is.TokenLiteral() + " ")
+
+	if is.Names != nil {
+		names := []string{}
+
+		for _, n := range is.Names {
+			names = append(names, n.String())
+		}
+
+		out.WriteString("{" + strings.Join(names, ", ") + "} from ")
+	}
+
+	out.WriteString("\"" + is.Path.Value + "\";")
+
+	return out.String()
+}
+
+// Namespace is the name a whole module import is bound to: the last element
+// of the path without its extension.
+func (is *ImportStatement) Namespace() string {
+	name := path.Base(is.Path.Value)
+
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// ExportStatement exports the name a declaration at the top level of a
+// module binds, `export let sum = ...` or `export struct Point { x, y }`.
+type ExportStatement struct {
+	Token token.Token
+	// Statement is a *LetStatement, *StructStatement or *EnumStatement.
+	Statement Statement
+}
+
+// Name returns the name Statement binds.
+func (es *ExportStatement) Name() *Identifier {
+	switch s := es.Statement.(type) {
+	case *LetStatement:
+		return s.Name
+	case *StructStatement:
+		return s.Name
+	case *EnumStatement:
+		return s.Name
+	}
+
+	return nil
+}
+
+func (es *ExportStatement) statementNode()       {}
+func (es *ExportStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExportStatement) Pos() token.Position  { return es.Token.Pos }
+func (es *ExportStatement) String() string {
+	return es.TokenLiteral() + " " + es.Statement.String()
+}
+
+// SelectorExpression accesses a member of a value, as in `lib.sum`.
+type SelectorExpression struct {
+	Token    token.Token
+	Left     Expression
+	Selector *Identifier
+}
+
+func (se *SelectorExpression) expressionNode()      {}
+func (se *SelectorExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SelectorExpression) Pos() token.Position  { return se.Token.Pos }
+func (se *SelectorExpression) String() string {
+	return se.Left.String() + "." + se.Selector.String()
+}
+
+// ThrowStatement raises Value as an error, see TryExpression.
+type ThrowStatement struct {
+	Token token.Token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) Pos() token.Position  { return ts.Token.Pos }
+func (ts *ThrowStatement) String() string {
+	return ts.TokenLiteral() + " " + ts.Value.String() + ";"
+}
+
+// TryExpression evaluates Block and, when it throws, binds the error to Param
+// and evaluates Catch instead. Finally runs last however the other blocks were
+// left. Either Catch or Finally may be missing, but not both.
+type TryExpression struct {
+	Token   token.Token
+	Block   *BlockStatement
+	Param   *Identifier
+	Catch   *BlockStatement
+	Finally *BlockStatement
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) Pos() token.Position  { return te.Token.Pos }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try " + te.Block.String())
+
+	if te.Catch != nil {
+		out.WriteString("catch(" + te.Param.String() + ") " + te.Catch.String())
+	}
+
+	if te.Finally != nil {
+		out.WriteString("finally " + te.Finally.String())
+	}
+
+	return out.String()
+}
+
+// PropagateExpression is the postfix `?` operator. It evaluates to the value
+// inside ok and some, and returns err and none from the enclosing function.
+type PropagateExpression struct {
+	Token token.Token
+	Left  Expression
+}
+
+func (pe *PropagateExpression) expressionNode()      {}
+func (pe *PropagateExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PropagateExpression) Pos() token.Position  { return pe.Token.Pos }
+func (pe *PropagateExpression) String() string {
+	return "(" + pe.Left.String() + "?)"
+}
+
+// HashLiteral is `{key: value, ...}`. Keys and Values are parallel, in
+// source order.
+type HashLiteral struct {
+	Token  token.Token
+	Keys   []Expression
+	Values []Expression
+}
+
+func (hl *HashLiteral) expressionNode()      {}
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position  { return hl.Token.Pos }
+func (hl *HashLiteral) String() string {
+	pairs := []string{}
+
+	for i, key := range hl.Keys {
+		pairs = append(pairs, key.String()+": "+hl.Values[i].String())
+	}
+
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// SpreadExpression is `...value`. In a pattern it is the rest of an array,
+// as in `[h, ...t]`, and Value is the identifier the rest is bound to. As the
+// last parameter of a function it collects the remaining arguments, as an
+// argument of a call it passes the elements of an array one by one.
+type SpreadExpression struct {
+	Token token.Token
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode()      {}
+func (se *SpreadExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadExpression) Pos() token.Position  { return se.Token.Pos }
+func (se *SpreadExpression) String() string {
+	return "..." + se.Value.String()
+}
+
+// DefaultParameter is a parameter with a default value, `y = 10`. Value is
+// evaluated when a call leaves the parameter out.
+type DefaultParameter struct {
+	Token     token.Token
+	Parameter Expression
+	Value     Expression
+}
+
+func (dp *DefaultParameter) expressionNode()      {}
+func (dp *DefaultParameter) TokenLiteral() string { return dp.Token.Literal }
+func (dp *DefaultParameter) Pos() token.Position  { return dp.Token.Pos }
+func (dp *DefaultParameter) String() string {
+	return dp.Parameter.String() + " = " + dp.Value.String()
+}
+
+// NamedArgument is an argument passed by the name of its parameter, as in
+// `f(y: 2, x: 1)`.
+type NamedArgument struct {
+	Token token.Token
+	Name  *Identifier
+	Value Expression
+}
+
+func (na *NamedArgument) expressionNode()      {}
+func (na *NamedArgument) TokenLiteral() string { return na.Token.Literal }
+func (na *NamedArgument) Pos() token.Position  { return na.Token.Pos }
+func (na *NamedArgument) String() string {
+	return na.Name.String() + ": " + na.Value.String()
+}
+
+// MatchExpression evaluates the Body of the first arm whose pattern matches
+// Subject and whose guard, if any, holds.
+type MatchExpression struct {
+	Token   token.Token
+	Subject Expression
+	Arms    []*MatchArm
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) Pos() token.Position  { return me.Token.Pos }
+func (me *MatchExpression) String() string {
+	arms := []string{}
+
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+
+	return "match (" + me.Subject.String() + ") {" + strings.Join(arms, ", ") + "}"
+}
+
+// MatchArm is `pattern if guard => body`. Patterns are literals,
+// identifiers, which bind the value they match unless they are `_`, array
+// and hash literals of patterns, and enum variants: selectors like
+// `Shape.Empty` and calls like `Shape.Circle(r)` whose arguments are
+// patterns. Guard is nil for arms without one.
+type MatchArm struct {
+	Token   token.Token
+	Pattern Expression
+	Guard   Expression
+	Body    *BlockStatement
+}
+
+func (ma *MatchArm) TokenLiteral() string { return ma.Token.Literal }
+func (ma *MatchArm) Pos() token.Position  { return ma.Token.Pos }
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ma.Pattern.String())
+
+	if ma.Guard != nil {
+		out.WriteString(" if " + ma.Guard.String())
+	}
+
+	out.WriteString(" => " + ma.Body.String())
+
+	return out.String()
+}
+
+// annotate writes a parameter with its annotation, keeping a default value
+// after the type as in `y: int = 10`.
+func annotate(param Expression, typ TypeExpression) string {
+	if dp, ok := param.(*DefaultParameter); ok {
+		return dp.Parameter.String() + ": " + typ.String() + " = " + dp.Value.String()
+	}
+
+	return param.String() + ": " + typ.String()
+}
+
+// TypeExpression is a type annotation. Annotations are optional and only
+// read by the types package; the interpreter and the compiler ignore them.
+type TypeExpression interface {
+	Node
+	typeNode()
+}
+
+// NamedType is a type written as a name, like int or any.
+type NamedType struct {
+	Token token.Token
+	Name  string
+}
+
+func (nt *NamedType) typeNode()            {}
+func (nt *NamedType) TokenLiteral() string { return nt.Token.Literal }
+func (nt *NamedType) Pos() token.Position  { return nt.Token.Pos }
+func (nt *NamedType) String() string       { return nt.Name }
+
+// ArrayType is `[T]`, an array whose elements are all of type Element.
+type ArrayType struct {
+	Token   token.Token
+	Element TypeExpression
+}
+
+func (at *ArrayType) typeNode()            {}
+func (at *ArrayType) TokenLiteral() string { return at.Token.Literal }
+func (at *ArrayType) Pos() token.Position  { return at.Token.Pos }
+func (at *ArrayType) String() string       { return "[" + at.Element.String() + "]" }
+
+// HashType is `{K: V}`.
+type HashType struct {
+	Token token.Token
+	Key   TypeExpression
+	Value TypeExpression
+}
+
+func (ht *HashType) typeNode()            {}
+func (ht *HashType) TokenLiteral() string { return ht.Token.Literal }
+func (ht *HashType) Pos() token.Position  { return ht.Token.Pos }
+func (ht *HashType) String() string {
+	return "{" + ht.Key.String() + ": " + ht.Value.String() + "}"
+}
+
+// FunctionType is `fn(A, B) -> R`. Result is nil when the arrow is left
+// out, which stands for any result.
+type FunctionType struct {
+	Token      token.Token
+	Parameters []TypeExpression
+	Result     TypeExpression
+}
+
+func (ft *FunctionType) typeNode()            {}
+func (ft *FunctionType) TokenLiteral() string { return ft.Token.Literal }
+func (ft *FunctionType) Pos() token.Position  { return ft.Token.Pos }
+func (ft *FunctionType) String() string {
+	params := []string{}
+
+	for _, p := range ft.Parameters {
+		params = append(params, p.String())
+	}
+
+	out := "fn(" + strings.Join(params, ", ") + ")"
+	if ft.Result != nil {
+		out += " -> " + ft.Result.String()
+	}
+
+	return out
+}
+
+// StructStatement declares a struct type, `struct Point { x, y }`. Name is
+// bound to the type like a const declaration.
+type StructStatement struct {
+	Token  token.Token
+	Name   *Identifier
+	Fields []*Identifier
+}
+
+func (ss *StructStatement) statementNode()       {}
+func (ss *StructStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *StructStatement) Pos() token.Position  { return ss.Token.Pos }
+func (ss *StructStatement) String() string {
+	fields := []string{}
+
+	for _, f := range ss.Fields {
+		fields = append(fields, f.String())
+	}
+
+	return "struct " + ss.Name.String() + " { " + strings.Join(fields, ", ") + " }"
+}
+
+// StructLiteral creates a struct of the type Name, `Point{x: 1, y: 2}`.
+// Fields and Values are parallel, in source order; fields left out are null.
+type StructLiteral struct {
+	Token token.Token
+	// Name is an *Identifier or, for a type exported by a module, a
+	// *SelectorExpression like `shapes.Point`.
+	Name   Expression
+	Fields []*Identifier
+	Values []Expression
+}
+
+func (sl *StructLiteral) expressionNode()      {}
+func (sl *StructLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StructLiteral) Pos() token.Position  { return sl.Token.Pos }
+func (sl *StructLiteral) String() string {
+	fields := []string{}
+
+	for i, f := range sl.Fields {
+		fields = append(fields, f.String()+": "+sl.Values[i].String())
+	}
+
+	return sl.Name.String() + "{" + strings.Join(fields, ", ") + "}"
+}
+
+// FieldAssignExpression assigns a field of a struct, `p.x = 3`.
+type FieldAssignExpression struct {
+	Token  token.Token
+	Target *SelectorExpression
+	Value  Expression
+}
+
+func (fa *FieldAssignExpression) expressionNode()      {}
+func (fa *FieldAssignExpression) TokenLiteral() string { return fa.Token.Literal }
+func (fa *FieldAssignExpression) Pos() token.Position  { return fa.Token.Pos }
+func (fa *FieldAssignExpression) String() string {
+	return "(" + fa.Target.String() + " = " + fa.Value.String() + ")"
+}
+
+// ImplStatement defines methods on a struct type,
+// `impl Point { fn norm(self) { ... } }`. The first parameter of a method is
+// the receiver. Each method is named by its FunctionExpression's Name.
+type ImplStatement struct {
+	Token   token.Token
+	Name    *Identifier
+	Methods []*FunctionExpression
+}
+
+func (is *ImplStatement) statementNode()       {}
+func (is *ImplStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImplStatement) Pos() token.Position  { return is.Token.Pos }
+func (is *ImplStatement) String() string {
+	methods := []string{}
+
+	for _, m := range is.Methods {
+		methods = append(methods, "fn "+m.Name+strings.TrimPrefix(m.String(), m.TokenLiteral()))
+	}
+
+	return "impl " + is.Name.String() + " { " + strings.Join(methods, " ") + " }"
+}
+
+// EnumStatement declares an enum, `enum Shape { Circle(r), Rect(w, h), Empty }`.
+// Name is bound to the enum like a const declaration.
+type EnumStatement struct {
+	Token    token.Token
+	Name     *Identifier
+	Variants []*EnumVariant
+}
+
+func (es *EnumStatement) statementNode()       {}
+func (es *EnumStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *EnumStatement) Pos() token.Position  { return es.Token.Pos }
+func (es *EnumStatement) String() string {
+	variants := []string{}
+
+	for _, v := range es.Variants {
+		variants = append(variants, v.String())
+	}
+
+	return "enum " + es.Name.String() + " { " + strings.Join(variants, ", ") + " }"
+}
+
+// EnumVariant is a variant of an enum declaration, `Circle(r)`. Fields is
+// empty for variants without a payload, `Empty`.
+type EnumVariant struct {
+	Token  token.Token
+	Name   *Identifier
+	Fields []*Identifier
+}
+
+func (ev *EnumVariant) TokenLiteral() string { return ev.Token.Literal }
+func (ev *EnumVariant) Pos() token.Position  { return ev.Token.Pos }
+func (ev *EnumVariant) String() string {
+	if len(ev.Fields) == 0 {
+		return ev.Name.String()
+	}
+
+	fields := []string{}
+
+	for _, f := range ev.Fields {
+		fields = append(fields, f.String())
+	}
+
+	return ev.Name.String() + "(" + strings.Join(fields, ", ") + ")"
+}
@@ -0,0 +1,331 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"unicode"
+
+	"github.com/marmotini/ngiri-lang/token"
+)
+
+// nodeTypes maps the type tag used in the JSON encoding to the node struct it
+// stands for. Every node that can appear in a tree has to be listed here.
+var nodeTypes = map[string]reflect.Type{
+	"Program":             reflect.TypeOf(Program{}),
+	"LetStatement":        reflect.TypeOf(LetStatement{}),
+	"ReturnStatement":     reflect.TypeOf(ReturnStatement{}),
+	"ExpressionStatement": reflect.TypeOf(ExpressionStatement{}),
+	"BlockStatement":      reflect.TypeOf(BlockStatement{}),
+	"Identifier":          reflect.TypeOf(Identifier{}),
+	"Boolean":             reflect.TypeOf(Boolean{}),
+	"IntegerLiteral":      reflect.TypeOf(IntegerLiteral{}),
+	"StringLiteral":       reflect.TypeOf(StringLiteral{}),
+	"PrefixExpression":    reflect.TypeOf(PrefixExpression{}),
+	"InfixExpression":     reflect.TypeOf(InfixExpression{}),
+	"AssignExpression":    reflect.TypeOf(AssignExpression{}),
+	"IfExpression":        reflect.TypeOf(IfExpression{}),
+	"FunctionExpression":  reflect.TypeOf(FunctionExpression{}),
+	"MacroLiteral":        reflect.TypeOf(MacroLiteral{}),
+	"CallExpression":      reflect.TypeOf(CallExpression{}),
+	"ListLiteral":         reflect.TypeOf(ListLiteral{}),
+	"IndexExpression":     reflect.TypeOf(IndexExpression{}),
+	"ArrayLiteral":        reflect.TypeOf(ArrayLiteral{}),
+	"ImportStatement":     reflect.TypeOf(ImportStatement{}),
+	"ExportStatement":     reflect.TypeOf(ExportStatement{}),
+	"SelectorExpression":  reflect.TypeOf(SelectorExpression{}),
+	"ThrowStatement":      reflect.TypeOf(ThrowStatement{}),
+	"TryExpression":       reflect.TypeOf(TryExpression{}),
+	"PropagateExpression": reflect.TypeOf(PropagateExpression{}),
+	"HashLiteral":         reflect.TypeOf(HashLiteral{}),
+	"SpreadExpression":    reflect.TypeOf(SpreadExpression{}),
+	"MatchExpression":     reflect.TypeOf(MatchExpression{}),
+	"MatchArm":            reflect.TypeOf(MatchArm{}),
+	"DefaultParameter":    reflect.TypeOf(DefaultParameter{}),
+	"NamedArgument":       reflect.TypeOf(NamedArgument{}),
+	"NamedType":           reflect.TypeOf(NamedType{}),
+	"ArrayType":           reflect.TypeOf(ArrayType{}),
+	"HashType":            reflect.TypeOf(HashType{}),
+	"FunctionType":        reflect.TypeOf(FunctionType{}),
+
+	"StructStatement":       reflect.TypeOf(StructStatement{}),
+	"StructLiteral":         reflect.TypeOf(StructLiteral{}),
+	"FieldAssignExpression": reflect.TypeOf(FieldAssignExpression{}),
+	"ImplStatement":         reflect.TypeOf(ImplStatement{}),
+	"EnumStatement":         reflect.TypeOf(EnumStatement{}),
+	"EnumVariant":           reflect.TypeOf(EnumVariant{}),
+}
+
+var (
+	nodeInterface = reflect.TypeOf((*Node)(nil)).Elem()
+	tokenType     = reflect.TypeOf(token.Token{})
+)
+
+// MarshalJSON encodes a tree as JSON. Every node becomes an object holding
+// its "type" tag, its source position as "pos", the "token" it was parsed
+// from and its fields under their lower camel case Go names:
+//
+//	{"type": "Identifier", "pos": {"line": 1, "column": 5},
+//	 "token": {"type": "IDENT", "literal": "x"}, "value": "x"}
+func MarshalJSON(node Node) ([]byte, error) {
+	return json.Marshal(encodeValue(reflect.ValueOf(&node).Elem()))
+}
+
+// Unmarshal decodes a tree encoded by MarshalJSON.
+func Unmarshal(data []byte) (Node, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	var raw interface{}
+	if err := d.Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	v, err := decodeValue(raw, nodeInterface)
+	if err != nil {
+		return nil, err
+	}
+
+	if v.IsNil() {
+		return nil, nil
+	}
+
+	return v.Interface().(Node), nil
+}
+
+// object is a JSON object that keeps its keys in insertion order
+type object []field
+
+type field struct {
+	key   string
+	value interface{}
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var out bytes.Buffer
+
+	out.WriteString("{")
+	for i, f := range o {
+		if i > 0 {
+			out.WriteString(",")
+		}
+
+		key, _ := json.Marshal(f.key)
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+
+		out.Write(key)
+		out.WriteString(":")
+		out.Write(value)
+	}
+	out.WriteString("}")
+
+	return out.Bytes(), nil
+}
+
+func jsonName(goName string) string {
+	r := []rune(goName)
+	r[0] = unicode.ToLower(r[0])
+
+	return string(r)
+}
+
+func encodeValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+
+		return encodeValue(v.Elem())
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = encodeValue(v.Index(i))
+		}
+
+		return list
+	case reflect.Struct:
+		return encodeStruct(v)
+	default:
+		return v.Interface()
+	}
+}
+
+func encodeStruct(v reflect.Value) object {
+	out := object{}
+
+	if _, ok := nodeTypes[v.Type().Name()]; ok {
+		out = append(out, field{"type", v.Type().Name()})
+
+		if pos := v.Addr().Interface().(Node).Pos(); pos.IsValid() {
+			out = append(out, field{"pos", object{{"line", pos.Line}, {"column", pos.Column}}})
+		}
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if f.Type == tokenType {
+			tok := v.Field(i).Interface().(token.Token)
+			out = append(out, field{"token", object{{"type", tok.Type}, {"literal", tok.Literal}}})
+			continue
+		}
+
+		out = append(out, field{jsonName(f.Name), encodeValue(v.Field(i))})
+	}
+
+	return out
+}
+
+func decodeValue(raw interface{}, t reflect.Type) (reflect.Value, error) {
+	switch t.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if raw == nil {
+			return reflect.Zero(t), nil
+		}
+
+		m, ok := raw.(map[string]interface{})
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected object for %s, got %T", t, raw)
+		}
+
+		structType := t
+		if tag, ok := m["type"].(string); ok || t.Kind() == reflect.Interface {
+			nodeType, ok := nodeTypes[tag]
+			if !ok {
+				return reflect.Value{}, fmt.Errorf("unknown node type %q", tag)
+			}
+
+			structType = reflect.PtrTo(nodeType)
+		}
+
+		if !structType.AssignableTo(t) {
+			return reflect.Value{}, fmt.Errorf("node %s can not be used as %s", structType.Elem().Name(), t)
+		}
+
+		ptr := reflect.New(structType.Elem())
+		if err := decodeStruct(m, ptr.Elem()); err != nil {
+			return reflect.Value{}, err
+		}
+
+		v := reflect.New(t).Elem()
+		v.Set(ptr)
+
+		return v, nil
+	case reflect.Slice:
+		if raw == nil {
+			return reflect.Zero(t), nil
+		}
+
+		list, ok := raw.([]interface{})
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected list for %s, got %T", t, raw)
+		}
+
+		v := reflect.MakeSlice(t, len(list), len(list))
+		for i, elem := range list {
+			e, err := decodeValue(elem, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+
+			v.Index(i).Set(e)
+		}
+
+		return v, nil
+	case reflect.Struct:
+		m, ok := raw.(map[string]interface{})
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected object for %s, got %T", t, raw)
+		}
+
+		v := reflect.New(t).Elem()
+
+		return v, decodeStruct(m, v)
+	case reflect.Int, reflect.Int64:
+		n, ok := raw.(json.Number)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected number for %s, got %T", t, raw)
+		}
+
+		i, err := n.Int64()
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		return reflect.ValueOf(i).Convert(t), nil
+	case reflect.String, reflect.Bool:
+		v := reflect.ValueOf(raw)
+		if !v.IsValid() || v.Kind() != t.Kind() {
+			return reflect.Value{}, fmt.Errorf("expected %s, got %T", t, raw)
+		}
+
+		return v.Convert(t), nil
+	}
+
+	return reflect.Value{}, fmt.Errorf("can not decode %s", t)
+}
+
+func decodeStruct(m map[string]interface{}, v reflect.Value) error {
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if f.Type == tokenType {
+			tok, err := decodeToken(m)
+			if err != nil {
+				return err
+			}
+
+			v.Field(i).Set(reflect.ValueOf(tok))
+			continue
+		}
+
+		fv, err := decodeValue(m[jsonName(f.Name)], f.Type)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %s", v.Type().Name(), f.Name, err)
+		}
+
+		v.Field(i).Set(fv)
+	}
+
+	return nil
+}
+
+func decodeToken(m map[string]interface{}) (token.Token, error) {
+	tok := token.Token{}
+
+	if raw, ok := m["token"].(map[string]interface{}); ok {
+		typ, _ := raw["type"].(string)
+		literal, _ := raw["literal"].(string)
+		tok.Type, tok.Literal = token.TokenType(typ), literal
+	}
+
+	pos, ok := m["pos"].(map[string]interface{})
+	if !ok {
+		return tok, nil
+	}
+
+	line, lineErr := decodeValue(pos["line"], reflect.TypeOf(0))
+	column, columnErr := decodeValue(pos["column"], reflect.TypeOf(0))
+	if lineErr != nil || columnErr != nil {
+		return tok, fmt.Errorf("invalid position %v", pos)
+	}
+
+	tok.Pos = token.Position{Line: int(line.Int()), Column: int(column.Int())}
+
+	return tok, nil
+}
@@ -0,0 +1,392 @@
+package ast
+
+import (
+	"testing"
+
+	"github.com/marmotini/ngiri-lang/token"
+	"github.com/stretchr/testify/assert"
+)
+
+func tok(typ token.TokenType, literal string, line, column int) token.Token {
+	return token.Token{Type: typ, Literal: literal, Pos: token.Position{Line: line, Column: column}}
+}
+
+// let add = fn(a, b) { a + b }; add(1, 2) == 3
+// if (true) {}
+func sampleProgram() *Program {
+	return &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: tok(token.LET, "let", 1, 1),
+				Name:  &Identifier{Token: tok(token.IDENT, "add", 1, 5), Value: "add"},
+				Value: &FunctionExpression{
+					Token: tok(token.FUNCTION, "fn", 1, 11),
+					Name:  "add",
+					Parameters: []Expression{
+						&Identifier{Token: tok(token.IDENT, "a", 1, 14), Value: "a"},
+						&Identifier{Token: tok(token.IDENT, "b", 1, 17), Value: "b"},
+					},
+					Body: &BlockStatement{
+						Token: tok(token.LBRACE, "{", 1, 20),
+						Statements: []Statement{
+							&ExpressionStatement{
+								Token: tok(token.IDENT, "a", 1, 22),
+								Expression: &InfixExpression{
+									Token:    tok(token.PLUS, "+", 1, 24),
+									Left:     &Identifier{Token: tok(token.IDENT, "a", 1, 22), Value: "a"},
+									Operator: "+",
+									Right:    &Identifier{Token: tok(token.IDENT, "b", 1, 26), Value: "b"},
+								},
+							},
+						},
+					},
+				},
+			},
+			&ExpressionStatement{
+				Token: tok(token.IDENT, "add", 1, 31),
+				Expression: &InfixExpression{
+					Token: tok(token.EQ, "==", 1, 41),
+					Left: &CallExpression{
+						Token:    tok(token.LPAREN, "(", 1, 34),
+						Function: &Identifier{Token: tok(token.IDENT, "add", 1, 31), Value: "add"},
+						Arguments: []Expression{
+							&IntegerLiteral{Token: tok(token.INT, "1", 1, 35), Value: 1},
+							&IntegerLiteral{Token: tok(token.INT, "2", 1, 38), Value: 2},
+						},
+					},
+					Operator: "==",
+					Right:    &IntegerLiteral{Token: tok(token.INT, "3", 1, 44), Value: 3},
+				},
+			},
+			&ExpressionStatement{
+				Token: tok(token.IF, "if", 2, 1),
+				Expression: &IfExpression{
+					Token:       tok(token.IF, "if", 2, 1),
+					Condition:   &Boolean{Token: tok(token.TRUE, "true", 2, 5), Value: true},
+					Consequence: &BlockStatement{Token: tok(token.LBRACE, "{", 2, 11), Statements: []Statement{}},
+				},
+			},
+		},
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	node := &PrefixExpression{
+		Token:    tok(token.MINUS, "-", 1, 1),
+		Operator: "-",
+		Right:    &IntegerLiteral{Token: tok(token.INT, "5", 1, 2), Value: 5},
+	}
+
+	expected := `{"type":"PrefixExpression","pos":{"line":1,"column":1},"token":{"type":"-","literal":"-"},"operator":"-",` +
+		`"right":{"type":"IntegerLiteral","pos":{"line":1,"column":2},"token":{"type":"INT","literal":"5"},"value":5}}`
+
+	data, err := MarshalJSON(node)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(data))
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	prog := sampleProgram()
+
+	data, err := MarshalJSON(prog)
+	assert.NoError(t, err)
+
+	decoded, err := Unmarshal(data)
+	assert.NoError(t, err)
+	assert.Equal(t, prog, decoded)
+	assert.Equal(t, prog.String(), decoded.String())
+}
+
+func TestJSONRoundTripMatch(t *testing.T) {
+	// match (x) { [h, ...t] if h => {"k": t}, _ => x[0] }
+	x := &Identifier{Token: tok(token.IDENT, "x", 1, 8), Value: "x"}
+	prog := &Program{Statements: []Statement{&ExpressionStatement{
+		Token: tok(token.MATCH, "match", 1, 1),
+		Expression: &MatchExpression{
+			Token:   tok(token.MATCH, "match", 1, 1),
+			Subject: x,
+			Arms: []*MatchArm{
+				{
+					Token: tok(token.LBRACKET, "[", 1, 13),
+					Pattern: &ListLiteral{Token: tok(token.LBRACKET, "[", 1, 13), Elements: []Expression{
+						&Identifier{Token: tok(token.IDENT, "h", 1, 14), Value: "h"},
+						&SpreadExpression{
+							Token: tok(token.ELLIPSIS, "...", 1, 17),
+							Value: &Identifier{Token: tok(token.IDENT, "t", 1, 20), Value: "t"},
+						},
+					}},
+					Guard: &Identifier{Token: tok(token.IDENT, "h", 1, 26), Value: "h"},
+					Body: &BlockStatement{Token: tok(token.LBRACE, "{", 1, 31), Statements: []Statement{
+						&ExpressionStatement{Token: tok(token.LBRACE, "{", 1, 31), Expression: &HashLiteral{
+							Token:  tok(token.LBRACE, "{", 1, 31),
+							Keys:   []Expression{&StringLiteral{Token: tok(token.STRING, "k", 1, 32), Value: "k"}},
+							Values: []Expression{&Identifier{Token: tok(token.IDENT, "t", 1, 37), Value: "t"}},
+						}},
+					}},
+				},
+				{
+					Token:   tok(token.IDENT, "_", 1, 41),
+					Pattern: &Identifier{Token: tok(token.IDENT, "_", 1, 41), Value: "_"},
+					Body: &BlockStatement{Token: tok(token.IDENT, "x", 1, 46), Statements: []Statement{
+						&ExpressionStatement{Token: tok(token.IDENT, "x", 1, 46), Expression: &IndexExpression{
+							Token: tok(token.LBRACKET, "[", 1, 47),
+							Left:  x,
+							Index: &IntegerLiteral{Token: tok(token.INT, "0", 1, 48), Value: 0},
+						}},
+					}},
+				},
+			},
+		},
+	}}}
+
+	data, err := MarshalJSON(prog)
+	assert.NoError(t, err)
+
+	decoded, err := Unmarshal(data)
+	assert.NoError(t, err)
+	assert.Equal(t, prog, decoded)
+	assert.Equal(t, "match (x) {[h, ...t] if h => {k: t}, _ => (x[0])}", decoded.String())
+}
+
+func TestJSONRoundTripCallArguments(t *testing.T) {
+	// fn(y = 1) { y }(...a, x: 2)
+	y := &Identifier{Token: tok(token.IDENT, "y", 1, 4), Value: "y"}
+	prog := &Program{Statements: []Statement{&ExpressionStatement{
+		Token: tok(token.FUNCTION, "fn", 1, 1),
+		Expression: &CallExpression{
+			Token: tok(token.LPAREN, "(", 1, 17),
+			Function: &FunctionExpression{
+				Token: tok(token.FUNCTION, "fn", 1, 1),
+				Parameters: []Expression{&DefaultParameter{
+					Token:     tok(token.ASSIGN, "=", 1, 6),
+					Parameter: y,
+					Value:     &IntegerLiteral{Token: tok(token.INT, "1", 1, 8), Value: 1},
+				}},
+				Body: &BlockStatement{Token: tok(token.LBRACE, "{", 1, 11), Statements: []Statement{
+					&ExpressionStatement{Token: tok(token.IDENT, "y", 1, 13), Expression: y},
+				}},
+			},
+			Arguments: []Expression{
+				&SpreadExpression{
+					Token: tok(token.ELLIPSIS, "...", 1, 18),
+					Value: &Identifier{Token: tok(token.IDENT, "a", 1, 21), Value: "a"},
+				},
+				&NamedArgument{
+					Token: tok(token.COLON, ":", 1, 25),
+					Name:  &Identifier{Token: tok(token.IDENT, "x", 1, 24), Value: "x"},
+					Value: &IntegerLiteral{Token: tok(token.INT, "2", 1, 27), Value: 2},
+				},
+			},
+		},
+	}}}
+
+	data, err := MarshalJSON(prog)
+	assert.NoError(t, err)
+
+	decoded, err := Unmarshal(data)
+	assert.NoError(t, err)
+	assert.Equal(t, prog, decoded)
+	assert.Equal(t, "fn( y = 1) y(...a, x: 2)", decoded.String())
+}
+
+func TestJSONRoundTripTypes(t *testing.T) {
+	// let f: fn([int]) -> int = fn(a: [int], b) -> {string: int} { a }
+	a := &Identifier{Token: tok(token.IDENT, "a", 1, 31), Value: "a"}
+	intType := func(column int) TypeExpression {
+		return &NamedType{Token: tok(token.IDENT, "int", 1, column), Name: "int"}
+	}
+	prog := &Program{Statements: []Statement{&LetStatement{
+		Token: tok(token.LET, "let", 1, 1),
+		Name:  &Identifier{Token: tok(token.IDENT, "f", 1, 5), Value: "f"},
+		Annotation: &FunctionType{
+			Token:      tok(token.FUNCTION, "fn", 1, 8),
+			Parameters: []TypeExpression{&ArrayType{Token: tok(token.LBRACKET, "[", 1, 11), Element: intType(12)}},
+			Result:     intType(21),
+		},
+		Value: &FunctionExpression{
+			Token:      tok(token.FUNCTION, "fn", 1, 27),
+			Name:       "f",
+			Parameters: []Expression{a, &Identifier{Token: tok(token.IDENT, "b", 1, 41), Value: "b"}},
+			ParameterTypes: []TypeExpression{
+				&ArrayType{Token: tok(token.LBRACKET, "[", 1, 34), Element: intType(35)},
+				nil,
+			},
+			ReturnType: &HashType{
+				Token: tok(token.LBRACE, "{", 1, 47),
+				Key:   &NamedType{Token: tok(token.IDENT, "string", 1, 48), Name: "string"},
+				Value: intType(56),
+			},
+			Body: &BlockStatement{Token: tok(token.LBRACE, "{", 1, 61), Statements: []Statement{
+				&ExpressionStatement{Token: tok(token.IDENT, "a", 1, 63), Expression: a},
+			}},
+		},
+	}}}
+
+	data, err := MarshalJSON(prog)
+	assert.NoError(t, err)
+
+	decoded, err := Unmarshal(data)
+	assert.NoError(t, err)
+	assert.Equal(t, prog, decoded)
+	assert.Equal(t, "let f: fn([int]) -> int = fn( a: [int], b) -> {string: int} a;", decoded.String())
+}
+
+func TestJSONRoundTripStructs(t *testing.T) {
+	// struct P { x }; P{x: 1}.x = 2
+	ident := func(name string, column int) *Identifier {
+		return &Identifier{Token: tok(token.IDENT, name, 1, column), Value: name}
+	}
+	lit := &StructLiteral{
+		Token:  tok(token.LBRACE, "{", 1, 18),
+		Name:   ident("P", 17),
+		Fields: []*Identifier{ident("x", 19)},
+		Values: []Expression{&IntegerLiteral{Token: tok(token.INT, "1", 1, 22), Value: 1}},
+	}
+	prog := &Program{Statements: []Statement{
+		&StructStatement{Token: tok(token.STRUCT, "struct", 1, 1), Name: ident("P", 8), Fields: []*Identifier{ident("x", 12)}},
+		&ExpressionStatement{Token: tok(token.IDENT, "P", 1, 17), Expression: &FieldAssignExpression{
+			Token:  tok(token.ASSIGN, "=", 1, 27),
+			Target: &SelectorExpression{Token: tok(token.DOT, ".", 1, 24), Left: lit, Selector: ident("x", 25)},
+			Value:  &IntegerLiteral{Token: tok(token.INT, "2", 1, 29), Value: 2},
+		}},
+	}}
+
+	data, err := MarshalJSON(prog)
+	assert.NoError(t, err)
+
+	decoded, err := Unmarshal(data)
+	assert.NoError(t, err)
+	assert.Equal(t, prog, decoded)
+	assert.Equal(t, "struct P { x }(P{x: 1}.x = 2)", decoded.String())
+}
+
+func TestJSONRoundTripExportedStruct(t *testing.T) {
+	// export struct P { x }; m.P{x: 1}
+	ident := func(name string, column int) *Identifier {
+		return &Identifier{Token: tok(token.IDENT, name, 1, column), Value: name}
+	}
+	prog := &Program{Statements: []Statement{
+		&ExportStatement{Token: tok(token.EXPORT, "export", 1, 1), Statement: &StructStatement{
+			Token: tok(token.STRUCT, "struct", 1, 8), Name: ident("P", 15), Fields: []*Identifier{ident("x", 19)},
+		}},
+		&ExpressionStatement{Token: tok(token.IDENT, "m", 1, 24), Expression: &StructLiteral{
+			Token:  tok(token.LBRACE, "{", 1, 27),
+			Name:   &SelectorExpression{Token: tok(token.DOT, ".", 1, 25), Left: ident("m", 24), Selector: ident("P", 26)},
+			Fields: []*Identifier{ident("x", 28)},
+			Values: []Expression{&IntegerLiteral{Token: tok(token.INT, "1", 1, 31), Value: 1}},
+		}},
+	}}
+
+	data, err := MarshalJSON(prog)
+	assert.NoError(t, err)
+
+	decoded, err := Unmarshal(data)
+	assert.NoError(t, err)
+	assert.Equal(t, prog, decoded)
+	assert.Equal(t, "export struct P { x }m.P{x: 1}", decoded.String())
+}
+
+func TestJSONRoundTripImpl(t *testing.T) {
+	// impl P { fn f(self) { self } }
+	self := func(column int) *Identifier {
+		return &Identifier{Token: tok(token.IDENT, "self", 1, column), Value: "self"}
+	}
+	prog := &Program{Statements: []Statement{
+		&ImplStatement{
+			Token: tok(token.IMPL, "impl", 1, 1),
+			Name:  &Identifier{Token: tok(token.IDENT, "P", 1, 6), Value: "P"},
+			Methods: []*FunctionExpression{{
+				Token:      tok(token.FUNCTION, "fn", 1, 10),
+				Name:       "f",
+				Parameters: []Expression{self(15)},
+				Body: &BlockStatement{Token: tok(token.LBRACE, "{", 1, 21), Statements: []Statement{
+					&ExpressionStatement{Token: tok(token.IDENT, "self", 1, 23), Expression: self(23)},
+				}},
+			}},
+		},
+	}}
+
+	data, err := MarshalJSON(prog)
+	assert.NoError(t, err)
+
+	decoded, err := Unmarshal(data)
+	assert.NoError(t, err)
+	assert.Equal(t, prog, decoded)
+	assert.Equal(t, "impl P { fn f( self) self }", decoded.String())
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"type":"Nope"}`, `unknown node type "Nope"`},
+		{`{"type":"LetStatement","name":{"type":"IntegerLiteral","value":1}}`, "LetStatement.Name: node IntegerLiteral can not be used as *ast.Identifier"},
+		{`{"type":"Program","statements":[{"type":"Identifier","value":"x"}]}`, "Program.Statements: node Identifier can not be used as ast.Statement"},
+		{`{"type":"IntegerLiteral","value":"1"}`, "IntegerLiteral.Value: expected number for int64, got string"},
+	}
+
+	for _, tt := range tests {
+		_, err := Unmarshal([]byte(tt.input))
+		assert.EqualError(t, err, tt.expected, tt.input)
+	}
+}
+
+func TestSExpr(t *testing.T) {
+	expected := `(Program 1:1
+  (LetStatement 1:1
+    (Identifier 1:5 "add")
+    nil
+    nil
+    (FunctionExpression 1:11 "add"
+      (Identifier 1:14 "a")
+      (Identifier 1:17 "b")
+      nil
+      (BlockStatement 1:20
+        (ExpressionStatement 1:22
+          (InfixExpression 1:24
+            (Identifier 1:22 "a") "+"
+            (Identifier 1:26 "b"))))))
+  (ExpressionStatement 1:31
+    (InfixExpression 1:41
+      (CallExpression 1:34
+        (Identifier 1:31 "add")
+        (IntegerLiteral 1:35 1)
+        (IntegerLiteral 1:38 2)) "=="
+      (IntegerLiteral 1:44 3)))
+  (ExpressionStatement 2:1
+    (IfExpression 2:1
+      (Boolean 2:5 true)
+      (BlockStatement 2:11)
+      nil)))`
+
+	assert.Equal(t, expected, SExpr(sampleProgram()))
+}
+
+func TestJSONRoundTripEnum(t *testing.T) {
+	// enum E { A(x), B }
+	prog := &Program{Statements: []Statement{
+		&EnumStatement{
+			Token: tok(token.ENUM, "enum", 1, 1),
+			Name:  &Identifier{Token: tok(token.IDENT, "E", 1, 6), Value: "E"},
+			Variants: []*EnumVariant{
+				{
+					Token:  tok(token.IDENT, "A", 1, 10),
+					Name:   &Identifier{Token: tok(token.IDENT, "A", 1, 10), Value: "A"},
+					Fields: []*Identifier{{Token: tok(token.IDENT, "x", 1, 12), Value: "x"}},
+				},
+				{
+					Token: tok(token.IDENT, "B", 1, 16),
+					Name:  &Identifier{Token: tok(token.IDENT, "B", 1, 16), Value: "B"},
+				},
+			},
+		},
+	}}
+
+	data, err := MarshalJSON(prog)
+	assert.NoError(t, err)
+
+	decoded, err := Unmarshal(data)
+	assert.NoError(t, err)
+	assert.Equal(t, prog, decoded)
+}
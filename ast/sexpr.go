@@ -0,0 +1,75 @@
+package ast
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// SExpr renders a tree as an indented S-expression, one node per line,
+// with the source position after the node type:
+//
+//	(LetStatement 1:1
+//	  (Identifier 1:5 "x")
+//	  (IntegerLiteral 1:9 5))
+func SExpr(node Node) string {
+	var out bytes.Buffer
+	writeSExpr(&out, reflect.ValueOf(&node).Elem(), 0)
+
+	return out.String()
+}
+
+func writeSExpr(out *bytes.Buffer, v reflect.Value, depth int) {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			out.WriteString("nil")
+			return
+		}
+
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+	case reflect.String:
+		fmt.Fprintf(out, "%q", v.String())
+		return
+	default:
+		fmt.Fprintf(out, "%v", v.Interface())
+		return
+	}
+
+	out.WriteString("(" + v.Type().Name())
+
+	if _, ok := nodeTypes[v.Type().Name()]; ok {
+		if pos := v.Addr().Interface().(Node).Pos(); pos.IsValid() {
+			out.WriteString(" " + pos.String())
+		}
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.PkgPath != "" || f.Type == tokenType {
+			continue
+		}
+
+		child := v.Field(i)
+		switch child.Kind() {
+		case reflect.Slice:
+			// list elements are written as consecutive children
+			for j := 0; j < child.Len(); j++ {
+				out.WriteString("\n" + strings.Repeat("  ", depth+1))
+				writeSExpr(out, child.Index(j), depth+1)
+			}
+		case reflect.Interface, reflect.Ptr, reflect.Struct:
+			out.WriteString("\n" + strings.Repeat("  ", depth+1))
+			writeSExpr(out, child, depth+1)
+		default:
+			out.WriteString(" ")
+			writeSExpr(out, child, depth+1)
+		}
+	}
+
+	out.WriteString(")")
+}
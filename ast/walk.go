@@ -0,0 +1,464 @@
+package ast
+
+import "fmt"
+
+// A Visitor's Visit method is invoked for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children
+// of node with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order. Nil children, such as a missing
+// else branch, are skipped.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		walkStatements(v, n.Statements)
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+	case *LetStatement:
+		if n.Pattern != nil {
+			Walk(v, n.Pattern)
+		} else {
+			Walk(v, n.Name)
+		}
+		walkType(v, n.Annotation)
+		walkExpression(v, n.Value)
+	case *ReturnStatement:
+		walkExpression(v, n.ReturnValue)
+	case *ExpressionStatement:
+		walkExpression(v, n.Expression)
+	case *PrefixExpression:
+		walkExpression(v, n.Right)
+	case *InfixExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Right)
+	case *AssignExpression:
+		Walk(v, n.Name)
+		walkExpression(v, n.Value)
+	case *IfExpression:
+		walkExpression(v, n.Condition)
+		Walk(v, n.Consequence)
+		if n.Alternative != nil {
+			Walk(v, n.Alternative)
+		}
+	case *FunctionExpression:
+		walkExpressions(v, n.Parameters)
+		walkTypes(v, n.ParameterTypes)
+		walkType(v, n.ReturnType)
+		Walk(v, n.Body)
+	case *MacroLiteral:
+		for _, p := range n.Parameters {
+			Walk(v, p)
+		}
+		Walk(v, n.Body)
+	case *CallExpression:
+		walkExpression(v, n.Function)
+		walkExpressions(v, n.Arguments)
+	case *ListLiteral:
+		walkExpressions(v, n.Elements)
+	case *ArrayLiteral:
+		walkExpressions(v, n.Elements)
+	case *IndexExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Index)
+	case *ImportStatement:
+		for _, name := range n.Names {
+			Walk(v, name)
+		}
+		Walk(v, n.Path)
+	case *ExportStatement:
+		Walk(v, n.Statement)
+	case *SelectorExpression:
+		walkExpression(v, n.Left)
+		Walk(v, n.Selector)
+	case *ThrowStatement:
+		walkExpression(v, n.Value)
+	case *PropagateExpression:
+		walkExpression(v, n.Left)
+	case *HashLiteral:
+		for i, key := range n.Keys {
+			walkExpression(v, key)
+			walkExpression(v, n.Values[i])
+		}
+	case *SpreadExpression:
+		walkExpression(v, n.Value)
+	case *DefaultParameter:
+		walkExpression(v, n.Parameter)
+		walkExpression(v, n.Value)
+	case *NamedArgument:
+		Walk(v, n.Name)
+		walkExpression(v, n.Value)
+	case *MatchExpression:
+		walkExpression(v, n.Subject)
+		for _, arm := range n.Arms {
+			Walk(v, arm)
+		}
+	case *MatchArm:
+		walkExpression(v, n.Pattern)
+		walkExpression(v, n.Guard)
+		Walk(v, n.Body)
+	case *TryExpression:
+		Walk(v, n.Block)
+		if n.Catch != nil {
+			Walk(v, n.Param)
+			Walk(v, n.Catch)
+		}
+		if n.Finally != nil {
+			Walk(v, n.Finally)
+		}
+	case *StructStatement:
+		Walk(v, n.Name)
+		for _, f := range n.Fields {
+			Walk(v, f)
+		}
+	case *StructLiteral:
+		walkExpression(v, n.Name)
+		for i, f := range n.Fields {
+			Walk(v, f)
+			walkExpression(v, n.Values[i])
+		}
+	case *FieldAssignExpression:
+		Walk(v, n.Target)
+		walkExpression(v, n.Value)
+	case *ImplStatement:
+		Walk(v, n.Name)
+		for _, m := range n.Methods {
+			Walk(v, m)
+		}
+	case *EnumStatement:
+		Walk(v, n.Name)
+		for _, variant := range n.Variants {
+			Walk(v, variant)
+		}
+	case *EnumVariant:
+		Walk(v, n.Name)
+		for _, f := range n.Fields {
+			Walk(v, f)
+		}
+	case *ArrayType:
+		Walk(v, n.Element)
+	case *HashType:
+		Walk(v, n.Key)
+		Walk(v, n.Value)
+	case *FunctionType:
+		walkTypes(v, n.Parameters)
+		walkType(v, n.Result)
+	case *Identifier, *IntegerLiteral, *StringLiteral, *Boolean, *NamedType:
+		// leaves
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+func walkStatements(v Visitor, list []Statement) {
+	for _, s := range list {
+		if s != nil {
+			Walk(v, s)
+		}
+	}
+}
+
+func walkExpression(v Visitor, exp Expression) {
+	if exp != nil {
+		Walk(v, exp)
+	}
+}
+
+func walkExpressions(v Visitor, list []Expression) {
+	for _, e := range list {
+		walkExpression(v, e)
+	}
+}
+
+func walkType(v Visitor, typ TypeExpression) {
+	if typ != nil {
+		Walk(v, typ)
+	}
+}
+
+func walkTypes(v Visitor, list []TypeExpression) {
+	for _, t := range list {
+		walkType(v, t)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order: It starts by calling
+// f(node); node must not be nil. If f returns true, Inspect invokes f
+// recursively for each of the non-nil children of node, followed by a
+// call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// RewriteFunc returns the node that should take the place of node. Returning
+// node unchanged keeps it.
+type RewriteFunc func(node Node) Node
+
+// Rewrite traverses an AST in depth-first order, children before their
+// parent, replacing every node with the result of f. The returned node is the
+// replacement for the root. A replacement must fit the slot it is put in, e.g.
+// a statement list only accepts statements; Rewrite panics otherwise.
+func Rewrite(node Node, f RewriteFunc) Node {
+	switch n := node.(type) {
+	case *Program:
+		n.Statements = rewriteStatements(n.Statements, f)
+	case *BlockStatement:
+		n.Statements = rewriteStatements(n.Statements, f)
+	case *LetStatement:
+		if n.Pattern != nil {
+			n.Pattern = rewriteExpression(n.Pattern, f)
+		} else {
+			n.Name = rewriteIdentifier(n.Name, f)
+		}
+		n.Annotation = rewriteType(n.Annotation, f)
+		n.Value = rewriteExpression(n.Value, f)
+	case *ReturnStatement:
+		n.ReturnValue = rewriteExpression(n.ReturnValue, f)
+	case *ExpressionStatement:
+		n.Expression = rewriteExpression(n.Expression, f)
+	case *PrefixExpression:
+		n.Right = rewriteExpression(n.Right, f)
+	case *InfixExpression:
+		n.Left = rewriteExpression(n.Left, f)
+		n.Right = rewriteExpression(n.Right, f)
+	case *AssignExpression:
+		n.Name = rewriteIdentifier(n.Name, f)
+		n.Value = rewriteExpression(n.Value, f)
+	case *IfExpression:
+		n.Condition = rewriteExpression(n.Condition, f)
+		n.Consequence = rewriteBlock(n.Consequence, f)
+		if n.Alternative != nil {
+			n.Alternative = rewriteBlock(n.Alternative, f)
+		}
+	case *FunctionExpression:
+		n.Parameters = rewriteExpressions(n.Parameters, f)
+		n.ParameterTypes = rewriteTypes(n.ParameterTypes, f)
+		n.ReturnType = rewriteType(n.ReturnType, f)
+		n.Body = rewriteBlock(n.Body, f)
+	case *MacroLiteral:
+		for i, p := range n.Parameters {
+			n.Parameters[i] = rewriteIdentifier(p, f)
+		}
+		n.Body = rewriteBlock(n.Body, f)
+	case *CallExpression:
+		n.Function = rewriteExpression(n.Function, f)
+		n.Arguments = rewriteExpressions(n.Arguments, f)
+	case *ListLiteral:
+		n.Elements = rewriteExpressions(n.Elements, f)
+	case *ArrayLiteral:
+		n.Elements = rewriteExpressions(n.Elements, f)
+	case *IndexExpression:
+		n.Left = rewriteExpression(n.Left, f)
+		n.Index = rewriteExpression(n.Index, f)
+	case *ImportStatement:
+		for i, name := range n.Names {
+			n.Names[i] = rewriteIdentifier(name, f)
+		}
+		n.Path = rewriteStringLiteral(n.Path, f)
+	case *ExportStatement:
+		n.Statement = rewriteStatement(n.Statement, f)
+	case *SelectorExpression:
+		n.Left = rewriteExpression(n.Left, f)
+		n.Selector = rewriteIdentifier(n.Selector, f)
+	case *ThrowStatement:
+		n.Value = rewriteExpression(n.Value, f)
+	case *PropagateExpression:
+		n.Left = rewriteExpression(n.Left, f)
+	case *HashLiteral:
+		n.Keys = rewriteExpressions(n.Keys, f)
+		n.Values = rewriteExpressions(n.Values, f)
+	case *SpreadExpression:
+		n.Value = rewriteExpression(n.Value, f)
+	case *DefaultParameter:
+		n.Parameter = rewriteExpression(n.Parameter, f)
+		n.Value = rewriteExpression(n.Value, f)
+	case *NamedArgument:
+		n.Name = rewriteIdentifier(n.Name, f)
+		n.Value = rewriteExpression(n.Value, f)
+	case *MatchExpression:
+		n.Subject = rewriteExpression(n.Subject, f)
+		for i, arm := range n.Arms {
+			replaced, ok := Rewrite(arm, f).(*MatchArm)
+			if !ok {
+				panic("ast.Rewrite: replacement for an *ast.MatchArm is not a match arm")
+			}
+			n.Arms[i] = replaced
+		}
+	case *MatchArm:
+		n.Pattern = rewriteExpression(n.Pattern, f)
+		n.Guard = rewriteExpression(n.Guard, f)
+		n.Body = rewriteBlock(n.Body, f)
+	case *TryExpression:
+		n.Block = rewriteBlock(n.Block, f)
+		if n.Catch != nil {
+			n.Param = rewriteIdentifier(n.Param, f)
+			n.Catch = rewriteBlock(n.Catch, f)
+		}
+		if n.Finally != nil {
+			n.Finally = rewriteBlock(n.Finally, f)
+		}
+	case *StructStatement:
+		n.Name = rewriteIdentifier(n.Name, f)
+		for i, field := range n.Fields {
+			n.Fields[i] = rewriteIdentifier(field, f)
+		}
+	case *StructLiteral:
+		n.Name = rewriteExpression(n.Name, f)
+		for i, field := range n.Fields {
+			n.Fields[i] = rewriteIdentifier(field, f)
+		}
+		n.Values = rewriteExpressions(n.Values, f)
+	case *FieldAssignExpression:
+		target, ok := Rewrite(n.Target, f).(*SelectorExpression)
+		if !ok {
+			panic("ast.Rewrite: replacement for an assigned *ast.SelectorExpression is not a selector")
+		}
+		n.Target = target
+		n.Value = rewriteExpression(n.Value, f)
+	case *ImplStatement:
+		n.Name = rewriteIdentifier(n.Name, f)
+		for i, m := range n.Methods {
+			method, ok := Rewrite(m, f).(*FunctionExpression)
+			if !ok {
+				panic("ast.Rewrite: replacement for a method is not a function")
+			}
+			n.Methods[i] = method
+		}
+	case *EnumStatement:
+		n.Name = rewriteIdentifier(n.Name, f)
+		for i, variant := range n.Variants {
+			replaced, ok := Rewrite(variant, f).(*EnumVariant)
+			if !ok {
+				panic("ast.Rewrite: replacement for an *ast.EnumVariant is not an enum variant")
+			}
+			n.Variants[i] = replaced
+		}
+	case *EnumVariant:
+		n.Name = rewriteIdentifier(n.Name, f)
+		for i, field := range n.Fields {
+			n.Fields[i] = rewriteIdentifier(field, f)
+		}
+	case *ArrayType:
+		n.Element = rewriteType(n.Element, f)
+	case *HashType:
+		n.Key = rewriteType(n.Key, f)
+		n.Value = rewriteType(n.Value, f)
+	case *FunctionType:
+		n.Parameters = rewriteTypes(n.Parameters, f)
+		n.Result = rewriteType(n.Result, f)
+	case *Identifier, *IntegerLiteral, *StringLiteral, *Boolean, *NamedType:
+		// leaves
+	default:
+		panic(fmt.Sprintf("ast.Rewrite: unexpected node type %T", n))
+	}
+
+	return f(node)
+}
+
+func rewriteStatement(stmt Statement, f RewriteFunc) Statement {
+	if stmt == nil {
+		return nil
+	}
+
+	replaced, ok := Rewrite(stmt, f).(Statement)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: replacement for %T is not a statement", stmt))
+	}
+
+	return replaced
+}
+
+func rewriteStatements(list []Statement, f RewriteFunc) []Statement {
+	for i, s := range list {
+		list[i] = rewriteStatement(s, f)
+	}
+
+	return list
+}
+
+func rewriteExpression(exp Expression, f RewriteFunc) Expression {
+	if exp == nil {
+		return nil
+	}
+
+	replaced, ok := Rewrite(exp, f).(Expression)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: replacement for %T is not an expression", exp))
+	}
+
+	return replaced
+}
+
+func rewriteExpressions(list []Expression, f RewriteFunc) []Expression {
+	for i, e := range list {
+		list[i] = rewriteExpression(e, f)
+	}
+
+	return list
+}
+
+func rewriteType(typ TypeExpression, f RewriteFunc) TypeExpression {
+	if typ == nil {
+		return nil
+	}
+
+	replaced, ok := Rewrite(typ, f).(TypeExpression)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: replacement for %T is not a type", typ))
+	}
+
+	return replaced
+}
+
+func rewriteTypes(list []TypeExpression, f RewriteFunc) []TypeExpression {
+	for i, t := range list {
+		list[i] = rewriteType(t, f)
+	}
+
+	return list
+}
+
+func rewriteBlock(block *BlockStatement, f RewriteFunc) *BlockStatement {
+	replaced, ok := Rewrite(block, f).(*BlockStatement)
+	if !ok {
+		panic("ast.Rewrite: replacement for *ast.BlockStatement is not a block")
+	}
+
+	return replaced
+}
+
+func rewriteIdentifier(ident *Identifier, f RewriteFunc) *Identifier {
+	replaced, ok := Rewrite(ident, f).(*Identifier)
+	if !ok {
+		panic("ast.Rewrite: replacement for *ast.Identifier is not an identifier")
+	}
+
+	return replaced
+}
+
+func rewriteStringLiteral(str *StringLiteral, f RewriteFunc) *StringLiteral {
+	replaced, ok := Rewrite(str, f).(*StringLiteral)
+	if !ok {
+		panic("ast.Rewrite: replacement for *ast.StringLiteral is not a string literal")
+	}
+
+	return replaced
+}
@@ -0,0 +1,173 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func one() Expression { return &IntegerLiteral{Value: 1} }
+func two() Expression { return &IntegerLiteral{Value: 2} }
+
+func TestInspect(t *testing.T) {
+	prog := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Name: &Identifier{Value: "a"},
+				Value: &IfExpression{
+					Condition:   &Boolean{Value: true},
+					Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+				},
+			},
+			&ExpressionStatement{
+				Expression: &IndexExpression{
+					Left:  &ListLiteral{Elements: []Expression{one(), &ArrayLiteral{Elements: []Expression{two()}}}},
+					Index: &CallExpression{Function: &Identifier{Value: "f"}},
+				},
+			},
+		},
+	}
+
+	expected := []string{
+		"*ast.Program",
+		"*ast.LetStatement", "*ast.Identifier",
+		"*ast.IfExpression", "*ast.Boolean", "*ast.BlockStatement", "*ast.ExpressionStatement", "*ast.IntegerLiteral",
+		"*ast.ExpressionStatement", "*ast.IndexExpression",
+		"*ast.ListLiteral", "*ast.IntegerLiteral", "*ast.ArrayLiteral", "*ast.IntegerLiteral",
+		"*ast.CallExpression", "*ast.Identifier",
+	}
+
+	visited := []string{}
+	Inspect(prog, func(node Node) bool {
+		if node != nil {
+			visited = append(visited, reflect.TypeOf(node).String())
+		}
+		return true
+	})
+
+	assert.Equal(t, expected, visited)
+}
+
+func TestInspectSkipsChildren(t *testing.T) {
+	prog := &Program{
+		Statements: []Statement{
+			&ExpressionStatement{Expression: &FunctionExpression{
+				Parameters: []Expression{&Identifier{Value: "x"}},
+				Body:       &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			}},
+			&ExpressionStatement{Expression: two()},
+		},
+	}
+
+	integers := 0
+	Inspect(prog, func(node Node) bool {
+		if _, ok := node.(*IntegerLiteral); ok {
+			integers++
+		}
+		_, isFn := node.(*FunctionExpression)
+		return !isFn
+	})
+
+	assert.Equal(t, 1, integers)
+}
+
+func TestRewrite(t *testing.T) {
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok || integer.Value != 1 {
+			return node
+		}
+
+		integer.Value = 2
+		return integer
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{one(), two()},
+		{
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+		},
+		{&InfixExpression{Left: one(), Operator: "+", Right: two()}, &InfixExpression{Left: two(), Operator: "+", Right: two()}},
+		{&PrefixExpression{Operator: "-", Right: one()}, &PrefixExpression{Operator: "-", Right: two()}},
+		{&IndexExpression{Left: one(), Index: one()}, &IndexExpression{Left: two(), Index: two()}},
+		{
+			&IfExpression{
+				Condition:   one(),
+				Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+				Alternative: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			},
+			&IfExpression{
+				Condition:   two(),
+				Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+				Alternative: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+			},
+		},
+		{&ReturnStatement{ReturnValue: one()}, &ReturnStatement{ReturnValue: two()}},
+		{&LetStatement{Name: &Identifier{Value: "a"}, Value: one()}, &LetStatement{Name: &Identifier{Value: "a"}, Value: two()}},
+		{
+			&FunctionExpression{Parameters: []Expression{}, Body: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}}},
+			&FunctionExpression{Parameters: []Expression{}, Body: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}}},
+		},
+		{&CallExpression{Function: one(), Arguments: []Expression{one()}}, &CallExpression{Function: two(), Arguments: []Expression{two()}}},
+		{&ListLiteral{Elements: []Expression{one(), one()}}, &ListLiteral{Elements: []Expression{two(), two()}}},
+		{&ArrayLiteral{Elements: []Expression{one()}}, &ArrayLiteral{Elements: []Expression{two()}}},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, Rewrite(tt.input, turnOneIntoTwo))
+	}
+}
+
+func TestRewriteReplacesNodes(t *testing.T) {
+	prog := &Program{Statements: []Statement{
+		&ExpressionStatement{Expression: &InfixExpression{Left: one(), Operator: "+", Right: two()}},
+	}}
+
+	folded := Rewrite(prog, func(node Node) Node {
+		infix, ok := node.(*InfixExpression)
+		if !ok {
+			return node
+		}
+
+		l := infix.Left.(*IntegerLiteral).Value
+		r := infix.Right.(*IntegerLiteral).Value
+		return &IntegerLiteral{Value: l + r}
+	})
+
+	expected := &Program{Statements: []Statement{&ExpressionStatement{Expression: &IntegerLiteral{Value: 3}}}}
+	assert.Equal(t, expected, folded)
+
+	assert.Panics(t, func() {
+		Rewrite(&ExpressionStatement{Expression: one()}, func(node Node) Node {
+			if _, ok := node.(*IntegerLiteral); ok {
+				return &BlockStatement{}
+			}
+			return node
+		})
+	})
+}
+
+func TestClone(t *testing.T) {
+	original := &LetStatement{
+		Name:  &Identifier{Value: "a"},
+		Value: &CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{one()}},
+	}
+
+	clone := Clone(original).(*LetStatement)
+	assert.Equal(t, original, clone)
+
+	Rewrite(clone, func(node Node) Node {
+		if _, ok := node.(*IntegerLiteral); ok {
+			return two()
+		}
+		return node
+	})
+
+	assert.Equal(t, one(), original.Value.(*CallExpression).Arguments[0])
+	assert.Equal(t, two(), clone.Value.(*CallExpression).Arguments[0])
+}
@@ -0,0 +1,304 @@
+// Package builtin holds the functions every ngiri program can call without
+// defining them. Each builtin belongs to a capability; a Policy decides which
+// capabilities a program is linked against, so an embedder can run untrusted
+// scripts that can not print, touch files or read the environment.
+package builtin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/marmotini/ngiri-lang/object"
+)
+
+type Capability string
+
+const (
+	// Core builtins have no side effects and are always linked.
+	Core   Capability = "core"
+	IO     Capability = "io"
+	FS     Capability = "fs"
+	OS     Capability = "os"
+	Time   Capability = "time"
+	Random Capability = "random"
+)
+
+// Capabilities lists every capability that a policy can allow.
+var Capabilities = []Capability{IO, FS, OS, Time, Random}
+
+type Builtin struct {
+	Name       string
+	Capability Capability
+	// Object is an *object.BuiltIn for builtin functions and the value
+	// itself for builtin values like none.
+	Object object.Object
+}
+
+// Builtins is indexed by the operand of code.OpGetBuiltin, so new builtins
+// are only ever appended. Builtin functions return nil for null.
+var Builtins = []*Builtin{
+	{"len", Core, &object.BuiltIn{FN: length}},
+	{"puts", IO, &object.BuiltIn{FN: puts}},
+	{"read_file", FS, &object.BuiltIn{FN: readFile}},
+	{"write_file", FS, &object.BuiltIn{FN: writeFile}},
+	{"getenv", OS, &object.BuiltIn{FN: getenv}},
+	{"now", Time, &object.BuiltIn{FN: now}},
+	{"sleep", Time, &object.BuiltIn{FN: sleep}},
+	{"random", Random, &object.BuiltIn{FN: random}},
+	{"error", Core, &object.BuiltIn{FN: newErrorValue}},
+	{"ok", Core, &object.BuiltIn{FN: okResult}},
+	{"err", Core, &object.BuiltIn{FN: errResult}},
+	{"some", Core, &object.BuiltIn{FN: someOption}},
+	{"none", Core, object.None},
+	{"unwrap", Core, &object.BuiltIn{FN: unwrap}},
+	{"unwrap_or", Core, &object.BuiltIn{FN: unwrapOr}},
+	{"is_ok", Core, &object.BuiltIn{FN: isOk}},
+	{"tag_of", Core, &object.BuiltIn{FN: tagOf}},
+}
+
+// Lookup returns the index of the builtin name in Builtins.
+func Lookup(name string) (int, *Builtin, bool) {
+	for i, b := range Builtins {
+		if b.Name == name {
+			return i, b, true
+		}
+	}
+
+	return -1, nil, false
+}
+
+// Policy is the set of capabilities a program may use.
+type Policy struct {
+	allowed map[Capability]bool
+}
+
+// NewPolicy allows caps on top of Core.
+func NewPolicy(caps ...Capability) *Policy {
+	p := &Policy{allowed: map[Capability]bool{Core: true}}
+	for _, c := range caps {
+		p.allowed[c] = true
+	}
+
+	return p
+}
+
+// AllowAll is the policy of the command line tools.
+func AllowAll() *Policy {
+	return NewPolicy(Capabilities...)
+}
+
+// ParseCapability returns the capability called name.
+func ParseCapability(name string) (Capability, error) {
+	for _, c := range Capabilities {
+		if string(c) == name {
+			return c, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown capability %q", name)
+}
+
+func (p *Policy) Allows(c Capability) bool {
+	return p.allowed[c]
+}
+
+// Allowed returns the builtins linked under p, by name.
+func (p *Policy) Allowed() map[string]*Builtin {
+	allowed := make(map[string]*Builtin)
+	for _, b := range Builtins {
+		if p.Allows(b.Capability) {
+			allowed[b.Name] = b
+		}
+	}
+
+	return allowed
+}
+
+// DisabledError is reported for uses of builtins whose capability the policy
+// does not allow.
+func DisabledError(b *Builtin) error {
+	return fmt.Errorf("%s needs the %s capability, which is not allowed", b.Name, b.Capability)
+}
+
+// newError fails the builtin call. Builtins that only want to hand an error
+// value to the script, like error, leave Thrown unset.
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...), Kind: object.RuntimeError, Thrown: true}
+}
+
+func arity(args []object.Object, want int) *object.Error {
+	if len(args) != want {
+		return newError("wrong number of arguments. got=%d, want=%d", len(args), want)
+	}
+
+	return nil
+}
+
+func length(args ...object.Object) object.Object {
+	if err := arity(args, 1); err != nil {
+		return err
+	}
+
+	switch arg := args[0].(type) {
+	case *object.String:
+		return &object.Integer{Value: int64(len(arg.Value))}
+	case *object.Array:
+		return &object.Integer{Value: int64(len(arg.Elements))}
+	case *object.Hash:
+		return &object.Integer{Value: int64(len(arg.Pairs))}
+	default:
+		return newError("argument to `len` not supported, got %s", args[0].Type())
+	}
+}
+
+func puts(args ...object.Object) object.Object {
+	for _, arg := range args {
+		fmt.Println(arg.Inspect())
+	}
+
+	return nil
+}
+
+// newErrorValue is error(message) or error(kind, message).
+func newErrorValue(args ...object.Object) object.Object {
+	if len(args) == 1 {
+		msg, err := stringArg("error", args, 0)
+		if err != nil {
+			return err
+		}
+
+		return &object.Error{Message: msg, Kind: object.ThrownError}
+	}
+
+	if err := arity(args, 2); err != nil {
+		return err
+	}
+
+	kind, err := stringArg("error", args, 0)
+	if err != nil {
+		return err
+	}
+
+	msg, err := stringArg("error", args, 1)
+	if err != nil {
+		return err
+	}
+
+	return &object.Error{Message: msg, Kind: kind}
+}
+
+func stringArg(name string, args []object.Object, i int) (string, *object.Error) {
+	s, ok := args[i].(*object.String)
+	if !ok {
+		return "", newError("argument %d to `%s` must be STRING, got %s", i+1, name, args[i].Type())
+	}
+
+	return s.Value, nil
+}
+
+func integerArg(name string, args []object.Object, i int) (int64, *object.Error) {
+	n, ok := args[i].(*object.Integer)
+	if !ok {
+		return 0, newError("argument %d to `%s` must be INTEGER, got %s", i+1, name, args[i].Type())
+	}
+
+	return n.Value, nil
+}
+
+func readFile(args ...object.Object) object.Object {
+	if err := arity(args, 1); err != nil {
+		return err
+	}
+
+	path, err := stringArg("read_file", args, 0)
+	if err != nil {
+		return err
+	}
+
+	b, ioErr := ioutil.ReadFile(path)
+	if ioErr != nil {
+		return newError("%s", ioErr)
+	}
+
+	return &object.String{Value: string(b)}
+}
+
+func writeFile(args ...object.Object) object.Object {
+	if err := arity(args, 2); err != nil {
+		return err
+	}
+
+	path, err := stringArg("write_file", args, 0)
+	if err != nil {
+		return err
+	}
+
+	content, err := stringArg("write_file", args, 1)
+	if err != nil {
+		return err
+	}
+
+	if ioErr := ioutil.WriteFile(path, []byte(content), 0644); ioErr != nil {
+		return newError("%s", ioErr)
+	}
+
+	return nil
+}
+
+func getenv(args ...object.Object) object.Object {
+	if err := arity(args, 1); err != nil {
+		return err
+	}
+
+	name, err := stringArg("getenv", args, 0)
+	if err != nil {
+		return err
+	}
+
+	return &object.String{Value: os.Getenv(name)}
+}
+
+// now returns the milliseconds since the Unix epoch.
+func now(args ...object.Object) object.Object {
+	if err := arity(args, 0); err != nil {
+		return err
+	}
+
+	return &object.Integer{Value: time.Now().UnixNano() / int64(time.Millisecond)}
+}
+
+func sleep(args ...object.Object) object.Object {
+	if err := arity(args, 1); err != nil {
+		return err
+	}
+
+	ms, err := integerArg("sleep", args, 0)
+	if err != nil {
+		return err
+	}
+
+	time.Sleep(time.Duration(ms) * time.Millisecond)
+
+	return nil
+}
+
+// random returns a number in [0, n).
+func random(args ...object.Object) object.Object {
+	if err := arity(args, 1); err != nil {
+		return err
+	}
+
+	n, err := integerArg("random", args, 0)
+	if err != nil {
+		return err
+	}
+
+	if n <= 0 {
+		return newError("argument to `random` must be positive, got %d", n)
+	}
+
+	return &object.Integer{Value: rand.Int63n(n)}
+}
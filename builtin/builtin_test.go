@@ -0,0 +1,148 @@
+package builtin
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/marmotini/ngiri-lang/object"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy(t *testing.T) {
+	p := NewPolicy(Time)
+
+	assert.True(t, p.Allows(Core))
+	assert.True(t, p.Allows(Time))
+	assert.False(t, p.Allows(IO))
+
+	names := []string{}
+	for name := range p.Allowed() {
+		names = append(names, name)
+	}
+	assert.ElementsMatch(t, []string{"len", "now", "sleep", "error", "ok", "err", "some", "none", "unwrap", "unwrap_or", "is_ok", "tag_of"}, names)
+
+	assert.Len(t, AllowAll().Allowed(), len(Builtins))
+
+	c, err := ParseCapability("fs")
+	assert.NoError(t, err)
+	assert.Equal(t, FS, c)
+
+	_, err = ParseCapability("net")
+	assert.EqualError(t, err, `unknown capability "net"`)
+
+	_, b, _ := Lookup("puts")
+	assert.EqualError(t, DisabledError(b), "puts needs the io capability, which is not allowed")
+}
+
+func call(name string, args ...object.Object) object.Object {
+	_, b, _ := Lookup(name)
+	return b.Object.(*object.BuiltIn).FN(args...)
+}
+
+func TestBuiltins(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ngiri-builtin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := &object.String{Value: filepath.Join(dir, "out.txt")}
+
+	assert.Nil(t, call("write_file", file, &object.String{Value: "data"}))
+	assert.Equal(t, &object.String{Value: "data"}, call("read_file", file))
+	assert.Equal(t, &object.Integer{Value: 2}, call("len", &object.Array{Elements: []object.Object{file, file}}))
+
+	n := call("random", &object.Integer{Value: 3}).(*object.Integer)
+	assert.True(t, n.Value >= 0 && n.Value < 3)
+
+	assert.Equal(t, &object.Error{Message: "boom", Kind: "Error"}, call("error", &object.String{Value: "boom"}))
+	assert.Equal(t, &object.Error{Message: "boom", Kind: "IOError"}, call("error", &object.String{Value: "IOError"}, &object.String{Value: "boom"}))
+
+	assert.Equal(t, newError("argument to `random` must be positive, got 0"), call("random", &object.Integer{Value: 0}))
+	assert.Equal(t, newError("argument 1 to `read_file` must be STRING, got INTEGER"), call("read_file", &object.Integer{Value: 0}))
+	assert.Equal(t, newError("wrong number of arguments. got=1, want=0"), call("now", file))
+	assert.Equal(t, newError("wrong number of arguments. got=3, want=2"), call("error", file, file, file))
+}
+
+func callMethod(recv object.Object, name string, args ...object.Object) (object.Object, error) {
+	m, ok := LookupMethod(recv, name)
+	if !ok {
+		return nil, fmt.Errorf("no method %s", name)
+	}
+
+	// Functions are stood in for by builtins.
+	caller := func(fn object.Object, args ...object.Object) (object.Object, error) {
+		result := fn.(*object.BuiltIn).FN(args...)
+		if err, ok := result.(*object.Error); ok && err.Thrown {
+			return nil, errors.New(err.Message)
+		}
+
+		return result, nil
+	}
+
+	return m.FN(caller, recv, args...)
+}
+
+func TestMethods(t *testing.T) {
+	str := func(s string) *object.String { return &object.String{Value: s} }
+	ints := func(values ...int64) *object.Array {
+		a := &object.Array{Elements: []object.Object{}}
+		for _, v := range values {
+			a.Elements = append(a.Elements, &object.Integer{Value: v})
+		}
+		return a
+	}
+	double := &object.BuiltIn{FN: func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	}}
+	add := &object.BuiltIn{FN: func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value + args[1].(*object.Integer).Value}
+	}}
+	odd := &object.BuiltIn{FN: func(args ...object.Object) object.Object {
+		if args[0].(*object.Integer).Value%2 == 1 {
+			return object.True
+		}
+		return object.False
+	}}
+
+	tests := []struct {
+		recv     object.Object
+		name     string
+		args     []object.Object
+		expected object.Object
+	}{
+		{str(" Ab "), "upper", nil, str(" AB ")},
+		{str(" Ab "), "lower", nil, str(" ab ")},
+		{str(" Ab "), "trim", nil, str("Ab")},
+		{str("a,b"), "split", []object.Object{str(",")}, &object.Array{Elements: []object.Object{str("a"), str("b")}}},
+		{str("abc"), "contains", []object.Object{str("bc")}, object.True},
+		{str("abc"), "len", nil, &object.Integer{Value: 3}},
+		{ints(1, 2), "map", []object.Object{double}, ints(2, 4)},
+		{ints(1, 2, 3), "filter", []object.Object{odd}, ints(1, 3)},
+		{ints(1, 2, 3), "reduce", []object.Object{add, &object.Integer{Value: 10}}, &object.Integer{Value: 16}},
+		{ints(1), "push", []object.Object{&object.Integer{Value: 2}}, ints(1, 2)},
+		{&object.Hash{Pairs: map[object.HashKey]object.HashPair{
+			str("b").HashKey(): {Key: str("b"), Value: &object.Integer{Value: 2}},
+			str("a").HashKey(): {Key: str("a"), Value: &object.Integer{Value: 1}},
+		}}, "values", nil, ints(1, 2)},
+		{str("a"), "split", nil, newError("wrong number of arguments. got=0, want=1")},
+		{str("a"), "contains", []object.Object{&object.Integer{Value: 1}}, newError("argument 1 to `contains` must be STRING, got INTEGER")},
+	}
+
+	for _, tt := range tests {
+		result, err := callMethod(tt.recv, tt.name, tt.args...)
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.expected, result, tt.name)
+	}
+
+	_, ok := LookupMethod(&object.Integer{Value: 1}, "upper")
+	assert.False(t, ok)
+
+	fail := &object.BuiltIn{FN: func(args ...object.Object) object.Object { return newError("no") }}
+	_, err := callMethod(ints(1), "map", fail)
+	assert.EqualError(t, err, "no")
+}
@@ -0,0 +1,20 @@
+package builtin
+
+import (
+	"github.com/marmotini/ngiri-lang/object"
+)
+
+// tagOf returns the name of the variant of an enum value, so that
+// `tag_of(Shape.Circle(3))` is "Circle".
+func tagOf(args ...object.Object) object.Object {
+	if err := arity(args, 1); err != nil {
+		return err
+	}
+
+	v, ok := args[0].(*object.Variant)
+	if !ok {
+		return newError("argument to `tag_of` must be VARIANT, got %s", args[0].Type())
+	}
+
+	return &object.String{Value: v.VariantType.Name}
+}
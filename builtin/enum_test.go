@@ -0,0 +1,22 @@
+package builtin
+
+import (
+	"testing"
+
+	"github.com/marmotini/ngiri-lang/object"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagOf(t *testing.T) {
+	shape := object.NewEnumType("Shape")
+	circle := shape.AddVariant("Circle", []string{"r"})
+	empty := shape.AddVariant("Empty", nil)
+
+	c, err := circle.New([]object.Object{&object.Integer{Value: 3}})
+	assert.NoError(t, err)
+
+	assert.Equal(t, &object.String{Value: "Circle"}, call("tag_of", c))
+	assert.Equal(t, &object.String{Value: "Empty"}, call("tag_of", empty.Unit))
+	assert.Equal(t, newError("argument to `tag_of` must be VARIANT, got ENUM"), call("tag_of", shape))
+	assert.Equal(t, newError("wrong number of arguments. got=0, want=1"), call("tag_of"))
+}
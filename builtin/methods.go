@@ -0,0 +1,255 @@
+package builtin
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/marmotini/ngiri-lang/object"
+)
+
+// Methods are the builtin methods of the values that are not structs, by
+// the type of the receiver and name. Like the core builtins they have no
+// side effects of their own.
+var Methods = map[object.ObjectType]map[string]*object.BuiltinMethod{
+	object.STRING_OBJ: methods(map[string]object.MethodFunction{
+		"len":      stringLen,
+		"upper":    stringUpper,
+		"lower":    stringLower,
+		"trim":     stringTrim,
+		"split":    stringSplit,
+		"contains": stringContains,
+	}),
+	object.ARRAY_OBJ: methods(map[string]object.MethodFunction{
+		"len":    arrayLen,
+		"push":   arrayPush,
+		"map":    arrayMap,
+		"filter": arrayFilter,
+		"reduce": arrayReduce,
+	}),
+	object.HASH_OBJ: methods(map[string]object.MethodFunction{
+		"len":    hashLen,
+		"keys":   hashKeys,
+		"values": hashValues,
+	}),
+}
+
+func methods(fns map[string]object.MethodFunction) map[string]*object.BuiltinMethod {
+	m := map[string]*object.BuiltinMethod{}
+	for name, fn := range fns {
+		m[name] = &object.BuiltinMethod{Name: name, FN: fn}
+	}
+
+	return m
+}
+
+// LookupMethod returns the builtin method name of receiver.
+func LookupMethod(receiver object.Object, name string) (*object.BuiltinMethod, bool) {
+	m, ok := Methods[receiver.Type()][name]
+
+	return m, ok
+}
+
+func stringLen(_ object.Caller, recv object.Object, args ...object.Object) (object.Object, error) {
+	if err := arity(args, 0); err != nil {
+		return err, nil
+	}
+
+	return &object.Integer{Value: int64(len(recv.(*object.String).Value))}, nil
+}
+
+func stringUpper(_ object.Caller, recv object.Object, args ...object.Object) (object.Object, error) {
+	if err := arity(args, 0); err != nil {
+		return err, nil
+	}
+
+	return &object.String{Value: strings.ToUpper(recv.(*object.String).Value)}, nil
+}
+
+func stringLower(_ object.Caller, recv object.Object, args ...object.Object) (object.Object, error) {
+	if err := arity(args, 0); err != nil {
+		return err, nil
+	}
+
+	return &object.String{Value: strings.ToLower(recv.(*object.String).Value)}, nil
+}
+
+func stringTrim(_ object.Caller, recv object.Object, args ...object.Object) (object.Object, error) {
+	if err := arity(args, 0); err != nil {
+		return err, nil
+	}
+
+	return &object.String{Value: strings.TrimSpace(recv.(*object.String).Value)}, nil
+}
+
+func stringSplit(_ object.Caller, recv object.Object, args ...object.Object) (object.Object, error) {
+	if err := arity(args, 1); err != nil {
+		return err, nil
+	}
+
+	sep, err := stringArg("split", args, 0)
+	if err != nil {
+		return err, nil
+	}
+
+	parts := &object.Array{Elements: []object.Object{}}
+	for _, p := range strings.Split(recv.(*object.String).Value, sep) {
+		parts.Elements = append(parts.Elements, &object.String{Value: p})
+	}
+
+	return parts, nil
+}
+
+func stringContains(_ object.Caller, recv object.Object, args ...object.Object) (object.Object, error) {
+	if err := arity(args, 1); err != nil {
+		return err, nil
+	}
+
+	sub, err := stringArg("contains", args, 0)
+	if err != nil {
+		return err, nil
+	}
+
+	if strings.Contains(recv.(*object.String).Value, sub) {
+		return object.True, nil
+	}
+
+	return object.False, nil
+}
+
+func arrayLen(_ object.Caller, recv object.Object, args ...object.Object) (object.Object, error) {
+	if err := arity(args, 0); err != nil {
+		return err, nil
+	}
+
+	return &object.Integer{Value: int64(len(recv.(*object.Array).Elements))}, nil
+}
+
+// arrayPush returns a new array with the arguments appended, the receiver
+// is left as it is.
+func arrayPush(_ object.Caller, recv object.Object, args ...object.Object) (object.Object, error) {
+	elements := recv.(*object.Array).Elements
+
+	pushed := make([]object.Object, 0, len(elements)+len(args))
+	pushed = append(pushed, elements...)
+	pushed = append(pushed, args...)
+
+	return &object.Array{Elements: pushed}, nil
+}
+
+func arrayMap(call object.Caller, recv object.Object, args ...object.Object) (object.Object, error) {
+	if err := arity(args, 1); err != nil {
+		return err, nil
+	}
+
+	mapped := &object.Array{Elements: []object.Object{}}
+	for _, e := range recv.(*object.Array).Elements {
+		v, err := call(args[0], e)
+		if err != nil {
+			return nil, err
+		}
+
+		mapped.Elements = append(mapped.Elements, v)
+	}
+
+	return mapped, nil
+}
+
+func arrayFilter(call object.Caller, recv object.Object, args ...object.Object) (object.Object, error) {
+	if err := arity(args, 1); err != nil {
+		return err, nil
+	}
+
+	kept := &object.Array{Elements: []object.Object{}}
+	for _, e := range recv.(*object.Array).Elements {
+		v, err := call(args[0], e)
+		if err != nil {
+			return nil, err
+		}
+
+		if truthy(v) {
+			kept.Elements = append(kept.Elements, e)
+		}
+	}
+
+	return kept, nil
+}
+
+func truthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null, nil:
+		return false
+	default:
+		return true
+	}
+}
+
+// arrayReduce folds the elements into the accumulator from the left,
+// xs.reduce(f, initial) is f(f(initial, xs[0]), xs[1]) and so on.
+func arrayReduce(call object.Caller, recv object.Object, args ...object.Object) (object.Object, error) {
+	if err := arity(args, 2); err != nil {
+		return err, nil
+	}
+
+	acc := args[1]
+	for _, e := range recv.(*object.Array).Elements {
+		v, err := call(args[0], acc, e)
+		if err != nil {
+			return nil, err
+		}
+
+		acc = v
+	}
+
+	return acc, nil
+}
+
+func hashLen(_ object.Caller, recv object.Object, args ...object.Object) (object.Object, error) {
+	if err := arity(args, 0); err != nil {
+		return err, nil
+	}
+
+	return &object.Integer{Value: int64(len(recv.(*object.Hash).Pairs))}, nil
+}
+
+// sortedPairs returns the pairs of h ordered by their keys, so that keys and
+// values list them in the same, stable order.
+func sortedPairs(h *object.Hash) []object.HashPair {
+	pairs := make([]object.HashPair, 0, len(h.Pairs))
+	for _, p := range h.Pairs {
+		pairs = append(pairs, p)
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Key.Inspect() < pairs[j].Key.Inspect()
+	})
+
+	return pairs
+}
+
+func hashKeys(_ object.Caller, recv object.Object, args ...object.Object) (object.Object, error) {
+	if err := arity(args, 0); err != nil {
+		return err, nil
+	}
+
+	keys := &object.Array{Elements: []object.Object{}}
+	for _, p := range sortedPairs(recv.(*object.Hash)) {
+		keys.Elements = append(keys.Elements, p.Key)
+	}
+
+	return keys, nil
+}
+
+func hashValues(_ object.Caller, recv object.Object, args ...object.Object) (object.Object, error) {
+	if err := arity(args, 0); err != nil {
+		return err, nil
+	}
+
+	values := &object.Array{Elements: []object.Object{}}
+	for _, p := range sortedPairs(recv.(*object.Hash)) {
+		values.Elements = append(values.Elements, p.Value)
+	}
+
+	return values, nil
+}
@@ -0,0 +1,88 @@
+package builtin
+
+import (
+	"github.com/marmotini/ngiri-lang/object"
+)
+
+func okResult(args ...object.Object) object.Object {
+	if err := arity(args, 1); err != nil {
+		return err
+	}
+
+	return &object.Result{Ok: true, Value: args[0]}
+}
+
+func errResult(args ...object.Object) object.Object {
+	if err := arity(args, 1); err != nil {
+		return err
+	}
+
+	return &object.Result{Value: args[0]}
+}
+
+func someOption(args ...object.Object) object.Object {
+	if err := arity(args, 1); err != nil {
+		return err
+	}
+
+	return &object.Option{Some: true, Value: args[0]}
+}
+
+// unwrap returns the value of ok and some. Unwrapping err throws its error,
+// or a runtime error if it holds some other value; unwrapping none throws.
+func unwrap(args ...object.Object) object.Object {
+	if err := arity(args, 1); err != nil {
+		return err
+	}
+
+	value, failed, ok := object.Unwrap(args[0])
+	if !ok {
+		return newError("argument to `unwrap` must be RESULT or OPTION, got %s", args[0].Type())
+	}
+
+	if !failed {
+		return value
+	}
+
+	if res, ok := value.(*object.Result); ok {
+		if e, ok := res.Value.(*object.Error); ok {
+			return e.Throw()
+		}
+	}
+
+	return newError("unwrap of %s", value.Inspect())
+}
+
+func unwrapOr(args ...object.Object) object.Object {
+	if err := arity(args, 2); err != nil {
+		return err
+	}
+
+	value, failed, ok := object.Unwrap(args[0])
+	if !ok {
+		return newError("argument 1 to `unwrap_or` must be RESULT or OPTION, got %s", args[0].Type())
+	}
+
+	if failed {
+		return args[1]
+	}
+
+	return value
+}
+
+func isOk(args ...object.Object) object.Object {
+	if err := arity(args, 1); err != nil {
+		return err
+	}
+
+	_, failed, ok := object.Unwrap(args[0])
+	if !ok {
+		return newError("argument to `is_ok` must be RESULT or OPTION, got %s", args[0].Type())
+	}
+
+	if failed {
+		return object.False
+	}
+
+	return object.True
+}
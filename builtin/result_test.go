@@ -0,0 +1,36 @@
+package builtin
+
+import (
+	"testing"
+
+	"github.com/marmotini/ngiri-lang/object"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResults(t *testing.T) {
+	one := &object.Integer{Value: 1}
+	two := &object.Integer{Value: 2}
+	boom := &object.Error{Message: "boom", Kind: object.ThrownError}
+
+	_, none, _ := Lookup("none")
+
+	assert.Equal(t, "ok(1)", call("ok", one).Inspect())
+	assert.Equal(t, "err(2)", call("err", two).Inspect())
+	assert.Equal(t, "some(1)", call("some", one).Inspect())
+	assert.Equal(t, object.None, none.Object)
+
+	assert.Equal(t, one, call("unwrap", call("ok", one)))
+	assert.Equal(t, one, call("unwrap", call("some", one)))
+	assert.Equal(t, boom.Throw(), call("unwrap", call("err", boom)))
+	assert.Equal(t, newError("unwrap of err(2)"), call("unwrap", call("err", two)))
+	assert.Equal(t, newError("unwrap of none"), call("unwrap", object.None))
+	assert.Equal(t, newError("argument to `unwrap` must be RESULT or OPTION, got INTEGER"), call("unwrap", one))
+
+	assert.Equal(t, one, call("unwrap_or", call("ok", one), two))
+	assert.Equal(t, two, call("unwrap_or", call("err", one), two))
+	assert.Equal(t, two, call("unwrap_or", object.None, two))
+
+	assert.Equal(t, object.True, call("is_ok", call("ok", one)))
+	assert.Equal(t, object.False, call("is_ok", call("err", one)))
+	assert.Equal(t, object.False, call("is_ok", object.None))
+}
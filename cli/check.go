@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/lexer"
+	"github.com/marmotini/ngiri-lang/parser"
+	"github.com/marmotini/ngiri-lang/types"
+)
+
+// runCheck implements `ngiri check [-defs] files...`, the static type checker.
+// It exits with 1 when type errors were reported and 2 when the files could
+// not be checked.
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	defs := fs.Bool("defs", false, "print the inferred types of the top level names")
+	fs.Parse(args)
+
+	status := 0
+	for _, filename := range fs.Args() {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 2
+			continue
+		}
+
+		p := parser.NewParser(lexer.NewLexer(string(src)))
+		prog := p.ParseProgram()
+		if len(p.Errors()) > 0 {
+			for _, err := range p.Errors() {
+				fmt.Fprintf(os.Stderr, "%s: parser error: %s\n", filename, err)
+			}
+			status = 2
+			continue
+		}
+
+		info, diagnostics := types.Check(prog)
+
+		if *defs {
+			for _, s := range prog.Statements {
+				if export, ok := s.(*ast.ExportStatement); ok {
+					s = export.Statement
+				}
+
+				if let, ok := s.(*ast.LetStatement); ok && let.Name != nil {
+					fmt.Printf("%s:%s: %s %s\n", filename, let.Pos(), let.Name.Value, info.Defs[let.Name])
+				}
+			}
+		}
+
+		for _, d := range diagnostics {
+			fmt.Printf("%s:%s\n", filename, d)
+			if status == 0 {
+				status = 1
+			}
+		}
+	}
+
+	return status
+}
@@ -3,14 +3,19 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/builtin"
 	"github.com/marmotini/ngiri-lang/compiler"
 	"github.com/marmotini/ngiri-lang/interpreter"
 	"github.com/marmotini/ngiri-lang/lexer"
+	"github.com/marmotini/ngiri-lang/limit"
 	"github.com/marmotini/ngiri-lang/object"
 	"github.com/marmotini/ngiri-lang/parser"
 	"github.com/marmotini/ngiri-lang/vm"
@@ -22,39 +27,82 @@ var (
 	interactive bool
 	fileName    string
 	runVm       bool
+	limits      limit.Limits
+	allow       string
+	optimize    int
 )
 
 func init() {
 	flag.BoolVar(&interactive, "i", false, "interactive mode")
 	flag.StringVar(&fileName, "f", "", "filename")
 	flag.BoolVar(&runVm, "vm", true, "run virtual machine")
+	flag.Int64Var(&limits.Steps, "steps", 0, "maximum number of steps, 0 for no limit")
+	flag.DurationVar(&limits.Timeout, "timeout", 0, "maximum run time, 0 for no limit")
+	flag.IntVar(&limits.MaxDepth, "depth", 0, "maximum call depth, 0 for the default")
+	flag.Int64Var(&limits.Memory, "memory", 0, "maximum bytes allocated, 0 for no limit")
+	flag.IntVar(&optimize, "O", 0, "optimization level of the bytecode: 0 compiles programs as written, 1 folds constants, 2 also runs the peephole optimizer, 3 also compiles functions through the SSA IR")
+	flag.StringVar(&allow, "allow", "io,fs,os,time,random", "comma separated capabilities of the builtins programs can use")
+}
+
+// commands are run as `ngiri <command> [args]` and return the exit status
+var commands = map[string]func(args []string) int{
+	"vet":   runVet,
+	"check": runCheck,
+	"parse": runParse,
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			os.Exit(cmd(os.Args[2:]))
+		}
+	}
+
 	flag.Parse()
 
+	policy, err := parsePolicy(allow)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
 	if fileName != "" {
 		p := parser.NewParser(lexer.NewLexerFromFile(fileName))
+		prog := p.ParseProgram()
 		if len(p.Errors()) > 0 {
 			for _, err := range p.Errors() {
 				fmt.Printf("Parser error: %s\n", err)
 			}
 		}
 
+		macroEnv := object.NewEnvironment()
+		interpreter.Link(macroEnv, policy)
+
+		prog, err := expandMacros(prog, macroEnv)
+		if err != nil {
+			fmt.Printf("Macro error: %s\n", err)
+			os.Exit(1)
+		}
+
 		var evaluated object.Object
 		if runVm {
 			constants := []object.Object{}
 			globals := make([]object.Object, vm.GlobalsSize)
 			symbolTable := compiler.NewSymbolTable()
+			symbolTable.LinkBuiltins(policy)
 
-			var err error
-			evaluated, err = executeVM(p, symbolTable, constants, globals, os.Stdout)
+			evaluated, err = executeVM(prog, fileName, symbolTable, constants, globals, os.Stdout)
 			if err != nil {
 				fmt.Fprintf(os.Stdout, err.Error())
 			}
 		} else {
-			env := object.NewEnvironment()
-			evaluated = interpreter.Eval(p.ParseProgram(), env)
+			env := object.NewModuleEnvironment(object.NewModule("main", fileName))
+			interpreter.Link(env, policy)
+			evaluated, err = interpreter.EvalContext(context.Background(), prog, env, limits)
+			if err != nil {
+				fmt.Printf("Evaluation stopped: %s\n", err)
+				os.Exit(1)
+			}
 		}
 
 		if evaluated != nil {
@@ -64,17 +112,21 @@ func main() {
 	}
 
 	if interactive && fileName == "" {
-		StartInteractiveMode(os.Stdin, os.Stdout)
+		StartInteractiveMode(os.Stdin, os.Stdout, policy)
 	}
 }
 
-func StartInteractiveMode(r io.Reader, w io.Writer) {
+func StartInteractiveMode(r io.Reader, w io.Writer, policy *builtin.Policy) {
 	scanner := bufio.NewScanner(r)
 	env := object.NewEnvironment()
+	interpreter.Link(env, policy)
+	macroEnv := object.NewEnvironment()
+	interpreter.Link(macroEnv, policy)
 
 	constants := []object.Object{}
 	globals := make([]object.Object, vm.GlobalsSize)
 	symbolTable := compiler.NewSymbolTable()
+	symbolTable.LinkBuiltins(policy)
 
 	for {
 		fmt.Printf(PROMPT)
@@ -86,21 +138,27 @@ func StartInteractiveMode(r io.Reader, w io.Writer) {
 
 		line := scanner.Text()
 		p := parser.NewParser(lexer.NewLexer(line))
+		prog := p.ParseProgram()
 		if len(p.Errors()) > 0 {
 			printParseErrors(w, p.Errors())
 			continue
 		}
 
+		prog, err := expandMacros(prog, macroEnv)
+		if err != nil {
+			fmt.Fprintf(w, "Macro error: %s\n", err)
+			continue
+		}
+
 		var evaluated object.Object
 		if runVm {
-			var err error
-			evaluated, err = executeVM(p, symbolTable, constants, globals, os.Stdout)
+			evaluated, err = executeVM(prog, "", symbolTable, constants, globals, os.Stdout)
 			if err != nil {
 				fmt.Fprintf(os.Stdout, err.Error())
 				continue
 			}
 		} else {
-			evaluated = interpreter.Eval(p.ParseProgram(), env)
+			evaluated = interpreter.Eval(prog, env)
 		}
 
 		if evaluated != nil {
@@ -110,17 +168,34 @@ func StartInteractiveMode(r io.Reader, w io.Writer) {
 	}
 }
 
+// expandMacros binds the macro definitions of prog in env and expands their
+// calls, so both the interpreter and the compiler only see plain code.
+func expandMacros(prog *ast.Program, env *object.Environment) (*ast.Program, error) {
+	interpreter.DefineMacros(prog, env)
+
+	expanded, err := interpreter.ExpandMacrosContext(context.Background(), prog, env, limits)
+	if err != nil {
+		return nil, err
+	}
+
+	return expanded.(*ast.Program), nil
+}
+
 func executeVM(
-	p *parser.Parser, sym *compiler.SymbolTable,
+	prog *ast.Program, filename string, sym *compiler.SymbolTable,
 	constants []object.Object, globals []object.Object, w io.Writer) (object.Object, error) {
 
 	comp := compiler.NewWithState(sym, constants)
-	err := comp.Compile(p.ParseProgram())
+	comp.SetModulePath(filename)
+	comp.SetOptimization(optimize)
+	err := comp.Compile(prog)
 	if err != nil {
 		return nil, fmt.Errorf("Woops! Compilation failed:\n %s\n", err)
 	}
 
 	machine := vm.NewWithGlobalsStore(comp.Bytecode(), globals)
+	machine.SetLimits(limits)
+
 	err = machine.Run()
 	if err != nil {
 		return nil, fmt.Errorf("Woops! Executing bytecode failed:\n %s\n", err)
@@ -129,6 +204,26 @@ func executeVM(
 	return machine.LastPoppedStackElem(), nil
 }
 
+// parsePolicy parses the -allow flag.
+func parsePolicy(allow string) (*builtin.Policy, error) {
+	caps := []builtin.Capability{}
+
+	for _, name := range strings.Split(allow, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+
+		c, err := builtin.ParseCapability(name)
+		if err != nil {
+			return nil, err
+		}
+
+		caps = append(caps, c)
+	}
+
+	return builtin.NewPolicy(caps...), nil
+}
+
 func printParseErrors(w io.Writer, errors []string) {
 	for _, err := range errors {
 		io.WriteString(w, err)
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMissingFile(t *testing.T) {
+	missing := filepath.Join("testdata", "missing.ngiri")
+
+	commands := map[string]func([]string) int{
+		"vet":   runVet,
+		"check": runCheck,
+		"parse": runParse,
+	}
+
+	for name, cmd := range commands {
+		if status := cmd([]string{missing}); status != 2 {
+			t.Errorf("ngiri %s of a missing file exited with %d, want 2", name, status)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/lexer"
+	"github.com/marmotini/ngiri-lang/parser"
+)
+
+// runParse implements `ngiri parse [-json] file`, printing the syntax tree as
+// an S-expression or, with -json, in the encoding of ast.MarshalJSON. It
+// exits with 1 on parser errors and 2 when the file could not be read.
+func runParse(args []string) int {
+	fs := flag.NewFlagSet("parse", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the tree as JSON")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: ngiri parse [-json] file")
+		return 2
+	}
+
+	src, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	p := parser.NewParser(lexer.NewLexer(string(src)))
+	prog := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		for _, err := range p.Errors() {
+			fmt.Fprintf(os.Stderr, "%s: parser error: %s\n", fs.Arg(0), err)
+		}
+		return 1
+	}
+
+	if !*asJSON {
+		fmt.Println(ast.SExpr(prog))
+		return 0
+	}
+
+	data, err := ast.MarshalJSON(prog)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var out bytes.Buffer
+	json.Indent(&out, data, "", "  ")
+	fmt.Println(out.String())
+
+	return 0
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/marmotini/ngiri-lang/lexer"
+	"github.com/marmotini/ngiri-lang/parser"
+	"github.com/marmotini/ngiri-lang/vet"
+)
+
+// runVet implements `ngiri vet [-config file] [-rules] files...`. It exits with
+// 1 when diagnostics were reported and 2 when the files could not be checked.
+func runVet(args []string) int {
+	fs := flag.NewFlagSet("vet", flag.ExitOnError)
+	configFile := fs.String("config", "", "vet config file (default "+vet.DefaultConfigFile+" if present)")
+	listRules := fs.Bool("rules", false, "list the available rules and exit")
+	fs.Parse(args)
+
+	if *listRules {
+		for _, r := range vet.Rules() {
+			fmt.Printf("%-22s %s\n", r.ID, r.Doc)
+		}
+		return 0
+	}
+
+	conf, err := loadVetConfig(*configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	status := 0
+	for _, filename := range fs.Args() {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 2
+			continue
+		}
+
+		p := parser.NewParser(lexer.NewLexer(string(src)))
+		prog := p.ParseProgram()
+		if len(p.Errors()) > 0 {
+			for _, err := range p.Errors() {
+				fmt.Fprintf(os.Stderr, "%s: parser error: %s\n", filename, err)
+			}
+			status = 2
+			continue
+		}
+
+		for _, d := range vet.Check(prog, conf) {
+			fmt.Printf("%s:%s\n", filename, d)
+			if status == 0 {
+				status = 1
+			}
+		}
+	}
+
+	return status
+}
+
+func loadVetConfig(filename string) (*vet.Config, error) {
+	if filename == "" {
+		if _, err := os.Stat(vet.DefaultConfigFile); err != nil {
+			return nil, nil
+		}
+		filename = vet.DefaultConfigFile
+	}
+
+	return vet.LoadConfig(filename)
+}
@@ -40,6 +40,29 @@ const (
 	OpCall
 	OpReturnValue
 	OpReturn
+
+	OpGetBuiltin
+
+	OpTry
+	OpEndTry
+	OpThrow
+	OpGetField
+	OpPropagate
+	OpIndex
+	OpMatch
+	OpNoMatch
+	OpDestructure
+	OpCallShaped
+	OpJumpIfBound
+	OpTailCall
+	OpAddLocalConst
+	OpJumpIfNotGreater
+	OpWide
+	OpSetField
+	OpStruct
+	OpCallMethod
+	OpDefineMethod
+	OpSubLocalConst
 )
 
 type Definition struct {
@@ -76,23 +99,114 @@ var definitions = map[OpCode]*Definition{
 	OpSetLocal: {"OpSetLocal", []int{1}},
 
 	OpArray: {"OpArray", []int{2}},
-	OpHash:  {"OpHash", []int{}},
+	OpHash:  {"OpHash", []int{2}},
 
 	OpCall:        {"OpCall", []int{1}},
 	OpReturnValue: {"OpReturnValue", []int{}},
 	OpReturn:      {"OpReturn", []int{}},
+
+	OpGetBuiltin: {"OpGetBuiltin", []int{1}},
+
+	OpTry:    {"OpTry", []int{2}},
+	OpEndTry: {"OpEndTry", []int{}},
+	OpThrow:  {"OpThrow", []int{}},
+
+	// OpGetField selects the field named by the string constant of its
+	// first operand. The second is the slot the field has in the structs
+	// the compiler knows of, which the VM tries before looking the name up.
+	OpGetField: {"OpGetField", []int{2, 1}},
+
+	OpPropagate: {"OpPropagate", []int{2}},
+
+	OpIndex:   {"OpIndex", []int{}},
+	OpMatch:   {"OpMatch", []int{2}},
+	OpNoMatch: {"OpNoMatch", []int{}},
+
+	OpDestructure: {"OpDestructure", []int{2}},
+
+	// OpCallShaped is OpCall for calls with spread or named arguments, its
+	// second operand is the index of an object.CallShape constant.
+	OpCallShaped: {"OpCallShaped", []int{1, 2}},
+	// OpJumpIfBound jumps to its second operand unless the parameter in
+	// the local of its first operand was left to its default.
+	OpJumpIfBound: {"OpJumpIfBound", []int{1, 2}},
+	// OpTailCall is OpCall for calls whose value the function returns, it
+	// replaces the frame of the function with the callee's.
+	OpTailCall: {"OpTailCall", []int{1}},
+
+	// Superinstructions the peephole optimizer fuses common sequences into.
+	// OpAddLocalConst is OpGetLocal, OpConstant and OpAdd, its operands are
+	// the local and the constant. OpJumpIfNotGreater is OpGreaterThan and
+	// OpJumpNotTruthy.
+	OpAddLocalConst:    {"OpAddLocalConst", []int{1, 2}},
+	OpJumpIfNotGreater: {"OpJumpIfNotGreater", []int{2}},
+
+	// OpWide prefixes an instruction whose operands are twice as wide as
+	// defined, for indices and counts that do not fit otherwise, see Make.
+	OpWide: {"OpWide", []int{}},
+
+	// OpSetField pops a value and a struct and sets the field like
+	// OpGetField selects it, pushing the value back.
+	OpSetField: {"OpSetField", []int{2, 1}},
+	// OpStruct builds a struct from the values on the stack, its operand is
+	// the index of an object.StructShape constant.
+	OpStruct: {"OpStruct", []int{2}},
+
+	// OpCallMethod calls the method named by the string constant of its
+	// first operand on the receiver below the arguments, its second operand
+	// is the number of arguments. The third numbers the call site for the
+	// VM to cache what the name resolved to.
+	OpCallMethod: {"OpCallMethod", []int{2, 1, 2}},
+	// OpDefineMethod pops a function and defines it as the method named by
+	// its operand on the struct type below, which it leaves on the stack.
+	OpDefineMethod: {"OpDefineMethod", []int{2}},
+
+	// OpSubLocalConst is OpGetLocal, OpConstant and OpSub, with the operands
+	// of OpAddLocalConst.
+	OpSubLocalConst: {"OpSubLocalConst", []int{1, 2}},
+}
+
+// widened are the instructions OpWide applies to. Jumps are not, their
+// operands are patched in place once the target is known.
+var widened = map[OpCode]bool{
+	OpConstant:     true,
+	OpGetLocal:     true,
+	OpSetLocal:     true,
+	OpArray:        true,
+	OpHash:         true,
+	OpCall:         true,
+	OpTailCall:     true,
+	OpCallShaped:   true,
+	OpGetField:     true,
+	OpSetField:     true,
+	OpStruct:       true,
+	OpCallMethod:   true,
+	OpDefineMethod: true,
+	OpMatch:        true,
+	OpDestructure:  true,
 }
 
 type Instructions []byte
 
+// Make encodes an instruction. Operands too large for their width are
+// truncated, except for instructions that have a wide form: those are
+// prefixed with OpWide when they need it. Fits tells whether they do.
 func Make(op OpCode, operands ...int) []byte {
 	def, ok := definitions[op]
 	if !ok {
 		return []byte{}
 	}
 
+	if widened[op] && !fits(def.OperandsWidths, operands) {
+		return append([]byte{byte(OpWide)}, makeInstruction(op, wide(def.OperandsWidths), operands)...)
+	}
+
+	return makeInstruction(op, def.OperandsWidths, operands)
+}
+
+func makeInstruction(op OpCode, widths []int, operands []int) []byte {
 	instructionLen := 1
-	for _, w := range def.OperandsWidths {
+	for _, w := range widths {
 		instructionLen += w
 	}
 
@@ -101,8 +215,10 @@ func Make(op OpCode, operands ...int) []byte {
 
 	offset := 1
 	for i, o := range operands {
-		width := def.OperandsWidths[i]
+		width := widths[i]
 		switch width {
+		case 4:
+			binary.BigEndian.PutUint32(instruction[offset:], uint32(o))
 		case 2:
 			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
 		case 1:
@@ -115,21 +231,56 @@ func Make(op OpCode, operands ...int) []byte {
 	return instruction
 }
 
+// Fits reports whether Make can encode the operands of op without
+// truncating them.
+func Fits(op OpCode, operands ...int) bool {
+	def, ok := definitions[op]
+	if !ok {
+		return false
+	}
+
+	return fits(def.OperandsWidths, operands) || (widened[op] && fits(wide(def.OperandsWidths), operands))
+}
+
+func fits(widths []int, operands []int) bool {
+	for i, o := range operands {
+		if o < 0 || uint64(o) >= 1<<(8*uint(widths[i])) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// wide returns the widths of the operands of an instruction after OpWide.
+func wide(widths []int) []int {
+	doubled := make([]int, len(widths))
+	for i, w := range widths {
+		doubled[i] = 2 * w
+	}
+
+	return doubled
+}
+
 func (ins Instructions) String() string {
 	var out bytes.Buffer
 
 	for i := 0; i < len(ins); {
-		def, err := Lookup(ins[i])
+		op, operands, read, err := ReadInstruction(ins[i:])
 		if err != nil {
 			fmt.Fprintf(&out, "Error: %s\n", err)
-			continue
+			break
 		}
 
-		operands, read := ReadOperands(def, ins[i+1:])
+		def := definitions[op]
+		prefix := ""
+		if OpCode(ins[i]) == OpWide {
+			prefix = "OpWide "
+		}
 
-		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+		fmt.Fprintf(&out, "%04d %s%s\n", i, prefix, ins.fmtInstruction(def, operands))
 
-		i += 1 + read
+		i += read
 	}
 
 	return out.String()
@@ -156,17 +307,81 @@ func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
 		return def.Name
 	case 1:
 		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	case 3:
+		return fmt.Sprintf("%s %d %d %d", def.Name, operands[0], operands[1], operands[2])
 	}
 
 	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
 }
 
+// JumpOperand returns the index of the operand of op that holds the offset
+// it may jump to. ok is false for instructions that do not jump.
+func JumpOperand(op OpCode) (index int, ok bool) {
+	switch op {
+	case OpJump, OpJumpNotTruthy, OpJumpIfNotGreater, OpPropagate:
+		return 0, true
+	case OpJumpIfBound:
+		return 1, true
+	default:
+		return 0, false
+	}
+}
+
+// ReadInstruction decodes the instruction ins starts with, the OpWide
+// prefix included when it has one. It returns the opcode of the
+// instruction, its operands and the number of bytes read.
+func ReadInstruction(ins Instructions) (OpCode, []int, int, error) {
+	op := OpCode(ins[0])
+	prefix := 0
+
+	if op == OpWide {
+		if len(ins) < 2 {
+			return 0, nil, 0, fmt.Errorf("OpWide is cut short")
+		}
+		op = OpCode(ins[1])
+		prefix = 1
+	}
+
+	def, ok := definitions[op]
+	if !ok {
+		return 0, nil, 0, fmt.Errorf("opcode %d is not defined", op)
+	}
+
+	widths := def.OperandsWidths
+	if prefix == 1 {
+		if !widened[op] {
+			return 0, nil, 0, fmt.Errorf("%s has no wide form", def.Name)
+		}
+		widths = wide(widths)
+	}
+
+	size := prefix + 1
+	for _, w := range widths {
+		size += w
+	}
+	if size > len(ins) {
+		return 0, nil, 0, fmt.Errorf("%s is cut short", def.Name)
+	}
+
+	operands, read := readOperands(widths, ins[prefix+1:])
+
+	return op, operands, prefix + 1 + read, nil
+}
+
 func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
-	operands := make([]int, len(def.OperandsWidths))
+	return readOperands(def.OperandsWidths, ins)
+}
+
+func readOperands(widths []int, ins Instructions) ([]int, int) {
+	operands := make([]int, len(widths))
 	offset := 0
 
-	for i, width := range def.OperandsWidths {
+	for i, width := range widths {
 		switch width {
+		case 4:
+			operands[i] = int(ReadUint32(ins[offset:]))
 		case 2:
 			operands[i] = int(ReadUint16(ins[offset:]))
 		case 1:
@@ -179,6 +394,10 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 	return operands, offset
 }
 
+func ReadUint32(ins Instructions) uint32 {
+	return binary.BigEndian.Uint32(ins)
+}
+
 func ReadUint16(ins Instructions) uint16 {
 	return binary.BigEndian.Uint16(ins)
 }
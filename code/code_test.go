@@ -15,7 +15,15 @@ func TestMake(t *testing.T) {
 	}{
 		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
 		{OpAdd, []int{}, []byte{byte(OpAdd)}},
-		{OpGetLocal, []int{255}, []byte{byte(OpGetGlobal), 255}},
+		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{OpCallShaped, []int{2, 65534}, []byte{byte(OpCallShaped), 2, 255, 254}},
+		{OpAddLocalConst, []int{3, 258}, []byte{byte(OpAddLocalConst), 3, 1, 2}},
+		{OpGetField, []int{258, 3}, []byte{byte(OpGetField), 1, 2, 3}},
+		{OpSetField, []int{1, 256}, []byte{byte(OpWide), byte(OpSetField), 0, 0, 0, 1, 1, 0}},
+		{OpGetLocal, []int{256}, []byte{byte(OpWide), byte(OpGetLocal), 1, 0}},
+		{OpCallMethod, []int{1, 2, 258}, []byte{byte(OpCallMethod), 0, 1, 2, 1, 2}},
+		{OpConstant, []int{65536}, []byte{byte(OpWide), byte(OpConstant), 0, 1, 0, 0}},
+		{OpCallShaped, []int{300, 2}, []byte{byte(OpWide), byte(OpCallShaped), 1, 44, 0, 0, 0, 2}},
 	}
 
 	for _, tt := range tests {
@@ -35,12 +43,18 @@ func TestInstructionsString(t *testing.T) {
 		Make(OpGetLocal, 1),
 		Make(OpConstant, 2),
 		Make(OpConstant, 65535),
+		Make(OpJumpIfBound, 1, 12),
+		Make(OpConstant, 65536),
+		Make(OpCallMethod, 4, 2, 7),
 	}
 
 	expected := `0000 OpAdd
 0001 OpGetLocal 1
-0001 OpConstant 2
-0004 OpConstant 65535
+0003 OpConstant 2
+0006 OpConstant 65535
+0009 OpJumpIfBound 1 12
+0013 OpWide OpConstant 65536
+0019 OpCallMethod 4 2 7
 `
 
 	concatted := Instructions{}
@@ -59,6 +73,7 @@ func TestReadOperands(t *testing.T) {
 	}{
 		{OpConstant, []int{65535}, 2},
 		{OpGetLocal, []int{255}, 1},
+		{OpCallShaped, []int{3, 65535}, 3},
 	}
 
 	for _, tt := range tests {
@@ -75,3 +90,78 @@ func TestReadOperands(t *testing.T) {
 		}
 	}
 }
+
+func TestJumpOperand(t *testing.T) {
+	tests := []struct {
+		op    OpCode
+		index int
+		ok    bool
+	}{
+		{OpJump, 0, true},
+		{OpJumpNotTruthy, 0, true},
+		{OpJumpIfNotGreater, 0, true},
+		{OpPropagate, 0, true},
+		{OpJumpIfBound, 1, true},
+		{OpConstant, 0, false},
+		{OpTry, 0, false},
+	}
+
+	for _, tt := range tests {
+		index, ok := JumpOperand(tt.op)
+		assert.Equal(t, tt.ok, ok, "ok wrong for %d", tt.op)
+		assert.Equal(t, tt.index, index, "index wrong for %d", tt.op)
+	}
+}
+
+func TestReadInstruction(t *testing.T) {
+	tests := []struct {
+		ins      Instructions
+		op       OpCode
+		operands []int
+		read     int
+		err      string
+	}{
+		{Instructions(Make(OpGetLocal, 255)), OpGetLocal, []int{255}, 2, ""},
+		{Instructions(Make(OpGetLocal, 256)), OpGetLocal, []int{256}, 4, ""},
+		{Instructions(Make(OpCallShaped, 1, 65536)), OpCallShaped, []int{1, 65536}, 8, ""},
+		{Instructions{byte(OpWide)}, 0, nil, 0, "OpWide is cut short"},
+		{Instructions{byte(OpWide), byte(OpJump), 0, 0, 0, 1}, 0, nil, 0, "OpJump has no wide form"},
+		{Instructions{byte(OpWide), byte(OpGetLocal), 1}, 0, nil, 0, "OpGetLocal is cut short"},
+		{Instructions{255}, 0, nil, 0, "opcode 255 is not defined"},
+	}
+
+	for _, tt := range tests {
+		op, operands, read, err := ReadInstruction(tt.ins)
+		if tt.err != "" {
+			assert.EqualError(t, err, tt.err)
+			continue
+		}
+
+		assert.NoError(t, err)
+		assert.Equal(t, tt.op, op)
+		assert.Equal(t, tt.operands, operands)
+		assert.Equal(t, tt.read, read)
+	}
+}
+
+func TestFits(t *testing.T) {
+	tests := []struct {
+		op       OpCode
+		operands []int
+		fits     bool
+	}{
+		{OpGetLocal, []int{255}, true},
+		{OpGetLocal, []int{65535}, true},
+		{OpGetLocal, []int{65536}, false},
+		{OpConstant, []int{1 << 20}, true},
+		{OpJump, []int{65535}, true},
+		{OpJump, []int{65536}, false},
+		{OpGetGlobal, []int{65536}, false},
+		{OpAddLocalConst, []int{256, 0}, false},
+		{OpCall, []int{-1}, false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.fits, Fits(tt.op, tt.operands...), "%d %v", tt.op, tt.operands)
+	}
+}
@@ -0,0 +1,387 @@
+package code
+
+import "fmt"
+
+// Bytecode is a compiled program as Verify sees it. Package code does not
+// know the objects of the constant pool, so they are described by Constant,
+// see compiler.Bytecode.Verify.
+type Bytecode struct {
+	// Main is the main program. It has no locals or parameters.
+	Main Function
+	// Constants describes the constant pool.
+	Constants Pool
+	// Functions are the indexes of the function constants to check. The
+	// others passed Verify with an earlier program sharing them.
+	Functions []int
+	// NumBuiltins is the number of builtins OpGetBuiltin can load.
+	NumBuiltins int
+}
+
+// Function is the code of the main program or of a compiled function.
+type Function struct {
+	Name          string
+	Instructions  Instructions
+	NumLocals     int
+	NumParameters int
+	// Handlers are the catch offsets of the function's handler table,
+	// indexed by the operand of OpTry.
+	Handlers []int
+}
+
+// ConstantKind is the kind of object in the constant pool the operand of an
+// instruction refers to.
+type ConstantKind int
+
+const (
+	// ValueConstant is any constant OpConstant may push and no other
+	// instruction needs, like integers.
+	ValueConstant ConstantKind = iota
+	StringConstant
+	FunctionConstant
+	PatternConstant
+	CallShapeConstant
+	StructShapeConstant
+)
+
+// Pool describes the constant pool of a program as Verify asks for it, so
+// the entries of a large pool need not be described up front.
+type Pool interface {
+	Len() int
+	// Constant describes the entry at index, which is less than Len.
+	Constant(index int) Constant
+}
+
+// Constants is a Pool described up front, in order.
+type Constants []Constant
+
+func (c Constants) Len() int { return len(c) }
+
+func (c Constants) Constant(index int) Constant { return c[index] }
+
+// Constant describes an entry of the constant pool.
+type Constant struct {
+	Kind ConstantKind
+	// Function is the code of a FunctionConstant. It is only needed for the
+	// Functions Verify checks.
+	Function *Function
+	// Values is the number of values OpDestructure pushes for a
+	// PatternConstant, the number of arguments passed by name for a
+	// CallShapeConstant, or the number of values OpStruct pops for a
+	// StructShapeConstant.
+	Values int
+	// Locals are the local slots OpMatch stores the values a
+	// PatternConstant binds in, nil when they are globals.
+	Locals []int
+}
+
+// VerifyError is the first problem Verify finds in a program.
+type VerifyError struct {
+	// Function is "main" or names the function constant, e.g.
+	// "fib (constant 3)".
+	Function string
+	// Offset is the offset of the instruction at fault.
+	Offset  int
+	Message string
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("invalid bytecode in %s at %04d: %s", e.Function, e.Offset, e.Message)
+}
+
+// Verify checks that the VM can run b without going wrong on the bytecode
+// itself: every opcode is defined and complete, operands refer to existing
+// constants of the right kind, locals, builtins and handlers, jumps land on
+// instructions, the stack depth at each instruction is the same along every
+// path to it and never below the locals, and functions end with a return.
+// Main is checked along with the Functions of the constant pool.
+func Verify(b Bytecode) error {
+	v := &verifier{b: &b, fn: &b.Main, name: "main", main: true}
+	if err := v.verify(); err != nil {
+		return err
+	}
+
+	for _, i := range b.Functions {
+		c := b.Constants.Constant(i)
+		name := c.Function.Name
+		if name == "" {
+			name = "fn"
+		}
+
+		v := &verifier{b: &b, fn: c.Function, name: fmt.Sprintf("%s (constant %d)", name, i)}
+		if err := v.verify(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// verifier checks one function of a program.
+type verifier struct {
+	b    *Bytecode
+	fn   *Function
+	name string
+	main bool
+}
+
+// state is what is known at an instruction: the number of values on the
+// stack above the locals and the number of try expressions entered and not
+// left yet.
+type state struct {
+	depth int
+	tries int
+}
+
+// instruction is a decoded instruction, size bytes long.
+type instruction struct {
+	op       OpCode
+	def      *Definition
+	operands []int
+	size     int
+}
+
+func (v *verifier) errorf(offset int, format string, args ...interface{}) error {
+	return &VerifyError{Function: v.name, Offset: offset, Message: fmt.Sprintf(format, args...)}
+}
+
+func (v *verifier) verify() error {
+	if !v.main && v.fn.NumParameters > v.fn.NumLocals {
+		return v.errorf(0, "%d parameters but %d locals", v.fn.NumParameters, v.fn.NumLocals)
+	}
+
+	decoded, err := v.decode()
+	if err != nil {
+		return err
+	}
+
+	for offset, ins := range decoded {
+		if err := v.checkOperands(offset, ins, decoded); err != nil {
+			return err
+		}
+	}
+
+	for i, catch := range v.fn.Handlers {
+		if _, ok := decoded[catch]; !ok {
+			return v.errorf(catch, "handler %d does not start at an instruction", i)
+		}
+	}
+
+	return v.checkStack(decoded)
+}
+
+// decode splits the instructions at their boundaries.
+func (v *verifier) decode() (map[int]instruction, error) {
+	ins := v.fn.Instructions
+	decoded := map[int]instruction{}
+
+	for offset := 0; offset < len(ins); {
+		op, operands, read, err := ReadInstruction(ins[offset:])
+		if err != nil {
+			return nil, v.errorf(offset, "%s", err)
+		}
+
+		decoded[offset] = instruction{op: op, def: definitions[op], operands: operands, size: read}
+		offset += read
+	}
+
+	return decoded, nil
+}
+
+// checkOperands checks the operands of ins that do not depend on the path
+// it is reached by.
+func (v *verifier) checkOperands(offset int, ins instruction, decoded map[int]instruction) error {
+	if index, ok := JumpOperand(ins.op); ok {
+		target := ins.operands[index]
+		if _, ok := decoded[target]; !ok && target != len(v.fn.Instructions) {
+			return v.errorf(offset, "%s jumps to %d, which is not an instruction", ins.def.Name, target)
+		}
+	}
+
+	switch ins.op {
+	case OpConstant:
+		return v.checkConstant(offset, ins, ins.operands[0], ValueConstant)
+	case OpAddLocalConst, OpSubLocalConst:
+		if err := v.checkLocal(offset, ins, ins.operands[0]); err != nil {
+			return err
+		}
+		return v.checkConstant(offset, ins, ins.operands[1], ValueConstant)
+	case OpGetLocal, OpSetLocal, OpJumpIfBound:
+		return v.checkLocal(offset, ins, ins.operands[0])
+	case OpGetBuiltin:
+		if ins.operands[0] >= v.b.NumBuiltins {
+			return v.errorf(offset, "%s loads builtin %d of %d", ins.def.Name, ins.operands[0], v.b.NumBuiltins)
+		}
+	case OpGetField, OpSetField, OpCallMethod, OpDefineMethod:
+		return v.checkConstant(offset, ins, ins.operands[0], StringConstant)
+	case OpStruct:
+		return v.checkConstant(offset, ins, ins.operands[0], StructShapeConstant)
+	case OpDestructure:
+		return v.checkConstant(offset, ins, ins.operands[0], PatternConstant)
+	case OpMatch:
+		if err := v.checkConstant(offset, ins, ins.operands[0], PatternConstant); err != nil {
+			return err
+		}
+		for _, local := range v.b.Constants.Constant(ins.operands[0]).Locals {
+			if err := v.checkLocal(offset, ins, local); err != nil {
+				return err
+			}
+		}
+	case OpCallShaped:
+		if err := v.checkConstant(offset, ins, ins.operands[1], CallShapeConstant); err != nil {
+			return err
+		}
+		if names := v.b.Constants.Constant(ins.operands[1]).Values; names > ins.operands[0] {
+			return v.errorf(offset, "%s passes %d arguments by name of %d", ins.def.Name, names, ins.operands[0])
+		}
+	case OpHash:
+		if ins.operands[0]%2 != 0 {
+			return v.errorf(offset, "%s of %d values, which do not pair up", ins.def.Name, ins.operands[0])
+		}
+	case OpTry:
+		if ins.operands[0] >= len(v.fn.Handlers) {
+			return v.errorf(offset, "%s uses handler %d of %d", ins.def.Name, ins.operands[0], len(v.fn.Handlers))
+		}
+	case OpReturn, OpTailCall:
+		if v.main {
+			return v.errorf(offset, "%s outside of a function", ins.def.Name)
+		}
+	}
+
+	return nil
+}
+
+var constantKinds = map[ConstantKind]string{
+	StringConstant:      "string",
+	FunctionConstant:    "function",
+	PatternConstant:     "pattern",
+	CallShapeConstant:   "call shape",
+	StructShapeConstant: "struct shape",
+}
+
+func (v *verifier) checkConstant(offset int, ins instruction, index int, kind ConstantKind) error {
+	if index >= v.b.Constants.Len() {
+		return v.errorf(offset, "%s uses constant %d of %d", ins.def.Name, index, v.b.Constants.Len())
+	}
+
+	if kind != ValueConstant && v.b.Constants.Constant(index).Kind != kind {
+		return v.errorf(offset, "%s uses constant %d, which is not a %s", ins.def.Name, index, constantKinds[kind])
+	}
+
+	return nil
+}
+
+func (v *verifier) checkLocal(offset int, ins instruction, local int) error {
+	if local >= v.fn.NumLocals {
+		return v.errorf(offset, "%s uses local %d of %d", ins.def.Name, local, v.fn.NumLocals)
+	}
+
+	return nil
+}
+
+// checkStack follows every path from the start of the function, and from
+// OpTry to its handler, checking that the paths agree on the state at each
+// instruction they reach.
+func (v *verifier) checkStack(decoded map[int]instruction) error {
+	end := len(v.fn.Instructions)
+	states := map[int]state{}
+	work := []int{}
+
+	reach := func(from, to int, s state) error {
+		if to == end && !v.main {
+			return v.errorf(from, "the function ends without a return")
+		}
+
+		if seen, ok := states[to]; ok {
+			if seen != s {
+				return v.errorf(to, "reached with stack depth %d and %d tries by %04d, and with %d and %d before",
+					s.depth, s.tries, from, seen.depth, seen.tries)
+			}
+			return nil
+		}
+
+		states[to] = s
+		if to != end {
+			work = append(work, to)
+		}
+		return nil
+	}
+
+	if err := reach(0, 0, state{}); err != nil {
+		return err
+	}
+
+	for len(work) > 0 {
+		offset := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		ins := decoded[offset]
+		s := states[offset]
+
+		pops, pushes := v.stackEffect(ins)
+		if s.depth < pops {
+			return v.errorf(offset, "%s pops %d values of %d", ins.def.Name, pops, s.depth)
+		}
+		s.depth += pushes - pops
+
+		switch ins.op {
+		case OpTry:
+			catch := v.fn.Handlers[ins.operands[0]]
+			if err := reach(offset, catch, state{depth: s.depth + 1, tries: s.tries}); err != nil {
+				return err
+			}
+			s.tries++
+		case OpEndTry:
+			if s.tries == 0 {
+				return v.errorf(offset, "%s outside of a try", ins.def.Name)
+			}
+			s.tries--
+		case OpReturnValue, OpReturn, OpThrow, OpNoMatch:
+			continue
+		}
+
+		if index, ok := JumpOperand(ins.op); ok {
+			if err := reach(offset, ins.operands[index], s); err != nil {
+				return err
+			}
+			if ins.op == OpJump {
+				continue
+			}
+		}
+
+		if err := reach(offset, offset+ins.size, s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stackEffect returns the number of values ins pops and then pushes.
+// Instructions that jump do the same on either way.
+func (v *verifier) stackEffect(ins instruction) (pops, pushes int) {
+	switch ins.op {
+	case OpConstant, OpTrue, OpFalse, OpNull, OpGetGlobal, OpGetLocal, OpGetBuiltin, OpAddLocalConst, OpSubLocalConst:
+		return 0, 1
+	case OpPop, OpSetGlobal, OpSetLocal, OpJumpNotTruthy, OpReturnValue, OpThrow, OpNoMatch:
+		return 1, 0
+	case OpAdd, OpSub, OpMul, OpDiv, OpEqual, OpNotEqual, OpGreaterThan, OpIndex, OpSetField, OpDefineMethod:
+		return 2, 1
+	case OpMinus, OpBang, OpGetField, OpPropagate, OpMatch:
+		return 1, 1
+	case OpJumpIfNotGreater:
+		return 2, 0
+	case OpArray, OpHash:
+		return ins.operands[0], 1
+	case OpCall, OpTailCall, OpCallShaped:
+		return ins.operands[0] + 1, 1
+	case OpCallMethod:
+		return ins.operands[1] + 1, 1
+	case OpDestructure:
+		return 1, v.b.Constants.Constant(ins.operands[0]).Values
+	case OpStruct:
+		return v.b.Constants.Constant(ins.operands[0]).Values, 1
+	default:
+		// OpJump, OpJumpIfBound, OpTry, OpEndTry and OpReturn.
+		return 0, 0
+	}
+}
@@ -0,0 +1,220 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func concat(instructions ...[]byte) Instructions {
+	out := Instructions{}
+	for _, ins := range instructions {
+		out = append(out, ins...)
+	}
+
+	return out
+}
+
+func TestVerify(t *testing.T) {
+	function := func(numLocals int, instructions ...[]byte) Constant {
+		return Constant{Kind: FunctionConstant, Function: &Function{
+			Name:         "f",
+			Instructions: concat(instructions...),
+			NumLocals:    numLocals,
+		}}
+	}
+
+	constants := Constants{
+		{Kind: ValueConstant},
+		{Kind: StringConstant},
+		{Kind: PatternConstant, Values: 2, Locals: []int{1}},
+		function(1,
+			Make(OpGetLocal, 0),
+			Make(OpJumpNotTruthy, 7),
+			Make(OpNull),
+			Make(OpReturnValue),
+			Make(OpConstant, 0),
+			Make(OpTailCall, 0),
+			Make(OpReturnValue),
+		),
+	}
+
+	tests := []struct {
+		name      string
+		main      Instructions
+		handlers  []int
+		constants Constants
+		functions []int
+		expected  string
+	}{
+		{
+			name: "valid program",
+			main: concat(
+				Make(OpTry, 0),
+				Make(OpConstant, 1),
+				Make(OpEndTry),
+				Make(OpJump, 17),
+				Make(OpGetField, 1, 0), // 0010
+				Make(OpJump, 17),
+				Make(OpPop), // 0017
+			),
+			handlers: []int{10},
+		},
+		{
+			name:     "undefined opcode",
+			main:     Instructions{255},
+			expected: "invalid bytecode in main at 0000: opcode 255 is not defined",
+		},
+		{
+			name:     "cut short",
+			main:     concat(Make(OpNull), Make(OpConstant, 0)[:2]),
+			expected: "invalid bytecode in main at 0001: OpConstant is cut short",
+		},
+		{
+			name:     "constant out of range",
+			main:     concat(Make(OpConstant, 4), Make(OpPop)),
+			expected: "invalid bytecode in main at 0000: OpConstant uses constant 4 of 4",
+		},
+		{
+			name:     "constant of the wrong kind",
+			main:     concat(Make(OpNull), Make(OpGetField, 0, 0), Make(OpPop)),
+			expected: "invalid bytecode in main at 0001: OpGetField uses constant 0, which is not a string",
+		},
+		{
+			name:     "builtin out of range",
+			main:     concat(Make(OpGetBuiltin, 3), Make(OpPop)),
+			expected: "invalid bytecode in main at 0000: OpGetBuiltin loads builtin 3 of 3",
+		},
+		{
+			name:     "jump into an instruction",
+			main:     concat(Make(OpJump, 4), Make(OpConstant, 0)),
+			expected: "invalid bytecode in main at 0000: OpJump jumps to 4, which is not an instruction",
+		},
+		{
+			name:     "handler inside an instruction",
+			main:     concat(Make(OpTry, 0), Make(OpEndTry)),
+			handlers: []int{1},
+			expected: "invalid bytecode in main at 0001: handler 0 does not start at an instruction",
+		},
+		{
+			name: "stack depth differs between paths",
+			main: concat(
+				Make(OpTrue),
+				Make(OpJumpNotTruthy, 5),
+				Make(OpNull),
+				Make(OpNull), // 0005
+				Make(OpPop),
+			),
+			expected: "invalid bytecode in main at 0005: reached with stack depth 1 and 0 tries by 0004, and with 0 and 0 before",
+		},
+		{
+			name:     "stack underflow",
+			main:     concat(Make(OpNull), Make(OpAdd)),
+			expected: "invalid bytecode in main at 0001: OpAdd pops 2 values of 1",
+		},
+		{
+			name:     "end of a try without a try",
+			main:     concat(Make(OpEndTry)),
+			expected: "invalid bytecode in main at 0000: OpEndTry outside of a try",
+		},
+		{
+			name:      "values popped by a struct",
+			main:      concat(Make(OpNull), Make(OpNull), Make(OpStruct, 0), Make(OpConstant, 1), Make(OpSetField, 1, 0), Make(OpPop)),
+			constants: Constants{{Kind: StructShapeConstant, Values: 2}, {Kind: StringConstant}},
+			expected:  "",
+		},
+		{
+			name:      "struct built from missing values",
+			main:      concat(Make(OpNull), Make(OpStruct, 0), Make(OpPop)),
+			constants: Constants{{Kind: StructShapeConstant, Values: 2}},
+			expected:  "invalid bytecode in main at 0001: OpStruct pops 2 values of 1",
+		},
+		{
+			name:     "struct of a constant of the wrong kind",
+			main:     concat(Make(OpStruct, 1), Make(OpPop)),
+			expected: "invalid bytecode in main at 0000: OpStruct uses constant 1, which is not a struct shape",
+		},
+		{
+			name:     "method call",
+			main:     concat(Make(OpNull), Make(OpNull), Make(OpNull), Make(OpCallMethod, 1, 2, 0), Make(OpPop)),
+			expected: "",
+		},
+		{
+			name:     "method call without its receiver",
+			main:     concat(Make(OpNull), Make(OpCallMethod, 1, 1, 0), Make(OpPop)),
+			expected: "invalid bytecode in main at 0001: OpCallMethod pops 2 values of 1",
+		},
+		{
+			name:     "method named by a constant of the wrong kind",
+			main:     concat(Make(OpNull), Make(OpNull), Make(OpDefineMethod, 0), Make(OpPop)),
+			expected: "invalid bytecode in main at 0002: OpDefineMethod uses constant 0, which is not a string",
+		},
+		{
+			name:     "return from the main program",
+			main:     concat(Make(OpReturn)),
+			expected: "invalid bytecode in main at 0000: OpReturn outside of a function",
+		},
+		{
+			name:     "locals of the main program",
+			main:     concat(Make(OpGetLocal, 0), Make(OpPop)),
+			expected: "invalid bytecode in main at 0000: OpGetLocal uses local 0 of 0",
+		},
+		{
+			name:      "local out of range",
+			constants: Constants{function(1, Make(OpGetLocal, 1), Make(OpReturnValue))},
+			expected:  "invalid bytecode in f (constant 0) at 0000: OpGetLocal uses local 1 of 1",
+		},
+		{
+			name:      "pattern binding a local out of range",
+			main:      concat(Make(OpNull), Make(OpMatch, 0), Make(OpPop)),
+			constants: Constants{{Kind: PatternConstant, Locals: []int{0}}},
+			expected:  "invalid bytecode in main at 0001: OpMatch uses local 0 of 0",
+		},
+		{
+			name:      "values pushed by destructuring",
+			constants: Constants{{Kind: PatternConstant, Values: 2}, function(2, Make(OpNull), Make(OpDestructure, 0), Make(OpSetLocal, 1), Make(OpReturnValue))},
+			expected:  "",
+		},
+		{
+			name:      "function without a return",
+			constants: Constants{function(0, Make(OpNull), Make(OpPop))},
+			expected:  "invalid bytecode in f (constant 0) at 0001: the function ends without a return",
+		},
+		{
+			name:      "function that is not to be checked",
+			constants: Constants{function(0, Make(OpNull), Make(OpPop))},
+			functions: []int{},
+		},
+	}
+
+	for _, tt := range tests {
+		program := Bytecode{
+			Main:        Function{Name: "main", Instructions: tt.main, Handlers: tt.handlers},
+			Constants:   constants,
+			NumBuiltins: 3,
+		}
+		if tt.constants != nil {
+			program.Constants = tt.constants
+		}
+
+		program.Functions = tt.functions
+		if program.Functions == nil {
+			for i, c := range program.Constants.(Constants) {
+				if c.Kind == FunctionConstant {
+					program.Functions = append(program.Functions, i)
+				}
+			}
+		}
+
+		err := Verify(program)
+		if tt.expected == "" {
+			assert.NoError(t, err, tt.name)
+			continue
+		}
+
+		if assert.Error(t, err, tt.name) {
+			assert.Equal(t, tt.expected, err.Error(), tt.name)
+			assert.IsType(t, &VerifyError{}, err, tt.name)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package compiler
+
+import (
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/code"
+	"github.com/marmotini/ngiri-lang/object"
+)
+
+// compileParameters binds the parameters of the function being compiled.
+// The VM passes the arguments in the first locals, one per parameter, and
+// leaves those of defaulted parameters the call did not pass unset:
+//
+//	OpJumpIfBound l target; <default>; OpSetLocal l
+//	target:
+//
+// Parameter names are bound one after the other, so a default value sees
+// the parameters before it and not those after it, like in the interpreter.
+func (c *Compiler) compileParameters(params []ast.Expression) error {
+	symbols := make([]Symbol, len(params))
+	for i := range params {
+		symbols[i] = c.symbolTable.DefineHidden()
+	}
+
+	for i, p := range params {
+		symbol := symbols[i]
+
+		if d, ok := p.(*ast.DefaultParameter); ok {
+			jump := c.emit(code.OpJumpIfBound, symbol.Index, 9999)
+
+			err := c.Compile(d.Value)
+			if err != nil {
+				return err
+			}
+
+			c.setSymbol(symbol)
+			c.changeOperand(jump, symbol.Index, len(c.currentInstructions()))
+
+			p = d.Parameter
+		}
+
+		if rest, ok := p.(*ast.SpreadExpression); ok {
+			p = rest.Value
+		}
+
+		if ident, ok := p.(*ast.Identifier); ok {
+			symbol.Name = ident.Value
+			c.symbolTable.Bind(ident.Value, symbol)
+			continue
+		}
+
+		c.getSymbol(symbol)
+
+		err := c.compileDestructure(p, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// compileCall compiles a call. Calls with spread or named arguments pass
+// their shape to the VM along with the arguments, see object.CallShape.
+func (c *Compiler) compileCall(node *ast.CallExpression) error {
+	if sel, ok := node.Function.(*ast.SelectorExpression); ok && !c.isModuleSelector(sel) && plainArguments(node.Arguments) {
+		return c.compileMethodCall(sel, node.Arguments)
+	}
+
+	err := c.Compile(node.Function)
+	if err != nil {
+		return err
+	}
+
+	shape := &object.CallShape{}
+
+	for i, a := range node.Arguments {
+		switch a := a.(type) {
+		case *ast.SpreadExpression:
+			shape.Spreads = append(shape.Spreads, i)
+			err = c.Compile(a.Value)
+		case *ast.NamedArgument:
+			shape.Names = append(shape.Names, a.Name.Value)
+			err = c.Compile(a.Value)
+		default:
+			err = c.Compile(a)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if shape.Spreads == nil && shape.Names == nil {
+		c.emit(code.OpCall, len(node.Arguments))
+		return nil
+	}
+
+	c.emit(code.OpCallShaped, len(node.Arguments), c.addConstant(shape))
+
+	return nil
+}
+
+// plainArguments reports whether args has no spread or named arguments.
+func plainArguments(args []ast.Expression) bool {
+	for _, a := range args {
+		switch a.(type) {
+		case *ast.SpreadExpression, *ast.NamedArgument:
+			return false
+		}
+	}
+
+	return true
+}
+
+// markTailCalls turns the calls of the current function whose value it
+// returns right away into OpTailCall, which reuses the function's frame
+// for the callee. A call is in tail position when OpReturnValue follows it,
+// directly or through jumps, like the call in
+//
+//	fn(n) { if (n == 0) { 0 } else { f(n - 1) } }
+//
+// Calls in try blocks are not, their frame holds the handler.
+func (c *Compiler) markTailCalls() {
+	ins := c.currentInstructions()
+
+	for _, pos := range c.scopes[c.scopeIndex].calls {
+		_, _, read, _ := code.ReadInstruction(ins[pos:])
+
+		next := pos + read
+		for code.OpCode(ins[next]) == code.OpJump {
+			next = int(code.ReadUint16(ins[next+1:]))
+		}
+
+		if code.OpCode(ins[next]) != code.OpReturnValue {
+			continue
+		}
+
+		if code.OpCode(ins[pos]) == code.OpWide {
+			pos++
+		}
+		ins[pos] = byte(code.OpTailCall)
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/builtin"
 	"github.com/marmotini/ngiri-lang/code"
+	"github.com/marmotini/ngiri-lang/module"
 	"github.com/marmotini/ngiri-lang/object"
+	"github.com/marmotini/ngiri-lang/pattern"
 )
 
 type Compiler struct {
@@ -13,12 +16,40 @@ type Compiler struct {
 	symbolTable *SymbolTable
 	scopes      []CompilationScope
 	scopeIndex  int
+
+	loader *module.Loader
+	dir    string
+	module *compiledModule
+
+	// optimization is the level set with SetOptimization and constantIndex
+	// the position of every integer and string in constants once it is 1.
+	optimization  int
+	constantIndex map[interface{}]int
+
+	// fieldSlots is the position of every field name in the first struct
+	// declared with it, the slot OpGetField and OpSetField try first.
+	fieldSlots map[string]int
+	// methodCalls numbers the OpCallMethod call sites.
+	methodCalls int
+
+	// err is the first limit the program breaks, see limitError. It is
+	// returned once the program is compiled.
+	err error
 }
 
 type CompilationScope struct {
 	instructions        code.Instructions
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+	handlers            []object.Handler
+	// finally holds the finally blocks of the try expressions being
+	// compiled, innermost last. Returns run them before leaving.
+	finally []*ast.BlockStatement
+	// tries counts the try regions, from OpTry to OpEndTry, the next
+	// instruction is in. calls are the positions of the OpCall
+	// instructions outside of them, see markTailCalls.
+	tries int
+	calls []int
 }
 
 type EmittedInstruction struct {
@@ -38,6 +69,9 @@ func NewCompiler() *Compiler {
 		symbolTable: NewSymbolTable(),
 		scopes:      []CompilationScope{mainScope},
 		scopeIndex:  0,
+
+		loader: module.NewLoader(module.NewResolver()),
+		dir:    ".",
 	}
 }
 
@@ -52,12 +86,18 @@ func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
 func (c *Compiler) Compile(node ast.Node) error {
 	switch node := node.(type) {
 	case *ast.Program:
+		if c.optimization > 0 {
+			node = fold(node).(*ast.Program)
+		}
+
 		for _, s := range node.Statements {
 			err := c.Compile(s)
 			if err != nil {
 				return err
 			}
 		}
+
+		return c.err
 	case *ast.ExpressionStatement:
 		err := c.Compile(node.Expression)
 		if err != nil {
@@ -80,6 +120,12 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return fmt.Errorf("unkown operator %s", node.Operator)
 		}
 	case *ast.IfExpression:
+		if c.optimization > 0 {
+			if block, ok := c.liveBranch(node); ok {
+				return c.compileBranch(block)
+			}
+		}
+
 		err := c.Compile(node.Condition)
 		if err != nil {
 			return err
@@ -87,15 +133,11 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
 
-		err = c.Compile(node.Consequence)
+		err = c.compileBlockValue(node.Consequence)
 		if err != nil {
 			return err
 		}
 
-		if c.lastInstructionIs(code.OpPop) {
-			c.removeLastPop()
-		}
-
 		// Emit an opJump with a bogus value
 		jumpPos := c.emit(code.OpJump, 9999)
 
@@ -105,26 +147,19 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if node.Alternative == nil {
 			c.emit(code.OpNull)
 		} else {
-			err := c.Compile(node.Alternative)
+			err := c.compileBlockValue(node.Alternative)
 			if err != nil {
 				return err
 			}
-
-			if c.lastInstructionIs(code.OpPop) {
-				c.removeLastPop()
-			}
-
 		}
 
 		afterAlternativePos := len(c.currentInstructions())
 		c.changeOperand(jumpPos, afterAlternativePos)
 	case *ast.BlockStatement:
-		for _, s := range node.Statements {
-			err := c.Compile(s)
-			if err != nil {
-				return err
-			}
-		}
+		c.enterBlock()
+		defer c.leaveBlock()
+
+		return c.compileStatements(node.Statements)
 	case *ast.InfixExpression:
 		if node.Operator == "<" {
 			err := c.Compile(node.Right)
@@ -182,36 +217,76 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpFalse)
 		}
 	case *ast.LetStatement:
-		err := c.Compile(node.Value)
+		// Global functions are bound before their body is compiled so that
+		// they can call themselves.
+		var symbol Symbol
+		var err error
+		_, isFn := node.Value.(*ast.FunctionExpression)
+		isFn = isFn && c.symbolTable.global() && node.Name != nil
+		if isFn {
+			symbol, err = c.symbolTable.Declare(node.Name.Value, node.Const())
+			if err != nil {
+				return err
+			}
+		}
+
+		err = c.Compile(node.Value)
 		if err != nil {
 			return err
 		}
 
-		symbol := c.symbolTable.Define(node.Name.Value)
-		if symbol.Scope == GlobalScope {
-			c.emit(code.OpSetGlobal, symbol.Index)
-		} else {
-			c.emit(code.OpSetLocal, symbol.Index)
+		if node.Pattern != nil {
+			return c.compileDestructure(node.Pattern, node.Const())
 		}
+
+		if !isFn {
+			symbol, err = c.symbolTable.Declare(node.Name.Value, node.Const())
+			if err != nil {
+				return err
+			}
+		}
+
+		c.setSymbol(symbol)
+	case *ast.AssignExpression:
+		return c.compileAssign(node)
 	case *ast.Identifier:
 		symbol, ok := c.symbolTable.Resolve(node.Value)
 		if !ok {
-			return fmt.Errorf("undefined variable %s", node.Value)
+			return c.compileBuiltin(node)
+		}
+
+		if symbol.Scope == ModuleScope {
+			return fmt.Errorf("module %s can only be used to select its exports, e.g. %s.name", node.Value, node.Value)
 		}
 
-		if symbol.Scope == GlobalScope {
+		switch symbol.Scope {
+		case GlobalScope:
 			c.emit(code.OpGetGlobal, symbol.Index)
-		} else {
+		case BuiltinScope:
+			c.emit(code.OpGetBuiltin, symbol.Index)
+		default:
 			c.emit(code.OpGetLocal, symbol.Index)
 		}
+	case *ast.MacroLiteral:
+		// Macros are defined and expanded before the program is compiled.
+		return fmt.Errorf("macro literals are only allowed in top-level let statements")
 	case *ast.FunctionExpression:
+		if c.optimization > 2 {
+			ok, err := c.compileSSA(node)
+			if ok || err != nil {
+				return err
+			}
+		}
+
 		c.enterScope()
 
-		for _, p := range node.Parameters {
-			c.symbolTable.Define(p.Value)
+		err := c.compileParameters(node.Parameters)
+		if err != nil {
+			return err
 		}
 
-		err := c.Compile(node.Body)
+		// The body shares the scope of the parameters.
+		err = c.compileStatements(node.Body.Statements)
 		if err != nil {
 			return err
 		}
@@ -224,43 +299,245 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpReturn)
 		}
 
-		numLocals := c.symbolTable.numDefinitions
-		instructions := c.leaveScope()
-
-		compiledFn := &object.CompiledFunction{Instructions: instructions, NumLocals: numLocals, NumParameters: len(node.Parameters)}
-		c.emit(code.OpConstant, c.addConstant(compiledFn))
+		return c.leaveFunction(node)
 	case *ast.CallExpression:
-		err := c.Compile(node.Function)
+		if c.isQuoteCall(node) {
+			return c.compileQuote(node.Arguments[0])
+		}
+
+		return c.compileCall(node)
+	case *ast.ImportStatement:
+		return c.compileImport(node)
+	case *ast.ExportStatement:
+		return c.compileExport(node)
+	case *ast.SelectorExpression:
+		return c.compileSelector(node)
+	case *ast.StructStatement:
+		return c.compileStruct(node)
+	case *ast.StructLiteral:
+		return c.compileStructLiteral(node)
+	case *ast.FieldAssignExpression:
+		return c.compileFieldAssign(node)
+	case *ast.ImplStatement:
+		return c.compileImpl(node)
+	case *ast.EnumStatement:
+		return c.compileEnum(node)
+	case *ast.TryExpression:
+		return c.compileTry(node)
+	case *ast.ReturnStatement:
+		if c.scopeIndex == 0 && c.module != nil {
+			return fmt.Errorf("return at the top level of module %s", c.module.name)
+		}
+
+		err := c.Compile(node.ReturnValue)
+		if err != nil {
+			return err
+		}
+
+		return c.emitReturn()
+	case *ast.PropagateExpression:
+		if c.scopeIndex == 0 && c.module != nil {
+			return fmt.Errorf("operator ? at the top level of module %s", c.module.name)
+		}
+
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+
+		// OpPropagate unwraps ok and some and jumps over the return.
+		propagatePos := c.emit(code.OpPropagate, 9999)
+
+		err = c.emitReturn()
+		if err != nil {
+			return err
+		}
+
+		c.changeOperand(propagatePos, len(c.currentInstructions()))
+	case *ast.ThrowStatement:
+		err := c.Compile(node.Value)
 		if err != nil {
 			return err
 		}
 
-		for _, a := range node.Arguments {
-			err = c.Compile(a)
-			if err != nil{
+		c.emit(code.OpThrow)
+	case *ast.ListLiteral:
+		for _, e := range node.Elements {
+			err := c.Compile(e)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpArray, len(node.Elements))
+	case *ast.HashLiteral:
+		for i, k := range node.Keys {
+			err := c.Compile(k)
+			if err != nil {
 				return err
 			}
+
+			err = c.Compile(node.Values[i])
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpHash, 2*len(node.Keys))
+	case *ast.IndexExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(node.Index)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpIndex)
+	case *ast.MatchExpression:
+		return c.compileMatch(node)
+	}
+
+	return nil
+}
+
+// compileStatements compiles statements in the current scope.
+func (c *Compiler) compileStatements(statements []ast.Statement) error {
+	for _, s := range statements {
+		err := c.Compile(s)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// compileAssign stores the value of an assignment in its variable and
+// leaves it on the stack as the value of the assignment. Constants,
+// builtins and modules can not be assigned.
+func (c *Compiler) compileAssign(node *ast.AssignExpression) error {
+	name := node.Name.Value
+
+	symbol, ok := c.symbolTable.Resolve(name)
+	switch {
+	case !ok:
+		if _, _, ok := builtin.Lookup(name); ok {
+			return fmt.Errorf("cannot assign to builtin %s", name)
+		}
+		return fmt.Errorf("undefined variable %s", name)
+	case symbol.Const:
+		return fmt.Errorf("cannot assign to constant %s", name)
+	case symbol.Scope == BuiltinScope:
+		return fmt.Errorf("cannot assign to builtin %s", name)
+	case symbol.Scope == ModuleScope:
+		return fmt.Errorf("cannot assign to module %s", name)
+	}
+
+	err := c.Compile(node.Value)
+	if err != nil {
+		return err
+	}
+
+	c.setSymbol(symbol)
+	c.getSymbol(symbol)
+
+	return nil
+}
+
+// compileBuiltin compiles an identifier the program does not bind. Builtins
+// whose capability the linked policy does not allow are an error.
+func (c *Compiler) compileBuiltin(node *ast.Identifier) error {
+	index, b, ok := builtin.Lookup(node.Value)
+	if !ok {
+		return fmt.Errorf("undefined variable %s", node.Value)
+	}
+
+	if c.symbolTable.linked() {
+		return builtin.DisabledError(b)
+	}
+
+	c.emit(code.OpGetBuiltin, index)
+
+	return nil
+}
+
+// isQuoteCall reports whether node is a call of the quote builtin rather than
+// of a user binding named quote.
+func (c *Compiler) isQuoteCall(node *ast.CallExpression) bool {
+	ident, ok := node.Function.(*ast.Identifier)
+	if !ok || ident.Value != "quote" || len(node.Arguments) != 1 {
+		return false
+	}
+
+	_, defined := c.symbolTable.Resolve(ident.Value)
+
+	return !defined
+}
+
+// compileQuote stores the quoted node as a constant. Unquoting needs the
+// values of the enclosing scope at the time quote runs, which is only
+// supported by the interpreter and inside macros.
+func (c *Compiler) compileQuote(node ast.Expression) error {
+	var unquote *ast.CallExpression
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpression); ok && call.Function.TokenLiteral() == "unquote" {
+			unquote = call
 		}
-		c.emit(code.OpCall, len(node.Arguments))
+
+		return unquote == nil
+	})
+
+	if unquote != nil {
+		return fmt.Errorf("unquote outside of a macro is not supported by the compiler: %s", unquote)
 	}
 
+	c.emit(code.OpConstant, c.addConstant(&object.Quote{Node: node}))
+
 	return nil
 }
 
 func (c *Compiler) addConstant(obj object.Object) int {
+	if c.optimization > 0 {
+		return c.addSharedConstant(obj)
+	}
+
 	c.constants = append(c.constants, obj)
 	return len(c.constants) - 1
 }
 
 func (c *Compiler) emit(op code.OpCode, operands ...int) int {
+	c.checkLimits(op, operands)
+
 	ins := code.Make(op, operands...)
 	pos := c.addInstruction(ins)
 
 	c.setLastInstruction(op, pos)
 
+	scope := &c.scopes[c.scopeIndex]
+	switch {
+	case op == code.OpTry:
+		scope.tries++
+	case op == code.OpEndTry:
+		scope.tries--
+	case op == code.OpCall && scope.tries == 0:
+		scope.calls = append(scope.calls, pos)
+	}
+
 	return pos
 }
 
+// checkLimits records the limit an instruction breaks when its operands do
+// not fit.
+func (c *Compiler) checkLimits(op code.OpCode, operands []int) {
+	if c.err == nil && !code.Fits(op, operands...) {
+		c.err = limitError(op, operands)
+	}
+}
+
 func (c *Compiler) currentInstructions() code.Instructions {
 	return c.scopes[c.scopeIndex].instructions
 }
@@ -315,9 +592,11 @@ func (c *Compiler) replaceLastPopWithReturn() {
 	c.scopes[c.scopeIndex].lastInstruction.OpCode = code.OpReturnValue
 }
 
-func (c *Compiler) changeOperand(opPos int, operand int) {
+func (c *Compiler) changeOperand(opPos int, operands ...int) {
 	op := code.OpCode(c.currentInstructions()[opPos])
-	newInstruction := code.Make(op, operand)
+	c.checkLimits(op, operands)
+
+	newInstruction := code.Make(op, operands...)
 
 	c.replaceInstruction(opPos, newInstruction)
 }
@@ -334,6 +613,42 @@ func (c *Compiler) enterScope() {
 	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
 }
 
+// enterBlock enters the scope of a block, whose names are not visible once
+// leaveBlock leaves it.
+func (c *Compiler) enterBlock() {
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveBlock() {
+	c.symbolTable = c.symbolTable.Outer
+}
+
+// leaveFunction leaves the scope of the function node once its body is
+// compiled and emits the compiled function.
+func (c *Compiler) leaveFunction(node *ast.FunctionExpression) error {
+	c.markTailCalls()
+
+	numLocals := c.symbolTable.numDefinitions
+	handlers := c.scopes[c.scopeIndex].handlers
+	instructions := c.leaveScope()
+
+	if c.optimization > 1 {
+		instructions, handlers = peephole(instructions, handlers, true)
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		Name:          node.Name,
+		Signature:     object.NewSignature(node.Name, node.Parameters),
+		Handlers:      handlers,
+	}
+	c.emit(code.OpConstant, c.addConstant(compiledFn))
+
+	return nil
+}
+
 func (c *Compiler) leaveScope() code.Instructions {
 	ins := c.currentInstructions()
 
@@ -345,15 +660,107 @@ func (c *Compiler) leaveScope() code.Instructions {
 }
 
 func (c *Compiler) Bytecode() *Bytecode {
+	instructions := c.currentInstructions()
+	handlers := c.scopes[c.scopeIndex].handlers
+
+	if c.optimization > 1 {
+		instructions, handlers = peephole(instructions, handlers, false)
+	}
+
 	return &Bytecode{
-		Instructions: c.currentInstructions(),
+		Instructions: instructions,
 		Constants:    c.constants,
+		Handlers:     handlers,
 	}
 }
 
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	// Handlers is the exception handler table of the main program.
+	Handlers []object.Handler
+
+	verified bool
+}
+
+// Verify checks that the VM can run b, see code.Verify. Bytecode and
+// functions that passed are not verified again.
+func (b *Bytecode) Verify() error {
+	if b.verified {
+		return nil
+	}
+
+	var functions []int
+	for i, c := range b.Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok && !fn.Verified {
+			functions = append(functions, i)
+		}
+	}
+
+	err := code.Verify(code.Bytecode{
+		Main:        code.Function{Name: "main", Instructions: b.Instructions, Handlers: catches(b.Handlers)},
+		Constants:   constantPool(b.Constants),
+		Functions:   functions,
+		NumBuiltins: len(builtin.Builtins),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, i := range functions {
+		b.Constants[i].(*object.CompiledFunction).Verified = true
+	}
+	b.verified = true
+
+	return nil
+}
+
+// constantPool describes a constant pool to code.Verify one entry at a time,
+// so verifying a small program sharing the constants of a large one, like
+// ngiri.Runtime.Call does, does not cost as much as the large one.
+type constantPool []object.Object
+
+func (p constantPool) Len() int { return len(p) }
+
+func (p constantPool) Constant(index int) code.Constant {
+	switch c := p[index].(type) {
+	case *object.String:
+		return code.Constant{Kind: code.StringConstant}
+	case *object.CompiledFunction:
+		if c.Verified {
+			return code.Constant{Kind: code.FunctionConstant}
+		}
+
+		return code.Constant{Kind: code.FunctionConstant, Function: &code.Function{
+			Name:          c.Name,
+			Instructions:  c.Instructions,
+			NumLocals:     c.NumLocals,
+			NumParameters: c.NumParameters,
+			Handlers:      catches(c.Handlers),
+		}}
+	case *object.Pattern:
+		constant := code.Constant{Kind: code.PatternConstant, Values: len(pattern.Bindings(c.Node))}
+		if c.Local {
+			constant.Locals = c.Slots
+		}
+
+		return constant
+	case *object.CallShape:
+		return code.Constant{Kind: code.CallShapeConstant, Values: len(c.Names)}
+	case *object.StructShape:
+		return code.Constant{Kind: code.StructShapeConstant, Values: len(c.Slots)}
+	}
+
+	return code.Constant{Kind: code.ValueConstant}
+}
+
+func catches(handlers []object.Handler) []int {
+	offsets := make([]int, len(handlers))
+	for i, h := range handlers {
+		offsets[i] = h.Catch
+	}
+
+	return offsets
 }
 
 func (b *Bytecode) String() string {
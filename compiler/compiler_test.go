@@ -2,9 +2,14 @@ package compiler
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/builtin"
 	"github.com/marmotini/ngiri-lang/code"
 	"github.com/marmotini/ngiri-lang/lexer"
 	"github.com/marmotini/ngiri-lang/object"
@@ -259,7 +264,7 @@ func TestFunctions(t *testing.T) {
 }
 
 func TestArrayLiterals(t *testing.T) {
-	_ = []compilerTestCase{
+	tests := []compilerTestCase{
 		{
 			input:             "[]",
 			expectedConstants: []interface{}{},
@@ -298,7 +303,274 @@ func TestArrayLiterals(t *testing.T) {
 		},
 	}
 
-	//runCompilerTests(t, tests)
+	runCompilerTests(t, tests)
+}
+
+func TestHashLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "{}",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpHash, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "{1: 2, 3: 4 * 5}",
+			expectedConstants: []interface{}{1, 2, 3, 4, 5},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpMul),
+				code.Make(code.OpHash, 4),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestIndexExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "[1, 2][1 + 1]",
+			expectedConstants: []interface{}{1, 2, 1, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpAdd),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let [a, ...b] = [1];",
+			expectedConstants: []interface{}{1, &object.Pattern{}},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpDestructure, 1),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+		{
+			input: "fn(n, [x]) { x }",
+			expectedConstants: []interface{}{
+				&object.Pattern{},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpDestructure, 0),
+					code.Make(code.OpSetLocal, 2),
+					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestCallArguments(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn(x, y = 2) { y }",
+			expectedConstants: []interface{}{
+				2,
+				[]code.Instructions{
+					code.Make(code.OpJumpIfBound, 1, 9),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "let f = fn(...a) { a }; f(...[1], x: 2)",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+				2,
+				&object.CallShape{Spreads: []int{0}, Names: []string{"x"}},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCallShaped, 2, 3),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "let f = fn() { f() };",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpTailCall, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+		{
+			input: "fn() { len(1); len(2) }",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpGetBuiltin, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpPop),
+					code.Make(code.OpGetBuiltin, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { if (true) { len(1) } else { 2 } }",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpTrue),
+					code.Make(code.OpJumpNotTruthy, 14),
+					// 0004
+					code.Make(code.OpGetBuiltin, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpTailCall, 1),
+					// 0011
+					code.Make(code.OpJump, 17),
+					// 0014
+					code.Make(code.OpConstant, 1),
+					// 0017
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "match (1) { x if x > 0 => x, _ => 0 }",
+			expectedConstants: []interface{}{
+				1,
+				&object.Pattern{Slots: []int{1}},
+				0,
+				&object.Pattern{Slots: []int{}},
+				0,
+			},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpMatch, 1),
+				code.Make(code.OpJumpNotTruthy, 31),
+				// 0015
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpGreaterThan),
+				code.Make(code.OpJumpNotTruthy, 31),
+				// 0025
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpJump, 50),
+				// 0031
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpMatch, 3),
+				code.Make(code.OpJumpNotTruthy, 46),
+				// 0040
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpJump, 50),
+				// 0046
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpNoMatch),
+				// 0050
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(a) { match (a) { [h, ...t] => t } }",
+			expectedConstants: []interface{}{
+				&object.Pattern{Slots: []int{2, 3}, Local: true},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpMatch, 0),
+					code.Make(code.OpJumpNotTruthy, 17),
+					code.Make(code.OpGetLocal, 3),
+					code.Make(code.OpJump, 20),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpNoMatch),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
 }
 
 func TestStringExpressions(t *testing.T) {
@@ -558,6 +830,291 @@ func TestIntegerArithmetic(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestQuote(t *testing.T) {
+	program := parse("quote(1 + x)")
+
+	compiler := NewCompiler()
+	assert.NoError(t, compiler.Compile(program))
+
+	bytecode := compiler.Bytecode()
+	assert.NoError(t, testInstructions([]code.Instructions{
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpPop),
+	}, bytecode.Instructions))
+
+	quote, ok := bytecode.Constants[0].(*object.Quote)
+	if assert.True(t, ok, "constant is not a quote") {
+		assert.Equal(t, "(1 + x)", quote.Node.String())
+	}
+
+	err := NewCompiler().Compile(parse("let x = 1; quote(unquote(x))"))
+	assert.EqualError(t, err, "unquote outside of a macro is not supported by the compiler: unquote(x)")
+}
+
+func TestMacroLiterals(t *testing.T) {
+	inputs := []string{
+		"let f = fn() { let m = macro() { quote(1) }; m() };",
+		"let ms = [macro() { quote(1) }];",
+		"if (true) { let m = macro() { quote(1) }; }",
+	}
+
+	for _, input := range inputs {
+		err := NewCompiler().Compile(parse(input))
+		assert.EqualError(t, err, "macro literals are only allowed in top-level let statements", input)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ngiri-modules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "math.ngiri"), []byte("let base = 10; export let ten = base;"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "math"; math`, "module math can only be used to select its exports, e.g. math.name"},
+		{`import "math"; math.base`, "module math does not export base"},
+		{`import "math"; math = 1`, "cannot assign to module math"},
+		{`import {base} from "math";`, "module math does not export base"},
+		{`a.b`, "undefined variable a"},
+		{`fn() { import "math"; }`, `import "math" is only allowed at the top level`},
+		{`if (true) { import "math"; }`, `import "math" is only allowed at the top level`},
+		{`fn() { export let a = 1; }`, "export of a outside of a module's top level"},
+		{`import "nope";`, `module "nope" not found in ` + dir},
+	}
+
+	for _, tt := range tests {
+		compiler := NewCompiler()
+		compiler.SetModulePath(filepath.Join(dir, "main.ngiri"))
+
+		err := compiler.Compile(parse(tt.input))
+		assert.EqualError(t, err, tt.expected, tt.input)
+	}
+}
+
+func TestImportSharesGlobals(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ngiri-modules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "math.ngiri"), []byte("let base = 10; export let ten = base;"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compiler := NewCompiler()
+	compiler.SetModulePath(filepath.Join(dir, "main.ngiri"))
+	assert.NoError(t, compiler.Compile(parse(`let one = 1; import {ten} from "math"; ten`)))
+
+	assert.NoError(t, testInstructions([]code.Instructions{
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpSetGlobal, 0),
+		code.Make(code.OpConstant, 1),
+		code.Make(code.OpSetGlobal, 1),
+		code.Make(code.OpGetGlobal, 1),
+		code.Make(code.OpSetGlobal, 2),
+		code.Make(code.OpGetGlobal, 2),
+		code.Make(code.OpPop),
+	}, compiler.Bytecode().Instructions))
+}
+
+func TestBuiltins(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `len("")`,
+			expectedConstants: []interface{}{""},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `fn() { puts }`,
+			expectedConstants: []interface{}{[]code.Instructions{
+				code.Make(code.OpGetBuiltin, 1),
+				code.Make(code.OpReturnValue),
+			}},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestBuiltinPolicy(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`len("a")`, ""},
+		{`puts("a")`, "puts needs the io capability, which is not allowed"},
+		{`fn() { read_file("/etc/passwd") }`, "read_file needs the fs capability, which is not allowed"},
+		{`let puts = fn(x) { x }; puts("a")`, ""},
+		{`now()`, ""},
+		{`nope()`, "undefined variable nope"},
+	}
+
+	for _, tt := range tests {
+		symbolTable := NewSymbolTable()
+		symbolTable.LinkBuiltins(builtin.NewPolicy(builtin.Time))
+
+		err := NewWithState(symbolTable, []object.Object{}).Compile(parse(tt.input))
+		if tt.expected == "" {
+			assert.NoError(t, err, tt.input)
+		} else {
+			assert.EqualError(t, err, tt.expected, tt.input)
+		}
+	}
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []struct {
+		compilerTestCase
+		handlers []object.Handler
+	}{
+		{
+			compilerTestCase{
+				input:             `try { 1 } catch (e) { 2 }`,
+				expectedConstants: []interface{}{1, 2},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpTry, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpEndTry),
+					code.Make(code.OpJump, 16),
+					code.Make(code.OpSetGlobal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpPop),
+				},
+			},
+			[]object.Handler{{Catch: 10}},
+		},
+		{
+			compilerTestCase{
+				input:             `try { throw "a" } finally { 3 }`,
+				expectedConstants: []interface{}{"a", 3},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpTry, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpThrow),
+					code.Make(code.OpNull),
+					code.Make(code.OpEndTry),
+					code.Make(code.OpJump, 16),
+					code.Make(code.OpTrue),
+					code.Make(code.OpJump, 17),
+					code.Make(code.OpFalse),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpPop),
+					code.Make(code.OpJumpNotTruthy, 25),
+					code.Make(code.OpThrow),
+					code.Make(code.OpPop),
+				},
+			},
+			[]object.Handler{{Catch: 12}},
+		},
+	}
+
+	for _, tt := range tests {
+		runCompilerTests(t, []compilerTestCase{tt.compilerTestCase})
+
+		compiler := NewCompiler()
+		assert.NoError(t, compiler.Compile(parse(tt.input)))
+		assert.Equal(t, tt.handlers, compiler.Bytecode().Handlers, tt.input)
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn() { return 1; 2 }`,
+			expectedConstants: []interface{}{1, 2, []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpReturnValue),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpReturnValue),
+			}},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(r) { r? }`,
+			expectedConstants: []interface{}{[]code.Instructions{
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpPropagate, 6),
+				code.Make(code.OpReturnValue),
+				code.Make(code.OpReturnValue),
+			}},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { try { return 1 } finally { 2 } }`,
+			expectedConstants: []interface{}{1, 2, 2, []code.Instructions{
+				code.Make(code.OpTry, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpReturnValue),
+				code.Make(code.OpNull),
+				code.Make(code.OpEndTry),
+				code.Make(code.OpJump, 20),
+				code.Make(code.OpTrue),
+				code.Make(code.OpJump, 21),
+				code.Make(code.OpFalse),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpPop),
+				code.Make(code.OpJumpNotTruthy, 29),
+				code.Make(code.OpThrow),
+				code.Make(code.OpReturnValue),
+			}},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+
+	compiler := NewCompiler()
+	compiler.module = &compiledModule{name: "lib"}
+	assert.EqualError(t, compiler.Compile(parse(`return 1;`)), "return at the top level of module lib")
+}
+
+func TestErrorFields(t *testing.T) {
+	runCompilerTests(t, []compilerTestCase{
+		{
+			input:             `error("boom").message`,
+			expectedConstants: []interface{}{"boom", "message"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 8),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpGetField, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	})
+}
+
 func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 	t.Helper()
 
@@ -622,6 +1179,24 @@ func testConstants(t *testing.T, expected []interface{}, actual []object.Object)
 				return fmt.Errorf("constant %d - testStringObject failed: %s", i, err)
 			}
 
+		case *object.Pattern:
+			p, ok := actual[i].(*object.Pattern)
+			if !ok {
+				return fmt.Errorf("constant %d - not a pattern: %T", i, actual[i])
+			}
+
+			if !reflect.DeepEqual(constant.Slots, p.Slots) || constant.Local != p.Local {
+				return fmt.Errorf("constant %d - wrong pattern slots. want=%v %t, got=%v %t",
+					i, constant.Slots, constant.Local, p.Slots, p.Local)
+			}
+		case *object.CallShape:
+			if !reflect.DeepEqual(constant, actual[i]) {
+				return fmt.Errorf("constant %d - wrong call shape. want=%s, got=%s", i, constant.Inspect(), actual[i].Inspect())
+			}
+		case object.Object:
+			if !reflect.DeepEqual(constant, actual[i]) {
+				return fmt.Errorf("constant %d - wrong constant. want=%s, got=%s", i, constant.Inspect(), actual[i].Inspect())
+			}
 		case []code.Instructions:
 			fn, ok := actual[i].(*object.CompiledFunction)
 			if !ok {
@@ -663,3 +1238,228 @@ func testIntegerObject(expected int64, actual object.Object) error {
 
 	return nil
 }
+
+func TestBlockScopes(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// The x of the block gets a global of its own, the x after
+			// the block is the first one again.
+			input:             "let x = 1; if (true) { let x = 2; x }; x",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 22),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpJump, 23),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "fn(x) { if (x) { let y = 1; y } else { let y = 2; y } }",
+			expectedConstants: []interface{}{1, 2, []code.Instructions{
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpJumpNotTruthy, 15),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetLocal, 1),
+				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpJump, 22),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetLocal, 2),
+				code.Make(code.OpGetLocal, 2),
+				code.Make(code.OpReturnValue),
+			}},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let x = 1; x = x + 1",
+			expectedConstants: []interface{}{1, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestDeclarationErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if (true) { let y = 1 }; y", "undefined variable y"},
+		{"let x = 1; let x = 2;", "x is already declared in this scope"},
+		{"fn(x) { let x = 1 }", "x is already declared in this scope"},
+		{"let [a, a] = [1, 2];", "a is already declared in this scope"},
+		{"try { 1 } catch (e) { let e = 2 }", "e is already declared in this scope"},
+		{"match (1) { n => { let n = 2 } }", "n is already declared in this scope"},
+		{"const x = 1; x = 2", "cannot assign to constant x"},
+		{"const [a, b] = [1, 2]; fn() { b = 3 }", "cannot assign to constant b"},
+		{"const f = fn() { f = 1 };", "cannot assign to constant f"},
+		{"y = 1", "undefined variable y"},
+		{"len = 1", "cannot assign to builtin len"},
+	}
+
+	for _, tt := range tests {
+		compiler := NewCompiler()
+
+		err := compiler.Compile(parse(tt.input))
+		assert.EqualError(t, err, tt.expected, tt.input)
+	}
+}
+
+func TestStructs(t *testing.T) {
+	point := &object.StructType{Name: "Point", Fields: []string{"x", "y"}}
+
+	tests := []compilerTestCase{
+		{
+			input:             "struct Point { x, y }; Point{y: 2, x: 1}.y",
+			expectedConstants: []interface{}{point, 2, 1, &object.StructShape{Struct: point, Slots: []int{1, 0}}, "y"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpStruct, 3),
+				code.Make(code.OpGetField, 4, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "struct Point { x, y }; let p = Point{}; p.x = 3",
+			expectedConstants: []interface{}{point, &object.StructShape{Struct: point, Slots: []int{}}, 3, "x"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpStruct, 1),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpSetField, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestMethods(t *testing.T) {
+	p := &object.StructType{Name: "P", Fields: []string{"x"}}
+
+	tests := []compilerTestCase{
+		{
+			input: "struct P { x }; impl P { fn get(self) { self.x } }; P{}.get(1)",
+			expectedConstants: []interface{}{
+				p,
+				"x",
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetField, 1, 0),
+					code.Make(code.OpReturnValue),
+				},
+				"get",
+				&object.StructShape{Struct: p, Slots: []int{}},
+				1,
+				"get",
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpDefineMethod, 3),
+				code.Make(code.OpPop),
+				code.Make(code.OpStruct, 4),
+				code.Make(code.OpConstant, 5),
+				code.Make(code.OpCallMethod, 6, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `"a".upper(); [].len(...[])`,
+			expectedConstants: []interface{}{"a", "upper", "len", &object.CallShape{Spreads: []int{0}}},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpCallMethod, 1, 0, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpGetField, 2, 0),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpCallShaped, 1, 3),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestStructErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let P = 1; P{x: 1}", "P is not a struct type"},
+		{"Q{}", "Q is not a struct type"},
+		{"struct P { x }; P{y: 1}", "struct P has no field y"},
+		{"struct P { x }; P = 1", "cannot assign to constant P"},
+		{"let P = 1; struct P { x }", "P is already declared in this scope"},
+		{"let P = 1; impl P { fn f(self) { 1 } }", "P is not a struct type"},
+		{"struct P { x }; impl P { fn x(self) { 1 } }", "struct P already has a field x"},
+		{"enum E { A }; E{}", "E is not a struct type"},
+		{"enum E { A }; impl E { fn f(self) { 1 } }", "E is not a struct type"},
+		{"enum E { A }; E = 1", "cannot assign to constant E"},
+		{"let E = 1; enum E { A }", "E is already declared in this scope"},
+	}
+
+	for _, tt := range tests {
+		compiler := NewCompiler()
+
+		err := compiler.Compile(parse(tt.input))
+		assert.EqualError(t, err, tt.expected, tt.input)
+	}
+}
+
+func TestEnums(t *testing.T) {
+	shape := object.NewEnumType("Shape")
+	shape.AddVariant("Circle", []string{"r"})
+	shape.AddVariant("Empty", []string{})
+
+	tests := []compilerTestCase{
+		{
+			input:             "enum Shape { Circle(r), Empty }; Shape.Circle(1); Shape.Empty",
+			expectedConstants: []interface{}{shape, 1, "Circle", "Empty"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpCallMethod, 2, 1, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpGetField, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
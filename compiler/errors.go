@@ -0,0 +1,186 @@
+package compiler
+
+import (
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/code"
+	"github.com/marmotini/ngiri-lang/object"
+)
+
+// compileTry lays a try expression out as
+//
+//	OpTry h0; <block>; OpEndTry; OpJump finally
+//	h0:      <bind error>; OpTry h1; <catch>; OpEndTry; OpJump finally
+//	h1:      OpTrue; OpJump body
+//	finally: OpFalse
+//	body:    <finally>; OpJumpNotTruthy end; OpThrow
+//	end:
+//
+// The VM jumps to a handler with the thrown error on the stack. The finally
+// block runs once for every way out of the try and catch blocks; the boolean
+// pushed before it tells whether an error has to be rethrown afterwards.
+// Without a finally block the catch block ends the expression, without a
+// catch block h0 goes straight to h1.
+func (c *Compiler) compileTry(node *ast.TryExpression) error {
+	if node.Finally != nil {
+		scope := &c.scopes[c.scopeIndex]
+		scope.finally = append(scope.finally, node.Finally)
+	}
+
+	jumps, err := c.compileTryCatch(node)
+
+	if node.Finally != nil {
+		// compileTryCatch may have grown c.scopes, so the scope is looked
+		// up again.
+		scope := &c.scopes[c.scopeIndex]
+		scope.finally = scope.finally[:len(scope.finally)-1]
+	}
+
+	if err != nil || node.Finally == nil {
+		return err
+	}
+
+	c.emit(code.OpTrue)
+	rethrow := c.emit(code.OpJump, 9999)
+
+	for _, pos := range jumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	c.emit(code.OpFalse)
+
+	c.changeOperand(rethrow, len(c.currentInstructions()))
+
+	err = c.Compile(node.Finally)
+	if err != nil {
+		return err
+	}
+
+	end := c.emit(code.OpJumpNotTruthy, 9999)
+	c.emit(code.OpThrow)
+	c.changeOperand(end, len(c.currentInstructions()))
+
+	return nil
+}
+
+// compileTryCatch compiles the try and catch blocks. It returns the jumps to
+// the finally block, the handler of the finally block is the next
+// instruction.
+func (c *Compiler) compileTryCatch(node *ast.TryExpression) ([]int, error) {
+	jumps := []int{}
+
+	tryHandler := c.addHandler()
+	c.emit(code.OpTry, tryHandler)
+
+	err := c.compileBlockValue(node.Block)
+	if err != nil {
+		return nil, err
+	}
+
+	c.emit(code.OpEndTry)
+	jumps = append(jumps, c.emit(code.OpJump, 9999))
+
+	c.setHandler(tryHandler)
+
+	if node.Catch == nil {
+		return jumps, nil
+	}
+
+	// The error is bound in the scope of the catch block.
+	c.enterBlock()
+	defer c.leaveBlock()
+
+	symbol, err := c.symbolTable.Declare(node.Param.Value, false)
+	if err != nil {
+		return nil, err
+	}
+	c.setSymbol(symbol)
+
+	// The catch block is guarded once the error is bound, so that the
+	// stack is the same on every way into the finally block.
+	catchHandler := -1
+	if node.Finally != nil {
+		catchHandler = c.addHandler()
+		c.emit(code.OpTry, catchHandler)
+	}
+
+	err = c.compileBodyValue(node.Catch)
+	if err != nil {
+		return nil, err
+	}
+
+	if node.Finally == nil {
+		c.changeOperand(jumps[0], len(c.currentInstructions()))
+		return nil, nil
+	}
+
+	c.emit(code.OpEndTry)
+	jumps = append(jumps, c.emit(code.OpJump, 9999))
+
+	c.setHandler(catchHandler)
+
+	return jumps, nil
+}
+
+// emitReturn returns the value on top of the stack from the current
+// function. The finally blocks of the try expressions the return leaves are
+// inlined before it, innermost first.
+func (c *Compiler) emitReturn() error {
+	finally := c.scopes[c.scopeIndex].finally
+
+	// While a finally block is inlined only the blocks around it are
+	// pending, so a return inside of it does not run it again.
+	defer func() { c.scopes[c.scopeIndex].finally = finally }()
+
+	for i := len(finally) - 1; i >= 0; i-- {
+		c.scopes[c.scopeIndex].finally = finally[:i:i]
+
+		err := c.Compile(finally[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	c.emit(code.OpReturnValue)
+
+	return nil
+}
+
+// compileBlockValue compiles block so that it leaves its value on the stack,
+// like the branches of an if expression. Blocks that do not end with an
+// expression evaluate to null.
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	c.enterBlock()
+	defer c.leaveBlock()
+
+	return c.compileBodyValue(block)
+}
+
+// compileBodyValue is compileBlockValue for blocks whose scope is entered
+// already, like that of a catch block, which holds the error.
+func (c *Compiler) compileBodyValue(block *ast.BlockStatement) error {
+	err := c.compileStatements(block.Statements)
+	if err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+
+	return nil
+}
+
+// addHandler adds an entry to the handler table of the current scope. Its
+// target is filled in by setHandler.
+func (c *Compiler) addHandler() int {
+	scope := &c.scopes[c.scopeIndex]
+	scope.handlers = append(scope.handlers, object.Handler{})
+
+	return len(scope.handlers) - 1
+}
+
+// setHandler makes the next instruction the target of handler index.
+func (c *Compiler) setHandler(index int) {
+	c.scopes[c.scopeIndex].handlers[index].Catch = len(c.currentInstructions())
+}
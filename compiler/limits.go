@@ -0,0 +1,36 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/marmotini/ngiri-lang/code"
+)
+
+// limitError returns the error of an instruction whose operands do not fit,
+// even with code.OpWide, naming the limit of the program it breaks.
+func limitError(op code.OpCode, operands []int) error {
+	if index, ok := code.JumpOperand(op); ok && !code.Fits(code.OpJump, operands[index]) {
+		return fmt.Errorf("function too large: a jump to offset %d is beyond the limit of 65535", operands[index])
+	}
+
+	switch op {
+	case code.OpGetLocal, code.OpSetLocal:
+		return fmt.Errorf("too many local variables: a function can have at most 65536")
+	case code.OpJumpIfBound:
+		return fmt.Errorf("too many parameters: only the first 256 can have default values")
+	case code.OpGetGlobal, code.OpSetGlobal:
+		return fmt.Errorf("too many global variables: a program can have at most 65536")
+	case code.OpCall, code.OpTailCall, code.OpCallShaped:
+		return fmt.Errorf("too many arguments: a call can pass at most 65535, got %d", operands[0])
+	case code.OpCallMethod:
+		if !code.Fits(code.OpCall, operands[1]) {
+			return fmt.Errorf("too many arguments: a call can pass at most 65535, got %d", operands[1])
+		}
+		return fmt.Errorf("too many method calls: a program can have at most 65536")
+	case code.OpTry:
+		return fmt.Errorf("too many try expressions: a function can have at most 65536")
+	default:
+		def, _ := code.Lookup(byte(op))
+		return fmt.Errorf("operands %v of %s out of range", operands, def.Name)
+	}
+}
@@ -0,0 +1,122 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/marmotini/ngiri-lang/code"
+	"github.com/marmotini/ngiri-lang/object"
+	"github.com/stretchr/testify/assert"
+)
+
+// sequence joins format applied to 0 up to n-1 with sep. %s in format is
+// a name made of letters, which is all identifiers can have, e.g. "v_bc"
+// for 28: `let %s = %d`.
+func sequence(n int, format, sep string) string {
+	parts := make([]string, n)
+	for i := range parts {
+		parts[i] = strings.NewReplacer("%s", letters(i), "%d", fmt.Sprint(i)).Replace(format)
+	}
+
+	return strings.Join(parts, sep)
+}
+
+func letters(i int) string {
+	name := ""
+	for {
+		name = string('a'+rune(i%26)) + name
+		i /= 26
+		if i == 0 {
+			return "v_" + name
+		}
+	}
+}
+
+func TestWideOperands(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			// The 256th local still fits a byte, the 257th does not.
+			input:    fmt.Sprintf("fn() { %s; %s }", sequence(256, "let %s = 0", "; "), letters(255)),
+			expected: " OpGetLocal 255\n",
+		},
+		{
+			input:    fmt.Sprintf("fn() { %s; %s }", sequence(257, "let %s = 0", "; "), letters(256)),
+			expected: " OpWide OpGetLocal 256\n",
+		},
+		{
+			input:    fmt.Sprintf("fn(f) { f(%s); 1 }", sequence(255, "%d", ", ")),
+			expected: " OpCall 255\n",
+		},
+		{
+			input:    fmt.Sprintf("fn(f) { f(%s); 1 }", sequence(256, "%d", ", ")),
+			expected: " OpWide OpCall 256\n",
+		},
+	}
+
+	for _, tt := range tests {
+		compiler := NewCompiler()
+
+		err := compiler.Compile(parse(tt.input))
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		constants := compiler.Bytecode().Constants
+		fn := constants[len(constants)-1].(*object.CompiledFunction)
+		assert.Contains(t, fn.Instructions.String(), tt.expected)
+	}
+}
+
+func TestWideConstants(t *testing.T) {
+	compiler := NewCompiler()
+
+	err := compiler.Compile(parse(fmt.Sprintf("[%s]", sequence(65537, "%d", ", "))))
+	assert.NoError(t, err)
+
+	bytecode := compiler.Bytecode()
+	assert.Len(t, bytecode.Constants, 65537)
+
+	ins := bytecode.Instructions
+	assert.Equal(t, code.Make(code.OpConstant, 65535), []byte(ins[3*65535:3*65536]))
+	assert.Equal(t, code.Make(code.OpConstant, 65536), []byte(ins[3*65536:3*65536+6]))
+	assert.Equal(t, code.Make(code.OpArray, 65537), []byte(ins[3*65536+6:len(ins)-1]))
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			fmt.Sprintf("fn() { %s }", sequence(65537, "let %s = 0", "; ")),
+			"too many local variables: a function can have at most 65536",
+		},
+		{
+			sequence(65537, "let %s = 0", "; "),
+			"too many global variables: a program can have at most 65536",
+		},
+		{
+			fmt.Sprintf("fn(f) { f(%s) }", sequence(65536, "%d", ", ")),
+			"too many arguments: a call can pass at most 65535, got 65536",
+		},
+		{
+			fmt.Sprintf("fn(x) { if (x) { [%s] } }", sequence(22000, "%d", ", ")),
+			"function too large: a jump to offset 66011 is beyond the limit of 65535",
+		},
+		{
+			fmt.Sprintf("fn(%s, x = 1) { x }", sequence(256, "%s", ", ")),
+			"too many parameters: only the first 256 can have default values",
+		},
+	}
+
+	for _, tt := range tests {
+		compiler := NewCompiler()
+
+		err := compiler.Compile(parse(tt.input))
+		assert.EqualError(t, err, tt.expected, tt.expected)
+	}
+}
@@ -0,0 +1,136 @@
+package compiler
+
+import (
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/code"
+	"github.com/marmotini/ngiri-lang/object"
+	"github.com/marmotini/ngiri-lang/pattern"
+)
+
+// compileMatch lays a match expression out as a chain of arms that jump to
+// the next arm when they do not match:
+//
+//	<subject>; OpSet subject
+//	arm0:  OpGet subject; OpMatch p0; OpJumpNotTruthy arm1
+//	       <guard>; OpJumpNotTruthy arm1; <body>; OpJump end
+//	arm1:  ...
+//	       OpGet subject; OpNoMatch
+//	end:
+//
+// OpMatch stores the values a pattern binds before the guard runs. The
+// subject is kept in a hidden variable.
+func (c *Compiler) compileMatch(node *ast.MatchExpression) error {
+	err := c.Compile(node.Subject)
+	if err != nil {
+		return err
+	}
+
+	subject := c.symbolTable.DefineHidden()
+	c.setSymbol(subject)
+
+	ends := []int{}
+
+	for _, arm := range node.Arms {
+		next, err := c.compileArm(arm, subject)
+		if err != nil {
+			return err
+		}
+
+		ends = append(ends, c.emit(code.OpJump, 9999))
+
+		for _, pos := range next {
+			c.changeOperand(pos, len(c.currentInstructions()))
+		}
+	}
+
+	c.getSymbol(subject)
+	c.emit(code.OpNoMatch)
+
+	for _, pos := range ends {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+
+	return nil
+}
+
+// compileArm compiles the pattern, guard and body of arm, which share a
+// scope, and returns the jumps to take when the arm does not match.
+func (c *Compiler) compileArm(arm *ast.MatchArm, subject Symbol) ([]int, error) {
+	c.enterBlock()
+	defer c.leaveBlock()
+
+	c.getSymbol(subject)
+	c.emit(code.OpMatch, c.addConstant(c.compilePattern(arm.Pattern)))
+
+	next := []int{c.emit(code.OpJumpNotTruthy, 9999)}
+
+	if arm.Guard != nil {
+		err := c.Compile(arm.Guard)
+		if err != nil {
+			return nil, err
+		}
+
+		next = append(next, c.emit(code.OpJumpNotTruthy, 9999))
+	}
+
+	return next, c.compileBodyValue(arm.Body)
+}
+
+// compilePattern defines the identifiers p binds and returns the operand of
+// its OpMatch.
+func (c *Compiler) compilePattern(p ast.Expression) *object.Pattern {
+	compiled := &object.Pattern{Node: p, Slots: []int{}}
+
+	for _, ident := range pattern.Bindings(p) {
+		symbol := c.symbolTable.Define(ident.Value)
+
+		compiled.Slots = append(compiled.Slots, symbol.Index)
+		compiled.Local = symbol.Scope == LocalScope
+	}
+
+	return compiled
+}
+
+func (c *Compiler) setSymbol(symbol Symbol) {
+	if symbol.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, symbol.Index)
+	} else {
+		c.emit(code.OpSetLocal, symbol.Index)
+	}
+}
+
+func (c *Compiler) getSymbol(symbol Symbol) {
+	if symbol.Scope == GlobalScope {
+		c.emit(code.OpGetGlobal, symbol.Index)
+	} else {
+		c.emit(code.OpGetLocal, symbol.Index)
+	}
+}
+
+// compileDestructure binds the identifiers of p to the parts of the value on
+// top of the stack. OpDestructure replaces the value with the bound values,
+// or fails when the value does not have the shape of p, and the values are
+// then stored like let statements store theirs:
+//
+//	OpDestructure p; OpSet tN; ...; OpSet t0
+//
+// The identifiers are declared as constants for const declarations.
+func (c *Compiler) compileDestructure(p ast.Expression, constant bool) error {
+	idents := pattern.Bindings(p)
+	c.emit(code.OpDestructure, c.addConstant(&object.Pattern{Node: p}))
+
+	symbols := make([]Symbol, len(idents))
+	for i, ident := range idents {
+		symbol, err := c.symbolTable.Declare(ident.Value, constant)
+		if err != nil {
+			return err
+		}
+		symbols[i] = symbol
+	}
+
+	for i := len(symbols) - 1; i >= 0; i-- {
+		c.setSymbol(symbols[i])
+	}
+
+	return nil
+}
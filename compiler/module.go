@@ -0,0 +1,182 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/code"
+	"github.com/marmotini/ngiri-lang/module"
+)
+
+// compiledModule is an imported module whose top level has been compiled in
+// place of its first import statement. Its exports are globals.
+type compiledModule struct {
+	name    string
+	exports map[string]Symbol
+}
+
+// moduleTable numbers the modules imported into a program, which ModuleScope
+// symbols index.
+type moduleTable struct {
+	modules []*compiledModule
+	byPath  map[string]int
+}
+
+// moduleTable returns the modules imported into the program of s. They are
+// kept with its global table rather than the Compiler, so that compilers
+// continuing the program with NewWithState, like those of the REPL, see the
+// modules imported before.
+func (s *SymbolTable) moduleTable() *moduleTable {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	if s.globals != nil {
+		s = s.globals
+	}
+
+	if s.modules == nil {
+		s.modules = &moduleTable{byPath: make(map[string]int)}
+	}
+
+	return s.modules
+}
+
+// SetModulePath sets the file the compiled program was read from. Its
+// imports are resolved relative to that file.
+func (c *Compiler) SetModulePath(filename string) {
+	c.dir = module.Dir(filename)
+}
+
+func (c *Compiler) isTopLevel() bool {
+	return c.scopeIndex == 0 && c.symbolTable.Outer == nil
+}
+
+func (c *Compiler) compileImport(node *ast.ImportStatement) error {
+	if !c.isTopLevel() {
+		return fmt.Errorf("import %q is only allowed at the top level", node.Path.Value)
+	}
+
+	m, err := c.loader.Import(node.Path.Value, c.dir, c.compileModule)
+	if err != nil {
+		return err
+	}
+
+	modules := c.symbolTable.moduleTable()
+	index := modules.byPath[m.Path]
+	mod := modules.modules[index]
+
+	if node.Names == nil {
+		c.symbolTable.Bind(node.Namespace(), Symbol{Name: node.Namespace(), Scope: ModuleScope, Index: index})
+		return nil
+	}
+
+	for _, name := range node.Names {
+		symbol, ok := mod.exports[name.Value]
+		if !ok {
+			return fmt.Errorf("module %s does not export %s", mod.name, name.Value)
+		}
+
+		c.symbolTable.Bind(name.Value, symbol)
+	}
+
+	return nil
+}
+
+// compileModule emits the top level of m into the current instructions, with
+// its own global symbol table and import directory. Modules an earlier
+// compiler of the program imported already ran and are not emitted again.
+func (c *Compiler) compileModule(m *module.Module) error {
+	modules := c.symbolTable.moduleTable()
+	if _, ok := modules.byPath[m.Path]; ok {
+		return nil
+	}
+
+	mod := &compiledModule{name: m.Name, exports: make(map[string]Symbol)}
+
+	symbolTable, dir, current := c.symbolTable, c.dir, c.module
+	c.symbolTable = NewModuleSymbolTable(symbolTable)
+	c.dir = module.Dir(m.Path)
+	c.module = mod
+
+	err := c.Compile(m.Program)
+
+	c.symbolTable, c.dir, c.module = symbolTable, dir, current
+
+	if err != nil {
+		return fmt.Errorf("module %s: %s", m.Name, err)
+	}
+
+	modules.byPath[m.Path] = len(modules.modules)
+	modules.modules = append(modules.modules, mod)
+
+	return nil
+}
+
+func (c *Compiler) compileExport(node *ast.ExportStatement) error {
+	if !c.isTopLevel() {
+		return fmt.Errorf("export of %s outside of a module's top level", node.Name().Value)
+	}
+
+	err := c.Compile(node.Statement)
+	if err != nil {
+		return err
+	}
+
+	if c.module != nil {
+		symbol, _ := c.symbolTable.Resolve(node.Name().Value)
+		c.module.exports[symbol.Name] = symbol
+	}
+
+	return nil
+}
+
+// isModuleSelector reports whether node selects an export of an imported
+// module.
+func (c *Compiler) isModuleSelector(node *ast.SelectorExpression) bool {
+	ident, ok := node.Left.(*ast.Identifier)
+	if !ok {
+		return false
+	}
+
+	symbol, ok := c.symbolTable.Resolve(ident.Value)
+
+	return ok && symbol.Scope == ModuleScope
+}
+
+// resolveExport returns the symbol of the export node selects from an
+// imported module.
+func (c *Compiler) resolveExport(node *ast.SelectorExpression) (Symbol, error) {
+	symbol, _ := c.symbolTable.Resolve(node.Left.(*ast.Identifier).Value)
+	mod := c.symbolTable.moduleTable().modules[symbol.Index]
+
+	export, ok := mod.exports[node.Selector.Value]
+	if !ok {
+		return Symbol{}, fmt.Errorf("module %s does not export %s", mod.name, node.Selector.Value)
+	}
+
+	return export, nil
+}
+
+func (c *Compiler) compileSelector(node *ast.SelectorExpression) error {
+	// Fields of other values, like the message of an error, are looked up
+	// at runtime.
+	if !c.isModuleSelector(node) {
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+
+		c.emitField(code.OpGetField, node.Selector.Value)
+
+		return nil
+	}
+
+	export, err := c.resolveExport(node)
+	if err != nil {
+		return err
+	}
+
+	c.emit(code.OpGetGlobal, export.Index)
+
+	return nil
+}
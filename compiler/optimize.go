@@ -0,0 +1,260 @@
+package compiler
+
+import (
+	"strconv"
+
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/code"
+	"github.com/marmotini/ngiri-lang/object"
+	"github.com/marmotini/ngiri-lang/token"
+)
+
+// SetOptimization sets how hard the compiler works on the bytecode it emits.
+// At level 0, the default, every expression is compiled as written. From
+// level 1 constant expressions are folded, branches on constant conditions
+// are dropped and equal integers and strings share one constant. Level 2
+// also runs the peephole pass over the instructions, see peephole. Level 3
+// compiles functions through their SSA form, see compileSSA.
+func (c *Compiler) SetOptimization(level int) {
+	c.optimization = level
+}
+
+// liveBranch returns the block an if expression with a constant condition
+// always runs, nil when that is a missing else. ok is false when the
+// condition is not constant. The other block is dropped: the names it
+// declares are local to it.
+func (c *Compiler) liveBranch(node *ast.IfExpression) (block *ast.BlockStatement, ok bool) {
+	truthy, ok := constantTruthiness(node.Condition)
+	if !ok {
+		return nil, false
+	}
+
+	if truthy {
+		return node.Consequence, true
+	}
+
+	return node.Alternative, true
+}
+
+// compileBranch compiles the live block of an if expression so that it
+// leaves its value on the stack, like the if expression would.
+func (c *Compiler) compileBranch(block *ast.BlockStatement) error {
+	if block == nil {
+		c.emit(code.OpNull)
+		return nil
+	}
+
+	return c.compileBlockValue(block)
+}
+
+// addSharedConstant is addConstant for optimized programs: an integer or a
+// string equal to one already in the pool reuses its index.
+func (c *Compiler) addSharedConstant(obj object.Object) int {
+	if c.constantIndex == nil {
+		c.constantIndex = make(map[interface{}]int)
+		for i, constant := range c.constants {
+			if key, ok := constantKey(constant); ok {
+				if _, seen := c.constantIndex[key]; !seen {
+					c.constantIndex[key] = i
+				}
+			}
+		}
+	}
+
+	key, ok := constantKey(obj)
+	if ok {
+		if index, seen := c.constantIndex[key]; seen {
+			return index
+		}
+	}
+
+	c.constants = append(c.constants, obj)
+	index := len(c.constants) - 1
+
+	if ok {
+		c.constantIndex[key] = index
+	}
+
+	return index
+}
+
+// constantKey returns the key equal constants share in constantIndex. The
+// Go types of the values keep integers and strings apart.
+func constantKey(obj object.Object) (interface{}, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return obj.Value, true
+	case *object.String:
+		return obj.Value, true
+	default:
+		return nil, false
+	}
+}
+
+// fold returns a copy of node with the operators whose operands are literals
+// replaced by the literal they evaluate to, e.g. `2 * 3 + 1` with `7`.
+// Operators that would fail, like division by zero, are left for the program
+// to run into at run time with the usual error. Quoted code is kept as
+// written.
+func fold(node ast.Node) ast.Node {
+	node = ast.Clone(node)
+	quoted := quotedNodes(node)
+
+	return ast.Rewrite(node, func(node ast.Node) ast.Node {
+		if quoted[node] {
+			return node
+		}
+
+		switch node := node.(type) {
+		case *ast.PrefixExpression:
+			if folded := foldPrefix(node); folded != nil {
+				return folded
+			}
+		case *ast.InfixExpression:
+			if folded := foldInfix(node); folded != nil {
+				return folded
+			}
+		}
+
+		return node
+	})
+}
+
+// quotedNodes returns the nodes in the arguments of calls of quote. The
+// program is not resolved yet, so calls of bindings named quote count too.
+func quotedNodes(node ast.Node) map[ast.Node]bool {
+	quoted := map[ast.Node]bool{}
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpression)
+		if !ok {
+			return true
+		}
+
+		if ident, ok := call.Function.(*ast.Identifier); !ok || ident.Value != "quote" {
+			return true
+		}
+
+		for _, arg := range call.Arguments {
+			ast.Inspect(arg, func(n ast.Node) bool {
+				if n != nil {
+					quoted[n] = true
+				}
+				return true
+			})
+		}
+
+		return false
+	})
+
+	return quoted
+}
+
+func foldPrefix(node *ast.PrefixExpression) ast.Expression {
+	switch node.Operator {
+	case "!":
+		truthy, ok := constantTruthiness(node.Right)
+		if ok {
+			return booleanLiteral(node.Token, !truthy)
+		}
+	case "-":
+		if right, ok := node.Right.(*ast.IntegerLiteral); ok {
+			return integerLiteral(node.Token, -right.Value)
+		}
+	}
+
+	return nil
+}
+
+func foldInfix(node *ast.InfixExpression) ast.Expression {
+	switch left := node.Left.(type) {
+	case *ast.IntegerLiteral:
+		right, ok := node.Right.(*ast.IntegerLiteral)
+		if !ok {
+			return nil
+		}
+
+		a, b := left.Value, right.Value
+
+		switch node.Operator {
+		case "+":
+			return integerLiteral(node.Token, a+b)
+		case "-":
+			return integerLiteral(node.Token, a-b)
+		case "*":
+			return integerLiteral(node.Token, a*b)
+		case "/":
+			if b != 0 {
+				return integerLiteral(node.Token, a/b)
+			}
+		case "<":
+			return booleanLiteral(node.Token, a < b)
+		case ">":
+			return booleanLiteral(node.Token, a > b)
+		case "==":
+			return booleanLiteral(node.Token, a == b)
+		case "!=":
+			return booleanLiteral(node.Token, a != b)
+		}
+	case *ast.StringLiteral:
+		right, ok := node.Right.(*ast.StringLiteral)
+		if !ok {
+			return nil
+		}
+
+		switch node.Operator {
+		case "+":
+			return &ast.StringLiteral{
+				Token: token.Token{Type: token.STRING, Literal: left.Value + right.Value, Pos: node.Token.Pos},
+				Value: left.Value + right.Value,
+			}
+		case "==":
+			return booleanLiteral(node.Token, left.Value == right.Value)
+		case "!=":
+			return booleanLiteral(node.Token, left.Value != right.Value)
+		}
+	case *ast.Boolean:
+		right, ok := node.Right.(*ast.Boolean)
+		if !ok {
+			return nil
+		}
+
+		switch node.Operator {
+		case "==":
+			return booleanLiteral(node.Token, left.Value == right.Value)
+		case "!=":
+			return booleanLiteral(node.Token, left.Value != right.Value)
+		}
+	}
+
+	return nil
+}
+
+// constantTruthiness reports whether the literal exp is truthy. ok is false
+// when exp is not a literal.
+func constantTruthiness(exp ast.Expression) (truthy, ok bool) {
+	switch exp := exp.(type) {
+	case *ast.Boolean:
+		return exp.Value, true
+	case *ast.IntegerLiteral, *ast.StringLiteral:
+		return true, true
+	default:
+		return false, false
+	}
+}
+
+func integerLiteral(tok token.Token, value int64) *ast.IntegerLiteral {
+	return &ast.IntegerLiteral{
+		Token: token.Token{Type: token.INT, Literal: strconv.FormatInt(value, 10), Pos: tok.Pos},
+		Value: value,
+	}
+}
+
+func booleanLiteral(tok token.Token, value bool) *ast.Boolean {
+	t := token.Token{Type: token.TRUE, Literal: "true", Pos: tok.Pos}
+	if !value {
+		t = token.Token{Type: token.FALSE, Literal: "false", Pos: tok.Pos}
+	}
+
+	return &ast.Boolean{Token: t, Value: value}
+}
@@ -0,0 +1,254 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/marmotini/ngiri-lang/code"
+	"github.com/marmotini/ngiri-lang/object"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConstantFolding(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2 * 3",
+			expectedConstants: []interface{}{7},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "(10 - 4) / 3 > 1",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "-5 * 2",
+			expectedConstants: []interface{}{-10},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "!true == false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "!5",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpFalse),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `"mon" + "key" != "monkey"`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpFalse),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `"mon" + "key"`,
+			expectedConstants: []interface{}{"monkey"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// Division by zero is left to fail at run time.
+			input:             "1 / (2 - 2)",
+			expectedConstants: []interface{}{1, 0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpDiv),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// Operands of different types are left to the VM too.
+			input:             `1 + "a"`,
+			expectedConstants: []interface{}{1, "a"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let x = 2; x * (3 + 4)",
+			expectedConstants: []interface{}{2, 7},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMul),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runOptimizedCompilerTests(t, tests)
+}
+
+func TestConstantBranches(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "if (1 < 2) {10} else {20}; 3333;",
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "if (false) {10}; 3333;",
+			expectedConstants: []interface{}{3333},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `if ("") {10} else {20}`,
+			expectedConstants: []interface{}{10},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// x is local to the else block, which is dropped like any
+			// other block that never runs.
+			input:             "if (true) {1} else {let x = 2; x}",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runOptimizedCompilerTests(t, tests)
+}
+
+func TestConstantPoolSharing(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `1; "a"; 1; "a"; "1"`,
+			expectedConstants: []interface{}{1, "a", "1"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { 5 }; 5",
+			expectedConstants: []interface{}{
+				5,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runOptimizedCompilerTests(t, tests)
+
+	// Compilers that continue the pool of an earlier one, like the REPL's,
+	// share its constants too.
+	first := NewCompiler()
+	first.SetOptimization(1)
+	assert.NoError(t, first.Compile(parse("10")))
+
+	second := NewWithState(first.symbolTable, first.Bytecode().Constants)
+	second.SetOptimization(1)
+	assert.NoError(t, second.Compile(parse("10 + 0; 20")))
+	assert.Len(t, second.Bytecode().Constants, 2)
+}
+
+func TestOptimizationLevelZero(t *testing.T) {
+	compiler := NewCompiler()
+	compiler.SetOptimization(0)
+
+	err := compiler.Compile(parse("1 + 1"))
+	assert.NoError(t, err)
+
+	bytecode := compiler.Bytecode()
+	assert.NoError(t, testInstructions([]code.Instructions{
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpConstant, 1),
+		code.Make(code.OpAdd),
+		code.Make(code.OpPop),
+	}, bytecode.Instructions))
+	assert.Len(t, bytecode.Constants, 2)
+}
+
+func TestFoldingKeepsQuotesAndInput(t *testing.T) {
+	program := parse("let x = 2 * 3; quote(1 + 2)")
+
+	compiler := NewCompiler()
+	compiler.SetOptimization(1)
+	assert.NoError(t, compiler.Compile(program))
+
+	bytecode := compiler.Bytecode()
+	quote, ok := bytecode.Constants[len(bytecode.Constants)-1].(*object.Quote)
+	if assert.True(t, ok, "constant is not a quote") {
+		assert.Equal(t, "(1 + 2)", quote.Node.String())
+	}
+
+	assert.Equal(t, "let x = (2 * 3);quote((1 + 2))", program.String())
+}
+
+func runOptimizedCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		compiler := NewCompiler()
+		compiler.SetOptimization(1)
+
+		err := compiler.Compile(parse(tt.input))
+		assert.NoError(t, err, tt.input)
+
+		bytecode := compiler.Bytecode()
+
+		err = testInstructions(tt.expectedInstructions, bytecode.Instructions)
+		assert.NoError(t, err, tt.input)
+
+		err = testConstants(t, tt.expectedConstants, bytecode.Constants)
+		assert.NoError(t, err, tt.input)
+	}
+}
@@ -0,0 +1,191 @@
+package compiler
+
+import (
+	"github.com/marmotini/ngiri-lang/code"
+	"github.com/marmotini/ngiri-lang/object"
+)
+
+// instruction is a decoded instruction. pos is its offset before the
+// peephole pass moved it.
+type instruction struct {
+	op       code.OpCode
+	operands []int
+	pos      int
+}
+
+// peephole rewrites ins, the instructions of a function or of the main
+// program, and the handler table pointing into them:
+//
+//	OpJump a; ... a: OpJump b         jumps to a jump go to b directly
+//	OpJump a; a:                      jumps to the next instruction go
+//	OpConstant c; OpPop               pure pushes that are popped right away
+//	OpGetLocal l; OpConstant c; OpAdd OpAddLocalConst l c
+//	OpGetLocal l; OpConstant c; OpSub OpSubLocalConst l c
+//	OpGreaterThan; OpJumpNotTruthy a  OpJumpIfNotGreater a
+//
+// Pops are only dropped when dropPops is set: the VM reports the last value
+// the main program popped, so its pops stay. Instructions are only fused
+// when nothing jumps between them and their operands fit the fused one.
+func peephole(ins code.Instructions, handlers []object.Handler, dropPops bool) (code.Instructions, []object.Handler) {
+	decoded := decode(ins)
+
+	threadJumps(decoded)
+
+	targets := jumpTargets(decoded, handlers)
+	optimized := make([]*instruction, 0, len(decoded))
+
+	for i := 0; i < len(decoded); i++ {
+		in := decoded[i]
+		a, b := follower(decoded, targets, i+1), follower(decoded, targets, i+2)
+
+		switch {
+		case in.op == code.OpJump && in.operands[0] == in.pos+in.width():
+			continue
+		case dropPops && pure(in.op) && a.is(code.OpPop):
+			i++
+			continue
+		case in.op == code.OpGetLocal && a.is(code.OpConstant) && b.is(code.OpAdd) &&
+			code.Fits(code.OpAddLocalConst, in.operands[0], a.operands[0]):
+			in = &instruction{op: code.OpAddLocalConst, operands: []int{in.operands[0], a.operands[0]}, pos: in.pos}
+			i += 2
+		case in.op == code.OpGetLocal && a.is(code.OpConstant) && b.is(code.OpSub) &&
+			code.Fits(code.OpSubLocalConst, in.operands[0], a.operands[0]):
+			in = &instruction{op: code.OpSubLocalConst, operands: []int{in.operands[0], a.operands[0]}, pos: in.pos}
+			i += 2
+		case in.op == code.OpGreaterThan && a.is(code.OpJumpNotTruthy):
+			in = &instruction{op: code.OpJumpIfNotGreater, operands: a.operands, pos: in.pos}
+			i++
+		}
+
+		optimized = append(optimized, in)
+	}
+
+	return encode(optimized, decoded, len(ins), handlers)
+}
+
+func decode(ins code.Instructions) []*instruction {
+	decoded := []*instruction{}
+
+	for pos := 0; pos < len(ins); {
+		op, operands, read, err := code.ReadInstruction(ins[pos:])
+		if err != nil {
+			panic(err)
+		}
+
+		decoded = append(decoded, &instruction{op: op, operands: operands, pos: pos})
+
+		pos += read
+	}
+
+	return decoded
+}
+
+// threadJumps points every jump whose target is an OpJump at the end of the
+// chain of jumps.
+func threadJumps(decoded []*instruction) {
+	at := make(map[int]*instruction, len(decoded))
+	for _, in := range decoded {
+		at[in.pos] = in
+	}
+
+	for _, in := range decoded {
+		index, ok := code.JumpOperand(in.op)
+		if !ok {
+			continue
+		}
+
+		target := in.operands[index]
+		seen := map[int]bool{}
+
+		for next, ok := at[target]; ok && next.op == code.OpJump && !seen[target]; next, ok = at[target] {
+			seen[target] = true
+			target = next.operands[0]
+		}
+
+		in.operands[index] = target
+	}
+}
+
+// jumpTargets returns the offsets the instructions and the handlers jump to.
+func jumpTargets(decoded []*instruction, handlers []object.Handler) map[int]bool {
+	targets := map[int]bool{}
+
+	for _, in := range decoded {
+		if index, ok := code.JumpOperand(in.op); ok {
+			targets[in.operands[index]] = true
+		}
+	}
+
+	for _, h := range handlers {
+		targets[h.Catch] = true
+	}
+
+	return targets
+}
+
+// follower returns decoded[i] when an instruction can be fused with the ones
+// before it, nil when it is missing or something jumps to it.
+func follower(decoded []*instruction, targets map[int]bool, i int) *instruction {
+	if i >= len(decoded) || targets[decoded[i].pos] {
+		return nil
+	}
+
+	return decoded[i]
+}
+
+func (in *instruction) is(op code.OpCode) bool {
+	return in != nil && in.op == op
+}
+
+func (in *instruction) width() int {
+	return len(code.Make(in.op, in.operands...))
+}
+
+// pure reports whether op only pushes a value, so that popping it right away
+// does nothing.
+func pure(op code.OpCode) bool {
+	switch op {
+	case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull,
+		code.OpGetLocal, code.OpGetGlobal, code.OpGetBuiltin:
+		return true
+	default:
+		return false
+	}
+}
+
+// encode lays optimized out again. Offsets into the original instructions
+// of length end move to where their instruction went, or to the next one
+// left when it was dropped.
+func encode(optimized, decoded []*instruction, end int, handlers []object.Handler) (code.Instructions, []object.Handler) {
+	moved := make(map[int]int, len(decoded)+1)
+
+	pos, j := 0, 0
+	for _, in := range decoded {
+		for j < len(optimized) && optimized[j].pos < in.pos {
+			pos += optimized[j].width()
+			j++
+		}
+		moved[in.pos] = pos
+	}
+	for ; j < len(optimized); j++ {
+		pos += optimized[j].width()
+	}
+	moved[end] = pos
+
+	ins := code.Instructions{}
+	for _, in := range optimized {
+		operands := append([]int{}, in.operands...)
+		if index, ok := code.JumpOperand(in.op); ok {
+			operands[index] = moved[operands[index]]
+		}
+
+		ins = append(ins, code.Make(in.op, operands...)...)
+	}
+
+	var movedHandlers []object.Handler
+	for _, h := range handlers {
+		movedHandlers = append(movedHandlers, object.Handler{Catch: moved[h.Catch]})
+	}
+
+	return ins, movedHandlers
+}
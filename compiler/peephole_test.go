@@ -0,0 +1,209 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/marmotini/ngiri-lang/code"
+	"github.com/marmotini/ngiri-lang/object"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeephole(t *testing.T) {
+	tests := []struct {
+		name             string
+		input            []code.Instructions
+		handlers         []object.Handler
+		dropPops         bool
+		expected         []code.Instructions
+		expectedHandlers []object.Handler
+	}{
+		{
+			name: "jump chains",
+			input: []code.Instructions{
+				code.Make(code.OpTrue),             // 0000
+				code.Make(code.OpJumpNotTruthy, 7), // 0001
+				code.Make(code.OpJump, 10),         // 0004
+				code.Make(code.OpJump, 10),         // 0007
+				code.Make(code.OpNull),             // 0010
+				code.Make(code.OpPop),              // 0011
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpTrue),             // 0000
+				code.Make(code.OpJumpNotTruthy, 7), // 0001
+				code.Make(code.OpJump, 7),          // 0004
+				code.Make(code.OpNull),             // 0007
+				code.Make(code.OpPop),              // 0008
+			},
+		},
+		{
+			name: "pure pushes popped right away",
+			input: []code.Instructions{
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpNull),
+				code.Make(code.OpReturnValue),
+			},
+			dropPops: true,
+			expected: []code.Instructions{
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpNull),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			name: "pops of the main program",
+			input: []code.Instructions{
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			name: "pops jumped to",
+			input: []code.Instructions{
+				code.Make(code.OpTrue),             // 0000
+				code.Make(code.OpJumpNotTruthy, 8), // 0001
+				code.Make(code.OpNull),             // 0004
+				code.Make(code.OpJump, 9),          // 0005
+				code.Make(code.OpNull),             // 0008
+				code.Make(code.OpPop),              // 0009
+				code.Make(code.OpNull),             // 0010
+				code.Make(code.OpReturnValue),      // 0011
+			},
+			dropPops: true,
+			expected: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 8),
+				code.Make(code.OpNull),
+				code.Make(code.OpJump, 9),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+				code.Make(code.OpNull),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			name: "superinstructions",
+			input: []code.Instructions{
+				code.Make(code.OpGetLocal, 1),       // 0000
+				code.Make(code.OpConstant, 2),       // 0002
+				code.Make(code.OpAdd),               // 0005
+				code.Make(code.OpGetLocal, 0),       // 0006
+				code.Make(code.OpGreaterThan),       // 0008
+				code.Make(code.OpJumpNotTruthy, 16), // 0009
+				code.Make(code.OpConstant, 3),       // 0012
+				code.Make(code.OpReturnValue),       // 0015
+				code.Make(code.OpNull),              // 0016
+				code.Make(code.OpReturnValue),       // 0017
+			},
+			dropPops: true,
+			expected: []code.Instructions{
+				code.Make(code.OpAddLocalConst, 1, 2),  // 0000
+				code.Make(code.OpGetLocal, 0),          // 0004
+				code.Make(code.OpJumpIfNotGreater, 13), // 0006
+				code.Make(code.OpConstant, 3),          // 0009
+				code.Make(code.OpReturnValue),          // 0012
+				code.Make(code.OpNull),                 // 0013
+				code.Make(code.OpReturnValue),          // 0014
+			},
+		},
+		{
+			name: "subtracting a constant",
+			input: []code.Instructions{
+				code.Make(code.OpGetLocal, 0), // 0000
+				code.Make(code.OpConstant, 1), // 0002
+				code.Make(code.OpSub),         // 0005
+				code.Make(code.OpReturnValue), // 0006
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpSubLocalConst, 0, 1), // 0000
+				code.Make(code.OpReturnValue),         // 0004
+			},
+		},
+		{
+			name: "no fusion across jump targets",
+			input: []code.Instructions{
+				code.Make(code.OpGetLocal, 0),      // 0000
+				code.Make(code.OpConstant, 1),      // 0002
+				code.Make(code.OpAdd),              // 0005
+				code.Make(code.OpJumpNotTruthy, 2), // 0006
+				code.Make(code.OpReturn),           // 0009
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpJumpNotTruthy, 2),
+				code.Make(code.OpReturn),
+			},
+		},
+		{
+			name: "handlers",
+			input: []code.Instructions{
+				code.Make(code.OpConstant, 0), // 0000
+				code.Make(code.OpPop),         // 0003
+				code.Make(code.OpTry, 0),      // 0004
+				code.Make(code.OpNull),        // 0007
+				code.Make(code.OpReturnValue), // 0008
+			},
+			handlers: []object.Handler{{Catch: 7}},
+			dropPops: true,
+			expected: []code.Instructions{
+				code.Make(code.OpTry, 0),      // 0000
+				code.Make(code.OpNull),        // 0003
+				code.Make(code.OpReturnValue), // 0004
+			},
+			expectedHandlers: []object.Handler{{Catch: 3}},
+		},
+	}
+
+	for _, tt := range tests {
+		ins, handlers := peephole(concatInstructions(tt.input), tt.handlers, tt.dropPops)
+
+		assert.NoError(t, testInstructions(tt.expected, ins), tt.name)
+		assert.Equal(t, tt.expectedHandlers, handlers, tt.name)
+	}
+}
+
+func TestPeepholeFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn(n) { n; if (n > 1) { n + 1 } else { n } }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),          // 0000
+					code.Make(code.OpConstant, 0),          // 0002
+					code.Make(code.OpJumpIfNotGreater, 15), // 0005
+					code.Make(code.OpAddLocalConst, 0, 0),  // 0008
+					code.Make(code.OpJump, 17),             // 0012
+					code.Make(code.OpGetLocal, 0),          // 0015
+					code.Make(code.OpReturnValue),          // 0017
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		compiler := NewCompiler()
+		compiler.SetOptimization(2)
+
+		assert.NoError(t, compiler.Compile(parse(tt.input)), tt.input)
+
+		bytecode := compiler.Bytecode()
+		assert.NoError(t, testInstructions(tt.expectedInstructions, bytecode.Instructions), tt.input)
+		assert.NoError(t, testConstants(t, tt.expectedConstants, bytecode.Constants), tt.input)
+	}
+}
@@ -0,0 +1,374 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/builtin"
+	"github.com/marmotini/ngiri-lang/code"
+	"github.com/marmotini/ngiri-lang/ir"
+	"github.com/marmotini/ngiri-lang/object"
+)
+
+// ssaFunction is the plan for generating stack code from an ir.Func. Values
+// used once, by a later value of their block with nothing run in between
+// that could observe the order, are computed right where they are used.
+// The others get a local: deferred values are left on the stack for their
+// user, stored values are kept in slots. Constants, parameters and globals
+// are loaded wherever they are used.
+type ssaFunction struct {
+	f        *ir.Func
+	deferred map[*ir.Value]bool
+	slots    map[*ir.Value]Symbol
+	starts   map[*ir.Block]int
+	jumps    map[int]*ir.Block
+}
+
+// compileSSA compiles node from its SSA form, see package ir. ok is false
+// when the function uses constructs the IR has no form for yet, which are
+// left to the compiler working on the syntax tree.
+func (c *Compiler) compileSSA(node *ast.FunctionExpression) (ok bool, err error) {
+	f, err := ir.Build(node)
+	if err != nil {
+		return false, nil
+	}
+
+	// Names that do not resolve to globals and builtins are left to the
+	// tree compiler, which reports the undefined ones. This is checked
+	// before dead code elimination drops unused reads.
+	for _, b := range f.Blocks {
+		for _, v := range b.Values {
+			if v.Op == ir.OpGlobal && !c.resolvesOutside(v.Name) {
+				return false, nil
+			}
+		}
+	}
+
+	ir.Optimize(f)
+
+	if err := ir.Verify(f); err != nil {
+		return false, fmt.Errorf("internal error compiling %s: %s", node, err)
+	}
+
+	fn := &ssaFunction{
+		f:        f,
+		deferred: deferredValues(f),
+		slots:    map[*ir.Value]Symbol{},
+		starts:   map[*ir.Block]int{},
+		jumps:    map[int]*ir.Block{},
+	}
+
+	c.enterScope()
+
+	for _, p := range f.Params {
+		c.symbolTable.Define(p)
+	}
+
+	uses := f.Uses()
+	for _, b := range f.Blocks {
+		for _, v := range b.Values {
+			if v.Op == ir.OpPhi || (uses[v] > 0 && !fn.deferred[v] && !cheap(v)) {
+				fn.slots[v] = c.symbolTable.DefineHidden()
+			}
+		}
+	}
+
+	for i, b := range f.Blocks {
+		var next *ir.Block
+		if i+1 < len(f.Blocks) {
+			next = f.Blocks[i+1]
+		}
+
+		if err := c.compileBlock(fn, b, next, uses); err != nil {
+			return false, err
+		}
+	}
+
+	for pos, target := range fn.jumps {
+		c.changeOperand(pos, fn.starts[target])
+	}
+
+	return true, c.leaveFunction(node)
+}
+
+// resolvesOutside reports whether name is a global, an export or a builtin
+// of the scope around the function being compiled.
+func (c *Compiler) resolvesOutside(name string) bool {
+	symbol, ok := c.symbolTable.Resolve(name)
+	if !ok {
+		_, _, ok := builtin.Lookup(name)
+		return ok && !c.symbolTable.linked()
+	}
+
+	return symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope
+}
+
+func (c *Compiler) compileBlock(fn *ssaFunction, b *ir.Block, next *ir.Block, uses map[*ir.Value]int) error {
+	fn.starts[b] = len(c.currentInstructions())
+
+	for _, v := range b.Values {
+		if v.Op == ir.OpPhi || fn.deferred[v] || cheap(v) {
+			continue
+		}
+
+		if err := c.compileValue(fn, v); err != nil {
+			return err
+		}
+
+		if slot, ok := fn.slots[v]; ok {
+			c.setSymbol(slot)
+		} else {
+			c.emit(code.OpPop)
+		}
+	}
+
+	switch b.Kind {
+	case ir.Plain:
+		succ := b.Succs[0]
+		index := predIndex(succ, b)
+
+		for _, v := range succ.Values {
+			if v.Op == ir.OpPhi {
+				if err := c.loadValue(fn, v.Args[index]); err != nil {
+					return err
+				}
+				c.setSymbol(fn.slots[v])
+			}
+		}
+
+		if succ != next {
+			fn.jumps[c.emit(code.OpJump, 9999)] = succ
+		}
+	case ir.If:
+		if err := c.loadValue(fn, b.Control); err != nil {
+			return err
+		}
+
+		fn.jumps[c.emit(code.OpJumpNotTruthy, 9999)] = b.Succs[1]
+		if b.Succs[0] != next {
+			fn.jumps[c.emit(code.OpJump, 9999)] = b.Succs[0]
+		}
+	case ir.Return:
+		if b.Control.Op == ir.OpConst && b.Control.Const == nil {
+			c.emit(code.OpReturn)
+			return nil
+		}
+
+		if err := c.loadValue(fn, b.Control); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+	}
+
+	return nil
+}
+
+var ssaOps = map[ir.Op]code.OpCode{
+	ir.OpNeg:      code.OpMinus,
+	ir.OpNot:      code.OpBang,
+	ir.OpAdd:      code.OpAdd,
+	ir.OpSub:      code.OpSub,
+	ir.OpMul:      code.OpMul,
+	ir.OpDiv:      code.OpDiv,
+	ir.OpEqual:    code.OpEqual,
+	ir.OpNotEqual: code.OpNotEqual,
+	ir.OpGreater:  code.OpGreaterThan,
+	ir.OpIndex:    code.OpIndex,
+}
+
+// compileValue leaves the value of v on the stack, computing it from its
+// arguments.
+func (c *Compiler) compileValue(fn *ssaFunction, v *ir.Value) error {
+	for _, a := range v.Args {
+		if err := c.loadValue(fn, a); err != nil {
+			return err
+		}
+	}
+
+	switch v.Op {
+	case ir.OpArray:
+		c.emit(code.OpArray, len(v.Args))
+	case ir.OpCall:
+		c.emit(code.OpCall, len(v.Args)-1)
+	case ir.OpGlobal:
+		return c.Compile(&ast.Identifier{Value: v.Name})
+	default:
+		op, ok := ssaOps[v.Op]
+		if !ok {
+			return fmt.Errorf("internal error: can not compile %s", v.LongString())
+		}
+		c.emit(op)
+	}
+
+	return nil
+}
+
+// loadValue pushes v: deferred values are computed here, the others loaded.
+func (c *Compiler) loadValue(fn *ssaFunction, v *ir.Value) error {
+	if fn.deferred[v] {
+		return c.compileValue(fn, v)
+	}
+
+	if slot, ok := fn.slots[v]; ok {
+		c.getSymbol(slot)
+		return nil
+	}
+
+	switch v.Op {
+	case ir.OpConst:
+		switch obj := v.Const.(type) {
+		case nil:
+			c.emit(code.OpNull)
+		case *object.Boolean:
+			if obj.Value {
+				c.emit(code.OpTrue)
+			} else {
+				c.emit(code.OpFalse)
+			}
+		default:
+			c.emit(code.OpConstant, c.addConstant(obj))
+		}
+	case ir.OpParam:
+		c.emit(code.OpGetLocal, v.Index)
+	default:
+		return fmt.Errorf("internal error: %s is neither computed nor stored", v)
+	}
+
+	return nil
+}
+
+// cheap reports whether v is loaded where it is used rather than computed
+// where it is defined. Globals are not: calls may assign them in between.
+func cheap(v *ir.Value) bool {
+	return v.Op == ir.OpConst || v.Op == ir.OpParam
+}
+
+// deferredValues returns the values computed where they are used. A value
+// qualifies when it is used once, by a value or the control of its own
+// block, and no other value whose order matters runs between the two. The
+// candidates are simulated on a stack: the arguments a value computes in
+// place must be the top of the stack in order, and nothing may be left on
+// it when a value that is not deferred runs. Candidates breaking that are
+// stored instead, until the plan holds.
+func deferredValues(f *ir.Func) map[*ir.Value]bool {
+	uses := f.Uses()
+	users := map[*ir.Value]*ir.Block{}
+	for _, b := range f.Blocks {
+		for _, v := range b.Values {
+			for _, a := range v.Args {
+				users[a] = v.Block
+			}
+		}
+		if b.Control != nil {
+			users[b.Control] = b
+		}
+		// Phi arguments are used at the end of the predecessors.
+		for _, v := range b.Values {
+			if v.Op == ir.OpPhi {
+				for _, a := range v.Args {
+					users[a] = nil
+				}
+			}
+		}
+	}
+
+	stored := map[*ir.Value]bool{}
+	candidate := func(v *ir.Value) bool {
+		return !stored[v] && !cheap(v) && v.Op != ir.OpPhi && uses[v] == 1 && users[v] == v.Block
+	}
+
+	for {
+		broken := deferBlocks(f, candidate, stored)
+		if !broken {
+			break
+		}
+	}
+
+	deferred := map[*ir.Value]bool{}
+	for _, b := range f.Blocks {
+		for _, v := range b.Values {
+			if candidate(v) {
+				deferred[v] = true
+			}
+		}
+	}
+
+	return deferred
+}
+
+// deferBlocks simulates the plan once, storing the candidates that break
+// it. It reports whether any did.
+func deferBlocks(f *ir.Func, candidate func(*ir.Value) bool, stored map[*ir.Value]bool) bool {
+	broken := false
+
+	store := func(values ...*ir.Value) {
+		for _, v := range values {
+			if candidate(v) {
+				stored[v] = true
+				broken = true
+			}
+		}
+	}
+
+	for _, b := range f.Blocks {
+		var stack []*ir.Value
+
+		consume := func(args []*ir.Value) {
+			var inPlace []*ir.Value
+			for _, a := range args {
+				if candidate(a) {
+					inPlace = append(inPlace, a)
+				}
+			}
+
+			top := len(stack) - len(inPlace)
+			if top < 0 || !sameValues(stack[top:], inPlace) {
+				store(inPlace...)
+				return
+			}
+			stack = stack[:top]
+		}
+
+		for _, v := range b.Values {
+			if v.Op == ir.OpPhi || cheap(v) {
+				continue
+			}
+
+			consume(v.Args)
+
+			if candidate(v) {
+				stack = append(stack, v)
+			} else {
+				store(stack...)
+				stack = nil
+			}
+		}
+
+		if b.Control != nil {
+			consume([]*ir.Value{b.Control})
+		}
+		store(stack...)
+	}
+
+	return broken
+}
+
+func sameValues(a, b []*ir.Value) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return len(a) == len(b)
+}
+
+func predIndex(b, pred *ir.Block) int {
+	for i, p := range b.Preds {
+		if p == pred {
+			return i
+		}
+	}
+
+	return -1
+}
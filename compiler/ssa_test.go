@@ -0,0 +1,141 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/marmotini/ngiri-lang/code"
+	"github.com/marmotini/ngiri-lang/object"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSSAFunctions(t *testing.T) {
+	tests := []struct {
+		input     string
+		numLocals int
+		expected  []code.Instructions
+	}{
+		{
+			// Single uses are computed in place, the tail call stays last.
+			input:     "let f = fn(n) { if (n < 2) { n } else { f(n - 1) } }",
+			numLocals: 1,
+			expected: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpJumpIfNotGreater, 11),
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpReturnValue),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpSubLocalConst, 0, 1),
+				code.Make(code.OpTailCall, 1),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			// Values used twice are stored in a hidden local, unused
+			// ones that can not fail are dropped.
+			input:     "let f = fn(a, b) { let c = a * b; a == b; puts(c); c + a }",
+			numLocals: 3,
+			expected: []code.Instructions{
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpMul),
+				code.Make(code.OpSetLocal, 2),
+				code.Make(code.OpGetBuiltin, 1),
+				code.Make(code.OpGetLocal, 2),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetLocal, 2),
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpAdd),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			// Constants are propagated through lets and branches.
+			input:     "let f = fn() { let x = 2; if (x > 1) { x * 3 } else { 0 } }",
+			numLocals: 0,
+			expected: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		fn := compileSSAFunction(t, tt.input)
+		if fn == nil {
+			continue
+		}
+
+		assert.Equal(t, tt.numLocals, fn.NumLocals, tt.input)
+		assert.NoError(t, testInstructions(tt.expected, fn.Instructions), tt.input)
+	}
+}
+
+func TestSSAFallback(t *testing.T) {
+	// Functions the IR has no form for are compiled from the syntax tree.
+	inputs := []string{
+		`let f = fn(x) { match (x) { 1 => "one", _ => "other" } }`,
+		"let f = fn(x) { let g = fn() { x }; g() }",
+		"let n = 0; let f = fn(x) { n = x }",
+	}
+
+	for _, input := range inputs {
+		tree := NewCompiler()
+		tree.SetOptimization(2)
+		assert.NoError(t, tree.Compile(parse(input)), input)
+
+		ssa := NewCompiler()
+		ssa.SetOptimization(3)
+		assert.NoError(t, ssa.Compile(parse(input)), input)
+
+		assert.Equal(t, tree.Bytecode().Constants, ssa.Bytecode().Constants, input)
+	}
+}
+
+func TestSSAUndefinedVariable(t *testing.T) {
+	compiler := NewCompiler()
+	compiler.SetOptimization(3)
+
+	err := compiler.Compile(parse("let f = fn() { let x = y; 1 }"))
+	assert.EqualError(t, err, "undefined variable y")
+}
+
+func TestSSADeclarationErrors(t *testing.T) {
+	// The IR leaves these to the tree compiler, which reports them.
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let f = fn() { const x = 1; x = 2 }", "cannot assign to constant x"},
+		{"let f = fn(x) { let x = 1; x }", "x is already declared in this scope"},
+		{"let f = fn(x) { if (x) { let y = 1 }; y }", "undefined variable y"},
+	}
+
+	for _, tt := range tests {
+		compiler := NewCompiler()
+		compiler.SetOptimization(3)
+
+		err := compiler.Compile(parse(tt.input))
+		assert.EqualError(t, err, tt.expected, tt.input)
+	}
+}
+
+func compileSSAFunction(t *testing.T, input string) *object.CompiledFunction {
+	t.Helper()
+
+	compiler := NewCompiler()
+	compiler.SetOptimization(3)
+	if !assert.NoError(t, compiler.Compile(parse(input)), input) {
+		return nil
+	}
+
+	for _, constant := range compiler.Bytecode().Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			return fn
+		}
+	}
+
+	t.Errorf("%s: no compiled function", input)
+	return nil
+}
@@ -0,0 +1,195 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/code"
+	"github.com/marmotini/ngiri-lang/object"
+)
+
+// compileStruct binds the name of a struct declaration to its type, like a
+// const declaration would.
+func (c *Compiler) compileStruct(node *ast.StructStatement) error {
+	t := &object.StructType{Name: node.Name.Value}
+
+	if c.fieldSlots == nil {
+		c.fieldSlots = make(map[string]int)
+	}
+
+	for i, f := range node.Fields {
+		t.Fields = append(t.Fields, f.Value)
+
+		if _, ok := c.fieldSlots[f.Value]; !ok {
+			c.fieldSlots[f.Value] = i
+		}
+	}
+
+	c.emit(code.OpConstant, c.addConstant(t))
+
+	symbol, err := c.symbolTable.DeclareStruct(t)
+	if err != nil {
+		return err
+	}
+
+	c.setSymbol(symbol)
+
+	return nil
+}
+
+// compileEnum binds the name of an enum declaration to the enum, like a
+// const declaration would. Constructing and selecting variants is left to
+// the VM, which looks them up in the enum.
+func (c *Compiler) compileEnum(node *ast.EnumStatement) error {
+	t := object.NewEnumType(node.Name.Value)
+
+	for _, v := range node.Variants {
+		fields := []string{}
+		for _, f := range v.Fields {
+			fields = append(fields, f.Value)
+		}
+
+		t.AddVariant(v.Name.Value, fields)
+	}
+
+	c.emit(code.OpConstant, c.addConstant(t))
+
+	symbol, err := c.symbolTable.Declare(t.Name, true)
+	if err != nil {
+		return err
+	}
+
+	c.setSymbol(symbol)
+
+	return nil
+}
+
+// compileStructLiteral pushes the values of the literal in source order and
+// builds the struct with OpStruct. The fields are resolved to their slots
+// here, which needs the name to be bound by a struct declaration, of this
+// program or exported by an imported module.
+func (c *Compiler) compileStructLiteral(node *ast.StructLiteral) error {
+	var symbol Symbol
+	var ok bool
+
+	switch name := node.Name.(type) {
+	case *ast.Identifier:
+		symbol, ok = c.symbolTable.Resolve(name.Value)
+	case *ast.SelectorExpression:
+		if c.isModuleSelector(name) {
+			export, err := c.resolveExport(name)
+			if err != nil {
+				return err
+			}
+			symbol, ok = export, true
+		}
+	}
+
+	if !ok || symbol.Struct == nil {
+		return fmt.Errorf("%s is not a struct type", node.Name)
+	}
+
+	shape := &object.StructShape{Struct: symbol.Struct, Slots: []int{}}
+
+	for i, f := range node.Fields {
+		slot, ok := symbol.Struct.FieldIndex(f.Value)
+		if !ok {
+			return fmt.Errorf("struct %s has no field %s", symbol.Struct.Name, f.Value)
+		}
+
+		err := c.Compile(node.Values[i])
+		if err != nil {
+			return err
+		}
+
+		shape.Slots = append(shape.Slots, slot)
+	}
+
+	c.emit(code.OpStruct, c.addConstant(shape))
+
+	return nil
+}
+
+// compileFieldAssign compiles `p.x = v` to
+//
+//	v; p; OpSetField x
+//
+// which leaves v on the stack as the value of the assignment.
+func (c *Compiler) compileFieldAssign(node *ast.FieldAssignExpression) error {
+	err := c.Compile(node.Value)
+	if err != nil {
+		return err
+	}
+
+	err = c.Compile(node.Target.Left)
+	if err != nil {
+		return err
+	}
+
+	c.emitField(code.OpSetField, node.Target.Selector.Value)
+
+	return nil
+}
+
+// compileImpl defines the methods of an impl block on the struct type when
+// the block runs, so that the methods are functions like any other:
+//
+//	<type>; <method>; OpDefineMethod name; <method>; ...; OpPop
+func (c *Compiler) compileImpl(node *ast.ImplStatement) error {
+	symbol, ok := c.symbolTable.Resolve(node.Name.Value)
+	if !ok || symbol.Struct == nil {
+		return fmt.Errorf("%s is not a struct type", node.Name.Value)
+	}
+
+	err := c.Compile(node.Name)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range node.Methods {
+		if _, ok := symbol.Struct.FieldIndex(m.Name); ok {
+			return fmt.Errorf("struct %s already has a field %s", symbol.Struct.Name, m.Name)
+		}
+
+		err := c.Compile(m)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpDefineMethod, c.addConstant(&object.String{Value: m.Name}))
+	}
+
+	c.emit(code.OpPop)
+
+	return nil
+}
+
+// compileMethodCall compiles `recv.name(args)` to
+//
+//	recv; args; OpCallMethod name len(args) site
+//
+// which saves the VM from building a bound method for every call. The call
+// sites are numbered for the VM's method caches.
+func (c *Compiler) compileMethodCall(sel *ast.SelectorExpression, args []ast.Expression) error {
+	err := c.Compile(sel.Left)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range args {
+		err := c.Compile(a)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.emit(code.OpCallMethod, c.addConstant(&object.String{Value: sel.Selector.Value}), len(args), c.methodCalls)
+	c.methodCalls++
+
+	return nil
+}
+
+// emitField emits OpGetField or OpSetField for the field name.
+func (c *Compiler) emitField(op code.OpCode, name string) {
+	c.emit(op, c.addConstant(&object.String{Value: name}), c.fieldSlots[name])
+}
@@ -1,22 +1,52 @@
 package compiler
 
+import (
+	"fmt"
+
+	"github.com/marmotini/ngiri-lang/builtin"
+	"github.com/marmotini/ngiri-lang/object"
+)
+
 type SymbolScope string
 
 const (
-	GlobalScope SymbolScope = "GLOBAL"
-	LocalScope  SymbolScope = "LOCAL"
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	ModuleScope  SymbolScope = "MODULE"
+	BuiltinScope SymbolScope = "BUILTIN"
 )
 
 type Symbol struct {
 	Name  string
 	Scope SymbolScope
 	Index int
+	// Const is set for names bound by const declarations, which can not
+	// be assigned.
+	Const bool
+	// Struct is the type a struct declaration binds the name to, which
+	// struct literals of the name build.
+	Struct *object.StructType
 }
 
 type SymbolTable struct {
 	Outer          *SymbolTable
 	store          map[string]Symbol
 	numDefinitions int
+
+	// block is set for the tables of blocks, see NewBlockSymbolTable.
+	block bool
+
+	// globals numbers the global definitions of module tables, see
+	// NewModuleSymbolTable.
+	globals *SymbolTable
+
+	// builtins are the builtins linked into a global table, see
+	// LinkBuiltins.
+	builtins map[string]Symbol
+
+	// modules are the modules imported into the program of a global table,
+	// see moduleTable.
+	modules *moduleTable
 }
 
 func NewSymbolTable() *SymbolTable {
@@ -31,16 +61,130 @@ func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
 	return s
 }
 
+// NewBlockSymbolTable returns the table of a block within the function or
+// program of outer. The names defined in it are only visible in the block,
+// their slots are numbered along with those of the enclosing function or
+// program so that they do not overwrite the variables of other blocks.
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewEnclosedSymbolTable(outer)
+	s.block = true
+	return s
+}
+
+// NewModuleSymbolTable returns the global table of an imported module. Its
+// globals are numbered after those of main so that the module and its
+// importers share one globals store without overwriting each other.
+func NewModuleSymbolTable(main *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.builtins = main.builtins
+	s.globals = main
+	if main.globals != nil {
+		s.globals = main.globals
+	}
+
+	return s
+}
+
 func (s *SymbolTable) Define(name string) Symbol {
-	symbol := Symbol{Name: name, Index: s.numDefinitions}
-	if s.Outer == nil {
+	frame := s.frame()
+
+	symbol := Symbol{Name: name, Index: frame.numDefinitions}
+	if frame.Outer == nil {
 		symbol.Scope = GlobalScope
 	} else {
 		symbol.Scope = LocalScope
 	}
 
+	if frame.globals != nil {
+		symbol.Index = frame.globals.numDefinitions
+		frame.globals.numDefinitions++
+	}
+
 	s.store[name] = symbol
-	s.numDefinitions++
+	frame.numDefinitions++
+	return symbol
+}
+
+// Declare defines name for a let or const declaration. Declarations may
+// shadow the names of enclosing scopes, but not a name of their own scope.
+func (s *SymbolTable) Declare(name string, constant bool) (Symbol, error) {
+	if _, ok := s.store[name]; ok {
+		return Symbol{}, fmt.Errorf("%s is already declared in this scope", name)
+	}
+
+	symbol := s.Define(name)
+	symbol.Const = constant
+	s.store[name] = symbol
+
+	return symbol, nil
+}
+
+// DeclareStruct declares the name of a struct declaration, a constant bound
+// to t.
+func (s *SymbolTable) DeclareStruct(t *object.StructType) (Symbol, error) {
+	symbol, err := s.Declare(t.Name, true)
+	if err != nil {
+		return Symbol{}, err
+	}
+
+	symbol.Struct = t
+	s.store[t.Name] = symbol
+
+	return symbol, nil
+}
+
+// Copy returns a copy of the global table s to compile against, e.g. so that
+// the names a program that fails to compile defines can be dropped with the
+// copy.
+func (s *SymbolTable) Copy() *SymbolTable {
+	c := *s
+
+	c.store = make(map[string]Symbol, len(s.store))
+	for name, symbol := range s.store {
+		c.store[name] = symbol
+	}
+
+	if s.modules != nil {
+		c.modules = &moduleTable{
+			modules: append([]*compiledModule{}, s.modules.modules...),
+			byPath:  make(map[string]int, len(s.modules.byPath)),
+		}
+		for path, index := range s.modules.byPath {
+			c.modules.byPath[path] = index
+		}
+	}
+
+	return &c
+}
+
+// frame returns the table numbering the definitions of s, which is the
+// table of the function or program around s for block tables.
+func (s *SymbolTable) frame() *SymbolTable {
+	if s.block {
+		return s.Outer.frame()
+	}
+
+	return s
+}
+
+// global reports whether the names s defines are globals.
+func (s *SymbolTable) global() bool {
+	return s.frame().Outer == nil
+}
+
+// DefineHidden reserves a slot that no identifier resolves to, for values
+// the compiler keeps around like the subject of a match expression.
+func (s *SymbolTable) DefineHidden() Symbol {
+	symbol := s.Define("")
+	delete(s.store, "")
+
+	return symbol
+}
+
+// Bind makes name refer to an existing symbol, e.g. an imported export.
+func (s *SymbolTable) Bind(name string, symbol Symbol) Symbol {
+	s.store[name] = symbol
+
 	return symbol
 }
 
@@ -51,5 +195,29 @@ func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 		return obj, ok
 	}
 
+	if !ok && s.builtins != nil {
+		obj, ok = s.builtins[name]
+	}
+
 	return obj, ok
 }
+
+// LinkBuiltins makes the builtins allowed by p resolvable in the global table
+// s and the tables it encloses. Programs compiled against tables that were
+// never linked can use every builtin.
+func (s *SymbolTable) LinkBuiltins(p *builtin.Policy) {
+	s.builtins = make(map[string]Symbol)
+
+	for name := range p.Allowed() {
+		index, _, _ := builtin.Lookup(name)
+		s.builtins[name] = Symbol{Name: name, Scope: BuiltinScope, Index: index}
+	}
+}
+
+func (s *SymbolTable) linked() bool {
+	if s.Outer != nil {
+		return s.Outer.linked()
+	}
+
+	return s.builtins != nil
+}
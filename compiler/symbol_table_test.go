@@ -149,3 +149,88 @@ func TestResolveGlobal(t *testing.T) {
 		}
 	}
 }
+
+func TestBlockSymbolTable(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	block := NewBlockSymbolTable(global)
+	block.Define("a")
+	block.Define("b")
+
+	local := NewEnclosedSymbolTable(block)
+	local.Define("c")
+
+	inner := NewBlockSymbolTable(local)
+	inner.Define("c")
+
+	tests := []struct {
+		table           *SymbolTable
+		expectedSymbols []Symbol
+	}{
+		{
+			global,
+			[]Symbol{
+				{Name: "a", Scope: GlobalScope, Index: 0},
+			},
+		},
+		{
+			block,
+			[]Symbol{
+				{Name: "a", Scope: GlobalScope, Index: 1},
+				{Name: "b", Scope: GlobalScope, Index: 2},
+			},
+		},
+		{
+			inner,
+			[]Symbol{
+				{Name: "a", Scope: GlobalScope, Index: 1},
+				{Name: "c", Scope: LocalScope, Index: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, sym := range tt.expectedSymbols {
+			result, ok := tt.table.Resolve(sym.Name)
+			if !ok {
+				t.Errorf("name %s not resolvable", sym.Name)
+				continue
+			}
+
+			if result != sym {
+				t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+			}
+		}
+	}
+
+	if _, ok := global.Resolve("b"); ok {
+		t.Errorf("name b of the block resolves outside of it")
+	}
+
+	if global.numDefinitions != 3 || local.numDefinitions != 2 {
+		t.Errorf("wrong number of definitions. got global=%d, local=%d", global.numDefinitions, local.numDefinitions)
+	}
+}
+
+func TestDeclare(t *testing.T) {
+	global := NewSymbolTable()
+
+	a, err := global.Declare("a", true)
+	if err != nil {
+		t.Fatalf("declaring a failed: %s", err)
+	}
+	if expected := (Symbol{Name: "a", Scope: GlobalScope, Index: 0, Const: true}); a != expected {
+		t.Errorf("expected a=%+v, got=%+v", expected, a)
+	}
+
+	_, err = global.Declare("a", false)
+	if err == nil || err.Error() != "a is already declared in this scope" {
+		t.Errorf("wrong error redeclaring a. got=%v", err)
+	}
+
+	block := NewBlockSymbolTable(global)
+	if _, err := block.Declare("a", false); err != nil {
+		t.Errorf("shadowing a in a block failed: %s", err)
+	}
+}
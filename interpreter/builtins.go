@@ -1,32 +1,32 @@
 package interpreter
 
 import (
-	"fmt"
-
+	"github.com/marmotini/ngiri-lang/builtin"
 	"github.com/marmotini/ngiri-lang/object"
 )
 
-var builtins = map[string]*object.BuiltIn{
-	"len": &object.BuiltIn{
-		FN: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
+// Link makes the builtins allowed by p available in the top level
+// environment env. Programs evaluated in environments that were never linked
+// can use every builtin, like they can on the command line.
+func Link(env *object.Environment, p *builtin.Policy) {
+	builtins := make(map[string]object.Object)
+	for name, b := range p.Allowed() {
+		builtins[name] = b.Object
+	}
+
+	env.Link(builtins)
+}
+
+// evalBuiltin resolves name to a builtin that env does not bind.
+func evalBuiltin(name string, env *object.Environment) (object.Object, bool) {
+	_, b, ok := builtin.Lookup(name)
+	if !ok {
+		return nil, false
+	}
+
+	if env.Builtins() != nil {
+		return newError("%s", builtin.DisabledError(b)), true
+	}
 
-			switch arg := args[0].(type) {
-			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}
-			default:
-				return newError("argument to `len` not supported, got %s", args[0].Type())
-			}
-		},
-	},
-	"puts": &object.BuiltIn{
-		FN: func(args ...object.Object) object.Object {
-			for _, arg := range args {
-				fmt.Println(arg.Inspect())
-			}
-			return NULL
-		},
-	},
+	return b.Object, true
 }
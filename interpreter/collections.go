@@ -0,0 +1,80 @@
+package interpreter
+
+import (
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/object"
+)
+
+func evalListLiteral(node *ast.ListLiteral, env *object.Environment) object.Object {
+	elements := evalExpressions(node.Elements, env)
+	if len(elements) == 1 && isAbrupt(elements[0]) {
+		return elements[0]
+	}
+
+	return track(env, &object.Array{Elements: append([]object.Object{}, elements...)})
+}
+
+func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	for i, keyNode := range node.Keys {
+		key := Eval(keyNode, env)
+		if isAbrupt(key) {
+			return key
+		}
+
+		hashable, ok := key.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", key.Type())
+		}
+
+		value := Eval(node.Values[i], env)
+		if isAbrupt(value) {
+			return value
+		}
+
+		pairs[hashable.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return track(env, &object.Hash{Pairs: pairs})
+}
+
+func evalIndexExpression(node *ast.IndexExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isAbrupt(left) {
+		return left
+	}
+
+	index := Eval(node.Index, env)
+	if isAbrupt(index) {
+		return index
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return newError("array index must be INTEGER, got %s", index.Type())
+		}
+
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return NULL
+		}
+
+		return left.Elements[i.Value]
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+
+		pair, ok := left.Pairs[key.HashKey()]
+		if !ok {
+			return NULL
+		}
+
+		return pair.Value
+	default:
+		return newError("index operator not supported: %s", left.Type())
+	}
+}
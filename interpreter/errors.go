@@ -0,0 +1,53 @@
+package interpreter
+
+import (
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/object"
+)
+
+// evalTryExpression evaluates to the value of the try block or, when it
+// throws, of the catch block. Errors raised by the execution limits end the
+// evaluation and are never caught.
+func evalTryExpression(node *ast.TryExpression, env *object.Environment) object.Object {
+	result := finishTailCall(Eval(node.Block, env), env.Budget())
+
+	if err, ok := result.(*object.Error); ok && err.Thrown && node.Catch != nil && env.Budget().Err() == nil {
+		// The error is bound in the environment of the catch block.
+		catchEnv := object.NewEnclosedEnvironment(env)
+		catchEnv.Set(node.Param.Value, err.Catch())
+		result = finishTailCall(evalBlockStatements(node.Catch, catchEnv, Eval), env.Budget())
+	}
+
+	if node.Finally != nil {
+		final := Eval(node.Finally, env)
+		if isAbrupt(final) {
+			return final
+		}
+	}
+
+	if result == nil {
+		return NULL
+	}
+
+	return result
+}
+
+// evalPropagateExpression unwraps ok and some, and returns err and none from
+// the enclosing function.
+func evalPropagateExpression(node *ast.PropagateExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isAbrupt(left) {
+		return left
+	}
+
+	value, failed, ok := object.Unwrap(left)
+	if !ok {
+		return newError("operator ? not supported for %s", left.Type())
+	}
+
+	if failed {
+		return &object.ReturnValue{Value: value}
+	}
+
+	return value
+}
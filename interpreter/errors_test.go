@@ -0,0 +1,127 @@
+package interpreter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/marmotini/ngiri-lang/lexer"
+	"github.com/marmotini/ngiri-lang/limit"
+	"github.com/marmotini/ngiri-lang/object"
+	"github.com/marmotini/ngiri-lang/parser"
+)
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { throw "boom"; 1 } catch (e) { 2 }`, 2},
+		{`try { throw "boom" } catch (e) { e.message }`, "boom"},
+		{`try { throw 42 } catch (e) { e.kind }`, "Error"},
+		{`try { 1 + true } catch (e) { e.kind }`, "RuntimeError"},
+		{`try { 1 + true } catch (e) { e.message }`, "type mismatch: INTEGER + BOOLEAN"},
+		{`try { len(1) } catch (e) { e.message }`, "argument to `len` not supported, got INTEGER"},
+		{`try { 1 / 0 } catch (e) { e.message }`, "division by zero"},
+		{`let f = fn(n) { 10 / n }; try { f(0) } catch (e) { e.kind }`, "RuntimeError"},
+		{`try { throw error("IOError", "disk full") } catch (e) { e.kind }`, "IOError"},
+		{`let e = error("boom"); e.message`, "boom"},
+		{`let f = fn() { throw "boom" }; let g = fn() { 1 + f() }; try { g() } catch (e) { len(e.stack) }`, 2},
+		{`let f = fn() { throw "boom" }; let g = fn() { f() }; try { g() } catch (e) { e.stack }`, "[f]"},
+		{`let f = fn() { throw "boom" }; try { f() } catch (e) { e.stack }`, "[f]"},
+		{`let x = 0; try { throw "a" } catch (e) { x = 1 } finally { x = x + 10 }; x`, 11},
+		{`let x = 0; try { 1 } finally { x = 5 }; x`, 5},
+		{`let f = fn() { try { return 1 } finally { let y = 2 } }; f()`, 1},
+		{`try { try { throw "inner" } finally { 1 } } catch (e) { e.message }`, "inner"},
+		{`try { try { throw "a" } catch (e) { throw e.message + "b" } } catch (e) { e.message }`, "ab"},
+		{`try { throw "a" } catch (e) { throw e }`, "a"},
+		{`throw "boom"; 1`, "boom"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			switch obj := evaluated.(type) {
+			case *object.String:
+				if obj.Value != expected {
+					t.Errorf("String has wrong value for %q. got=%q, expected=%q", tt.input, obj.Value, expected)
+				}
+			case *object.Array:
+				if obj.Inspect() != expected {
+					t.Errorf("Array has wrong value for %q. got=%s, expected=%s", tt.input, obj.Inspect(), expected)
+				}
+			case *object.Error:
+				if !obj.Thrown || obj.Message != expected {
+					t.Errorf("wrong thrown error for %q. got=%+v, expected=%q", tt.input, obj, expected)
+				}
+			default:
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestUncaughtErrors(t *testing.T) {
+	input := `let f = fn() { throw error("IOError", "disk full") }; f()`
+
+	err, ok := testEval(input).(*object.Error)
+	if !ok || !err.Thrown {
+		t.Fatalf("object is not a thrown Error. got=%T (%+v)", err, err)
+	}
+
+	if err.Inspect() != "IOError: disk full" {
+		t.Errorf("error has wrong value. got=%q", err.Inspect())
+	}
+
+	if len(err.Stack) != 1 || err.Stack[0] != "f" {
+		t.Errorf("error has wrong stack. got=%v", err.Stack)
+	}
+}
+
+func TestLimitErrorsAreNotCaught(t *testing.T) {
+	input := `let f = fn(n) { 1 + f(n + 1) }; try { f(0) } catch (e) { 1 }`
+
+	env := object.NewEnvironment()
+	prog := parser.NewParser(lexer.NewLexer(input)).ParseProgram()
+
+	_, err := EvalContext(context.Background(), prog, env, limit.Limits{MaxDepth: 10})
+	if err != ErrStackOverflow {
+		t.Errorf("wrong error. want %v, got=%v", ErrStackOverflow, err)
+	}
+}
+
+func TestPropagate(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let f = fn(r) { r? + 1 }; f(ok(1))`, "2"},
+		{`let f = fn(r) { r? + 1 }; f(err("bad"))`, "err(bad)"},
+		{`let f = fn(o) { some(o? * 2) }; f(some(2))`, "some(4)"},
+		{`let f = fn(o) { some(o? * 2) }; f(none)`, "none"},
+		{`let check = fn(n) { if (n > 0) { ok(n) } else { err("negative") } };
+		  let sum = fn(a, b) { ok(check(a)? + check(b)?) };
+		  sum(1, -1)`, "err(negative)"},
+		{`let f = fn() { let x = err(1)?; 2 }; f()`, "err(1)"},
+		{`let f = fn() { try { err(1)? } finally { 2 } }; f()`, "err(1)"},
+		{`none?; 1`, "none"},
+		{`unwrap_or(err(1), 2) + unwrap(some(1))`, "3"},
+		{`is_ok(ok(1)) == true`, "true"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%s, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+
+	err, ok := testEval(`let f = fn(x) { x? }; f(1)`).(*object.Error)
+	if !ok || err.Message != "operator ? not supported for INTEGER" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
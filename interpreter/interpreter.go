@@ -4,19 +4,25 @@ import (
 	"fmt"
 
 	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/limit"
 	"github.com/marmotini/ngiri-lang/object"
+	"github.com/marmotini/ngiri-lang/pattern"
 )
 
 var (
 	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	TRUE  = object.True
+	FALSE = object.False
 )
 
 func Eval(
 	node ast.Node,
 	env *object.Environment) object.Object {
 
+	if err := env.Budget().Step(); err != nil {
+		return newError("%s", err)
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
 		return evalProgram(node, env)
@@ -25,49 +31,70 @@ func Eval(
 		return Eval(node.Expression, env)
 
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}
+		return track(env, &object.Integer{Value: node.Value})
 
 	case *ast.Boolean:
 		return nativeBoolean(node.Value)
 
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
 
-		return evalPrefixExpression(node.Operator, right)
+		return track(env, evalPrefixExpression(node.Operator, right))
 	case *ast.InfixExpression:
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if isAbrupt(left) {
 			return left
 		}
 
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
 
-		return evalInfixExpression(node.Operator, left, right)
+		return track(env, evalInfixExpression(node.Operator, left, right))
 	case *ast.BlockStatement:
-		return evalBlockStatements(node, env)
+		return evalBlockStatements(node, object.NewEnclosedEnvironment(env), Eval)
 
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return evalIfExpression(node, env, Eval)
+
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+
+	case *ast.PropagateExpression:
+		return evalPropagateExpression(node, env)
+
+	case *ast.ThrowStatement:
+		value := Eval(node.Value, env)
+		if isAbrupt(value) {
+			return value
+		}
+		return object.ThrowValue(value)
 
 	case *ast.ReturnStatement:
-		value := Eval(node.ReturnValue, env)
-		if isError(value) {
+		value := evalTail(node.ReturnValue, env)
+		if isAbrupt(value) {
 			return value
 		}
 		return &object.ReturnValue{Value: value}
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
-		if isError(val) {
+		if isAbrupt(val) {
 			return val
 		}
 
-		env.Set(node.Name.Value, val)
+		if node.Pattern != nil {
+			return destructure(node.Pattern, val, env, node.Const())
+		}
+
+		if err := env.Declare(node.Name.Value, val, node.Const()); err != nil {
+			return newError("%s", err)
+		}
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 
@@ -75,22 +102,49 @@ func Eval(
 		params := node.Parameters
 		body := node.Body
 
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return track(env, &object.Function{Name: node.Name, Parameters: params, Env: env, Body: body})
+
+	case *ast.MacroLiteral:
+		// DefineMacros takes the macros out of the program before it runs.
+		return newError("macro literals are only allowed in top-level let statements")
 
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
-		if isError(function) {
-			return function
+		if isQuoteCall(node) {
+			return quote(node.Arguments[0], env)
 		}
 
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
+		call, abrupt := evalCall(node, env)
+		if abrupt != nil {
+			return abrupt
 		}
 
-		return applyFunction(function, args)
+		return applyFunction(call.fn, call.args, call.names, env.Budget())
 	case *ast.StringLiteral:
-		return &object.String{Value: node.Value}
+		return track(env, &object.String{Value: node.Value})
+	case *ast.ImportStatement:
+		return evalImportStatement(node, env)
+	case *ast.ExportStatement:
+		return evalExportStatement(node, env)
+	case *ast.SelectorExpression:
+		return evalSelectorExpression(node, env)
+	case *ast.ListLiteral:
+		return evalListLiteral(node, env)
+	case *ast.HashLiteral:
+		return evalHashLiteral(node, env)
+	case *ast.IndexExpression:
+		return evalIndexExpression(node, env)
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env, Eval)
+	case *ast.StructStatement:
+		return evalStructStatement(node, env)
+	case *ast.StructLiteral:
+		return evalStructLiteral(node, env)
+	case *ast.EnumStatement:
+		return evalEnumStatement(node, env)
+	case *ast.FieldAssignExpression:
+		return evalFieldAssignExpression(node, env)
+	case *ast.ImplStatement:
+		return evalImplStatement(node, env)
 	}
 
 	return nil
@@ -105,30 +159,39 @@ func evalProgram(
 	for _, statement := range prog.Statements {
 		results = Eval(statement, env)
 
-		switch r := results.(type) {
+		switch r := finishTailCall(results, env.Budget()).(type) {
 		case *object.ReturnValue:
 			return r.Value
 		case *object.Error:
-			return r
+			if r.Thrown {
+				return r
+			}
 		}
 	}
 
 	return results
 }
 
+// evalBlockStatements evaluates the statements of block in env, the last one
+// with eval, which is evalTail for blocks in tail position. Blocks get an
+// environment of their own, except for the bodies of functions, match arms
+// and catch blocks, which share theirs with the names bound for them.
 func evalBlockStatements(
 	block *ast.BlockStatement,
-	env *object.Environment) object.Object {
+	env *object.Environment,
+	eval evaluator) object.Object {
 
 	var results object.Object
 
-	for _, statement := range block.Statements {
-		results = Eval(statement, env)
+	for i, statement := range block.Statements {
+		if i == len(block.Statements)-1 {
+			results = eval(statement, env)
+		} else {
+			results = Eval(statement, env)
+		}
 
 		if results != nil {
-			r := results.Type()
-
-			if r == object.RETURN_VALUE_OBJ || r == object.ERROR_OBJ {
+			if results.Type() == object.RETURN_VALUE_OBJ || isError(results) {
 				return results
 			}
 		}
@@ -196,9 +259,9 @@ func evalInfixExpression(
 	case left.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
 	case operator == "==":
-		return nativeBoolean(left == right)
+		return nativeBoolean(object.Equal(left, right))
 	case operator == "!=":
-		return nativeBoolean(left != right)
+		return nativeBoolean(!object.Equal(left, right))
 	}
 
 	return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
@@ -207,11 +270,19 @@ func evalInfixExpression(
 func evalStringInfixExpression(
 	operator string,
 	left, right object.Object) object.Object {
-	if operator != "+" {
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	l := left.(*object.String).Value
+	r := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: l + r}
+	case "==":
+		return nativeBoolean(l == r)
+	case "!=":
+		return nativeBoolean(l != r)
 	}
 
-	return &object.String{Value: fmt.Sprintf("%s%s", left.Inspect(), right.Inspect())}
+	return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 }
 
 func evalIntegerInfixExpression(
@@ -227,6 +298,9 @@ func evalIntegerInfixExpression(
 	case "-":
 		return &object.Integer{Value: l - r}
 	case "/":
+		if r == 0 {
+			return newError("division by zero")
+		}
 		return &object.Integer{Value: l / r}
 	case "*":
 		return &object.Integer{Value: l * r}
@@ -244,19 +318,21 @@ func evalIntegerInfixExpression(
 	return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 }
 
+// evalIfExpression evaluates the branch the condition picks with eval.
 func evalIfExpression(
 	node *ast.IfExpression,
-	env *object.Environment) object.Object {
+	env *object.Environment,
+	eval evaluator) object.Object {
 
 	condition := Eval(node.Condition, env)
-	if isError(condition) {
+	if isAbrupt(condition) {
 		return condition
 	}
 
 	if isTruthy(condition) {
-		return Eval(node.Consequence, env)
+		return eval(node.Consequence, env)
 	} else if node.Alternative != nil {
-		return Eval(node.Alternative, env)
+		return eval(node.Alternative, env)
 	} else {
 		return NULL
 	}
@@ -275,16 +351,37 @@ func isTruthy(obj object.Object) bool {
 	}
 }
 
+// track charges the memory budget of env for obj, which must have just been
+// allocated.
+func track(env *object.Environment, obj object.Object) object.Object {
+	if err := env.Budget().Alloc(object.SizeOf(obj)); err != nil {
+		return newError("%s", err)
+	}
+
+	return obj
+}
+
+// environmentSize estimates the bytes of an environment holding n bindings.
+func environmentSize(n int) int64 {
+	return 48 + 32*int64(n)
+}
+
 func newError(format string, s ...interface{}) object.Object {
-	return &object.Error{Message: fmt.Sprintf(format, s)}
+	return &object.Error{Message: fmt.Sprintf(format, s...), Kind: object.RuntimeError, Thrown: true}
 }
 
+// isAbrupt reports whether evaluating an expression ended early, by
+// throwing an error or by returning from the function with `?`.
+func isAbrupt(obj object.Object) bool {
+	return isError(obj) || (obj != nil && obj.Type() == object.RETURN_VALUE_OBJ)
+}
+
+// isError reports whether obj is a thrown error. Caught errors are ordinary
+// values.
 func isError(obj object.Object) bool {
-	if obj != nil {
-		return obj.Type() == object.ERROR_OBJ
-	}
+	err, ok := obj.(*object.Error)
 
-	return false
+	return ok && err.Thrown
 }
 
 func evalIdentifier(
@@ -296,8 +393,7 @@ func evalIdentifier(
 		return val
 	}
 
-	builtin, ok := builtins[node.Value]
-	if ok {
+	if builtin, ok := evalBuiltin(node.Value, env); ok {
 		return builtin
 	}
 
@@ -312,7 +408,7 @@ func evalExpressions(
 
 	for _, e := range exps {
 		evaluated := Eval(e, env)
-		if isError(evaluated) {
+		if isAbrupt(evaluated) {
 			return []object.Object{evaluated}
 		}
 
@@ -322,28 +418,211 @@ func evalExpressions(
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// evalArguments evaluates the arguments of a call. The elements of spread
+// arrays are passed one by one, the values of named arguments come last and
+// their names are returned with them. abrupt is set when evaluating an
+// argument ended early.
+func evalArguments(exps []ast.Expression, env *object.Environment) (args []object.Object, names []string, abrupt object.Object) {
+	for _, e := range exps {
+		switch e := e.(type) {
+		case *ast.SpreadExpression:
+			value := Eval(e.Value, env)
+			if isAbrupt(value) {
+				return nil, nil, value
+			}
+
+			array, ok := value.(*object.Array)
+			if !ok {
+				return nil, nil, newError("can not spread %s, want ARRAY", value.Type())
+			}
+			args = append(args, array.Elements...)
+		case *ast.NamedArgument:
+			value := Eval(e.Value, env)
+			if isAbrupt(value) {
+				return nil, nil, value
+			}
+
+			args = append(args, value)
+			names = append(names, e.Name.Value)
+		default:
+			value := Eval(e, env)
+			if isAbrupt(value) {
+				return nil, nil, value
+			}
+
+			args = append(args, value)
+		}
+	}
+
+	return args, names, nil
+}
+
+// applyFunction calls fn on behalf of a caller that is limited by budget. The
+// call is charged to the caller's budget even if fn was defined under
+// another one. The last len(names) arguments are passed by name.
+//
+// Calls in tail position of fn's body are made here, one after the other,
+// rather than from inside of the body, see evalTail.
+func applyFunction(fn object.Object, args []object.Object, names []string, budget *limit.Budget) object.Object {
+	for {
+		result := apply(fn, args, names, budget)
+
+		call, ok := result.(*tailCall)
+		if !ok {
+			return result
+		}
+
+		fn, args, names = call.fn, call.args, call.names
+	}
+}
+
+// apply calls fn, it returns the next call when fn ends with a tail call.
+func apply(fn object.Object, args []object.Object, names []string, budget *limit.Budget) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
-		extendedEnv := extendedFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
+		if err := budget.Enter(); err != nil {
+			return newError("%s", err)
+		}
+		defer budget.Leave()
+
+		if err := budget.Alloc(environmentSize(len(args))); err != nil {
+			return newError("%s", err)
+		}
+
+		extendedEnv, abrupt := extendedFunctionEnv(fn, args, names, budget)
+		if abrupt != nil {
+			if err, ok := abrupt.(*object.Error); ok {
+				err.Unwind(fn.Name)
+			}
+			return unwrapReturnValue(abrupt)
+		}
+		evaluated := evalBlockStatements(fn.Body, extendedEnv, evalTail)
+
+		if err, ok := evaluated.(*object.Error); ok && err.Thrown {
+			err.Unwind(fn.Name)
+		}
 
 		return unwrapReturnValue(evaluated)
 	case *object.BuiltIn:
-		return fn.FN(args...)
+		if len(names) > 0 {
+			return newError("builtin functions take no named arguments")
+		}
+
+		result := fn.FN(args...)
+		if err, ok := result.(*object.Error); ok && err.Thrown {
+			return err.Throw()
+		}
+		if result != nil {
+			return result
+		}
+		return NULL
+	case *object.BoundMethod:
+		return applyMethod(fn, args, names, budget)
+	case *object.VariantType:
+		if len(names) > 0 {
+			return newError("variant constructors take no named arguments")
+		}
+
+		v, err := fn.New(args)
+		if err != nil {
+			return newError("%s", err)
+		}
+
+		if err := budget.Alloc(object.SizeOf(v)); err != nil {
+			return newError("%s", err)
+		}
+
+		return v
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
 }
 
-func extendedFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+// extendedFunctionEnv binds the arguments of a call of fn. Default values
+// are evaluated in the new environment, after the parameters before them
+// are bound. It fails when the arguments do not fit the signature of fn or
+// an argument does not fit the pattern of its parameter, and ends early
+// when evaluating a default value does.
+func extendedFunctionEnv(fn *object.Function, args []object.Object, names []string, budget *limit.Budget) (*object.Environment, object.Object) {
+	values, err := fn.Signature().Bind(args, names)
+	if err != nil {
+		return nil, newError("%s", err)
+	}
+
 	env := object.NewEnclosedEnvironment(fn.Env)
+	env.SetBudget(budget)
+
+	for i, param := range fn.Parameters {
+		value := values[i]
+
+		if d, ok := param.(*ast.DefaultParameter); ok {
+			param = d.Parameter
 
-	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+			if value == nil {
+				value = Eval(d.Value, env)
+				if isAbrupt(value) {
+					return nil, value
+				}
+			}
+		}
+
+		if rest, ok := param.(*ast.SpreadExpression); ok {
+			param = rest.Value
+		}
+
+		if ident, ok := param.(*ast.Identifier); ok {
+			env.Set(ident.Value, value)
+			continue
+		}
+
+		if err := destructure(param, value, env, false); err != nil {
+			return nil, err
+		}
+	}
+
+	return env, nil
+}
+
+// destructure declares the identifiers of pat in env, as constants when
+// constant is set, bound to the parts of value. It returns nil, or an error
+// when value does not have the shape of pat.
+func destructure(pat ast.Expression, value object.Object, env *object.Environment, constant bool) object.Object {
+	values, err := pattern.Destructure(pat, value)
+	if err != nil {
+		return newError("%s", err)
+	}
+
+	for i, ident := range pattern.Bindings(pat) {
+		if err := env.Declare(ident.Value, values[i], constant); err != nil {
+			return newError("%s", err)
+		}
+	}
+
+	return nil
+}
+
+// evalAssignExpression stores the value of node in the variable it assigns
+// and evaluates to the value. Constants, builtins and modules can not be
+// assigned.
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	name := node.Name.Value
+	if current, ok := env.Get(name); ok && current.Type() == object.MODULE_OBJ {
+		return newError("cannot assign to module %s", name)
+	}
+
+	val := Eval(node.Value, env)
+	if isAbrupt(val) {
+		return val
+	}
+
+	if err := env.Assign(name, val); err != nil {
+		if _, ok := evalBuiltin(name, env); ok {
+			return newError("cannot assign to builtin %s", name)
+		}
+		return newError("%s", err)
 	}
 
-	return env
+	return val
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
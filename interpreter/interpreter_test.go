@@ -3,6 +3,7 @@ package interpreter
 import (
 	"testing"
 
+	"github.com/marmotini/ngiri-lang/builtin"
 	"github.com/marmotini/ngiri-lang/lexer"
 	"github.com/marmotini/ngiri-lang/object"
 	"github.com/marmotini/ngiri-lang/parser"
@@ -217,6 +218,65 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
+func TestCallArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let f = fn(x, y = 10) { x + y }; f(1)`, "11"},
+		{`let f = fn(x, y = 10) { x + y }; f(1, 2)`, "3"},
+		{`let f = fn(x, y = x * 2) { y }; f(4)`, "8"},
+		{`let x = 1; let f = fn(x = x + 1) { x }; f()`, "2"},
+		{`let f = fn(a, [b, c] = [2, 3]) { a + b + c }; f(1)`, "6"},
+		{`let f = fn(first, ...rest) { rest }; f(1, 2, 3)`, "[2, 3]"},
+		{`let f = fn(first, ...rest) { rest }; f(1)`, "[]"},
+		{`let f = fn(x, y, z) { x * 100 + y * 10 + z }; let args = [2, 3]; f(1, ...args)`, "123"},
+		{`let f = fn(...xs) { len(xs) }; f(...[1, 2], 3, ...[])`, "3"},
+		{`len(...["abc"])`, "3"},
+		{`let f = fn(x, y) { x - y }; f(y: 2, x: 1)`, "-1"},
+		{`let f = fn(x, y = 2, z = 3) { x + y * 10 + z * 100 }; f(1, z: 5)`, "521"},
+		{`let f = fn(x, y) { x }; try { f(1, 2, 3) } catch (e) { e.message }`, "f(x, y) takes 2 arguments, got 3"},
+		{`let f = fn(x, y = 1) { x }; try { f() } catch (e) { e.message }`, "f(x, y = 1) is missing the argument x"},
+		{`let f = fn(x, y = 1) { x }; try { f(1, 2, 3) } catch (e) { e.message }`, "f(x, y = 1) takes at most 2 arguments, got 3"},
+		{`let f = fn(x) { x }; try { f(z: 1) } catch (e) { e.message }`, "f(x) has no parameter z"},
+		{`let f = fn(x) { x }; try { f(1, x: 1) } catch (e) { e.message }`, "f(x) got the argument x twice"},
+		{`try { fn(x) { x }(...1) } catch (e) { e.message }`, "can not spread INTEGER, want ARRAY"},
+		{`try { len(x: "a") } catch (e) { e.message }`, "builtin functions take no named arguments"},
+		{`let f = fn(x, y) { x }; try { f(1) } catch (e) { e.stack }`, "[f]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, expected=%s", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let loop = fn(n, acc) { if (n == 0) { acc } else { loop(n - 1, acc + n) } }; loop(100000, 0)`, "5000050000"},
+		{`let loop = fn(n) { if (n == 0) { return "done" } return loop(n - 1) }; loop(100000)`, "done"},
+		{`let loop = fn(n) { match (n) { 0 => "done", _ => loop(n - 1) } }; loop(100000)`, "done"},
+		{`let loop = fn(n, acc = 0) { if (n == 0) { acc } else { loop(n - 1, acc + 1) } }; loop(100000)`, "100000"},
+		{`let odd = fn(n, even) { if (n == 0) { false } else { even(n - 1) } }; let even = fn(n) { if (n == 0) { true } else { odd(n - 1, even) } }; even(100001)`, "false"},
+		{`let f = fn(a) { len(a) }; f([1, 2])`, "2"},
+		{`let g = fn() { throw "g" }; let f = fn() { try { g() } catch (e) { e.message } }; f()`, "g"},
+		{`let g = fn() { throw "g" }; let f = fn() { try { return g() } catch (e) { e.stack } }; f()`, "[g]"},
+		{`let g = fn() { 1 }; let f = fn() { try { return g() } finally { throw "f" } }; try { f() } catch (e) { e.message }`, "f"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, expected=%s", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
 func TestStringLiteral(t *testing.T) {
 	input := `"Hello world";`
 
@@ -253,8 +313,8 @@ func TestBuiltInFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("Hello world")`, 11},
-		{`len(1)`, "argument to `len` not supported, got [INTEGER]"},
-		{`len("one", "two")`, "wrong number of arguments. got=[2], want=1"},
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
 	}
 
 	for _, tt := range tests {
@@ -275,3 +335,166 @@ func TestBuiltInFunctions(t *testing.T) {
 		}
 	}
 }
+
+func TestBuiltinPolicy(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("four")`, 4},
+		{`let f = fn() { puts("a") }; f()`, "puts needs the io capability, which is not allowed"},
+		{`let puts = fn(x) { 1 }; puts("a")`, 1},
+		{`random(1)`, 0},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		Link(env, builtin.NewPolicy(builtin.Random))
+
+		obj := Eval(parser.NewParser(lexer.NewLexer(tt.input)).ParseProgram(), env)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, obj, int64(expected))
+		case string:
+			errObj, ok := obj.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", obj, obj)
+				continue
+			}
+
+			if errObj.Message != expected {
+				t.Errorf("Wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestMethods(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`struct P { x, y }; impl P { fn sum(self) { self.x + self.y } }; P{x: 1, y: 2}.sum()`, "3"},
+		{`struct P { x }; impl P { fn add(self, n) { self.x + n } fn twice(self) { self.add(self.x) } }; P{x: 4}.twice()`, "8"},
+		{`struct P { x }; impl P { fn get(self) { self.x } }; let p = P{x: 7}; let f = p.get; [f, f()]`, "[method P.get, 7]"},
+		{`struct P { f }; P{f: fn(a) { a * 2 }}.f(21)`, "42"},
+		{`struct P { x }; impl P { fn add(self, a, b = 10) { self.x + a + b } }; P{x: 1}.add(b: 1, a: 1)`, "3"},
+		{`struct P { x }; let k = 5; impl P { fn get(self) { self.x + k } }; P{x: 1}.get()`, "6"},
+		{`struct P { x }; impl P { fn x(self) { 1 } }`, "RuntimeError: struct P already has a field x"},
+		{`let P = 1; impl P { fn x(self) { 1 } }`, "RuntimeError: P is not a struct type"},
+		{`struct P { x }; P{x: 1}.nope()`, "RuntimeError: struct P has no field or method nope"},
+		{`"abc".upper() + "ABC".lower()`, "ABCabc"},
+		{`let up = "abc".upper; up`, "method STRING.upper"},
+		{`[1, 2, 3].map(fn(x) { x * 2 }).filter(fn(x) { x > 2 })`, "[4, 6]"},
+		{`let n = 10; [1, 2].reduce(fn(acc, x) { acc + x * n }, 0)`, "30"},
+		{`{"b": 2, "a": 1}.keys()`, "[a, b]"},
+		{`[1, 2].map(fn(x) { throw "no" })`, "Error: no"},
+		{`try { [1].map(fn(x) { x.y }) } catch (e) { e.message }`, "can not select y from INTEGER"},
+		{`"a".split(1)`, "RuntimeError: argument 1 to `split` must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, expected=%s", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestBlockScopes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let x = 1; if (true) { let x = 2; x }; x`, "1"},
+		{`let x = 1; if (true) { let x = 2; x }`, "2"},
+		{`let x = 1; if (true) { x = 2 }; x`, "2"},
+		{`let x = 1; let y = x = x + 1; [x, y]`, "[2, 2]"},
+		{`let x = 1; let f = fn() { x = x * 10 }; f(); f(); x`, "100"},
+		{`let f = fn(n) { let a = 0; if (n > 0) { a = n; let a = 5 }; a }; f(7)`, "7"},
+		{`let x = 1; match (2) { x => x }; x`, "1"},
+		{`let e = 1; try { throw 2 } catch (e) { e.message }; e`, "1"},
+		{`if (true) { let y = 1 }; y`, "RuntimeError: identifier not found: y"},
+		{`let x = 1; let x = 2;`, "RuntimeError: x is already declared in this scope"},
+		{`let f = fn(x) { let x = 1 }; f(0)`, "RuntimeError: x is already declared in this scope"},
+		{`let [a, a] = [1, 2];`, "RuntimeError: a is already declared in this scope"},
+		{`try { throw 1 } catch (e) { let e = 2 }`, "RuntimeError: e is already declared in this scope"},
+		{`const x = 1; x = 2`, "RuntimeError: cannot assign to constant x"},
+		{`const [a, b] = [1, 2]; let f = fn() { b = 3 }; f()`, "RuntimeError: cannot assign to constant b"},
+		{`y = 1`, "RuntimeError: identifier not found: y"},
+		{`len = 1`, "RuntimeError: cannot assign to builtin len"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, expected=%s", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestStructs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`struct Point { x, y }; Point{y: 2, x: 1}`, "Point{x: 1, y: 2}"},
+		{`struct Point { x, y }; Point{x: 1}`, "Point{x: 1, y: null}"},
+		{`struct Point { x, y }; Point`, "struct Point"},
+		{`struct Point { x, y }; let p = Point{x: 1, y: 2}; p.x + p.y`, "3"},
+		{`struct Point { x, y }; let p = Point{}; p.x = p.y = 3; p`, "Point{x: 3, y: 3}"},
+		{`struct P { x }; let f = fn(p) { p.x = p.x + 1 }; let p = P{x: 1}; f(p); p.x`, "2"},
+		{`struct P { x, y }; P{x: 1, y: "a"} == P{x: 1, y: "a"}`, "true"},
+		{`struct P { x, y }; P{x: 1, y: [1]} == P{x: 1, y: [1]}`, "false"},
+		{`struct P { x }; struct Q { x }; P{x: 1} != Q{x: 1}`, "true"},
+		{`struct P { x }; P{x: 1}.y`, "RuntimeError: struct P has no field or method y"},
+		{`struct P { x }; P{y: 1}`, "RuntimeError: struct P has no field y"},
+		{`let P = 1; P{x: 1}`, "RuntimeError: P is not a struct type"},
+		{`struct P { x }; let a = 1; a.x = 2`, "RuntimeError: can not set x on INTEGER"},
+		{`struct P { x }; P{x: 1}.y = 2`, "RuntimeError: struct P has no field y"},
+		{`struct P { x }; P = 1`, "RuntimeError: cannot assign to constant P"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, expected=%s", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestEnums(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`enum Shape { Circle(r), Rect(w, h), Empty }; Shape.Circle(3)`, "Shape.Circle(3)"},
+		{`enum Shape { Circle(r), Rect(w, h), Empty }; [Shape.Rect(1, "a"), Shape.Empty]`, "[Shape.Rect(1, a), Shape.Empty]"},
+		{`enum Shape { Circle(r), Empty }; [Shape, Shape.Circle]`, "[enum Shape, Shape.Circle]"},
+		{`enum Shape { Circle(r), Rect(w, h) }; let s = Shape.Rect(2, 5); s.w * s.h`, "10"},
+		{`enum Shape { Circle(r), Empty }; [tag_of(Shape.Circle(1)), tag_of(Shape.Empty)]`, "[Circle, Empty]"},
+		{`enum Shape { Circle(r), Empty }; [Shape.Circle(1) == Shape.Circle(1), Shape.Circle(1) == Shape.Circle(2), Shape.Empty == Shape.Empty]`, "[true, false, true]"},
+		{`enum A { X(v) }; enum B { X(v) }; A.X(1) == B.X(1)`, "false"},
+		{`enum Shape { Circle(r) }; [1, 2].map(Shape.Circle)`, "[Shape.Circle(1), Shape.Circle(2)]"},
+		{`enum Shape { Circle(r), Rect(w, h), Empty }; let area = fn(s) { match (s) { Shape.Circle(r) => 3 * r * r, Rect(w, h) => w * h, Shape.Empty => 0 } }; [area(Shape.Circle(2)), area(Shape.Rect(2, 5)), area(Shape.Empty)]`, "[12, 10, 0]"},
+		{`enum T { Leaf, Node(l, v, r) }; let sum = fn(t) { match (t) { T.Leaf => 0, T.Node(l, v, r) => sum(l) + v + sum(r) } }; sum(T.Node(T.Node(T.Leaf, 1, T.Leaf), 2, T.Leaf))`, "3"},
+		{`enum O { Some(v), None }; match (O.Some(5)) { Some(1) => 1, Some(n) if n > 2 => n * 2, _ => 0 }`, "10"},
+		{`enum Shape { Circle(r), Empty }; let f = fn() { Shape.Circle(1) }; f().r`, "1"},
+		{`enum Shape { Circle(r), Empty }; Shape.Circle(1, 2)`, "RuntimeError: wrong number of arguments for Shape.Circle. got=2, want=1"},
+		{`enum Shape { Circle(r), Empty }; Shape.Square`, "RuntimeError: enum Shape has no variant Square"},
+		{`enum Shape { Circle(r), Empty }; Shape.Circle(1).x`, "RuntimeError: variant Shape.Circle has no field x"},
+		{`enum Shape { Circle(r), Empty }; Shape.Circle(1).r = 2`, "RuntimeError: can not set r on VARIANT"},
+		{`enum Shape { Circle(r), Empty }; Shape.Circle(r: 1)`, "RuntimeError: variant constructors take no named arguments"},
+		{`enum Shape { Circle(r), Empty }; Shape.Empty(1)`, "RuntimeError: not a function: VARIANT"},
+		{`enum Shape { Circle(r), Empty }; match (Shape.Empty) { Shape.Circle(r) => r }`, "RuntimeError: no match arm matches Shape.Empty"},
+		{`enum Shape { Circle(r) }; Shape = 1`, "RuntimeError: cannot assign to constant Shape"},
+		{`tag_of(1)`, "RuntimeError: argument to `tag_of` must be VARIANT, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, expected=%s", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
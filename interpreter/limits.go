@@ -0,0 +1,53 @@
+package interpreter
+
+import (
+	"context"
+
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/limit"
+	"github.com/marmotini/ngiri-lang/object"
+)
+
+var (
+	ErrBudgetExceeded = limit.ErrBudgetExceeded
+	ErrTimeout        = limit.ErrTimeout
+	ErrCancelled      = limit.ErrCancelled
+	ErrStackOverflow  = limit.ErrStackOverflow
+)
+
+// EvalContext evaluates node like Eval within limits. It stops when ctx is
+// done or a limit is hit and returns ErrCancelled, ErrBudgetExceeded,
+// ErrTimeout or ErrStackOverflow; the error objects of the program itself are returned as
+// values like Eval does.
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment, limits limit.Limits) (object.Object, error) {
+	budget := limit.NewBudget(ctx, limits)
+
+	outer := env.Budget()
+	env.SetBudget(budget)
+	defer env.SetBudget(outer)
+
+	result := Eval(node, env)
+	if err := budget.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ExpandMacrosContext is ExpandMacros running the macros within limits, see
+// EvalContext. It returns ErrCancelled, ErrBudgetExceeded, ErrTimeout or
+// ErrStackOverflow when a macro hits them.
+func ExpandMacrosContext(ctx context.Context, program ast.Node, env *object.Environment, limits limit.Limits) (ast.Node, error) {
+	budget := limit.NewBudget(ctx, limits)
+
+	outer := env.Budget()
+	env.SetBudget(budget)
+	defer env.SetBudget(outer)
+
+	expanded, err := ExpandMacros(program, env)
+	if budgetErr := budget.Err(); budgetErr != nil {
+		return nil, budgetErr
+	}
+
+	return expanded, err
+}
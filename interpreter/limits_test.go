@@ -0,0 +1,69 @@
+package interpreter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/marmotini/ngiri-lang/lexer"
+	"github.com/marmotini/ngiri-lang/limit"
+	"github.com/marmotini/ngiri-lang/object"
+	"github.com/marmotini/ngiri-lang/parser"
+)
+
+func TestEvalContextLimits(t *testing.T) {
+	countdown := `let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; `
+	tail := `let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; `
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		input    string
+		ctx      context.Context
+		limits   limit.Limits
+		expected error
+	}{
+		{countdown + "f(500)", context.Background(), limit.Limits{}, nil},
+		{countdown + "f(500)", context.Background(), limit.Limits{Steps: 100}, ErrBudgetExceeded},
+		{countdown + "f(500)", context.Background(), limit.Limits{Timeout: time.Nanosecond}, ErrTimeout},
+		{countdown + "f(500)", context.Background(), limit.Limits{MaxDepth: 10}, ErrStackOverflow},
+		{countdown + "f(500)", cancelled, limit.Limits{}, ErrCancelled},
+		{countdown + "f(5000)", context.Background(), limit.Limits{}, ErrStackOverflow},
+		{`let f = fn(s) { f(s + "abcdefgh") }; f("")`, context.Background(), limit.Limits{Memory: 1000}, ErrBudgetExceeded},
+		{tail + "f(100000)", context.Background(), limit.Limits{MaxDepth: 10}, nil},
+		{`let f = fn() { f() }; f()`, context.Background(), limit.Limits{Steps: 10000}, ErrBudgetExceeded},
+	}
+
+	for _, tt := range tests {
+		program := parser.NewParser(lexer.NewLexer(tt.input)).ParseProgram()
+
+		_, err := EvalContext(tt.ctx, program, object.NewEnvironment(), tt.limits)
+		if err != tt.expected {
+			t.Errorf("wrong error for %s (%+v). want=%v, got=%v", tt.input, tt.limits, tt.expected, err)
+		}
+	}
+}
+
+func TestEvalContextChargesCaller(t *testing.T) {
+	env := object.NewEnvironment()
+	program := parser.NewParser(lexer.NewLexer(`let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } };`)).ParseProgram()
+
+	_, err := EvalContext(context.Background(), program, env, limit.Limits{Steps: 1000})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// f was defined under the first budget but is limited by the second
+	call := parser.NewParser(lexer.NewLexer(`f(100)`)).ParseProgram()
+
+	_, err = EvalContext(context.Background(), call, env, limit.Limits{Steps: 10})
+	if err != ErrBudgetExceeded {
+		t.Errorf("wrong error. want=%v, got=%v", ErrBudgetExceeded, err)
+	}
+
+	result, err := EvalContext(context.Background(), call, env, limit.Limits{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	testIntegerObject(t, result, 0)
+}
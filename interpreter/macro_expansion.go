@@ -0,0 +1,118 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/object"
+)
+
+// DefineMacros binds every top level `let name = macro(...) {...}` of program
+// in env and removes the definitions from the program. It runs before
+// ExpandMacros, ahead of both evaluation and compilation.
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	statements := program.Statements[:0]
+
+	for _, statement := range program.Statements {
+		let, ok := statement.(*ast.LetStatement)
+		if !ok {
+			statements = append(statements, statement)
+			continue
+		}
+
+		macro, ok := let.Value.(*ast.MacroLiteral)
+		if !ok || let.Name == nil {
+			statements = append(statements, statement)
+			continue
+		}
+
+		env.Set(let.Name.Value, &object.Macro{
+			Parameters: macro.Parameters,
+			Body:       macro.Body,
+			Env:        env,
+		})
+	}
+
+	program.Statements = statements
+}
+
+// ExpandMacros replaces every call of a macro bound in env with the quoted
+// code the macro returns. Arguments are handed to the macro unevaluated.
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, error) {
+	var err error
+
+	expanded := ast.Rewrite(program, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || err != nil {
+			return node
+		}
+
+		macro, ok := macroOf(call, env)
+		if !ok {
+			return node
+		}
+
+		if len(call.Arguments) != len(macro.Parameters) {
+			err = fmt.Errorf("%s: macro %s takes %d arguments, got %d",
+				call.Pos(), call.Function, len(macro.Parameters), len(call.Arguments))
+			return node
+		}
+
+		macroEnv := extendedMacroEnv(macro, call.Arguments)
+		evaluated := unwrapReturnValue(finishTailCall(evalBlockStatements(macro.Body, macroEnv, Eval), macroEnv.Budget()))
+		if isError(evaluated) {
+			err = fmt.Errorf("%s: expanding macro %s: %s", call.Pos(), call.Function, evaluated.(*object.Error).Message)
+			return node
+		}
+
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			err = fmt.Errorf("%s: macro %s must return a quote, got %s", call.Pos(), call.Function, typeOf(evaluated))
+			return node
+		}
+
+		exp, ok := quote.Node.(ast.Expression)
+		if !ok {
+			err = fmt.Errorf("%s: macro %s must return an expression", call.Pos(), call.Function)
+			return node
+		}
+
+		return exp
+	})
+
+	return expanded, err
+}
+
+func macroOf(call *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+
+	obj, ok := env.Get(ident.Value)
+	if !ok {
+		return nil, false
+	}
+
+	macro, ok := obj.(*object.Macro)
+
+	return macro, ok
+}
+
+func extendedMacroEnv(macro *object.Macro, args []ast.Expression) *object.Environment {
+	env := object.NewEnclosedEnvironment(macro.Env)
+
+	for paramIdx, param := range macro.Parameters {
+		env.Set(param.Value, &object.Quote{Node: args[paramIdx]})
+	}
+
+	return env
+}
+
+func typeOf(obj object.Object) object.ObjectType {
+	if obj == nil {
+		return object.NULL_OBJ
+	}
+
+	return obj.Type()
+}
@@ -0,0 +1,49 @@
+package interpreter
+
+import (
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/object"
+	"github.com/marmotini/ngiri-lang/pattern"
+)
+
+// evalMatchExpression evaluates the body of the first arm that matches with
+// eval. The identifiers of a pattern are bound in an environment of the arm
+// before its guard is evaluated.
+func evalMatchExpression(node *ast.MatchExpression, env *object.Environment, eval evaluator) object.Object {
+	subject := Eval(node.Subject, env)
+	if isAbrupt(subject) {
+		return subject
+	}
+
+	for _, arm := range node.Arms {
+		values, ok := pattern.Match(arm.Pattern, subject)
+		if !ok {
+			continue
+		}
+
+		armEnv := object.NewEnclosedEnvironment(env)
+		for i, ident := range pattern.Bindings(arm.Pattern) {
+			armEnv.Set(ident.Value, values[i])
+		}
+
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, armEnv)
+			if isAbrupt(guard) {
+				return guard
+			}
+
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+
+		result := evalBlockStatements(arm.Body, armEnv, eval)
+		if result == nil {
+			return NULL
+		}
+
+		return result
+	}
+
+	return newError("no match arm matches %s", subject.Inspect())
+}
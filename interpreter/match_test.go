@@ -0,0 +1,114 @@
+package interpreter
+
+import "testing"
+
+func TestArraysAndHashes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[1, 2 * 2, 3 + 3]`, "[1, 4, 6]"},
+		{`[1, 2, 3][1]`, "2"},
+		{`let i = 0; [1][i]`, "1"},
+		{`[1, 2, 3][3]`, "null"},
+		{`[1, 2, 3][-1]`, "null"},
+		{`{"one": 1, "two": 2}["two"]`, "2"},
+		{`{1: "a", true: "b"}[true]`, "b"},
+		{`{"one": 1}["two"]`, "null"},
+		{`let h = {"a": [1, 2]}; h["a"][1]`, "2"},
+		{`len({"a": 1, "b": 2})`, "2"},
+		{`"a" == "a"`, "true"},
+		{`"a" != "a"`, "false"},
+		{`1[0]`, "RuntimeError: index operator not supported: INTEGER"},
+		{`[1]["a"]`, "RuntimeError: array index must be INTEGER, got STRING"},
+		{`{fn(x) { x }: 1}`, "RuntimeError: unusable as hash key: FUNCTION"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, expected=%s", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	classify := `let classify = fn(x) {
+	match (x) {
+		0 => "zero",
+		-1 => "minus one",
+		"s" => "string",
+		true => "true",
+		[] => "empty",
+		[h] => "one " + h,
+		[h, ...t] => t,
+		{"k": v} => "k is " + v,
+		_ => "other"
+	}
+};`
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{classify + `classify(0)`, "zero"},
+		{classify + `classify(-1)`, "minus one"},
+		{classify + `classify("s")`, "string"},
+		{classify + `classify(true)`, "true"},
+		{classify + `classify(false)`, "other"},
+		{classify + `classify([])`, "empty"},
+		{classify + `classify(["a"])`, "one a"},
+		{classify + `classify(["a", "b", "c"])`, "[b, c]"},
+		{classify + `classify({"k": "v", "j": 1})`, "k is v"},
+		{classify + `classify({"j": 1})`, "other"},
+		{`match (11) { n if n > 10 => "big", _ => "small" }`, "big"},
+		{`match (10) { n if n > 10 => "big", _ => "small" }`, "small"},
+		{`match (true) { n if n > 10 => 1 }`, "RuntimeError: type mismatch: BOOLEAN > INTEGER"},
+		{`match ([1, [2, 3]]) { [a, [b, ...c]] => a + b + len(c) }`, "4"},
+		{`match ([1, 2]) { [_, ...rest] => rest }`, "[2]"},
+		{`match ([1, 2]) { [a] => a, [a, b] => a + b }`, "3"},
+		{`match (5) { n => { let m = n * 2; m } }`, "10"},
+		{`let n = 1; match (5) { n if n < 0 => n, _ => n }`, "1"},
+		{`match (5) { 1 => 1 }`, "RuntimeError: no match arm matches 5"},
+		{`match (1 + true) { _ => 1 }`, "RuntimeError: type mismatch: INTEGER + BOOLEAN"},
+		{`let f = fn(x) { match (x) { 1 => { return 10 } }; 20 }; f(1)`, "10"},
+		{`match (1) { 1 => {} }`, "null"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, expected=%s", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let [a, b, ...rest] = [1, 2, 3, 4]; a + b + len(rest)`, "5"},
+		{`let [a, ...rest] = [1]; rest`, "[]"},
+		{`let {name, age} = {"name": "ann", "age": 3}; name + "/" + age`, "RuntimeError: type mismatch: STRING + INTEGER"},
+		{`let {name, age} = {"name": "ann", "age": 3, "x": 0}; name`, "ann"},
+		{`let {"p": [x, y], 1: z} = {"p": [1, 2], 1: 3}; x + y + z`, "6"},
+		{`let f = fn([a, b], {k}) { a * b + k }; f([2, 3], {"k": 4})`, "10"},
+		{`let f = fn(n, [h, ..._]) { n + h }; f(1, [2, 3])`, "3"},
+		{`let [a, b] = [1]`, "RuntimeError: [a, b] needs 2 elements, got 1"},
+		{`let [a, ...b] = []`, "RuntimeError: [a, ...b] needs at least 1 elements, got 0"},
+		{`let [a] = 1`, "RuntimeError: can not destructure INTEGER with [a], want ARRAY"},
+		{`let {name} = {"age": 1}`, "RuntimeError: {name: name} needs the key name"},
+		{`let {name} = [1]`, "RuntimeError: can not destructure ARRAY with {name: name}, want HASH"},
+		{`let f = fn([a]) { a }; try { f(1) } catch (e) { e.stack }`, "[f]"},
+		{`let f = fn([a]) { a }; try { f(1) } catch (e) { e.message }`, "can not destructure INTEGER with [a], want ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, expected=%s", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
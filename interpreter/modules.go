@@ -0,0 +1,156 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/builtin"
+	"github.com/marmotini/ngiri-lang/module"
+	"github.com/marmotini/ngiri-lang/object"
+)
+
+// evalImportStatement binds the module node imports, or the names it imports
+// from it. Each module is evaluated once per program, in its own environment,
+// and shared by all its importers in the program.
+func evalImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+	if !env.TopLevel() {
+		return newError("import %q is only allowed at the top level", node.Path.Value)
+	}
+
+	dir := "."
+	if m := env.Module(); m != nil {
+		dir = module.Dir(m.Path)
+	}
+
+	imports := env.Imports()
+	loaded, err := imports.Loader.Import(node.Path.Value, dir, func(m *module.Module) error {
+		return loadModule(m, env)
+	})
+	if err != nil {
+		return newError("%s", err)
+	}
+
+	mod := imports.Modules[loaded.Path]
+	if node.Names == nil {
+		env.Set(node.Namespace(), mod)
+		return nil
+	}
+
+	for _, name := range node.Names {
+		val, ok := mod.Exports[name.Value]
+		if !ok {
+			return newError("module %s does not export %s", mod.Name, name.Value)
+		}
+
+		env.Set(name.Value, val)
+	}
+
+	return nil
+}
+
+// loadModule evaluates m with the builtins, the imports and the budget of the
+// importing environment.
+func loadModule(m *module.Module, importer *object.Environment) error {
+	mod := object.NewModule(m.Name, m.Path)
+
+	// The budget only applies while the module is loaded, later calls of
+	// its functions are charged to their callers.
+	env := object.NewModuleEnvironment(mod)
+	env.Link(importer.Builtins())
+	env.LinkImports(importer.Imports())
+	env.SetBudget(importer.Budget())
+	defer env.SetBudget(nil)
+
+	result := Eval(m.Program, env)
+	if isError(result) {
+		return fmt.Errorf("module %s: %s", m.Name, result.(*object.Error).Message)
+	}
+
+	importer.Imports().Modules[m.Path] = mod
+
+	return nil
+}
+
+func evalExportStatement(node *ast.ExportStatement, env *object.Environment) object.Object {
+	name := node.Name().Value
+
+	let, ok := node.Statement.(*ast.LetStatement)
+	if !ok {
+		// struct and enum declarations bind their name themselves
+		if result := Eval(node.Statement, env); isAbrupt(result) {
+			return result
+		}
+
+		val, _ := env.Get(name)
+		if !env.Export(name, val) {
+			return newError("export of %s outside of a module's top level", name)
+		}
+
+		return nil
+	}
+
+	val := Eval(let.Value, env)
+	if isAbrupt(val) {
+		return val
+	}
+
+	if !env.Export(name, val) {
+		return newError("export of %s outside of a module's top level", name)
+	}
+
+	if err := env.Declare(name, val, let.Const()); err != nil {
+		return newError("%s", err)
+	}
+
+	return nil
+}
+
+func evalSelectorExpression(node *ast.SelectorExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isAbrupt(left) {
+		return left
+	}
+
+	switch left := left.(type) {
+	case *object.Module:
+		val, ok := left.Exports[node.Selector.Value]
+		if !ok {
+			return newError("module %s does not export %s", left.Name, node.Selector.Value)
+		}
+		return val
+	case *object.Struct:
+		if val, ok := left.Field(node.Selector.Value); ok {
+			return val
+		}
+
+		method, ok := left.StructType.Methods[node.Selector.Value]
+		if !ok {
+			return newError("struct %s has no field or method %s", left.StructType.Name, node.Selector.Value)
+		}
+		return track(env, &object.BoundMethod{Receiver: left, Name: node.Selector.Value, Method: method})
+	case *object.Error:
+		val, ok := left.Field(node.Selector.Value)
+		if !ok {
+			return newError("error has no field %s", node.Selector.Value)
+		}
+		return val
+	case *object.EnumType:
+		val, err := left.Select(node.Selector.Value)
+		if err != nil {
+			return newError("%s", err)
+		}
+		return val
+	case *object.Variant:
+		val, ok := left.Field(node.Selector.Value)
+		if !ok {
+			return newError("variant %s has no field %s", left.VariantType.Inspect(), node.Selector.Value)
+		}
+		return val
+	default:
+		method, ok := builtin.LookupMethod(left, node.Selector.Value)
+		if !ok {
+			return newError("can not select %s from %s", node.Selector.Value, left.Type())
+		}
+		return track(env, &object.BoundMethod{Receiver: left, Name: node.Selector.Value, Method: method})
+	}
+}
@@ -0,0 +1,138 @@
+package interpreter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/marmotini/ngiri-lang/builtin"
+	"github.com/marmotini/ngiri-lang/lexer"
+	"github.com/marmotini/ngiri-lang/object"
+	"github.com/marmotini/ngiri-lang/parser"
+)
+
+var testModules = map[string]string{
+	"math.ngiri": `
+	let base = 10;
+	export let add = fn(a, b) { a + b };
+	export let addBase = fn(a) { add(a, base) };`,
+	"lib/greet.ngiri": `
+	import "../math";
+	export let greeting = "hello";
+	export let eleven = math.addBase(1);`,
+	"cycle_a.ngiri": `import "cycle_b";`,
+	"cycle_b.ngiri": `import "cycle_a";`,
+	"broken.ngiri":  `export let x = y;`,
+	"shapes.ngiri": `
+	export struct Point { x, y };
+	impl Point { fn sum(self) { self.x + self.y } };
+	export enum Shape { Circle(r), Empty };`,
+	"dice.ngiri": `export let roll = fn() { random(1) };`,
+}
+
+func writeModules(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "ngiri-modules")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range testModules {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(filename), 0755)
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func testEvalModule(dir, input string) object.Object {
+	env := object.NewModuleEnvironment(object.NewModule("main", filepath.Join(dir, "main.ngiri")))
+	return Eval(parser.NewParser(lexer.NewLexer(input)).ParseProgram(), env)
+}
+
+func TestImports(t *testing.T) {
+	dir := writeModules(t)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`import "math"; math.add(1, 2)`, 3},
+		{`import {add, addBase} from "math"; add(1, addBase(2))`, 13},
+		{`import "lib/greet"; greet.eleven`, 11},
+		{`import "math"; import {add} from "./math.ngiri"; add == math.add`, true},
+		{`import "shapes"; let p = shapes.Point{x: 1, y: 2}; p.sum() + p.y`, 5},
+		{`import {Point} from "shapes"; Point{y: 4}.y`, 4},
+		{`import "shapes"; match (shapes.Shape.Circle(3)) { shapes.Shape.Empty => 0, shapes.Shape.Circle(r) => r }`, 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalModule(dir, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestImportPolicies(t *testing.T) {
+	dir := writeModules(t)
+	defer os.RemoveAll(dir)
+
+	eval := func(p *builtin.Policy) object.Object {
+		env := object.NewModuleEnvironment(object.NewModule("main", filepath.Join(dir, "main.ngiri")))
+		Link(env, p)
+		return Eval(parser.NewParser(lexer.NewLexer(`import "dice"; dice.roll()`)).ParseProgram(), env)
+	}
+
+	// every program loads the module with its own builtins
+	testIntegerObject(t, eval(builtin.NewPolicy(builtin.Random)), 0)
+
+	errObj, ok := eval(builtin.NewPolicy()).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned for a module loaded without random")
+	}
+
+	if expected := "random needs the random capability, which is not allowed"; errObj.Message != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	dir := writeModules(t)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import {base} from "math";`, "module math does not export base"},
+		{`import "math"; math.base`, "module math does not export base"},
+		{`import "math"; math = 1`, "cannot assign to module math"},
+		{`let a = 1; a.b`, "can not select b from INTEGER"},
+		{`import "cycle_a";`, "module cycle_a: module cycle_b: import cycle: cycle_a -> cycle_b -> cycle_a"},
+		{`import "broken";`, "module broken: identifier not found: y"},
+		{`let f = fn() { export let a = 1; }; f()`, "export of a outside of a module's top level"},
+		{`let f = fn() { import "math"; }; f()`, `import "math" is only allowed at the top level`},
+		{`if (true) { import "math"; }`, `import "math" is only allowed at the top level`},
+	}
+
+	for _, tt := range tests {
+		errObj, ok := testEvalModule(dir, tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/object"
+	"github.com/marmotini/ngiri-lang/token"
+)
+
+func isQuoteCall(node *ast.CallExpression) bool {
+	return node.Function.TokenLiteral() == "quote" && len(node.Arguments) == 1
+}
+
+// quote returns the unevaluated node. Calls to unquote inside of it are
+// evaluated and their result spliced back into a copy of the tree.
+func quote(node ast.Node, env *object.Environment) object.Object {
+	node = evalUnquoteCalls(ast.Clone(node), env)
+
+	return &object.Quote{Node: node}
+}
+
+func evalUnquoteCalls(quoted ast.Node, env *object.Environment) ast.Node {
+	return ast.Rewrite(quoted, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || call.Function.TokenLiteral() != "unquote" || len(call.Arguments) != 1 {
+			return node
+		}
+
+		unquoted := Eval(call.Arguments[0], env)
+
+		return convertObjectToASTNode(unquoted, call)
+	})
+}
+
+// convertObjectToASTNode turns the result of an unquote back into syntax.
+// Objects without a literal form leave the unquote call in place.
+func convertObjectToASTNode(obj object.Object, call *ast.CallExpression) ast.Node {
+	pos := call.Pos()
+
+	switch obj := obj.(type) {
+	case *object.Integer:
+		t := token.Token{Type: token.INT, Literal: fmt.Sprintf("%d", obj.Value), Pos: pos}
+		return &ast.IntegerLiteral{Token: t, Value: obj.Value}
+	case *object.Boolean:
+		t := token.Token{Type: token.FALSE, Literal: "false", Pos: pos}
+		if obj.Value {
+			t = token.Token{Type: token.TRUE, Literal: "true", Pos: pos}
+		}
+		return &ast.Boolean{Token: t, Value: obj.Value}
+	case *object.String:
+		t := token.Token{Type: token.STRING, Literal: obj.Value, Pos: pos}
+		return &ast.StringLiteral{Token: t, Value: obj.Value}
+	case *object.Quote:
+		return obj.Node
+	default:
+		return call
+	}
+}
@@ -0,0 +1,170 @@
+package interpreter
+
+import (
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/limit"
+	"github.com/marmotini/ngiri-lang/object"
+)
+
+// evalStructStatement binds the name of a struct declaration to its type as
+// a constant.
+func evalStructStatement(node *ast.StructStatement, env *object.Environment) object.Object {
+	t := &object.StructType{Name: node.Name.Value}
+	for _, f := range node.Fields {
+		t.Fields = append(t.Fields, f.Value)
+	}
+
+	if err := env.Declare(t.Name, t, true); err != nil {
+		return newError("%s", err)
+	}
+
+	return nil
+}
+
+// evalEnumStatement binds the name of an enum declaration to the enum as a
+// constant. Its variants are selected from it.
+func evalEnumStatement(node *ast.EnumStatement, env *object.Environment) object.Object {
+	t := object.NewEnumType(node.Name.Value)
+	for _, v := range node.Variants {
+		fields := []string{}
+		for _, f := range v.Fields {
+			fields = append(fields, f.Value)
+		}
+
+		t.AddVariant(v.Name.Value, fields)
+	}
+
+	if err := env.Declare(t.Name, t, true); err != nil {
+		return newError("%s", err)
+	}
+
+	return nil
+}
+
+func evalStructLiteral(node *ast.StructLiteral, env *object.Environment) object.Object {
+	obj := Eval(node.Name, env)
+	if isAbrupt(obj) {
+		return obj
+	}
+
+	t, ok := obj.(*object.StructType)
+	if !ok {
+		return newError("%s is not a struct type", node.Name)
+	}
+
+	shape := &object.StructShape{Struct: t}
+	values := []object.Object{}
+
+	for i, f := range node.Fields {
+		slot, ok := t.FieldIndex(f.Value)
+		if !ok {
+			return newError("struct %s has no field %s", t.Name, f.Value)
+		}
+
+		value := Eval(node.Values[i], env)
+		if isAbrupt(value) {
+			return value
+		}
+
+		shape.Slots = append(shape.Slots, slot)
+		values = append(values, value)
+	}
+
+	return track(env, shape.New(values, NULL))
+}
+
+func evalFieldAssignExpression(node *ast.FieldAssignExpression, env *object.Environment) object.Object {
+	val := Eval(node.Value, env)
+	if isAbrupt(val) {
+		return val
+	}
+
+	obj := Eval(node.Target.Left, env)
+	if isAbrupt(obj) {
+		return obj
+	}
+
+	name := node.Target.Selector.Value
+
+	s, ok := obj.(*object.Struct)
+	if !ok {
+		return newError("can not set %s on %s", name, obj.Type())
+	}
+
+	if !s.SetField(name, val) {
+		return newError("struct %s has no field %s", s.StructType.Name, name)
+	}
+
+	return val
+}
+
+// evalImplStatement defines the methods of an impl block on the struct
+// type. They are functions like any other, closed over env.
+func evalImplStatement(node *ast.ImplStatement, env *object.Environment) object.Object {
+	obj := Eval(node.Name, env)
+	if isAbrupt(obj) {
+		return obj
+	}
+
+	t, ok := obj.(*object.StructType)
+	if !ok {
+		return newError("%s is not a struct type", node.Name.Value)
+	}
+
+	for _, m := range node.Methods {
+		fn := Eval(m, env)
+		if isAbrupt(fn) {
+			return fn
+		}
+
+		if err := t.DefineMethod(m.Name, fn); err != nil {
+			return newError("%s", err)
+		}
+	}
+
+	return nil
+}
+
+// applyMethod calls a bound method with its receiver as the first argument.
+func applyMethod(fn *object.BoundMethod, args []object.Object, names []string, budget *limit.Budget) object.Object {
+	m, ok := fn.Method.(*object.BuiltinMethod)
+	if !ok {
+		return apply(fn.Method, append([]object.Object{fn.Receiver}, args...), names, budget)
+	}
+
+	if len(names) > 0 {
+		return newError("builtin methods take no named arguments")
+	}
+
+	call := func(f object.Object, args ...object.Object) (object.Object, error) {
+		result := applyFunction(f, args, nil, budget)
+		if isError(result) {
+			return nil, &abruptError{result}
+		}
+
+		return result, nil
+	}
+
+	result, err := m.FN(call, fn.Receiver, args...)
+	if err != nil {
+		return err.(*abruptError).obj
+	}
+
+	if isError(result) {
+		return result.(*object.Error).Throw()
+	}
+
+	if result == nil {
+		return NULL
+	}
+
+	return result
+}
+
+// abruptError carries the error a function called by a builtin method
+// threw through the method.
+type abruptError struct {
+	obj object.Object
+}
+
+func (e *abruptError) Error() string { return e.obj.Inspect() }
@@ -0,0 +1,99 @@
+package interpreter
+
+import (
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/limit"
+	"github.com/marmotini/ngiri-lang/object"
+)
+
+// evaluator evaluates a node, it is Eval or evalTail.
+type evaluator func(node ast.Node, env *object.Environment) object.Object
+
+// tailCall is a call in tail position of a function body. Rather than
+// making it, evalTail returns it to applyFunction, which makes it once the
+// body is done, so that recursion in tail position runs in constant stack.
+type tailCall struct {
+	fn    object.Object
+	args  []object.Object
+	names []string
+}
+
+func (tc *tailCall) Type() object.ObjectType { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string         { return "tail call" }
+
+// evalTail evaluates node, whose value is the value of the function being
+// applied: the body of the function, the value of a return statement, and
+// the last statements, branches and arm bodies within them. A call there is
+// returned as a *tailCall.
+func evalTail(node ast.Node, env *object.Environment) object.Object {
+	switch node.(type) {
+	case *ast.BlockStatement, *ast.ExpressionStatement, *ast.IfExpression, *ast.MatchExpression, *ast.CallExpression:
+	default:
+		return Eval(node, env)
+	}
+
+	if err := env.Budget().Step(); err != nil {
+		return newError("%s", err)
+	}
+
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		return evalBlockStatements(node, object.NewEnclosedEnvironment(env), evalTail)
+	case *ast.ExpressionStatement:
+		return evalTail(node.Expression, env)
+	case *ast.IfExpression:
+		return evalIfExpression(node, env, evalTail)
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env, evalTail)
+	default:
+		call := node.(*ast.CallExpression)
+		if isQuoteCall(call) {
+			return quote(call.Arguments[0], env)
+		}
+
+		tail, abrupt := evalCall(call, env)
+		if abrupt != nil {
+			return abrupt
+		}
+
+		return tail
+	}
+}
+
+// evalCall evaluates the function and the arguments of a call.
+func evalCall(node *ast.CallExpression, env *object.Environment) (*tailCall, object.Object) {
+	function := Eval(node.Function, env)
+	if isAbrupt(function) {
+		return nil, function
+	}
+
+	args, names, abrupt := evalArguments(node.Arguments, env)
+	if abrupt != nil {
+		return nil, abrupt
+	}
+
+	return &tailCall{fn: function, args: args, names: names}, nil
+}
+
+// finishTailCall makes the call a return statement returned as its value,
+// for the places that stop returns other than applyFunction: try
+// expressions, whose handlers have to see the errors of the call, and the
+// top level of programs and macros.
+func finishTailCall(result object.Object, budget *limit.Budget) object.Object {
+	ret, ok := result.(*object.ReturnValue)
+	if !ok {
+		return result
+	}
+
+	call, ok := ret.Value.(*tailCall)
+	if !ok {
+		return result
+	}
+
+	value := applyFunction(call.fn, call.args, call.names, budget)
+	if isError(value) {
+		return value
+	}
+
+	return &object.ReturnValue{Value: value}
+}
@@ -0,0 +1,568 @@
+package ir
+
+import (
+	"fmt"
+
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/object"
+)
+
+// UnsupportedError is returned by Build for functions using a construct the
+// IR has no form for, like match expressions or destructuring.
+type UnsupportedError struct {
+	Node ast.Node
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("ir: can not lower %T %s", e.Node, e.Node)
+}
+
+// builder lowers the statements of a function in the order they run. cur is
+// the block being filled, nil after a return.
+type builder struct {
+	f    *Func
+	cur  *Block
+	defs map[*Block]map[string]*Value
+
+	// scopes are the variables declared by the blocks being lowered,
+	// innermost last, and declared counts the declarations of each name.
+	scopes   []map[string]variable
+	declared map[string]int
+}
+
+// variable is a name declared by a let or const statement or a parameter.
+// Its values are kept in defs under key, which tells it apart from the
+// other variables of the same name.
+type variable struct {
+	key      string
+	constant bool
+}
+
+// Build lowers node to SSA form. Variables are resolved as they are read:
+// from the definitions of the current block, and of the blocks before it
+// through phis where the paths into a block disagree. Names the function
+// does not declare are read with OpGlobal.
+//
+// Assignments to globals and constants and declarations of a name twice in
+// one scope are unsupported, the compiler reports the errors.
+func Build(node *ast.FunctionExpression) (*Func, error) {
+	b := &builder{
+		f:        &Func{Name: node.Name},
+		defs:     map[*Block]map[string]*Value{},
+		scopes:   []map[string]variable{{}},
+		declared: map[string]int{},
+	}
+	b.cur = b.f.newBlock()
+
+	for i, p := range node.Parameters {
+		ident, ok := p.(*ast.Identifier)
+		if !ok {
+			return nil, &UnsupportedError{p}
+		}
+
+		b.f.Params = append(b.f.Params, ident.Value)
+
+		key, ok := b.declare(ident.Value, false)
+		if !ok {
+			return nil, &UnsupportedError{p}
+		}
+
+		param := b.cur.newValue(OpParam, Any)
+		param.Index = i
+		b.define(key, param)
+	}
+
+	// The body shares the scope of the parameters.
+	result, err := b.statements(node.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.cur != nil {
+		b.ret(result)
+	}
+
+	return b.f, nil
+}
+
+// block lowers the statements of block in a scope of their own.
+func (b *builder) block(block *ast.BlockStatement) (*Value, error) {
+	b.scopes = append(b.scopes, map[string]variable{})
+	defer func() { b.scopes = b.scopes[:len(b.scopes)-1] }()
+
+	return b.statements(block)
+}
+
+// statements lowers the statements of block in the current scope and
+// returns the value of the last one, nil when the block has no value.
+func (b *builder) statements(block *ast.BlockStatement) (*Value, error) {
+	var result *Value
+
+	for _, s := range block.Statements {
+		if b.cur == nil {
+			break
+		}
+
+		result = nil
+
+		switch s := s.(type) {
+		case *ast.ExpressionStatement:
+			v, err := b.lower(s.Expression)
+			if err != nil {
+				return nil, err
+			}
+			result = v
+		case *ast.LetStatement:
+			if s.Name == nil {
+				return nil, &UnsupportedError{s}
+			}
+
+			v, err := b.expr(s.Value)
+			if err != nil {
+				return nil, err
+			}
+
+			key, ok := b.declare(s.Name.Value, s.Const())
+			if !ok {
+				return nil, &UnsupportedError{s}
+			}
+
+			copied := b.cur.newValue(OpCopy, v.Type, v)
+			copied.Name = s.Name.Value
+			b.define(key, copied)
+		case *ast.ReturnStatement:
+			v, err := b.expr(s.ReturnValue)
+			if err != nil {
+				return nil, err
+			}
+			b.ret(v)
+		default:
+			return nil, &UnsupportedError{s}
+		}
+	}
+
+	return result, nil
+}
+
+// ret ends the current block with a return of v, null when v is nil.
+func (b *builder) ret(v *Value) {
+	if v == nil {
+		v = b.constant(nil)
+	}
+
+	b.cur.Kind = Return
+	b.cur.Control = v
+	b.cur = nil
+}
+
+// expr lowers e to the value it evaluates to.
+func (b *builder) expr(e ast.Expression) (*Value, error) {
+	v, err := b.lower(e)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.cur == nil {
+		// Both arms of an if expression return, yet its value is used,
+		// e.g. `1 + if (x) { return 1 } else { return 2 }`.
+		return nil, &UnsupportedError{e}
+	}
+
+	return v, nil
+}
+
+// lower is expr for expression statements, whose if expressions may return
+// from every arm and so leave no current block.
+func (b *builder) lower(e ast.Expression) (*Value, error) {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return b.constant(&object.Integer{Value: e.Value}), nil
+	case *ast.StringLiteral:
+		return b.constant(&object.String{Value: e.Value}), nil
+	case *ast.Boolean:
+		if e.Value {
+			return b.constant(object.True), nil
+		}
+		return b.constant(object.False), nil
+	case *ast.Identifier:
+		return b.read(e.Value)
+	case *ast.PrefixExpression:
+		return b.prefix(e)
+	case *ast.InfixExpression:
+		return b.infix(e)
+	case *ast.IfExpression:
+		return b.ifExpression(e)
+	case *ast.AssignExpression:
+		return b.assign(e)
+	case *ast.CallExpression:
+		return b.call(e)
+	case *ast.ListLiteral:
+		elements, err := b.exprs(e.Elements)
+		if err != nil {
+			return nil, err
+		}
+		return b.value(OpArray, Any, elements...), nil
+	case *ast.IndexExpression:
+		args, err := b.exprs([]ast.Expression{e.Left, e.Index})
+		if err != nil {
+			return nil, err
+		}
+		return b.value(OpIndex, Any, args...), nil
+	default:
+		return nil, &UnsupportedError{e}
+	}
+}
+
+// exprs lowers exps from left to right.
+func (b *builder) exprs(exps []ast.Expression) ([]*Value, error) {
+	values := make([]*Value, len(exps))
+
+	for i, e := range exps {
+		if _, ok := e.(*ast.SpreadExpression); ok {
+			return nil, &UnsupportedError{e}
+		}
+
+		v, err := b.expr(e)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+
+	return values, nil
+}
+
+var infixOps = map[string]Op{
+	"+":  OpAdd,
+	"-":  OpSub,
+	"*":  OpMul,
+	"/":  OpDiv,
+	"==": OpEqual,
+	"!=": OpNotEqual,
+	">":  OpGreater,
+}
+
+func (b *builder) prefix(e *ast.PrefixExpression) (*Value, error) {
+	right, err := b.exprs([]ast.Expression{e.Right})
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.Operator {
+	case "!":
+		return b.value(OpNot, Any, right...), nil
+	case "-":
+		return b.value(OpNeg, Any, right...), nil
+	default:
+		return nil, &UnsupportedError{e}
+	}
+}
+
+func (b *builder) infix(e *ast.InfixExpression) (*Value, error) {
+	if e.Operator == "<" {
+		args, err := b.exprs([]ast.Expression{e.Right, e.Left})
+		if err != nil {
+			return nil, err
+		}
+		return b.value(OpGreater, Any, args...), nil
+	}
+
+	op, ok := infixOps[e.Operator]
+	if !ok {
+		return nil, &UnsupportedError{e}
+	}
+
+	args, err := b.exprs([]ast.Expression{e.Left, e.Right})
+	if err != nil {
+		return nil, err
+	}
+
+	return b.value(op, Any, args...), nil
+}
+
+// ifExpression lowers an if expression to a branch into a block for each
+// arm, which both jump to a block that joins them:
+//
+//	cur:  if cond then else
+//	then: ...; jump join
+//	else: ...; jump join
+//	join: v = phi thenValue elseValue
+//
+// An arm that returns does not jump to the join, which is left out when
+// neither arm reaches it.
+func (b *builder) ifExpression(e *ast.IfExpression) (*Value, error) {
+	cond, err := b.expr(e.Condition)
+	if err != nil {
+		return nil, err
+	}
+
+	branch := b.cur
+	branch.Kind = If
+	branch.Control = cond
+
+	var ends []*Block
+	var values []*Value
+
+	for _, arm := range []*ast.BlockStatement{e.Consequence, e.Alternative} {
+		b.cur = b.f.newBlock()
+		branch.addEdge(b.cur)
+
+		var v *Value
+		if arm != nil {
+			v, err = b.block(arm)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if b.cur != nil {
+			if v == nil {
+				v = b.constant(nil)
+			}
+
+			ends = append(ends, b.cur)
+			values = append(values, v)
+		}
+	}
+
+	if len(ends) == 0 {
+		b.cur = nil
+		return nil, nil
+	}
+
+	b.cur = b.f.newBlock()
+	for _, end := range ends {
+		end.addEdge(b.cur)
+	}
+
+	return b.merge(values), nil
+}
+
+// assign lowers an assignment to a variable of the function, which gets a
+// new value from here on.
+func (b *builder) assign(e *ast.AssignExpression) (*Value, error) {
+	variable, ok := b.resolve(e.Name.Value)
+	if !ok || variable.constant {
+		return nil, &UnsupportedError{e}
+	}
+
+	v, err := b.expr(e.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	copied := b.cur.newValue(OpCopy, v.Type, v)
+	copied.Name = e.Name.Value
+	b.define(variable.key, copied)
+
+	return copied, nil
+}
+
+func (b *builder) call(e *ast.CallExpression) (*Value, error) {
+	if ident, ok := e.Function.(*ast.Identifier); ok && (ident.Value == "quote" || ident.Value == "unquote") {
+		return nil, &UnsupportedError{e}
+	}
+
+	for _, a := range e.Arguments {
+		if _, ok := a.(*ast.NamedArgument); ok {
+			return nil, &UnsupportedError{a}
+		}
+	}
+
+	args, err := b.exprs(append([]ast.Expression{e.Function}, e.Arguments...))
+	if err != nil {
+		return nil, err
+	}
+
+	return b.value(OpCall, Any, args...), nil
+}
+
+// value adds a value to the current block, typed from its operation and
+// arguments unless typ says more.
+func (b *builder) value(op Op, typ Type, args ...*Value) *Value {
+	v := b.cur.newValue(op, typ, args...)
+	if typ == Any {
+		v.Type = infer(v)
+	}
+
+	return v
+}
+
+func (b *builder) constant(obj object.Object) *Value {
+	v := b.cur.newValue(OpConst, constType(obj))
+	v.Const = obj
+
+	return v
+}
+
+// declare declares name in the innermost scope and returns the key of the
+// new variable. ok is false when the scope declares name already.
+func (b *builder) declare(name string, constant bool) (key string, ok bool) {
+	scope := b.scopes[len(b.scopes)-1]
+	if _, declared := scope[name]; declared {
+		return "", false
+	}
+
+	key = name
+	if n := b.declared[name]; n > 0 {
+		key = fmt.Sprintf("%s'%d", name, n)
+	}
+	b.declared[name]++
+
+	scope[name] = variable{key: key, constant: constant}
+
+	return key, true
+}
+
+// resolve returns the variable name refers to in the innermost scope
+// declaring it.
+func (b *builder) resolve(name string) (variable, bool) {
+	for i := len(b.scopes) - 1; i >= 0; i-- {
+		if v, ok := b.scopes[i][name]; ok {
+			return v, true
+		}
+	}
+
+	return variable{}, false
+}
+
+func (b *builder) define(name string, v *Value) {
+	if b.defs[b.cur] == nil {
+		b.defs[b.cur] = map[string]*Value{}
+	}
+
+	b.defs[b.cur][name] = v
+}
+
+// read returns the value of the variable name in the current block.
+func (b *builder) read(name string) (*Value, error) {
+	variable, ok := b.resolve(name)
+	if !ok {
+		global := b.cur.newValue(OpGlobal, Any)
+		global.Name = name
+		return global, nil
+	}
+
+	v, found, err := b.lookup(variable.key, b.cur)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, fmt.Errorf("ir: %s is read before it is defined", name)
+	}
+
+	return v, nil
+}
+
+// lookup returns the value name has when control reaches the end of block.
+// Blocks with several predecessors merge the values of their predecessors,
+// each of which is complete since the blocks form a DAG built in order.
+func (b *builder) lookup(name string, block *Block) (*Value, bool, error) {
+	if v, ok := b.defs[block][name]; ok {
+		return v, true, nil
+	}
+
+	switch len(block.Preds) {
+	case 0:
+		return nil, false, nil
+	case 1:
+		return b.lookup(name, block.Preds[0])
+	}
+
+	values := make([]*Value, len(block.Preds))
+	defined := 0
+
+	for i, pred := range block.Preds {
+		v, found, err := b.lookup(name, pred)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if found {
+			values[i] = v
+			defined++
+		}
+	}
+
+	if defined == 0 {
+		return nil, false, nil
+	}
+
+	if defined < len(values) {
+		return nil, false, fmt.Errorf("ir: %s is not defined on every path into %s", name, block)
+	}
+
+	v := b.mergeIn(block, values)
+
+	if b.defs[block] == nil {
+		b.defs[block] = map[string]*Value{}
+	}
+	b.defs[block][name] = v
+
+	return v, true, nil
+}
+
+// merge returns the value of values[i] when the current block is entered
+// from its predecessor i.
+func (b *builder) merge(values []*Value) *Value {
+	return b.mergeIn(b.cur, values)
+}
+
+func (b *builder) mergeIn(block *Block, values []*Value) *Value {
+	same := true
+	typ := values[0].Type
+
+	for _, v := range values[1:] {
+		same = same && v == values[0]
+		if v.Type != typ {
+			typ = Any
+		}
+	}
+
+	if same {
+		return values[0]
+	}
+
+	return block.newPhi(typ, values)
+}
+
+// infer returns the type of v from its operation and the types of its
+// arguments.
+func infer(v *Value) Type {
+	switch v.Op {
+	case OpConst:
+		return constType(v.Const)
+	case OpCopy:
+		return v.Args[0].Type
+	case OpNot, OpEqual, OpNotEqual:
+		return Bool
+	case OpNeg:
+		if v.Args[0].Type == Int {
+			return Int
+		}
+	case OpGreater:
+		if v.Args[0].Type == Int && v.Args[1].Type == Int {
+			return Bool
+		}
+	case OpAdd:
+		if v.Args[0].Type == String && v.Args[1].Type == String {
+			return String
+		}
+		fallthrough
+	case OpSub, OpMul, OpDiv:
+		if v.Args[0].Type == Int && v.Args[1].Type == Int {
+			return Int
+		}
+	case OpPhi:
+		typ := v.Args[0].Type
+		for _, a := range v.Args[1:] {
+			if a.Type != typ {
+				return Any
+			}
+		}
+		return typ
+	}
+
+	return Any
+}
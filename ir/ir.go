@@ -0,0 +1,258 @@
+// Package ir is an intermediate representation of functions in static single
+// assignment form. A function is a graph of basic blocks, each a list of
+// values computed from values defined before them and ending in a jump, a
+// branch or a return. A variable that is assigned differently on the paths
+// into a block is read through a phi value there.
+//
+// Build lowers an ast.FunctionExpression, Optimize simplifies the result and
+// backends like the compiler generate code from it:
+//
+//	f, err := ir.Build(node)
+//	if err != nil {
+//		// node uses a construct the IR has no form for yet
+//	}
+//	ir.Optimize(f)
+//
+// The language has no loops, so the blocks of a function form a directed
+// acyclic graph and Blocks lists them in an order where every block comes
+// after the blocks that jump to it.
+package ir
+
+import (
+	"fmt"
+
+	"github.com/marmotini/ngiri-lang/object"
+)
+
+// Type is what is known about the values a Value can take at run time.
+type Type int
+
+const (
+	Any Type = iota
+	Int
+	Bool
+	String
+	Null
+)
+
+var typeNames = map[Type]string{
+	Any:    "any",
+	Int:    "int",
+	Bool:   "bool",
+	String: "string",
+	Null:   "null",
+}
+
+func (t Type) String() string { return typeNames[t] }
+
+// Op is the operation a Value performs on its arguments.
+type Op int
+
+const (
+	// OpConst is the constant Const.
+	OpConst Op = iota
+	// OpParam is the parameter of the function at Index.
+	OpParam
+	// OpGlobal is the variable Name defined outside the function.
+	OpGlobal
+	// OpCopy is Args[0] bound to the variable Name.
+	OpCopy
+	// OpPhi is Args[i] when the block was entered from Block.Preds[i].
+	OpPhi
+
+	OpNeg
+	OpNot
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpEqual
+	OpNotEqual
+	// OpGreater compares Args[0] > Args[1]. a < b is lowered as b > a with
+	// b evaluated first, like the compiler does.
+	OpGreater
+
+	// OpArray is an array of Args.
+	OpArray
+	// OpIndex is Args[0][Args[1]].
+	OpIndex
+	// OpCall calls Args[0] with Args[1:].
+	OpCall
+)
+
+var opNames = map[Op]string{
+	OpConst:    "const",
+	OpParam:    "param",
+	OpGlobal:   "global",
+	OpCopy:     "copy",
+	OpPhi:      "phi",
+	OpNeg:      "neg",
+	OpNot:      "not",
+	OpAdd:      "add",
+	OpSub:      "sub",
+	OpMul:      "mul",
+	OpDiv:      "div",
+	OpEqual:    "eq",
+	OpNotEqual: "neq",
+	OpGreater:  "gt",
+	OpArray:    "array",
+	OpIndex:    "index",
+	OpCall:     "call",
+}
+
+func (op Op) String() string { return opNames[op] }
+
+// Value is the result of an operation. Each value is defined once, by the
+// block that lists it.
+type Value struct {
+	ID    int
+	Op    Op
+	Type  Type
+	Args  []*Value
+	Block *Block
+
+	// Const is the value of OpConst, nil for null.
+	Const object.Object
+	// Index is the parameter of OpParam.
+	Index int
+	// Name is the variable of OpGlobal and OpCopy.
+	Name string
+}
+
+func (v *Value) String() string { return fmt.Sprintf("v%d", v.ID) }
+
+// BlockKind says how control leaves a block.
+type BlockKind int
+
+const (
+	// Plain blocks jump to Succs[0].
+	Plain BlockKind = iota
+	// If blocks go to Succs[0] when Control is truthy, to Succs[1]
+	// otherwise.
+	If
+	// Return blocks return Control from the function.
+	Return
+)
+
+// Block is a basic block: its values run in order, then control leaves as
+// its Kind says.
+type Block struct {
+	ID   int
+	Kind BlockKind
+	// Values lists the values the block defines, phis first.
+	Values  []*Value
+	Control *Value
+	Preds   []*Block
+	Succs   []*Block
+	Func    *Func
+}
+
+func (b *Block) String() string { return fmt.Sprintf("b%d", b.ID) }
+
+// Func is a function in SSA form.
+type Func struct {
+	Name   string
+	Params []string
+	// Blocks lists the blocks of the function, the entry first.
+	Blocks []*Block
+
+	nextValue int
+	nextBlock int
+}
+
+// Entry returns the block the function starts in.
+func (f *Func) Entry() *Block { return f.Blocks[0] }
+
+// Uses counts the references to every value, from the arguments of values
+// and the controls of blocks.
+func (f *Func) Uses() map[*Value]int {
+	uses := map[*Value]int{}
+
+	for _, b := range f.Blocks {
+		for _, v := range b.Values {
+			for _, a := range v.Args {
+				uses[a]++
+			}
+		}
+
+		if b.Control != nil {
+			uses[b.Control]++
+		}
+	}
+
+	return uses
+}
+
+func (f *Func) newBlock() *Block {
+	b := &Block{ID: f.nextBlock, Func: f}
+	f.nextBlock++
+	f.Blocks = append(f.Blocks, b)
+
+	return b
+}
+
+func (b *Block) newValue(op Op, typ Type, args ...*Value) *Value {
+	v := &Value{ID: b.Func.nextValue, Op: op, Type: typ, Args: args, Block: b}
+	b.Func.nextValue++
+	b.Values = append(b.Values, v)
+
+	return v
+}
+
+// newPhi adds a phi to the phis at the start of b.
+func (b *Block) newPhi(typ Type, args []*Value) *Value {
+	v := &Value{ID: b.Func.nextValue, Op: OpPhi, Type: typ, Args: args, Block: b}
+	b.Func.nextValue++
+
+	n := 0
+	for n < len(b.Values) && b.Values[n].Op == OpPhi {
+		n++
+	}
+
+	b.Values = append(b.Values, nil)
+	copy(b.Values[n+1:], b.Values[n:])
+	b.Values[n] = v
+
+	return v
+}
+
+// addEdge makes control flow from b to succ.
+func (b *Block) addEdge(succ *Block) {
+	b.Succs = append(b.Succs, succ)
+	succ.Preds = append(succ.Preds, b)
+}
+
+// removePred removes the edge from pred to b along with the arguments the
+// phis of b take from pred.
+func (b *Block) removePred(pred *Block) {
+	for i, p := range b.Preds {
+		if p != pred {
+			continue
+		}
+
+		b.Preds = append(b.Preds[:i:i], b.Preds[i+1:]...)
+		for _, v := range b.Values {
+			if v.Op == OpPhi {
+				v.Args = append(v.Args[:i:i], v.Args[i+1:]...)
+			}
+		}
+
+		return
+	}
+}
+
+// constType returns the type of the constant obj, nil standing for null.
+func constType(obj object.Object) Type {
+	switch obj.(type) {
+	case *object.Integer:
+		return Int
+	case *object.Boolean:
+		return Bool
+	case *object.String:
+		return String
+	case nil:
+		return Null
+	default:
+		return Any
+	}
+}
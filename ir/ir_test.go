@@ -0,0 +1,262 @@
+package ir
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/lexer"
+	"github.com/marmotini/ngiri-lang/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input: "fn(a, b) { if (a > b) { a } else { b } }",
+			expected: `
+fn fn(a, b)
+b0:
+	v0 = param 0 : any
+	v1 = param 1 : any
+	v2 = gt v0 v1 : any
+	if v2 b1 b2
+b1: <- b0
+	jump b3
+b2: <- b0
+	jump b3
+b3: <- b1 b2
+	v3 = phi v0 v1 : any
+	return v3
+`,
+		},
+		{
+			input: `fn(x) { let y = x < 1; if (y) { return "small" }; -x }`,
+			expected: `
+fn fn(x)
+b0:
+	v0 = param 0 : any
+	v1 = const 1 : int
+	v2 = gt v1 v0 : any
+	v3 = copy v2 y : any
+	if v3 b1 b2
+b1: <- b0
+	v4 = const "small" : string
+	return v4
+b2: <- b0
+	v5 = const null : null
+	jump b3
+b3: <- b2
+	v6 = neg v0 : any
+	return v6
+`,
+		},
+		{
+			input: "fn() { let n = 1; if (true) { n = n + 1; 0 }; puts([n]) }",
+			expected: `
+fn fn()
+b0:
+	v0 = const 1 : int
+	v1 = copy v0 n : int
+	v2 = const true : bool
+	if v2 b1 b2
+b1: <- b0
+	v3 = const 1 : int
+	v4 = add v1 v3 : int
+	v5 = copy v4 n : int
+	v6 = const 0 : int
+	jump b3
+b2: <- b0
+	v7 = const null : null
+	jump b3
+b3: <- b1 b2
+	v8 = phi v6 v7 : any
+	v10 = phi v5 v1 : int
+	v9 = global puts : any
+	v11 = array v10 : any
+	v12 = call v9 v11 : any
+	return v12
+`,
+		},
+		{
+			// The n of the block shadows the n of the function, which
+			// keeps its value after the block.
+			input: "fn() { let n = 1; if (true) { let n = 2; n }; n }",
+			expected: `
+fn fn()
+b0:
+	v0 = const 1 : int
+	v1 = copy v0 n : int
+	v2 = const true : bool
+	if v2 b1 b2
+b1: <- b0
+	v3 = const 2 : int
+	v4 = copy v3 n : int
+	jump b3
+b2: <- b0
+	v5 = const null : null
+	jump b3
+b3: <- b1 b2
+	v6 = phi v4 v5 : any
+	return v1
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		f, err := Build(parseFunction(t, tt.input))
+		assert.NoError(t, err, tt.input)
+		assert.Equal(t, strings.TrimLeft(tt.expected, "\n"), f.String(), tt.input)
+		assert.NoError(t, Verify(f), tt.input)
+	}
+}
+
+func TestBuildUnsupported(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(x) { match (x) { _ => 1 } }", "ir: can not lower *ast.MatchExpression"},
+		{"fn(x) { 1 + if (x) { return 1 } else { return 2 } }", "ir: can not lower *ast.IfExpression"},
+		{"fn(x) { let y = 1; let y = 2 }", "ir: can not lower *ast.LetStatement"},
+		{"fn(x) { const y = 1; y = 2 }", "ir: can not lower *ast.AssignExpression"},
+		{"fn(x) { y = 2 }", "ir: can not lower *ast.AssignExpression"},
+	}
+
+	for _, tt := range tests {
+		_, err := Build(parseFunction(t, tt.input))
+		if assert.Error(t, err, tt.input) {
+			assert.Contains(t, err.Error(), tt.expected, tt.input)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name     string
+		breakIt  func(f *Func)
+		expected string
+	}{
+		{
+			name:     "missing predecessor",
+			breakIt:  func(f *Func) { f.Blocks[3].Preds = f.Blocks[3].Preds[:1] },
+			expected: "ir: edge b2 -> b3 is missing in the predecessors of b3",
+		},
+		{
+			name:     "phi arguments",
+			breakIt:  func(f *Func) { phi := f.Blocks[3].Values[0]; phi.Args = phi.Args[:1] },
+			expected: "ir: phi v3 has 1 arguments for 2 predecessors",
+		},
+		{
+			name: "use before definition",
+			breakIt: func(f *Func) {
+				entry := f.Entry()
+				entry.Values[0], entry.Values[2] = entry.Values[2], entry.Values[0]
+			},
+			expected: "ir: v2 uses v0 before it is defined",
+		},
+		{
+			name: "use from a block not dominating",
+			breakIt: func(f *Func) {
+				f.Blocks[1].Kind = Return
+				f.Blocks[1].Control = f.Blocks[3].Values[0]
+				f.Blocks[1].Succs = nil
+				f.Blocks[3].removePred(f.Blocks[1])
+			},
+			expected: "ir: b1 is controlled by v3 before it is defined",
+		},
+		{
+			name:     "control of a plain block",
+			breakIt:  func(f *Func) { f.Blocks[1].Control = f.Entry().Values[0] },
+			expected: "ir: control of b1 does not match its kind",
+		},
+	}
+
+	for _, tt := range tests {
+		f, err := Build(parseFunction(t, "fn(a, b) { if (a > b) { a } else { b } }"))
+		assert.NoError(t, err, tt.name)
+
+		tt.breakIt(f)
+		assert.EqualError(t, Verify(f), tt.expected, tt.name)
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			// Returns are sunk into the arms of the branch.
+			input: "fn(a, b) { if (a > b) { a } else { b } }",
+			expected: `
+fn fn(a, b)
+b0:
+	v0 = param 0 : any
+	v1 = param 1 : any
+	v2 = gt v0 v1 : any
+	if v2 b1 b2
+b1: <- b0
+	return v0
+b2: <- b0
+	return v1
+`,
+		},
+		{
+			// Constants are propagated through copies and branches.
+			input: "fn(x) { let y = 1 + 2; if (y > 2) { x } else { return 0 } }",
+			expected: `
+fn fn(x)
+b0:
+	v0 = param 0 : any
+	return v0
+`,
+		},
+		{
+			// Operations that may fail stay, unused or not.
+			input: `fn(x) { x / 0; x * 2; "a" + "b"; x == 1; 1 }`,
+			expected: `
+fn fn(x)
+b0:
+	v0 = param 0 : any
+	v1 = const 0 : int
+	v2 = div v0 v1 : any
+	v3 = const 2 : int
+	v4 = mul v0 v3 : any
+	v10 = const 1 : int
+	return v10
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		f, err := Build(parseFunction(t, tt.input))
+		assert.NoError(t, err, tt.input)
+
+		Optimize(f)
+		assert.Equal(t, strings.TrimLeft(tt.expected, "\n"), f.String(), tt.input)
+		assert.NoError(t, Verify(f), tt.input)
+	}
+}
+
+func TestPropagateConstants(t *testing.T) {
+	f, err := Build(parseFunction(t, `fn() { if (!(2 * 3 > 5)) { "x" + "y" } else { 10 / 0 } }`))
+	assert.NoError(t, err)
+
+	assert.True(t, PropagateConstants(f))
+	assert.Len(t, f.Blocks, 3)
+	assert.Equal(t, "div v9 v10 : int", f.Blocks[1].Values[2].LongString())
+	assert.NoError(t, Verify(f))
+
+	assert.False(t, PropagateConstants(f))
+}
+
+func parseFunction(t *testing.T, input string) *ast.FunctionExpression {
+	t.Helper()
+
+	program := parser.NewParser(lexer.NewLexer(input)).ParseProgram()
+	return program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionExpression)
+}
@@ -0,0 +1,370 @@
+package ir
+
+import "github.com/marmotini/ngiri-lang/object"
+
+// Optimize runs the passes until none of them changes f.
+func Optimize(f *Func) {
+	for {
+		changed := PropagateConstants(f)
+		changed = PropagateCopies(f) || changed
+		changed = SinkReturns(f) || changed
+		changed = EliminateDeadCode(f) || changed
+
+		if !changed {
+			return
+		}
+	}
+}
+
+// PropagateConstants replaces the operations whose arguments are constants
+// with their result, e.g. `add 1 2` with `const 3`, and turns branches on a
+// constant into jumps, dropping the blocks no longer reached. Operations
+// that would fail, like division by zero, are left for the program to fail
+// at run time.
+func PropagateConstants(f *Func) bool {
+	changed := false
+
+	for _, b := range f.Blocks {
+		for _, v := range b.Values {
+			if result, ok := fold(v); ok {
+				v.Op = OpConst
+				v.Const = result
+				v.Type = constType(result)
+				v.Args = nil
+				changed = true
+			}
+		}
+
+		if b.Kind == If && b.Control.Op == OpConst {
+			live, dead := b.Succs[0], b.Succs[1]
+			if !truthy(b.Control.Const) {
+				live, dead = dead, live
+			}
+
+			dead.removePred(b)
+			b.Kind = Plain
+			b.Control = nil
+			b.Succs = []*Block{live}
+			changed = true
+		}
+	}
+
+	return removeUnreachable(f) || changed
+}
+
+// fold returns the constant v evaluates to, with the semantics of the VM.
+func fold(v *Value) (object.Object, bool) {
+	if v.Op == OpConst || v.Op == OpPhi || len(v.Args) == 0 {
+		return nil, false
+	}
+
+	for _, a := range v.Args {
+		if a.Op != OpConst {
+			return nil, false
+		}
+	}
+
+	switch v.Op {
+	case OpNot:
+		return nativeBool(!truthy(v.Args[0].Const)), true
+	case OpNeg:
+		if i, ok := v.Args[0].Const.(*object.Integer); ok {
+			return &object.Integer{Value: -i.Value}, true
+		}
+		return nil, false
+	case OpCopy:
+		return v.Args[0].Const, true
+	}
+
+	if len(v.Args) != 2 {
+		return nil, false
+	}
+
+	switch left := v.Args[0].Const.(type) {
+	case *object.Integer:
+		right, ok := v.Args[1].Const.(*object.Integer)
+		if !ok {
+			return nil, false
+		}
+
+		a, b := left.Value, right.Value
+
+		switch v.Op {
+		case OpAdd:
+			return &object.Integer{Value: a + b}, true
+		case OpSub:
+			return &object.Integer{Value: a - b}, true
+		case OpMul:
+			return &object.Integer{Value: a * b}, true
+		case OpDiv:
+			if b != 0 {
+				return &object.Integer{Value: a / b}, true
+			}
+		case OpGreater:
+			return nativeBool(a > b), true
+		case OpEqual:
+			return nativeBool(a == b), true
+		case OpNotEqual:
+			return nativeBool(a != b), true
+		}
+	case *object.String:
+		right, ok := v.Args[1].Const.(*object.String)
+		if !ok {
+			return nil, false
+		}
+
+		switch v.Op {
+		case OpAdd:
+			return &object.String{Value: left.Value + right.Value}, true
+		case OpEqual:
+			return nativeBool(left.Value == right.Value), true
+		case OpNotEqual:
+			return nativeBool(left.Value != right.Value), true
+		}
+	case *object.Boolean:
+		right, ok := v.Args[1].Const.(*object.Boolean)
+		if !ok {
+			return nil, false
+		}
+
+		switch v.Op {
+		case OpEqual:
+			return nativeBool(left == right), true
+		case OpNotEqual:
+			return nativeBool(left != right), true
+		}
+	}
+
+	return nil, false
+}
+
+func truthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case nil:
+		return false
+	default:
+		return true
+	}
+}
+
+func nativeBool(b bool) object.Object {
+	if b {
+		return object.True
+	}
+
+	return object.False
+}
+
+// removeUnreachable drops the blocks that no path from the entry reaches,
+// and their edges into the blocks that remain.
+func removeUnreachable(f *Func) bool {
+	reached := map[*Block]bool{f.Entry(): true}
+	for _, b := range f.Blocks {
+		if reached[b] {
+			for _, s := range b.Succs {
+				reached[s] = true
+			}
+		}
+	}
+
+	if len(reached) == len(f.Blocks) {
+		return false
+	}
+
+	blocks := f.Blocks[:0]
+	for _, b := range f.Blocks {
+		if reached[b] {
+			blocks = append(blocks, b)
+			continue
+		}
+
+		for _, s := range b.Succs {
+			s.removePred(b)
+		}
+	}
+	f.Blocks = blocks
+
+	return true
+}
+
+// PropagateCopies makes the users of a copy use the value copied, and the
+// users of a phi whose arguments are all the same value use that value.
+func PropagateCopies(f *Func) bool {
+	replace := map[*Value]*Value{}
+
+	for _, b := range f.Blocks {
+		for _, v := range b.Values {
+			switch {
+			case v.Op == OpCopy:
+				replace[v] = v.Args[0]
+			case v.Op == OpPhi && len(v.Args) > 0 && allSame(v.Args):
+				replace[v] = v.Args[0]
+			}
+		}
+	}
+
+	if len(replace) == 0 {
+		return false
+	}
+
+	resolve := func(v *Value) *Value {
+		for replace[v] != nil {
+			v = replace[v]
+		}
+		return v
+	}
+
+	changed := false
+	for _, b := range f.Blocks {
+		for _, v := range b.Values {
+			for i, a := range v.Args {
+				if r := resolve(a); r != a {
+					v.Args[i] = r
+					changed = true
+				}
+			}
+		}
+
+		if b.Control != nil {
+			if r := resolve(b.Control); r != b.Control {
+				b.Control = r
+				changed = true
+			}
+		}
+	}
+
+	return changed
+}
+
+func allSame(values []*Value) bool {
+	for _, v := range values[1:] {
+		if v != values[0] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SinkReturns moves the return of a block that does nothing else into the
+// blocks jumping to it, so that calls whose value is returned are the last
+// thing their block does, see compiler.markTailCalls:
+//
+//	b1: v3 = call v1; jump b3        b1: v3 = call v1; return v3
+//	b2: jump b3                 =>   b2: return v4
+//	b3: v5 = phi v3 v4; return v5
+func SinkReturns(f *Func) bool {
+	changed := false
+
+	for _, b := range f.Blocks {
+		if b.Kind != Return || len(b.Preds) == 0 {
+			continue
+		}
+
+		// The block may only define the phi it returns.
+		phi := b.Control
+		if len(b.Values) > 1 || (len(b.Values) == 1 && (b.Values[0] != phi || phi.Op != OpPhi)) {
+			continue
+		}
+
+		for i, p := range b.Preds {
+			if p.Kind != Plain {
+				continue
+			}
+
+			p.Kind = Return
+			p.Succs = nil
+			p.Control = phi
+			if phi.Block == b {
+				p.Control = phi.Args[i]
+			}
+			changed = true
+		}
+	}
+
+	if !changed {
+		return false
+	}
+
+	for _, b := range f.Blocks {
+		preds := b.Preds[:0]
+		for i, p := range b.Preds {
+			if p.Kind != Return {
+				preds = append(preds, p)
+				continue
+			}
+
+			for _, v := range b.Values {
+				if v.Op == OpPhi {
+					v.Args[i] = nil
+				}
+			}
+		}
+
+		for _, v := range b.Values {
+			if v.Op == OpPhi {
+				args := v.Args[:0]
+				for _, a := range v.Args {
+					if a != nil {
+						args = append(args, a)
+					}
+				}
+				v.Args = args
+			}
+		}
+		b.Preds = preds
+	}
+
+	removeUnreachable(f)
+
+	return true
+}
+
+// EliminateDeadCode removes the values that are not used and can not fail or
+// have an effect when they run.
+func EliminateDeadCode(f *Func) bool {
+	changed := false
+
+	for {
+		uses := f.Uses()
+		removed := false
+
+		for _, b := range f.Blocks {
+			values := b.Values[:0]
+			for _, v := range b.Values {
+				if uses[v] == 0 && pure(v) {
+					removed = true
+					continue
+				}
+				values = append(values, v)
+			}
+			b.Values = values
+		}
+
+		if !removed {
+			return changed
+		}
+		changed = true
+	}
+}
+
+// pure reports whether v neither fails nor has an effect, given what is
+// known of the types of its arguments.
+func pure(v *Value) bool {
+	switch v.Op {
+	case OpConst, OpParam, OpGlobal, OpCopy, OpPhi, OpNot, OpEqual, OpNotEqual, OpArray:
+		return true
+	case OpNeg:
+		return v.Args[0].Type == Int
+	case OpAdd:
+		return v.Type == Int || v.Type == String
+	case OpSub, OpMul:
+		return v.Type == Int
+	case OpGreater:
+		return v.Type == Bool
+	default:
+		return false
+	}
+}
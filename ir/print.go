@@ -0,0 +1,85 @@
+package ir
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// String prints f one block after the other, e.g.
+//
+//	fn max(a, b)
+//	b0:
+//		v0 = param 0 : any
+//		v1 = param 1 : any
+//		v2 = gt v0 v1 : any
+//		if v2 b1 b2
+//	b1: <- b0
+//		jump b3
+//	...
+func (f *Func) String() string {
+	var out bytes.Buffer
+
+	name := f.Name
+	if name == "" {
+		name = "fn"
+	}
+	fmt.Fprintf(&out, "fn %s(%s)\n", name, strings.Join(f.Params, ", "))
+
+	for _, b := range f.Blocks {
+		out.WriteString(b.String() + ":")
+		if len(b.Preds) > 0 {
+			out.WriteString(" <-")
+			for _, p := range b.Preds {
+				out.WriteString(" " + p.String())
+			}
+		}
+		out.WriteString("\n")
+
+		for _, v := range b.Values {
+			fmt.Fprintf(&out, "\t%s = %s\n", v, v.LongString())
+		}
+
+		switch b.Kind {
+		case Plain:
+			fmt.Fprintf(&out, "\tjump %s\n", b.Succs[0])
+		case If:
+			fmt.Fprintf(&out, "\tif %s %s %s\n", b.Control, b.Succs[0], b.Succs[1])
+		case Return:
+			fmt.Fprintf(&out, "\treturn %s\n", b.Control)
+		}
+	}
+
+	return out.String()
+}
+
+// LongString prints the operation of v with its arguments and type, e.g.
+// `add v1 v2 : int`.
+func (v *Value) LongString() string {
+	parts := []string{v.Op.String()}
+
+	switch v.Op {
+	case OpConst:
+		if v.Const == nil {
+			parts = append(parts, "null")
+		} else if v.Type == String {
+			parts = append(parts, fmt.Sprintf("%q", v.Const.Inspect()))
+		} else {
+			parts = append(parts, v.Const.Inspect())
+		}
+	case OpParam:
+		parts = append(parts, fmt.Sprintf("%d", v.Index))
+	case OpGlobal:
+		parts = append(parts, v.Name)
+	}
+
+	for _, a := range v.Args {
+		parts = append(parts, a.String())
+	}
+
+	if v.Op == OpCopy {
+		parts = append(parts, v.Name)
+	}
+
+	return strings.Join(parts, " ") + " : " + v.Type.String()
+}
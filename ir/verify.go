@@ -0,0 +1,203 @@
+package ir
+
+import "fmt"
+
+// Verify checks that f is well formed: every block ends the way its kind
+// says, its edges are recorded at both ends, phis come first and take one
+// argument per predecessor, and every value is defined before it is used
+// on all paths to the use. Passes are expected to keep it true.
+func Verify(f *Func) error {
+	if len(f.Blocks) == 0 {
+		return fmt.Errorf("ir: %s has no blocks", f.Name)
+	}
+
+	if len(f.Entry().Preds) > 0 {
+		return fmt.Errorf("ir: entry %s has predecessors", f.Entry())
+	}
+
+	defined := map[*Value]bool{}
+	index := map[*Block]int{}
+	ids := map[int]bool{}
+
+	for i, b := range f.Blocks {
+		index[b] = i
+
+		if b.Func != f {
+			return fmt.Errorf("ir: %s belongs to another function", b)
+		}
+
+		for _, v := range b.Values {
+			if ids[v.ID] {
+				return fmt.Errorf("ir: %s is defined twice", v)
+			}
+			ids[v.ID] = true
+			defined[v] = true
+		}
+	}
+
+	for _, b := range f.Blocks {
+		if err := verifyEdges(b, index); err != nil {
+			return err
+		}
+	}
+
+	idom, err := dominators(f, index)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range f.Blocks {
+		if err := verifyValues(b, defined, idom); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func verifyEdges(b *Block, index map[*Block]int) error {
+	succs := map[BlockKind]int{Plain: 1, If: 2, Return: 0}
+
+	if len(b.Succs) != succs[b.Kind] {
+		return fmt.Errorf("ir: %s has %d successors, want %d", b, len(b.Succs), succs[b.Kind])
+	}
+
+	if (b.Kind == Plain) != (b.Control == nil) {
+		return fmt.Errorf("ir: control of %s does not match its kind", b)
+	}
+
+	for _, s := range b.Succs {
+		if _, ok := index[s]; !ok {
+			return fmt.Errorf("ir: %s jumps to %s, which is not in the function", b, s)
+		}
+
+		if count(s.Preds, b) != count(b.Succs, s) {
+			return fmt.Errorf("ir: edge %s -> %s is missing in the predecessors of %s", b, s, s)
+		}
+
+		if index[s] <= index[b] {
+			return fmt.Errorf("ir: %s jumps back to %s", b, s)
+		}
+	}
+
+	for _, p := range b.Preds {
+		if count(p.Succs, b) == 0 {
+			return fmt.Errorf("ir: %s lists %s as predecessor, which does not jump to it", b, p)
+		}
+	}
+
+	return nil
+}
+
+func verifyValues(b *Block, defined map[*Value]bool, idom map[*Block]*Block) error {
+	seen := map[*Value]bool{}
+	phis := true
+
+	for _, v := range b.Values {
+		if v.Block != b {
+			return fmt.Errorf("ir: %s is listed in %s but belongs to %s", v, b, v.Block)
+		}
+
+		if v.Op != OpPhi {
+			phis = false
+		} else if !phis {
+			return fmt.Errorf("ir: phi %s follows other values in %s", v, b)
+		} else if len(v.Args) != len(b.Preds) {
+			return fmt.Errorf("ir: phi %s has %d arguments for %d predecessors", v, len(v.Args), len(b.Preds))
+		}
+
+		for i, a := range v.Args {
+			if a == nil || !defined[a] {
+				return fmt.Errorf("ir: %s uses a value that is not defined", v)
+			}
+
+			// The arguments of phis are used at the end of the
+			// predecessors, those of other values where they are.
+			use := b
+			if v.Op == OpPhi {
+				use = b.Preds[i]
+			}
+
+			if !available(a, use, seen, idom) && !(v.Op == OpPhi && a.Block == use) {
+				return fmt.Errorf("ir: %s uses %s before it is defined", v, a)
+			}
+		}
+
+		seen[v] = true
+	}
+
+	if c := b.Control; c != nil {
+		if !defined[c] {
+			return fmt.Errorf("ir: %s is controlled by a value that is not defined", b)
+		}
+
+		if !available(c, b, seen, idom) {
+			return fmt.Errorf("ir: %s is controlled by %s before it is defined", b, c)
+		}
+	}
+
+	return nil
+}
+
+// available reports whether a, used in block use, is defined before that
+// use on every path: earlier in the same block or in a block dominating it.
+func available(a *Value, use *Block, seen map[*Value]bool, idom map[*Block]*Block) bool {
+	if a.Block == use {
+		return seen[a]
+	}
+
+	for b := idom[use]; b != nil; b = idom[b] {
+		if b == a.Block {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dominators returns the immediate dominator of every block, the last block
+// all paths from the entry pass through before reaching it. The entry has
+// none. Blocks are ordered so that predecessors come first, which makes one
+// pass enough.
+func dominators(f *Func, index map[*Block]int) (map[*Block]*Block, error) {
+	idom := map[*Block]*Block{}
+
+	for _, b := range f.Blocks[1:] {
+		if len(b.Preds) == 0 {
+			return nil, fmt.Errorf("ir: %s is unreachable", b)
+		}
+
+		d := b.Preds[0]
+		for _, p := range b.Preds[1:] {
+			d = intersect(d, p, idom, index)
+		}
+		idom[b] = d
+	}
+
+	return idom, nil
+}
+
+// intersect returns the closest block dominating both a and b.
+func intersect(a, b *Block, idom map[*Block]*Block, index map[*Block]int) *Block {
+	for a != b {
+		for index[a] > index[b] {
+			a = idom[a]
+		}
+		for index[b] > index[a] {
+			b = idom[b]
+		}
+	}
+
+	return a
+}
+
+func count(blocks []*Block, b *Block) int {
+	n := 0
+	for _, x := range blocks {
+		if x == b {
+			n++
+		}
+	}
+
+	return n
+}
@@ -8,6 +8,9 @@ type Lexer struct {
 	position     int
 	readPosition int
 	ch           byte
+
+	line   int
+	column int
 }
 
 func NewLexerFromFile(filename string) *Lexer {
@@ -15,7 +18,7 @@ func NewLexerFromFile(filename string) *Lexer {
 }
 
 func NewLexer(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 
 	return l
@@ -29,7 +32,21 @@ func (l *Lexer) peekChar() byte {
 	return l.input[l.readPosition]
 }
 
+// peekCharAt returns the character n positions after the current one.
+func (l *Lexer) peekCharAt(n int) byte {
+	if l.position+n >= len(l.input) {
+		return 0
+	}
+
+	return l.input[l.position+n]
+}
+
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -38,24 +55,37 @@ func (l *Lexer) readChar() {
 
 	l.position = l.readPosition
 	l.readPosition += 1
+	l.column++
 }
 
-func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
+func (l *Lexer) NextToken() (tok token.Token) {
 
 	l.skipWhiteSpace()
 
+	pos := token.Position{Line: l.line, Column: l.column}
+	defer func() { tok.Pos = pos }()
+
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
 			l.readChar()
 
 			tok = token.Token{Type: token.EQ, Literal: "=="}
+		} else if l.peekChar() == '>' {
+			l.readChar()
+
+			tok = token.Token{Type: token.ARROW, Literal: "=>"}
 		} else {
 			tok = l.newToken(token.ASSIGN, l.ch)
 		}
 	case '-':
-		tok = l.newToken(token.MINUS, l.ch)
+		if l.peekChar() == '>' {
+			l.readChar()
+
+			tok = token.Token{Type: token.RARROW, Literal: "->"}
+		} else {
+			tok = l.newToken(token.MINUS, l.ch)
+		}
 	case '!':
 		if l.peekChar() == '=' {
 			l.readChar()
@@ -80,6 +110,19 @@ func (l *Lexer) NextToken() token.Token {
 		tok = l.newToken(token.RPAREN, l.ch)
 	case ',':
 		tok = l.newToken(token.COMMA, l.ch)
+	case '.':
+		if l.peekChar() == '.' && l.peekCharAt(2) == '.' {
+			l.readChar()
+			l.readChar()
+
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tok = l.newToken(token.DOT, l.ch)
+		}
+	case ':':
+		tok = l.newToken(token.COLON, l.ch)
+	case '?':
+		tok = l.newToken(token.QUESTION, l.ch)
 	case '+':
 		tok = l.newToken(token.PLUS, l.ch)
 	case '{':
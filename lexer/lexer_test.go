@@ -7,7 +7,7 @@ import (
 )
 
 func TestNextToken_1(t *testing.T) {
-	input := `=+(){},;`
+	input := `=+(){},;?:=>->...a.b`
 
 	tests := []struct {
 		expectedType    token.TokenType
@@ -21,6 +21,14 @@ func TestNextToken_1(t *testing.T) {
 		{token.RBRACE, "}"},
 		{token.COMMA, ","},
 		{token.SEMICOLON, ";"},
+		{token.QUESTION, "?"},
+		{token.COLON, ":"},
+		{token.ARROW, "=>"},
+		{token.RARROW, "->"},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "a"},
+		{token.DOT, "."},
+		{token.IDENT, "b"},
 	}
 
 	testHelper(t, input, tests)
@@ -183,3 +191,29 @@ func testHelper(
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  x + \"ab\"\n"
+
+	tests := []token.Position{
+		{Line: 1, Column: 1},
+		{Line: 1, Column: 5},
+		{Line: 1, Column: 7},
+		{Line: 1, Column: 9},
+		{Line: 1, Column: 10},
+		{Line: 2, Column: 3},
+		{Line: 2, Column: 5},
+		{Line: 2, Column: 7},
+		{Line: 3, Column: 1},
+	}
+
+	l := NewLexer(input)
+
+	for i, want := range tests {
+		tok := l.NextToken()
+
+		if tok.Pos != want {
+			t.Errorf("tests[%d] - position of %q wrong. expected=%s, got=%s", i, tok.Literal, want, tok.Pos)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// Package limit bounds the resources a program may use so that a runaway
+// script fails with an error instead of hanging or crashing its host. Both
+// the VM and the interpreter charge their work to a Budget.
+package limit
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrBudgetExceeded is returned when a run takes more steps or memory
+	// than allowed, ErrTimeout when it runs longer than allowed.
+	ErrBudgetExceeded = errors.New("execution budget exceeded")
+	ErrTimeout        = errors.New("execution time limit exceeded")
+	ErrCancelled      = errors.New("execution cancelled")
+	ErrStackOverflow  = errors.New("stack overflow")
+)
+
+// DefaultMaxDepth is the call depth allowed when Limits.MaxDepth is zero.
+const DefaultMaxDepth = 1024
+
+// checkInterval is the number of steps between checks of the context and the
+// deadline, which are too expensive to do on every step.
+const checkInterval = 1024
+
+// Limits are the resources a single run may use. Zero values mean no limit,
+// except for MaxDepth.
+type Limits struct {
+	// Steps is the number of VM instructions or evaluated AST nodes.
+	Steps int64
+
+	Timeout time.Duration
+
+	// MaxDepth is the number of nested function calls.
+	MaxDepth int
+
+	// Memory is the approximate number of bytes of objects allocated, see
+	// object.SizeOf. Memory is never given back during a run.
+	Memory int64
+}
+
+// Budget tracks the resources used by one run. The first limit that is hit
+// is remembered and returned by every later check. A nil Budget has no
+// limits.
+type Budget struct {
+	ctx      context.Context
+	limits   Limits
+	deadline time.Time
+
+	steps  int64
+	depth  int
+	memory int64
+
+	err error
+}
+
+func NewBudget(ctx context.Context, limits Limits) *Budget {
+	b := &Budget{ctx: ctx, limits: limits}
+
+	if limits.Timeout > 0 {
+		b.deadline = time.Now().Add(limits.Timeout)
+	}
+
+	if b.limits.MaxDepth == 0 {
+		b.limits.MaxDepth = DefaultMaxDepth
+	}
+
+	return b
+}
+
+// Step charges a single step.
+func (b *Budget) Step() error {
+	if b == nil {
+		return nil
+	}
+
+	if b.err != nil {
+		return b.err
+	}
+
+	b.steps++
+	if b.limits.Steps > 0 && b.steps > b.limits.Steps {
+		return b.fail(ErrBudgetExceeded)
+	}
+
+	if b.steps%checkInterval == 0 {
+		return b.check()
+	}
+
+	return nil
+}
+
+func (b *Budget) check() error {
+	select {
+	case <-b.ctx.Done():
+		return b.fail(ErrCancelled)
+	default:
+	}
+
+	if !b.deadline.IsZero() && time.Now().After(b.deadline) {
+		return b.fail(ErrTimeout)
+	}
+
+	return nil
+}
+
+// Enter charges a function call, Leave returns it.
+func (b *Budget) Enter() error {
+	if b == nil {
+		return nil
+	}
+
+	b.depth++
+	if b.depth > b.limits.MaxDepth {
+		return b.fail(ErrStackOverflow)
+	}
+
+	return nil
+}
+
+func (b *Budget) Leave() {
+	if b != nil {
+		b.depth--
+	}
+}
+
+// Alloc charges size bytes of memory.
+func (b *Budget) Alloc(size int64) error {
+	if b == nil {
+		return nil
+	}
+
+	b.memory += size
+	if b.limits.Memory > 0 && b.memory > b.limits.Memory {
+		return b.fail(ErrBudgetExceeded)
+	}
+
+	return nil
+}
+
+// Err returns the limit that stopped the run, if any.
+func (b *Budget) Err() error {
+	if b == nil {
+		return nil
+	}
+
+	return b.err
+}
+
+func (b *Budget) fail(err error) error {
+	if b.err == nil {
+		b.err = err
+	}
+
+	return b.err
+}
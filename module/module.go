@@ -0,0 +1,168 @@
+// Package module finds, parses and caches the modules named by import
+// statements. Running a module is left to the interpreter and the compiler,
+// which hand a load function to Loader.Import.
+package module
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/lexer"
+	"github.com/marmotini/ngiri-lang/parser"
+)
+
+// Extension is appended to import paths that have none.
+const Extension = ".ngiri"
+
+// PathEnv lists extra directories searched for modules, separated like PATH.
+const PathEnv = "NGIRI_PATH"
+
+type Module struct {
+	Name    string
+	Path    string
+	Program *ast.Program
+}
+
+// Resolver maps import paths to files. Paths starting with ./ or ../ are
+// relative to the importing file only, other paths are looked up next to the
+// importing file first and then in every directory of SearchPath.
+type Resolver struct {
+	SearchPath []string
+}
+
+func NewResolver() *Resolver {
+	return &Resolver{SearchPath: filepath.SplitList(os.Getenv(PathEnv))}
+}
+
+func (r *Resolver) Resolve(importPath, dir string) (string, error) {
+	name := filepath.FromSlash(importPath)
+	if filepath.Ext(name) == "" {
+		name += Extension
+	}
+
+	if filepath.IsAbs(name) {
+		if isFile(name) {
+			return name, nil
+		}
+		return "", fmt.Errorf("module %q not found", importPath)
+	}
+
+	dirs := []string{dir}
+	if !strings.HasPrefix(importPath, "./") && !strings.HasPrefix(importPath, "../") {
+		dirs = append(dirs, r.SearchPath...)
+	}
+
+	for _, d := range dirs {
+		if filename := filepath.Join(d, name); isFile(filename) {
+			return filepath.Abs(filename)
+		}
+	}
+
+	return "", fmt.Errorf("module %q not found in %s", importPath, strings.Join(dirs, ", "))
+}
+
+func isFile(filename string) bool {
+	info, err := os.Stat(filename)
+
+	return err == nil && !info.IsDir()
+}
+
+// Name is the namespace a module is imported as, see ast.ImportStatement.
+func Name(importPath string) string {
+	name := path.Base(importPath)
+
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+type Loader struct {
+	Resolver *Resolver
+
+	loaded  map[string]*Module
+	loading []*Module
+}
+
+func NewLoader(r *Resolver) *Loader {
+	return &Loader{Resolver: r, loaded: make(map[string]*Module)}
+}
+
+// Import resolves importPath relative to dir. The first import of a module
+// parses it and calls load with it; later imports return the cached module
+// without calling load again. Importing a module while it is still being
+// loaded is an import cycle and fails.
+func (l *Loader) Import(importPath, dir string, load func(*Module) error) (*Module, error) {
+	filename, err := l.Resolver.Resolve(importPath, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if m, ok := l.loaded[filename]; ok {
+		return m, nil
+	}
+
+	for i, m := range l.loading {
+		if m.Path == filename {
+			return nil, cycleError(l.loading[i:], importPath)
+		}
+	}
+
+	prog, err := parse(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Module{Name: Name(importPath), Path: filename, Program: prog}
+
+	l.loading = append(l.loading, m)
+	err = load(m)
+	l.loading = l.loading[:len(l.loading)-1]
+
+	if err != nil {
+		return nil, err
+	}
+
+	l.loaded[filename] = m
+
+	return m, nil
+}
+
+func cycleError(chain []*Module, importPath string) error {
+	names := []string{}
+	for _, m := range chain {
+		names = append(names, m.Name)
+	}
+	names = append(names, Name(importPath))
+
+	return fmt.Errorf("import cycle: %s", strings.Join(names, " -> "))
+}
+
+func parse(filename string) (*ast.Program, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser.NewParser(lexer.NewLexer(string(b)))
+	prog := p.ParseProgram()
+
+	if len(p.Errors()) > 0 {
+		return nil, fmt.Errorf("%s: parser errors:\n\t%s", filename, strings.Join(p.Errors(), "\n\t"))
+	}
+
+	return prog, nil
+}
+
+// Dir is the directory imports of the module stored at filename are resolved
+// against. Programs that were not read from a file resolve against the
+// working directory.
+func Dir(filename string) string {
+	if filename == "" {
+		return "."
+	}
+
+	return filepath.Dir(filename)
+}
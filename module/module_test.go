@@ -0,0 +1,112 @@
+package module
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tempTree(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "ngiri-module")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestResolve(t *testing.T) {
+	dir := tempTree(t, map[string]string{
+		"main/util.ngiri":  "",
+		"main/sub/x.ngiri": "",
+		"lib/math.ngiri":   "",
+		"lib/util.ngiri":   "",
+	})
+	defer os.RemoveAll(dir)
+
+	r := &Resolver{SearchPath: []string{filepath.Join(dir, "lib")}}
+	main := filepath.Join(dir, "main")
+
+	tests := []struct {
+		importPath string
+		expected   string
+	}{
+		{"util", "main/util.ngiri"},
+		{"./util", "main/util.ngiri"},
+		{"math", "lib/math.ngiri"},
+		{"math.ngiri", "lib/math.ngiri"},
+		{"sub/x", "main/sub/x.ngiri"},
+		{"../lib/math", "lib/math.ngiri"},
+	}
+
+	for _, tt := range tests {
+		filename, err := r.Resolve(tt.importPath, main)
+		assert.NoError(t, err, tt.importPath)
+		assert.Equal(t, filepath.Join(dir, filepath.FromSlash(tt.expected)), filename, tt.importPath)
+	}
+
+	_, err := r.Resolve("./math", main)
+	assert.EqualError(t, err, `module "./math" not found in `+main)
+
+	_, err = r.Resolve("nope", main)
+	assert.EqualError(t, err, `module "nope" not found in `+main+", "+filepath.Join(dir, "lib"))
+}
+
+func TestLoaderCachesModules(t *testing.T) {
+	dir := tempTree(t, map[string]string{"a.ngiri": "export let a = 1;"})
+	defer os.RemoveAll(dir)
+
+	l := NewLoader(&Resolver{})
+	loads := 0
+	load := func(m *Module) error {
+		loads++
+		return nil
+	}
+
+	first, err := l.Import("a", dir, load)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", first.Name)
+	assert.Len(t, first.Program.Statements, 1)
+
+	second, err := l.Import("./a.ngiri", dir, load)
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+	assert.Equal(t, 1, loads)
+}
+
+func TestLoaderErrors(t *testing.T) {
+	dir := tempTree(t, map[string]string{
+		"a.ngiri":   `import "b";`,
+		"b.ngiri":   `import "a";`,
+		"bad.ngiri": "let = 1;",
+	})
+	defer os.RemoveAll(dir)
+
+	l := NewLoader(&Resolver{})
+
+	_, err := l.Import("a", dir, func(m *Module) error {
+		_, err := l.Import("b", dir, func(m *Module) error {
+			_, err := l.Import("a", dir, func(*Module) error { return nil })
+			return err
+		})
+		return err
+	})
+	assert.EqualError(t, err, "import cycle: a -> b -> a")
+
+	_, err = l.Import("bad", dir, func(*Module) error { return nil })
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "bad.ngiri: parser errors:")
+}
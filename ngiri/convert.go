@@ -0,0 +1,444 @@
+package ngiri
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/marmotini/ngiri-lang/object"
+	"github.com/marmotini/ngiri-lang/vm"
+)
+
+// null and the booleans are the VM's singletons, which it compares by
+// identity.
+var null = vm.Null
+
+func nativeBoolean(b bool) object.Object {
+	if b {
+		return vm.True
+	}
+
+	return vm.False
+}
+
+var (
+	objectType = reflect.TypeOf((*object.Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// ToObject converts a Go value to an ngiri object. Integers of every size
+// become integers, slices and arrays become arrays, maps become hashes and
+// structs become hashes keyed by their exported field names, which a
+// `ngiri:"name"` tag can change ("-" skips the field). Functions become
+// builtins, see Func. Objects are returned unchanged.
+func ToObject(v interface{}) (object.Object, error) {
+	if v == nil {
+		return null, nil
+	}
+
+	if obj, ok := v.(object.Object); ok {
+		return obj, nil
+	}
+
+	return toObject(reflect.ValueOf(v))
+}
+
+func toObject(v reflect.Value) (object.Object, error) {
+	if obj, ok := v.Interface().(object.Object); ok && !(v.Kind() == reflect.Ptr && v.IsNil()) {
+		return obj, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return nativeBoolean(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &object.Integer{Value: int64(v.Uint())}, nil
+	case reflect.String:
+		return &object.String{Value: v.String()}, nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return null, nil
+		}
+		return toObject(v.Elem())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return null, nil
+		}
+		return toArray(v)
+	case reflect.Map:
+		if v.IsNil() {
+			return null, nil
+		}
+		return toHash(v)
+	case reflect.Struct:
+		return structToHash(v)
+	case reflect.Func:
+		if v.IsNil() {
+			return null, nil
+		}
+		return Func("function", v.Interface())
+	}
+
+	return nil, fmt.Errorf("can not convert %s to an ngiri value", v.Type())
+}
+
+func toArray(v reflect.Value) (object.Object, error) {
+	elements := make([]object.Object, v.Len())
+
+	for i := range elements {
+		el, err := toObject(v.Index(i))
+		if err != nil {
+			return nil, err
+		}
+
+		elements[i] = el
+	}
+
+	return &object.Array{Elements: elements}, nil
+}
+
+func toHash(v reflect.Value) (object.Object, error) {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	for _, k := range v.MapKeys() {
+		key, err := toObject(k)
+		if err != nil {
+			return nil, err
+		}
+
+		hashable, ok := key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("can not use %s as a hash key", key.Type())
+		}
+
+		value, err := toObject(v.MapIndex(k))
+		if err != nil {
+			return nil, err
+		}
+
+		pairs[hashable.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: pairs}, nil
+}
+
+func structToHash(v reflect.Value) (object.Object, error) {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	for i, name := range fieldNames(v.Type()) {
+		if name == "" {
+			continue
+		}
+
+		value, err := toObject(v.Field(i))
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %s", v.Type().Field(i).Name, err)
+		}
+
+		key := &object.String{Value: name}
+		pairs[key.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: pairs}, nil
+}
+
+// fieldNames returns the hash key of every field of the struct type t, or ""
+// for fields that are not converted.
+func fieldNames(t reflect.Type) []string {
+	names := make([]string, t.NumField())
+
+	for i := range names {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		switch tag := f.Tag.Get("ngiri"); tag {
+		case "-":
+		case "":
+			names[i] = f.Name
+		default:
+			names[i] = tag
+		}
+	}
+
+	return names
+}
+
+// FromObject stores obj in the Go value ptr points to, converting it like
+// ToObject in reverse. Decoding into an interface{} picks int64, string,
+// bool, nil, []interface{} and map[string]interface{}, or
+// map[interface{}]interface{} for hashes with non string keys; other objects
+// are stored as they are.
+func FromObject(obj object.Object, ptr interface{}) error {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errors.New("FromObject needs a non-nil pointer")
+	}
+
+	return fromObject(obj, v.Elem())
+}
+
+// Value converts obj to its natural Go value, see FromObject.
+func Value(obj object.Object) interface{} {
+	var v interface{}
+	fromObject(obj, reflect.ValueOf(&v).Elem())
+
+	return v
+}
+
+func fromObject(obj object.Object, v reflect.Value) error {
+	if v.Type() == objectType {
+		v.Set(reflect.ValueOf(&obj).Elem())
+		return nil
+	}
+
+	if obj == nil || obj.Type() == object.NULL_OBJ {
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map, reflect.Func:
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		return fmt.Errorf("can not convert null to %s", v.Type())
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		natural, err := naturalValue(obj)
+		if err != nil {
+			return err
+		}
+		if !reflect.TypeOf(natural).AssignableTo(v.Type()) {
+			return mismatch(obj, v.Type())
+		}
+		v.Set(reflect.ValueOf(natural))
+		return nil
+	case reflect.Ptr:
+		elem := reflect.New(v.Type().Elem())
+		if err := fromObject(obj, elem.Elem()); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return setInteger(obj, v)
+	case *object.String:
+		if v.Kind() != reflect.String {
+			return mismatch(obj, v.Type())
+		}
+		v.SetString(obj.Value)
+	case *object.Boolean:
+		if v.Kind() != reflect.Bool {
+			return mismatch(obj, v.Type())
+		}
+		v.SetBool(obj.Value)
+	case *object.Array:
+		return setArray(obj, v)
+	case *object.Hash:
+		return setHash(obj, v)
+	default:
+		return mismatch(obj, v.Type())
+	}
+
+	return nil
+}
+
+func naturalValue(obj object.Object) (interface{}, error) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return obj.Value, nil
+	case *object.String:
+		return obj.Value, nil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.Array:
+		var s []interface{}
+		err := setArray(obj, reflect.ValueOf(&s).Elem())
+		return s, err
+	case *object.Hash:
+		for _, pair := range obj.Pairs {
+			if pair.Key.Type() != object.STRING_OBJ {
+				var m map[interface{}]interface{}
+				err := setHash(obj, reflect.ValueOf(&m).Elem())
+				return m, err
+			}
+		}
+
+		var m map[string]interface{}
+		err := setHash(obj, reflect.ValueOf(&m).Elem())
+		return m, err
+	}
+
+	return obj, nil
+}
+
+func setInteger(obj *object.Integer, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.OverflowInt(obj.Value) {
+			return fmt.Errorf("integer %d overflows %s", obj.Value, v.Type())
+		}
+		v.SetInt(obj.Value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if obj.Value < 0 || v.OverflowUint(uint64(obj.Value)) {
+			return fmt.Errorf("integer %d overflows %s", obj.Value, v.Type())
+		}
+		v.SetUint(uint64(obj.Value))
+	default:
+		return mismatch(obj, v.Type())
+	}
+
+	return nil
+}
+
+func setArray(obj *object.Array, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), len(obj.Elements), len(obj.Elements)))
+	case reflect.Array:
+		if v.Len() != len(obj.Elements) {
+			return fmt.Errorf("can not convert ARRAY of %d elements to %s", len(obj.Elements), v.Type())
+		}
+	default:
+		return mismatch(obj, v.Type())
+	}
+
+	for i, el := range obj.Elements {
+		if err := fromObject(el, v.Index(i)); err != nil {
+			return fmt.Errorf("index %d: %s", i, err)
+		}
+	}
+
+	return nil
+}
+
+func setHash(obj *object.Hash, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Map:
+		m := reflect.MakeMapWithSize(v.Type(), len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := fromObject(pair.Key, key); err != nil {
+				return fmt.Errorf("key %s: %s", pair.Key.Inspect(), err)
+			}
+
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err := fromObject(pair.Value, value); err != nil {
+				return fmt.Errorf("key %s: %s", pair.Key.Inspect(), err)
+			}
+
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+	case reflect.Struct:
+		for i, name := range fieldNames(v.Type()) {
+			if name == "" {
+				continue
+			}
+
+			key := &object.String{Value: name}
+			pair, ok := obj.Pairs[key.HashKey()]
+			if !ok {
+				continue
+			}
+
+			if err := fromObject(pair.Value, v.Field(i)); err != nil {
+				return fmt.Errorf("field %s: %s", v.Type().Field(i).Name, err)
+			}
+		}
+	default:
+		return mismatch(obj, v.Type())
+	}
+
+	return nil
+}
+
+func mismatch(obj object.Object, t reflect.Type) error {
+	return fmt.Errorf("can not convert %s to %s", obj.Type(), t)
+}
+
+// Func wraps the Go function fn as a builtin. Arguments are converted with
+// FromObject and results with ToObject. A function may return nothing, a
+// value, an error or a value and an error; a non-nil error stops the ngiri
+// program. name is used in error messages.
+func Func(name string, fn interface{}) (*object.BuiltIn, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return nil, fmt.Errorf("%s is a %T, not a function", name, fn)
+	}
+
+	t := v.Type()
+	results := t.NumOut()
+	returnsError := results > 0 && t.Out(results-1) == errorType
+	if returnsError {
+		results--
+	}
+
+	if results > 1 {
+		return nil, fmt.Errorf("%s returns %d values, want at most one value and an error", name, t.NumOut())
+	}
+
+	call := func(args ...object.Object) object.Object {
+		in, err := arguments(t, args)
+		if err != nil {
+			return newError("%s: %s", name, err)
+		}
+
+		out := v.Call(in)
+
+		if returnsError && !out[len(out)-1].IsNil() {
+			return newError("%s: %s", name, out[len(out)-1].Interface().(error))
+		}
+
+		if results == 0 {
+			return null
+		}
+
+		result, err := toObject(out[0])
+		if err != nil {
+			return newError("%s: %s", name, err)
+		}
+
+		return result
+	}
+
+	return &object.BuiltIn{FN: call}, nil
+}
+
+func arguments(t reflect.Type, args []object.Object) ([]reflect.Value, error) {
+	params := t.NumIn()
+	if t.IsVariadic() && len(args) < params-1 {
+		return nil, fmt.Errorf("wrong number of arguments. got=%d, want at least %d", len(args), params-1)
+	}
+
+	if !t.IsVariadic() && len(args) != params {
+		return nil, fmt.Errorf("wrong number of arguments. got=%d, want=%d", len(args), params)
+	}
+
+	in := make([]reflect.Value, len(args))
+
+	for i, arg := range args {
+		var pt reflect.Type
+		if t.IsVariadic() && i >= params-1 {
+			pt = t.In(params - 1).Elem()
+		} else {
+			pt = t.In(i)
+		}
+
+		in[i] = reflect.New(pt).Elem()
+		if err := fromObject(arg, in[i]); err != nil {
+			return nil, fmt.Errorf("argument %d: %s", i+1, err)
+		}
+	}
+
+	return in, nil
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...), Kind: object.RuntimeError, Thrown: true}
+}
@@ -0,0 +1,93 @@
+package ngiri
+
+import (
+	"testing"
+
+	"github.com/marmotini/ngiri-lang/object"
+	"github.com/stretchr/testify/assert"
+)
+
+type point struct {
+	X, Y   int
+	Label  string `ngiri:"label"`
+	Hidden bool   `ngiri:"-"`
+	secret int
+}
+
+func TestToObject(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{nil, "null"},
+		{int8(-3), "-3"},
+		{uint32(7), "7"},
+		{"ngiri", "ngiri"},
+		{true, "true"},
+		{[]int{1, 2, 3}, "[1, 2, 3]"},
+		{[2]string{"a", "b"}, "[a, b]"},
+		{[]interface{}{1, "a", nil}, "[1, a, null]"},
+		{map[string]int{"a": 1}, "{a: 1}"},
+		{point{X: 1, Hidden: true}, ""},
+		{&object.Integer{Value: 5}, "5"},
+		{(*point)(nil), "null"},
+		{[]int(nil), "null"},
+	}
+
+	for _, tt := range tests {
+		obj, err := ToObject(tt.input)
+		assert.NoError(t, err)
+
+		if tt.expected != "" {
+			assert.Equal(t, tt.expected, obj.Inspect(), "%#v", tt.input)
+		}
+	}
+
+	obj, err := ToObject(point{X: 1, Y: 2, Label: "p", Hidden: true})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"X": int64(1), "Y": int64(2), "label": "p"}, Value(obj))
+
+	_, err = ToObject(map[float64]int{1: 1})
+	assert.EqualError(t, err, "can not convert float64 to an ngiri value")
+
+	_, err = ToObject([]interface{}{1, 1.5})
+	assert.EqualError(t, err, "can not convert float64 to an ngiri value")
+}
+
+func TestFromObject(t *testing.T) {
+	var p point
+	obj, _ := ToObject(map[string]interface{}{"X": 3, "label": "q", "Hidden": true, "other": 1})
+	assert.NoError(t, FromObject(obj, &p))
+	assert.Equal(t, point{X: 3, Label: "q"}, p)
+
+	var ints []uint8
+	obj, _ = ToObject([]int{1, 2})
+	assert.NoError(t, FromObject(obj, &ints))
+	assert.Equal(t, []uint8{1, 2}, ints)
+
+	obj, _ = ToObject([]int{1, 300})
+	assert.EqualError(t, FromObject(obj, &ints), "index 1: integer 300 overflows uint8")
+
+	var m map[int]bool
+	obj, _ = ToObject(map[int]bool{1: true})
+	assert.NoError(t, FromObject(obj, &m))
+	assert.Equal(t, map[int]bool{1: true}, m)
+	assert.Equal(t, map[interface{}]interface{}{int64(1): true}, Value(obj))
+
+	var ptr *int
+	assert.NoError(t, FromObject(&object.Integer{Value: 4}, &ptr))
+	assert.Equal(t, 4, *ptr)
+	assert.NoError(t, FromObject(null, &ptr))
+	assert.Nil(t, ptr)
+
+	var s string
+	assert.EqualError(t, FromObject(&object.Integer{Value: 4}, &s), "can not convert INTEGER to string")
+	assert.EqualError(t, FromObject(null, &s), "can not convert null to string")
+	assert.EqualError(t, FromObject(null, s), "FromObject needs a non-nil pointer")
+
+	var raw object.Object
+	fn := &object.CompiledFunction{}
+	assert.NoError(t, FromObject(fn, &raw))
+	assert.Equal(t, fn, raw)
+	assert.Equal(t, fn, Value(fn))
+}
@@ -0,0 +1,198 @@
+// Package ngiri embeds the language in Go programs. A Runtime compiles and
+// runs source on the VM and keeps its globals between calls, so the host can
+// define values and functions before running a script and read the results
+// afterwards.
+package ngiri
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/builtin"
+	"github.com/marmotini/ngiri-lang/code"
+	"github.com/marmotini/ngiri-lang/compiler"
+	"github.com/marmotini/ngiri-lang/interpreter"
+	"github.com/marmotini/ngiri-lang/lexer"
+	"github.com/marmotini/ngiri-lang/limit"
+	"github.com/marmotini/ngiri-lang/object"
+	"github.com/marmotini/ngiri-lang/parser"
+	"github.com/marmotini/ngiri-lang/vm"
+)
+
+type Options struct {
+	// ModulePath is the file evaluated sources are treated as, imports are
+	// resolved relative to it. The working directory is used when empty.
+	ModulePath string
+
+	// Limits bound every Eval and Call, see package limit. The macros an
+	// Eval expands are limited on their own.
+	Limits limit.Limits
+
+	// Policy decides which builtins scripts can use. Only the builtins
+	// without side effects are linked when it is nil.
+	Policy *builtin.Policy
+}
+
+type Runtime struct {
+	opts Options
+
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []object.Object
+	macros      *object.Environment
+}
+
+func NewRuntime(opts Options) *Runtime {
+	if opts.Policy == nil {
+		opts.Policy = builtin.NewPolicy()
+	}
+
+	symbolTable := compiler.NewSymbolTable()
+	symbolTable.LinkBuiltins(opts.Policy)
+
+	macros := object.NewEnvironment()
+	interpreter.Link(macros, opts.Policy)
+
+	return &Runtime{
+		opts:        opts,
+		symbolTable: symbolTable,
+		constants:   []object.Object{},
+		globals:     make([]object.Object, vm.GlobalsSize),
+		macros:      macros,
+	}
+}
+
+// Eval runs src and returns the value of its last expression statement.
+// Globals defined by src stay visible to later calls.
+func (r *Runtime) Eval(src string) (object.Object, error) {
+	return r.EvalContext(context.Background(), src)
+}
+
+// EvalContext is Eval stopping with vm.ErrCancelled once ctx is done.
+func (r *Runtime) EvalContext(ctx context.Context, src string) (object.Object, error) {
+	p := parser.NewParser(lexer.NewLexer(src))
+	prog := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, fmt.Errorf("parser errors:\n\t%s", strings.Join(p.Errors(), "\n\t"))
+	}
+
+	interpreter.DefineMacros(prog, r.macros)
+	expanded, err := interpreter.ExpandMacrosContext(ctx, prog, r.macros, r.opts.Limits)
+	if err != nil {
+		return nil, err
+	}
+
+	// The names src defines are only kept once it compiles.
+	symbolTable := r.symbolTable.Copy()
+	comp := compiler.NewWithState(symbolTable, r.constants)
+	comp.SetModulePath(r.opts.ModulePath)
+
+	if err := comp.Compile(expanded.(*ast.Program)); err != nil {
+		return nil, err
+	}
+
+	bytecode := comp.Bytecode()
+	r.symbolTable = symbolTable
+	r.constants = bytecode.Constants
+
+	return r.run(ctx, bytecode)
+}
+
+// Call calls the global function fnName with args, converted by ToObject.
+func (r *Runtime) Call(fnName string, args ...interface{}) (object.Object, error) {
+	return r.CallContext(context.Background(), fnName, args...)
+}
+
+// CallContext is Call stopping with vm.ErrCancelled once ctx is done.
+func (r *Runtime) CallContext(ctx context.Context, fnName string, args ...interface{}) (object.Object, error) {
+	symbol, ok := r.symbolTable.Resolve(fnName)
+	if !ok || symbol.Scope != compiler.GlobalScope {
+		return nil, fmt.Errorf("undefined function %s", fnName)
+	}
+
+	switch r.globals[symbol.Index].(type) {
+	case *object.CompiledFunction, *object.BuiltIn:
+	default:
+		return nil, fmt.Errorf("%s is not a function", fnName)
+	}
+
+	// The call runs as a program of its own; the arguments are constants
+	// of that program only.
+	constants := r.constants[:len(r.constants):len(r.constants)]
+	instructions := code.Instructions(code.Make(code.OpGetGlobal, symbol.Index))
+
+	for i, arg := range args {
+		obj, err := ToObject(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d to %s: %s", i+1, fnName, err)
+		}
+
+		constants = append(constants, obj)
+		instructions = append(instructions, code.Make(code.OpConstant, len(constants)-1)...)
+	}
+
+	instructions = append(instructions, code.Make(code.OpCall, len(args))...)
+	instructions = append(instructions, code.Make(code.OpPop)...)
+
+	return r.run(ctx, &compiler.Bytecode{Instructions: instructions, Constants: constants})
+}
+
+func (r *Runtime) run(ctx context.Context, bytecode *compiler.Bytecode) (object.Object, error) {
+	machine := vm.NewWithGlobalsStore(bytecode, r.globals)
+	machine.SetLimits(r.opts.Limits)
+
+	if err := machine.RunContext(ctx); err != nil {
+		return nil, err
+	}
+
+	return machine.LastPoppedStackElem(), nil
+}
+
+// SetGlobal binds name to value, converted by ToObject, for all later
+// calls. Go functions become builtins, see Func.
+func (r *Runtime) SetGlobal(name string, value interface{}) error {
+	var obj object.Object
+	var err error
+
+	if value != nil && reflect.TypeOf(value).Kind() == reflect.Func {
+		obj, err = Func(name, value)
+	} else {
+		obj, err = ToObject(value)
+	}
+
+	if err != nil {
+		return fmt.Errorf("global %s: %s", name, err)
+	}
+
+	symbol, ok := r.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope {
+		symbol = r.symbolTable.Define(name)
+	}
+
+	r.globals[symbol.Index] = obj
+
+	return nil
+}
+
+// GetGlobal returns the value of the global name.
+func (r *Runtime) GetGlobal(name string) (object.Object, bool) {
+	symbol, ok := r.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope || r.globals[symbol.Index] == nil {
+		return nil, false
+	}
+
+	return r.globals[symbol.Index], true
+}
+
+// Register makes the Go function fn callable as name, see Func.
+func (r *Runtime) Register(name string, fn interface{}) error {
+	builtin, err := Func(name, fn)
+	if err != nil {
+		return err
+	}
+
+	return r.SetGlobal(name, builtin)
+}
@@ -0,0 +1,261 @@
+package ngiri
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marmotini/ngiri-lang/builtin"
+	"github.com/marmotini/ngiri-lang/limit"
+	"github.com/marmotini/ngiri-lang/object"
+	"github.com/marmotini/ngiri-lang/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEval(t *testing.T) {
+	r := NewRuntime(Options{})
+
+	_, err := r.Eval(`let double = fn(x) { x * 2 };`)
+	assert.NoError(t, err)
+
+	result, err := r.Eval(`double(21)`)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), Value(result))
+
+	_, err = r.Eval(`let = 1;`)
+	assert.EqualError(t, err, "parser errors:\n\texpected next token to be IDENT, got = instead\n\tno prefix parse function for = found")
+
+	_, err = r.Eval(`missing`)
+	assert.EqualError(t, err, "undefined variable missing")
+
+	// programs that do not compile define nothing
+	_, err = r.Eval(`let defined = 1; missing`)
+	assert.EqualError(t, err, "undefined variable missing")
+	_, err = r.Eval(`defined`)
+	assert.EqualError(t, err, "undefined variable defined")
+
+	_, err = r.Eval(`1 / 0`)
+	assert.EqualError(t, err, "division by zero")
+}
+
+func TestGlobals(t *testing.T) {
+	r := NewRuntime(Options{})
+
+	assert.NoError(t, r.SetGlobal("limit", 10))
+	assert.NoError(t, r.SetGlobal("name", "ngiri"))
+
+	result, err := r.Eval(`let over = limit > 5; name + "!"`)
+	assert.NoError(t, err)
+	assert.Equal(t, "ngiri!", Value(result))
+
+	over, ok := r.GetGlobal("over")
+	assert.True(t, ok)
+	assert.Equal(t, true, Value(over))
+
+	assert.NoError(t, r.SetGlobal("limit", 1))
+	result, err = r.Eval(`limit > 5`)
+	assert.NoError(t, err)
+	assert.Equal(t, false, Value(result))
+
+	_, ok = r.GetGlobal("missing")
+	assert.False(t, ok)
+
+	assert.EqualError(t, r.SetGlobal("ratio", 0.5), "global ratio: can not convert float64 to an ngiri value")
+}
+
+func TestCall(t *testing.T) {
+	r := NewRuntime(Options{})
+
+	_, err := r.Eval(`let add = fn(a, b) { a + b }; let answer = 42;`)
+	assert.NoError(t, err)
+
+	result, err := r.Call("add", 40, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), Value(result))
+
+	result, err = r.Call("add", "ng", "iri")
+	assert.NoError(t, err)
+	assert.Equal(t, "ngiri", Value(result))
+
+	_, err = r.Call("add", 1)
+	assert.EqualError(t, err, "add(a, b) is missing the argument b")
+
+	_, err = r.Call("answer")
+	assert.EqualError(t, err, "answer is not a function")
+
+	_, err = r.Call("nope")
+	assert.EqualError(t, err, "undefined function nope")
+
+	// calls do not leak their arguments into later programs
+	constants := len(r.constants)
+	_, err = r.Call("add", 1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, constants, len(r.constants))
+}
+
+func TestImports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ngiri-runtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "lib.ngiri"), []byte("export let k = 42;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRuntime(Options{ModulePath: filepath.Join(dir, "main.ngiri")})
+
+	_, err = r.Eval(`import "lib";`)
+	assert.NoError(t, err)
+
+	// imports stay visible to later Evals, which do not load them again
+	result, err := r.Eval(`lib.k`)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), Value(result))
+
+	result, err = r.Eval(`import {k} from "lib"; k + lib.k`)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(84), Value(result))
+}
+
+func TestRegister(t *testing.T) {
+	r := NewRuntime(Options{})
+
+	type order struct {
+		ID    string
+		Total int
+		Items []string `ngiri:"items"`
+	}
+
+	var seen []string
+
+	assert.NoError(t, r.Register("lookup", func(id string) (*order, error) {
+		if id == "missing" {
+			return nil, errors.New("no such order")
+		}
+		return &order{ID: id, Total: 120, Items: []string{"a", "b"}}, nil
+	}))
+	assert.NoError(t, r.Register("log", func(msgs ...string) {
+		seen = append(seen, strings.Join(msgs, " "))
+	}))
+	assert.NoError(t, r.Register("discount", func(o order) int {
+		if len(o.Items) > 1 {
+			return o.Total / 10
+		}
+		return 0
+	}))
+
+	result, err := r.Eval(`let o = lookup("o-1"); log("checking", "o-1"); discount(o)`)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12), Value(result))
+	assert.Equal(t, []string{"checking o-1"}, seen)
+
+	result, err = r.Call("lookup", "o-2")
+	assert.NoError(t, err)
+
+	var decoded order
+	assert.NoError(t, FromObject(result, &decoded))
+	assert.Equal(t, order{ID: "o-2", Total: 120, Items: []string{"a", "b"}}, decoded)
+
+	_, err = r.Eval(`lookup("missing")`)
+	assert.EqualError(t, err, "lookup: no such order")
+
+	_, err = r.Eval(`lookup(1)`)
+	assert.EqualError(t, err, "lookup: argument 1: can not convert INTEGER to string")
+
+	_, err = r.Eval(`lookup()`)
+	assert.EqualError(t, err, "lookup: wrong number of arguments. got=0, want=1")
+
+	_, err = r.Eval(`log()`)
+	assert.NoError(t, err)
+
+	assert.EqualError(t, r.Register("bad", 1), "bad is a int, not a function")
+	assert.EqualError(t, r.Register("bad", func() (int, int) { return 0, 0 }), "bad returns 2 values, want at most one value and an error")
+}
+
+func TestHostFunctionValues(t *testing.T) {
+	r := NewRuntime(Options{})
+
+	assert.NoError(t, r.Register("flag", func() bool { return true }))
+	assert.NoError(t, r.Register("nothing", func() *string { return nil }))
+
+	result, err := r.Eval(`flag() == true`)
+	assert.NoError(t, err)
+	assert.Equal(t, true, Value(result))
+
+	result, err = r.Eval(`!nothing()`)
+	assert.NoError(t, err)
+	assert.Equal(t, true, Value(result))
+
+	result, err = r.Eval(`nothing()`)
+	assert.NoError(t, err)
+	assert.Equal(t, object.ObjectType(object.NULL_OBJ), result.Type())
+}
+
+func TestLimits(t *testing.T) {
+	r := NewRuntime(Options{Limits: limit.Limits{Steps: 10000}})
+
+	_, err := r.Eval(`let loop = fn(n) { 1 + loop(n + 1) };`)
+	assert.NoError(t, err)
+
+	_, err = r.Call("loop", 0)
+	assert.IsType(t, &vm.StackOverflowError{}, err)
+	assert.EqualError(t, err, "stack overflow at call depth 1024 in loop, loop, loop, loop, loop, loop, loop, loop, loop, loop and 1014 more")
+
+	_, err = r.Eval(`let count = fn(n) { if (n == 0) { 0 } else { count(n - 1) } }; count(100000)`)
+	assert.Equal(t, vm.ErrBudgetExceeded, err)
+
+	r = NewRuntime(Options{Limits: limit.Limits{Timeout: time.Nanosecond}})
+	_, err = r.Eval(`let count = fn(n) { if (n == 0) { 0 } else { count(n - 1) } }; count(100000)`)
+	assert.True(t, errors.Is(err, limit.ErrTimeout), "got %v, want a timeout", err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r = NewRuntime(Options{})
+	_, err = r.Eval(`let count = fn(n) { if (n == 0) { 0 } else { count(n - 1) } };`)
+	assert.NoError(t, err)
+
+	_, err = r.CallContext(ctx, "count", 500)
+	assert.Equal(t, vm.ErrCancelled, err)
+
+	result, err := r.Call("count", 500)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), Value(result))
+}
+
+func TestMacroLimits(t *testing.T) {
+	r := NewRuntime(Options{Limits: limit.Limits{Steps: 1000, Timeout: time.Second}})
+	_, err := r.Eval(`let m = macro() { let f = fn(n) { f(n + 1) }; f(0) }; m();`)
+	assert.Equal(t, limit.ErrBudgetExceeded, err)
+
+	r = NewRuntime(Options{Limits: limit.Limits{Timeout: time.Second}})
+	_, err = r.Eval(`let m = macro() { let f = fn(n) { 1 + f(n + 1) }; f(0) }; m();`)
+	assert.Equal(t, limit.ErrStackOverflow, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r = NewRuntime(Options{})
+	_, err = r.EvalContext(ctx, `let m = macro() { let f = fn(n) { if (n > 0) { f(n - 1) } else { quote(1) } }; f(100000) }; m();`)
+	assert.Equal(t, limit.ErrCancelled, err)
+}
+
+func TestPolicy(t *testing.T) {
+	_, err := NewRuntime(Options{}).Eval(`puts("leak")`)
+	assert.EqualError(t, err, "puts needs the io capability, which is not allowed")
+
+	result, err := NewRuntime(Options{}).Eval(`len("abc")`)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), Value(result))
+
+	result, err = NewRuntime(Options{Policy: builtin.NewPolicy(builtin.Random)}).Eval(`random(1)`)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), Value(result))
+}
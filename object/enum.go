@@ -0,0 +1,108 @@
+package object
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EnumType describes the values an `enum Shape { Circle(r), Empty }`
+// declaration creates. Selecting a variant from it, `Shape.Circle`, gives the
+// constructor of the variant, or the only value of a variant without fields.
+type EnumType struct {
+	Name     string
+	Variants []*VariantType
+}
+
+// NewEnumType returns the enum name with no variants yet.
+func NewEnumType(name string) *EnumType {
+	return &EnumType{Name: name}
+}
+
+func (et *EnumType) Type() ObjectType { return ENUM_OBJ }
+func (et *EnumType) Inspect() string  { return "enum " + et.Name }
+
+// AddVariant adds the variant name with the given fields. Its tag is its
+// position in the declaration.
+func (et *EnumType) AddVariant(name string, fields []string) *VariantType {
+	vt := &VariantType{Enum: et, Name: name, Fields: fields, Tag: len(et.Variants)}
+	if len(fields) == 0 {
+		vt.Unit = &Variant{VariantType: vt}
+	}
+
+	et.Variants = append(et.Variants, vt)
+
+	return vt
+}
+
+// Select returns what `Shape.name` evaluates to: the constructor of the
+// variant name, or its value when it has no fields.
+func (et *EnumType) Select(name string) (Object, error) {
+	for _, vt := range et.Variants {
+		if vt.Name != name {
+			continue
+		}
+
+		if vt.Unit != nil {
+			return vt.Unit, nil
+		}
+		return vt, nil
+	}
+
+	return nil, fmt.Errorf("enum %s has no variant %s", et.Name, name)
+}
+
+// VariantType is a variant of an enum. Variants with fields are called like
+// functions to construct their values, `Shape.Circle(3)`.
+type VariantType struct {
+	Enum   *EnumType
+	Name   string
+	Fields []string
+	Tag    int
+
+	// Unit is the only value of a variant without fields, nil otherwise.
+	Unit *Variant
+}
+
+func (vt *VariantType) Type() ObjectType { return VARIANT_TYPE_OBJ }
+func (vt *VariantType) Inspect() string  { return vt.Enum.Name + "." + vt.Name }
+
+// New constructs a value of the variant from the values of its fields.
+func (vt *VariantType) New(values []Object) (*Variant, error) {
+	if len(values) != len(vt.Fields) {
+		return nil, fmt.Errorf("wrong number of arguments for %s. got=%d, want=%d", vt.Inspect(), len(values), len(vt.Fields))
+	}
+
+	return &Variant{VariantType: vt, Values: append([]Object{}, values...)}, nil
+}
+
+// Variant is a value of an enum, tagged with its variant. Values is parallel
+// to the variant's fields.
+type Variant struct {
+	VariantType *VariantType
+	Values      []Object
+}
+
+func (v *Variant) Type() ObjectType { return VARIANT_OBJ }
+func (v *Variant) Inspect() string {
+	if len(v.Values) == 0 {
+		return v.VariantType.Inspect()
+	}
+
+	values := []string{}
+	for _, value := range v.Values {
+		values = append(values, value.Inspect())
+	}
+
+	return v.VariantType.Inspect() + "(" + strings.Join(values, ", ") + ")"
+}
+
+// Field returns the value of the field name.
+func (v *Variant) Field(name string) (Object, bool) {
+	for i, f := range v.VariantType.Fields {
+		if f == name {
+			return v.Values[i], true
+		}
+	}
+
+	return nil, false
+}
@@ -1,14 +1,44 @@
 package object
 
+import (
+	"fmt"
+
+	"github.com/marmotini/ngiri-lang/limit"
+	"github.com/marmotini/ngiri-lang/module"
+)
+
 type Environment struct {
 	store map[string]Object
 
+	// constants are the names of store bound by const declarations.
+	constants map[string]bool
+
 	outer *Environment
+
+	module *Module
+
+	budget *limit.Budget
+
+	// builtins are the builtins linked into a top level environment.
+	builtins map[string]Object
+
+	// imports are the modules imported into a top level environment, see
+	// Imports.
+	imports *Imports
+}
+
+// Imports are the modules a program imports, directly or through other
+// modules, by path. Each program loads its own, so a module runs with the
+// builtins of the program importing it.
+type Imports struct {
+	Loader  *module.Loader
+	Modules map[string]*Module
 }
 
 func NewEnclosedEnvironment(env *Environment) *Environment {
 	e := NewEnvironment()
 	e.outer = env
+	e.budget = env.budget
 
 	return e
 }
@@ -17,17 +47,145 @@ func NewEnvironment() *Environment {
 	return &Environment{store: make(map[string]Object)}
 }
 
+// NewModuleEnvironment returns the top level environment of module m.
+func NewModuleEnvironment(m *Module) *Environment {
+	e := NewEnvironment()
+	e.module = m
+
+	return e
+}
+
 func (e *Environment) Set(name string, val Object) Object {
 	e.store[name] = val
 
 	return val
 }
 
+// Declare binds name in e for a let or const declaration. Declarations may
+// shadow the names of outer environments, but not a name e binds already.
+func (e *Environment) Declare(name string, val Object, constant bool) error {
+	if _, ok := e.store[name]; ok {
+		return fmt.Errorf("%s is already declared in this scope", name)
+	}
+
+	e.store[name] = val
+
+	if constant {
+		if e.constants == nil {
+			e.constants = make(map[string]bool)
+		}
+		e.constants[name] = true
+	}
+
+	return nil
+}
+
+// Assign changes the value of name in the innermost environment binding it.
+// Constants and names no environment binds can not be assigned.
+func (e *Environment) Assign(name string, val Object) error {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; !ok {
+			continue
+		}
+
+		if env.constants[name] {
+			return fmt.Errorf("cannot assign to constant %s", name)
+		}
+
+		env.store[name] = val
+		return nil
+	}
+
+	return fmt.Errorf("identifier not found: %s", name)
+}
+
 func (e *Environment) Get(name string) (Object, bool) {
 	obj, ok := e.store[name]
 	if !ok && e.outer != nil {
 		obj, ok = e.outer.Get(name)
 	}
 
+	if !ok && e.outer == nil && e.builtins != nil {
+		obj, ok = e.builtins[name]
+	}
+
 	return obj, ok
 }
+
+// TopLevel reports whether e is the top level environment of a program or
+// module rather than that of a function or block.
+func (e *Environment) TopLevel() bool {
+	return e.outer == nil
+}
+
+// Module returns the module e belongs to, nil outside of modules.
+func (e *Environment) Module() *Module {
+	if e.module == nil && e.outer != nil {
+		return e.outer.Module()
+	}
+
+	return e.module
+}
+
+// Export records val as an export of the module e is the top level
+// environment of. It reports false if e is not a module's top level.
+func (e *Environment) Export(name string, val Object) bool {
+	if e.module == nil {
+		return false
+	}
+
+	e.module.Exports[name] = val
+
+	return true
+}
+
+// SetBudget makes evaluation in e and the environments enclosed by it from
+// now on charge b.
+func (e *Environment) SetBudget(b *limit.Budget) {
+	e.budget = b
+}
+
+// Budget returns the budget evaluation in e is charged to, nil if it is not
+// limited. Enclosed environments start out with the budget of their outer
+// environment.
+func (e *Environment) Budget() *limit.Budget {
+	return e.budget
+}
+
+// Link makes builtins visible in the top level environment e and all
+// environments it encloses. Bindings of the program shadow them.
+func (e *Environment) Link(builtins map[string]Object) {
+	e.builtins = builtins
+}
+
+// Builtins returns the builtins linked into the top level environment of e,
+// nil if none were linked.
+func (e *Environment) Builtins() map[string]Object {
+	if e.outer != nil {
+		return e.outer.Builtins()
+	}
+
+	return e.builtins
+}
+
+// Imports returns the modules imported into the program of e.
+func (e *Environment) Imports() *Imports {
+	if e.outer != nil {
+		return e.outer.Imports()
+	}
+
+	if e.imports == nil {
+		e.imports = &Imports{
+			Loader:  module.NewLoader(module.NewResolver()),
+			Modules: make(map[string]*Module),
+		}
+	}
+
+	return e.imports
+}
+
+// LinkImports makes the top level environment e share imports, like the
+// environment of a module shares those of the program importing it.
+func (e *Environment) LinkImports(imports *Imports) {
+	e.imports = imports
+}
@@ -0,0 +1,38 @@
+package object
+
+// Caller calls fn with args, for builtin methods that call back into the
+// program like map. The error, one that fn raised and did not catch or a
+// limit the run hit, must be returned by the method as it is.
+type Caller func(fn Object, args ...Object) (Object, error)
+
+// MethodFunction implements a builtin method. Like a BuiltInFunction it
+// fails by returning a thrown *Error, and returns nil for null.
+type MethodFunction func(call Caller, receiver Object, args ...Object) (Object, error)
+
+// BuiltinMethod is a method of the values that are not structs, like
+// "abc".upper().
+type BuiltinMethod struct {
+	Name string
+	FN   MethodFunction
+}
+
+func (bm *BuiltinMethod) Type() ObjectType { return BUILTIN_METHOD_OBJ }
+func (bm *BuiltinMethod) Inspect() string  { return "builtin method " + bm.Name }
+
+// BoundMethod is a method selected from its receiver without calling it,
+// `let f = p.norm;`. Calling it passes Receiver as the first argument.
+type BoundMethod struct {
+	Receiver Object
+	Name     string
+	// Method is the function an impl block defined or a *BuiltinMethod.
+	Method Object
+}
+
+func (bm *BoundMethod) Type() ObjectType { return BOUND_METHOD_OBJ }
+func (bm *BoundMethod) Inspect() string {
+	if s, ok := bm.Receiver.(*Struct); ok {
+		return "method " + s.StructType.Name + "." + bm.Name
+	}
+
+	return "method " + string(bm.Receiver.Type()) + "." + bm.Name
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/marmotini/ngiri-lang/code"
+	"hash/fnv"
 	"strings"
 
 	"github.com/marmotini/ngiri-lang/ast"
@@ -21,6 +22,23 @@ const (
 	STRING_OBJ            = "STRING"
 	BUILTIN_OBJ           = "BUILTIN"
 	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION_OBJ"
+	QUOTE_OBJ             = "QUOTE"
+	MACRO_OBJ             = "MACRO"
+	MODULE_OBJ            = "MODULE"
+	ARRAY_OBJ             = "ARRAY"
+	HASH_OBJ              = "HASH"
+	RESULT_OBJ            = "RESULT"
+	OPTION_OBJ            = "OPTION"
+	PATTERN_OBJ           = "PATTERN"
+	CALL_SHAPE_OBJ        = "CALL_SHAPE"
+	STRUCT_TYPE_OBJ       = "STRUCT_TYPE"
+	STRUCT_OBJ            = "STRUCT"
+	STRUCT_SHAPE_OBJ      = "STRUCT_SHAPE"
+	BOUND_METHOD_OBJ      = "BOUND_METHOD"
+	BUILTIN_METHOD_OBJ    = "BUILTIN_METHOD"
+	ENUM_OBJ              = "ENUM"
+	VARIANT_TYPE_OBJ      = "VARIANT_TYPE"
+	VARIANT_OBJ           = "VARIANT"
 )
 
 type Object interface {
@@ -29,9 +47,23 @@ type Object interface {
 }
 
 type CompiledFunction struct {
-	Instructions code.Instructions
-	NumLocals    int
+	Instructions  code.Instructions
+	NumLocals     int
 	NumParameters int
+	Name          string
+	Signature     *Signature
+	// Handlers holds the catch blocks of the function's try expressions,
+	// indexed by the operand of code.OpTry.
+	Handlers []Handler
+	// Verified is set once the function passed the bytecode verifier, every
+	// program sharing it can skip it from then on.
+	Verified bool
+}
+
+// Handler is an entry of a function's exception handler table. Catch is the
+// offset of the instructions a thrown error jumps to.
+type Handler struct {
+	Catch int
 }
 
 func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
@@ -53,6 +85,13 @@ type Boolean struct {
 func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
 func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
 
+// True and False are the only booleans; the interpreter and the VM compare
+// booleans by identity.
+var (
+	True  = &Boolean{Value: true}
+	False = &Boolean{Value: false}
+)
+
 type Null struct{}
 
 func (n *Null) Inspect() string  { return "null" }
@@ -65,17 +104,111 @@ type ReturnValue struct {
 func (r *ReturnValue) Inspect() string  { return r.Value.Inspect() }
 func (r *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 
+// Kinds of errors raised by the runtime and by throw statements.
+const (
+	RuntimeError = "RuntimeError"
+	ThrownError  = "Error"
+)
+
+// Error is both the value scripts catch and pass around and, while Thrown is
+// set, an error that unwinds the stack until a try expression catches it.
 type Error struct {
 	Message string
+	Kind    string
+	// Stack names the functions the error unwound through, innermost first.
+	Stack  []string
+	Thrown bool
 }
 
-func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
+func (e *Error) Inspect() string {
+	if e.Kind == "" {
+		return "ERROR: " + e.Message
+	}
+
+	return e.Kind + ": " + e.Message
+}
+
+// Field returns the message, kind and stack fields scripts can select from
+// an error, e.g. `e.message`.
+func (e *Error) Field(name string) (Object, bool) {
+	switch name {
+	case "message":
+		return &String{Value: e.Message}, true
+	case "kind":
+		return &String{Value: e.Kind}, true
+	case "stack":
+		stack := &Array{Elements: []Object{}}
+		for _, fn := range e.Stack {
+			stack.Elements = append(stack.Elements, &String{Value: fn})
+		}
+		return stack, true
+	default:
+		return nil, false
+	}
+}
+
+// Throw returns a thrown copy of the error, filling in RuntimeError for
+// errors that do not name their kind.
+func (e *Error) Throw() *Error {
+	thrown := *e
+	thrown.Thrown = true
+	thrown.Stack = append([]string(nil), e.Stack...)
+
+	if thrown.Kind == "" {
+		thrown.Kind = RuntimeError
+	}
+
+	return &thrown
+}
+
+// ThrowValue returns the error a throw statement raises for value. Errors are
+// rethrown, any other value becomes the message of a new error.
+func ThrowValue(value Object) *Error {
+	switch value := value.(type) {
+	case *Error:
+		return value.Throw()
+	case *String:
+		return &Error{Message: value.Value, Kind: ThrownError, Thrown: true}
+	default:
+		return &Error{Message: value.Inspect(), Kind: ThrownError, Thrown: true}
+	}
+}
+
+// Unwind records that the error left the function called name. Anonymous
+// functions show up as fn.
+func (e *Error) Unwind(name string) {
+	if name == "" {
+		name = "fn"
+	}
+
+	e.Stack = append(e.Stack, name)
+}
+
+// Catch returns the value a catch block binds for the thrown error.
+func (e *Error) Catch() *Error {
+	caught := *e
+	caught.Thrown = false
+
+	return &caught
+}
 
 type Function struct {
-	Parameters []*ast.Identifier
+	Name       string
+	Parameters []ast.Expression
 	Body       *ast.BlockStatement
 	Env        *Environment
+
+	signature *Signature
+}
+
+// Signature returns the signature of f's parameters.
+func (f *Function) Signature() *Signature {
+	if f.signature == nil {
+		f.signature = NewSignature(f.Name, f.Parameters)
+	}
+
+	return f.signature
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -105,6 +238,69 @@ type String struct {
 func (s *String) Inspect() string  { return s.Value }
 func (s *String) Type() ObjectType { return STRING_OBJ }
 
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() ObjectType { return ARRAY_OBJ }
+func (a *Array) Inspect() string {
+	elements := []string{}
+	for _, e := range a.Elements {
+		elements = append(elements, e.Inspect())
+	}
+
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// Hashable is implemented by the objects that can be used as hash keys.
+type Hashable interface {
+	HashKey() HashKey
+}
+
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+type Hash struct {
+	Pairs map[HashKey]HashPair
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string {
+	pairs := []string{}
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	}
+
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
 type BuiltInFunction func(args ...Object) Object
 
 type BuiltIn struct {
@@ -113,3 +309,154 @@ type BuiltIn struct {
 
 func (b *BuiltIn) Inspect() string  { return "builtin function" }
 func (b *BuiltIn) Type() ObjectType { return BUILTIN_OBJ }
+
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Inspect() string  { return "QUOTE(" + q.Node.String() + ")" }
+func (q *Quote) Type() ObjectType { return QUOTE_OBJ }
+
+// Pattern is the constant operand of code.OpMatch and code.OpDestructure.
+// Slots are the globals, or with Local the locals of the current frame, that
+// OpMatch stores the identifiers bound by Node in.
+type Pattern struct {
+	Node  ast.Expression
+	Slots []int
+	Local bool
+}
+
+func (p *Pattern) Inspect() string  { return "PATTERN(" + p.Node.String() + ")" }
+func (p *Pattern) Type() ObjectType { return PATTERN_OBJ }
+
+// CallShape is the constant operand of code.OpCallShaped. Spreads are the
+// positions of the arguments whose elements are passed one by one, Names
+// the names the last len(Names) arguments are passed by.
+type CallShape struct {
+	Spreads []int
+	Names   []string
+}
+
+func (cs *CallShape) Type() ObjectType { return CALL_SHAPE_OBJ }
+func (cs *CallShape) Inspect() string {
+	return fmt.Sprintf("CALL_SHAPE(spreads=%v, names=%v)", cs.Spreads, cs.Names)
+}
+
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (m *Macro) Type() ObjectType { return MACRO_OBJ }
+func (m *Macro) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+
+	for _, p := range m.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("macro")
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(m.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+// Module is the namespace an imported module is bound to. Exports holds the
+// values of the module's export let statements.
+type Module struct {
+	Name    string
+	Path    string
+	Exports map[string]Object
+}
+
+func NewModule(name, path string) *Module {
+	return &Module{Name: name, Path: path, Exports: make(map[string]Object)}
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return "module " + m.Name }
+
+// SizeOf estimates the bytes allocated for obj itself, not counting the
+// objects it refers to. It is what execution memory budgets are charged.
+func SizeOf(obj Object) int64 {
+	const word = 8
+
+	switch obj := obj.(type) {
+	case *String:
+		return 2*word + int64(len(obj.Value))
+	case *Array:
+		return 3*word + word*int64(len(obj.Elements))
+	case *Hash:
+		return 6*word + 8*word*int64(len(obj.Pairs))
+	case *Struct:
+		return 4*word + word*int64(len(obj.Fields))
+	case *Variant:
+		return 4*word + word*int64(len(obj.Values))
+	case *Function:
+		return 8 * word
+	case nil, *Boolean, *Null:
+		return 0
+	default:
+		return 2 * word
+	}
+}
+
+// Result is the outcome of an operation that can fail: ok(Value) when Ok is
+// set, err(Value) otherwise.
+type Result struct {
+	Ok    bool
+	Value Object
+}
+
+func (r *Result) Type() ObjectType { return RESULT_OBJ }
+func (r *Result) Inspect() string {
+	if r.Ok {
+		return "ok(" + r.Value.Inspect() + ")"
+	}
+
+	return "err(" + r.Value.Inspect() + ")"
+}
+
+// Option is an optional value, some(Value) when Some is set. There is only
+// one none, None.
+type Option struct {
+	Some  bool
+	Value Object
+}
+
+var None = &Option{}
+
+func (o *Option) Type() ObjectType { return OPTION_OBJ }
+func (o *Option) Inspect() string {
+	if o.Some {
+		return "some(" + o.Value.Inspect() + ")"
+	}
+
+	return "none"
+}
+
+// Unwrap returns the value inside ok and some. Failed reports err and none,
+// whose result is the object itself; it is false for other objects.
+func Unwrap(obj Object) (value Object, failed bool, ok bool) {
+	switch obj := obj.(type) {
+	case *Result:
+		if obj.Ok {
+			return obj.Value, false, true
+		}
+		return obj, true, true
+	case *Option:
+		if obj.Some {
+			return obj.Value, false, true
+		}
+		return obj, true, true
+	default:
+		return nil, false, false
+	}
+}
@@ -0,0 +1,156 @@
+package object
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/marmotini/ngiri-lang/ast"
+)
+
+// Signature describes the parameters of a function. The interpreter and the
+// VM bind the arguments of calls with it, so both accept the same calls and
+// reject the others with the same errors.
+type Signature struct {
+	Name string
+	// Params names the parameters in order. Destructured parameters have
+	// no name and can only be passed by position.
+	Params []string
+	// Optional counts the parameters with a default value. They follow the
+	// required ones.
+	Optional int
+	// Rest is set when the last parameter collects the positional arguments
+	// left over into an array.
+	Rest bool
+
+	display []string
+}
+
+// NewSignature returns the signature of the function name with params, the
+// parameters of an ast.FunctionExpression.
+func NewSignature(name string, params []ast.Expression) *Signature {
+	s := &Signature{Name: name, Params: make([]string, len(params))}
+
+	for i, p := range params {
+		s.display = append(s.display, p.String())
+
+		if d, ok := p.(*ast.DefaultParameter); ok {
+			s.Optional++
+			p = d.Parameter
+		}
+
+		if r, ok := p.(*ast.SpreadExpression); ok {
+			s.Rest = true
+			p = r.Value
+		}
+
+		if ident, ok := p.(*ast.Identifier); ok {
+			s.Params[i] = ident.Value
+		}
+	}
+
+	return s
+}
+
+func (s *Signature) String() string {
+	name := s.Name
+	if name == "" {
+		name = "fn"
+	}
+
+	return name + "(" + strings.Join(s.display, ", ") + ")"
+}
+
+// Arity returns the least and the most number of arguments a call can pass,
+// max is -1 when the function takes a rest parameter.
+func (s *Signature) Arity() (min, max int) {
+	max = len(s.Params)
+	if s.Rest {
+		max = -1
+	}
+
+	return s.fixed() - s.Optional, max
+}
+
+// fixed counts the parameters other than the rest parameter.
+func (s *Signature) fixed() int {
+	if s.Rest {
+		return len(s.Params) - 1
+	}
+
+	return len(s.Params)
+}
+
+// Bind assigns the arguments of a call to the parameters. The last
+// len(names) arguments are passed by name, the others by position. The
+// result holds the value of every parameter, nil for those left to their
+// default.
+func (s *Signature) Bind(args []Object, names []string) ([]Object, error) {
+	positional := args[:len(args)-len(names)]
+	fixed := s.fixed()
+
+	if len(names) == 0 && !s.Rest && len(positional) == fixed {
+		return args, nil
+	}
+
+	if len(positional) > fixed && !s.Rest {
+		return nil, fmt.Errorf("%s takes %s, got %d", s, s.want(), len(positional))
+	}
+
+	values := make([]Object, len(s.Params))
+
+	n := len(positional)
+	if n > fixed {
+		n = fixed
+	}
+	copy(values, positional[:n])
+
+	if s.Rest {
+		values[fixed] = &Array{Elements: append([]Object{}, positional[n:]...)}
+	}
+
+	for i, name := range names {
+		index := s.index(name)
+		if index < 0 {
+			return nil, fmt.Errorf("%s has no parameter %s", s, name)
+		}
+
+		if values[index] != nil {
+			return nil, fmt.Errorf("%s got the argument %s twice", s, name)
+		}
+
+		values[index] = args[len(positional)+i]
+	}
+
+	for i := 0; i < fixed-s.Optional; i++ {
+		if values[i] == nil {
+			return nil, fmt.Errorf("%s is missing the argument %s", s, s.display[i])
+		}
+	}
+
+	return values, nil
+}
+
+// index returns the position of the parameter that can be passed as name,
+// or -1.
+func (s *Signature) index(name string) int {
+	for i := 0; i < s.fixed(); i++ {
+		if s.Params[i] == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (s *Signature) want() string {
+	fixed := s.fixed()
+
+	switch {
+	case s.Optional > 0:
+		return fmt.Sprintf("at most %d arguments", fixed)
+	case fixed == 1:
+		return "1 argument"
+	default:
+		return fmt.Sprintf("%d arguments", fixed)
+	}
+}
@@ -0,0 +1,162 @@
+package object
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StructType describes the structs a `struct Point { x, y }` declaration
+// creates. All the structs of a type share it, so comparing types is
+// comparing pointers.
+type StructType struct {
+	Name   string
+	Fields []string
+
+	// Methods are the methods impl blocks define on the type, by name.
+	Methods map[string]Object
+	// Generation counts the changes to Methods, so that the VM can tell
+	// when a method it cached was redefined.
+	Generation int
+}
+
+func (st *StructType) Type() ObjectType { return STRUCT_TYPE_OBJ }
+func (st *StructType) Inspect() string  { return "struct " + st.Name }
+
+// FieldIndex returns the position of the field name in the structs of the
+// type.
+func (st *StructType) FieldIndex(name string) (int, bool) {
+	for i, f := range st.Fields {
+		if f == name {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
+// DefineMethod makes fn the method name of the type, replacing a method of
+// the same name. A method can not be named like a field, the field would
+// hide it.
+func (st *StructType) DefineMethod(name string, fn Object) error {
+	if _, ok := st.FieldIndex(name); ok {
+		return fmt.Errorf("struct %s already has a field %s", st.Name, name)
+	}
+
+	if st.Methods == nil {
+		st.Methods = map[string]Object{}
+	}
+
+	st.Methods[name] = fn
+	st.Generation++
+
+	return nil
+}
+
+// Struct is a value of a struct type. Fields is parallel to the type's
+// field names.
+type Struct struct {
+	StructType *StructType
+	Fields     []Object
+}
+
+func (s *Struct) Type() ObjectType { return STRUCT_OBJ }
+func (s *Struct) Inspect() string {
+	fields := []string{}
+	for i, f := range s.Fields {
+		fields = append(fields, s.StructType.Fields[i]+": "+f.Inspect())
+	}
+
+	return s.StructType.Name + "{" + strings.Join(fields, ", ") + "}"
+}
+
+// Field returns the value of the field name.
+func (s *Struct) Field(name string) (Object, bool) {
+	i, ok := s.StructType.FieldIndex(name)
+	if !ok {
+		return nil, false
+	}
+
+	return s.Fields[i], true
+}
+
+// SetField sets the field name to value, reporting whether the struct has
+// such a field.
+func (s *Struct) SetField(name string, value Object) bool {
+	i, ok := s.StructType.FieldIndex(name)
+	if !ok {
+		return false
+	}
+
+	s.Fields[i] = value
+
+	return true
+}
+
+// StructShape is the constant operand of code.OpStruct. Slots are the field
+// positions of the values on the stack, in the order the literal lists them.
+type StructShape struct {
+	Struct *StructType
+	Slots  []int
+}
+
+func (ss *StructShape) Type() ObjectType { return STRUCT_SHAPE_OBJ }
+func (ss *StructShape) Inspect() string {
+	return fmt.Sprintf("STRUCT_SHAPE(%s, slots=%v)", ss.Struct.Name, ss.Slots)
+}
+
+// New builds the struct from the values of the literal's fields. Fields the
+// literal leaves out are null.
+func (ss *StructShape) New(values []Object, null Object) *Struct {
+	s := &Struct{StructType: ss.Struct, Fields: make([]Object, len(ss.Struct.Fields))}
+	for i := range s.Fields {
+		s.Fields[i] = null
+	}
+
+	for i, slot := range ss.Slots {
+		s.Fields[slot] = values[i]
+	}
+
+	return s
+}
+
+// Equal reports whether a and b are equal for == and !=. Integers and
+// strings compare by value, structs by type and fields, variants by variant
+// and payload, anything else by identity.
+func Equal(a, b Object) bool {
+	switch a := a.(type) {
+	case *Integer:
+		b, ok := b.(*Integer)
+		return ok && a.Value == b.Value
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Struct:
+		b, ok := b.(*Struct)
+		if !ok || a.StructType != b.StructType {
+			return false
+		}
+
+		for i := range a.Fields {
+			if !Equal(a.Fields[i], b.Fields[i]) {
+				return false
+			}
+		}
+
+		return true
+	case *Variant:
+		b, ok := b.(*Variant)
+		if !ok || a.VariantType != b.VariantType {
+			return false
+		}
+
+		for i := range a.Values {
+			if !Equal(a.Values[i], b.Values[i]) {
+				return false
+			}
+		}
+
+		return true
+	default:
+		return a == b
+	}
+}
@@ -19,15 +19,19 @@ type (
 const (
 	_ = iota
 	LOWEST
+	ASSIGN      // x = y
 	EQUALS      // ==
 	LESSGREATER // > or <
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // -X or !X
 	CALL        // myFunc(X)
+	SELECTOR    // lib.member
+	INDEX       // list[i]
 )
 
 var precedence = map[token.TokenType]int{
+	token.ASSIGN:   ASSIGN,
 	token.EQ:       EQUALS,
 	token.NOT_EQ:   EQUALS,
 	token.LT:       LESSGREATER,
@@ -37,6 +41,10 @@ var precedence = map[token.TokenType]int{
 	token.F_SLASH:  PRODUCT,
 	token.ASTERISK: PRODUCT,
 	token.LPAREN:   CALL,
+	token.LBRACE:   CALL,
+	token.DOT:      SELECTOR,
+	token.QUESTION: SELECTOR,
+	token.LBRACKET: INDEX,
 }
 
 type Parser struct {
@@ -65,6 +73,10 @@ func NewParser(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.FUNCTION, p.parseFunctionExpression)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseListLiteral)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
+	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -76,6 +88,11 @@ func NewParser(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
+	p.registerInfix(token.LBRACE, p.parseStructLiteral)
+	p.registerInfix(token.DOT, p.parseSelectorExpression)
+	p.registerInfix(token.QUESTION, p.parsePropagateExpression)
+	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
 
 	p.nextToken()
 	p.nextToken()
@@ -165,32 +182,284 @@ func (p *Parser) ParseProgram() (prog *ast.Program) {
 
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.currToken.Type {
-	case token.LET:
-		return p.parseLetStatement()
+	case token.LET, token.CONST:
+		// a nil *ast.LetStatement must not become a non nil ast.Statement
+		if stmt := p.parseLetStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.IMPORT:
+		if stmt := p.parseImportStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
+	case token.EXPORT:
+		if stmt := p.parseExportStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
+	case token.STRUCT:
+		if stmt := p.parseStructStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
+	case token.IMPL:
+		if stmt := p.parseImplStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
+	case token.ENUM:
+		if stmt := p.parseEnumStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
 	default:
 		return p.parseExpressionStatement()
 	}
-	return nil
 }
 
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: p.currToken}
 
+	if p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+
+		stmt.Pattern = p.parseBindingPattern()
+		if stmt.Pattern == nil {
+			return nil
+		}
+	} else {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+	}
+
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		p.nextToken()
+
+		stmt.Annotation = p.parseType()
+		if stmt.Annotation == nil {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if fn, ok := stmt.Value.(*ast.FunctionExpression); ok && stmt.Name != nil {
+		fn.Name = stmt.Name.Value
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parses `struct Point { x, y }`
+func (p *Parser) parseStructStatement() *ast.StructStatement {
+	stmt := &ast.StructStatement{Token: p.currToken}
+
 	if !p.expectPeek(token.IDENT) {
 		return nil
 	}
 
 	stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
 
-	if !p.expectPeek(token.ASSIGN) {
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Fields = p.parseIdentifierList(token.RBRACE)
+	if stmt.Fields == nil {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	for _, f := range stmt.Fields {
+		if seen[f.Value] {
+			p.errors = append(p.errors, fmt.Sprintf("duplicate field %s in struct %s", f.Value, stmt.Name.Value))
+			return nil
+		}
+		seen[f.Value] = true
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parses `impl Point { fn norm(self) { ... } fn scale(self, k) { ... } }`
+func (p *Parser) parseImplStatement() *ast.ImplStatement {
+	stmt := &ast.ImplStatement{Token: p.currToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
+	seen := map[string]bool{}
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.FUNCTION) {
+			return nil
+		}
+
+		method := &ast.FunctionExpression{Token: p.currToken}
+
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		method.Name = p.currToken.Literal
+
+		if seen[method.Name] {
+			p.errors = append(p.errors, fmt.Sprintf("duplicate method %s in impl %s", method.Name, stmt.Name.Value))
+			return nil
+		}
+		seen[method.Name] = true
+
+		if p.parseFunction(method) == nil {
+			return nil
+		}
+
+		if len(method.Parameters) == 0 {
+			p.errors = append(p.errors, fmt.Sprintf("method %s of %s has no receiver parameter", method.Name, stmt.Name.Value))
+			return nil
+		}
+
+		stmt.Methods = append(stmt.Methods, method)
+
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+	}
+
 	p.nextToken()
 
-	stmt.Value = p.parseExpression(LOWEST)
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parses `enum Shape { Circle(r), Rect(w, h), Empty }`
+func (p *Parser) parseEnumStatement() *ast.EnumStatement {
+	stmt := &ast.EnumStatement{Token: p.currToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		variant := &ast.EnumVariant{Token: p.currToken, Name: &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}}
+
+		if p.peekTokenIs(token.LPAREN) {
+			p.nextToken()
+
+			variant.Fields = p.parseIdentifierList(token.RPAREN)
+			if variant.Fields == nil {
+				return nil
+			}
+		}
+
+		stmt.Variants = append(stmt.Variants, variant)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	p.nextToken()
+
+	if len(stmt.Variants) == 0 {
+		p.errors = append(p.errors, fmt.Sprintf("enum %s has no variants", stmt.Name.Value))
+		return nil
+	}
+
+	seen := map[string]bool{}
+	for _, v := range stmt.Variants {
+		if seen[v.Name.Value] {
+			p.errors = append(p.errors, fmt.Sprintf("duplicate variant %s in enum %s", v.Name.Value, stmt.Name.Value))
+			return nil
+		}
+		seen[v.Name.Value] = true
+
+		fields := map[string]bool{}
+		for _, f := range v.Fields {
+			if fields[f.Value] {
+				p.errors = append(p.errors, fmt.Sprintf("duplicate field %s in variant %s.%s", f.Value, stmt.Name.Value, v.Name.Value))
+				return nil
+			}
+			fields[f.Value] = true
+		}
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parses `import "path";` and `import {a, b} from "path";`
+func (p *Parser) parseImportStatement() *ast.ImportStatement {
+	stmt := &ast.ImportStatement{Token: p.currToken}
+
+	if p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+
+		stmt.Names = p.parseIdentifierList(token.RBRACE)
+		if stmt.Names == nil {
+			return nil
+		}
+
+		// from is not a keyword so it stays usable as a name elsewhere
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		if p.currToken.Literal != "from" {
+			p.errors = append(p.errors, fmt.Sprintf("expected from after import list, got %s instead", p.currToken.Literal))
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+
+	stmt.Path = &ast.StringLiteral{Token: p.currToken, Value: p.currToken.Literal}
 
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
@@ -199,6 +468,47 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
+func (p *Parser) parseExportStatement() *ast.ExportStatement {
+	stmt := &ast.ExportStatement{Token: p.currToken}
+
+	switch {
+	case p.peekTokenIs(token.STRUCT):
+		p.nextToken()
+		if s := p.parseStructStatement(); s != nil {
+			stmt.Statement = s
+		}
+	case p.peekTokenIs(token.ENUM):
+		p.nextToken()
+		if s := p.parseEnumStatement(); s != nil {
+			stmt.Statement = s
+		}
+	default:
+		if p.peekTokenIs(token.CONST) {
+			p.nextToken()
+		} else if !p.expectPeek(token.LET) {
+			return nil
+		}
+
+		let := p.parseLetStatement()
+		if let == nil {
+			return nil
+		}
+
+		if let.Pattern != nil {
+			p.errors = append(p.errors, "export of a destructuring let, export each name on its own")
+			return nil
+		}
+
+		stmt.Statement = let
+	}
+
+	if stmt.Statement == nil {
+		return nil
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	ret := &ast.ReturnStatement{Token: p.currToken}
 
@@ -213,6 +523,20 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return ret
 }
 
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.currToken}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	es := &ast.ExpressionStatement{Token: p.currToken}
 
@@ -332,6 +656,55 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return exp
 }
 
+// parsePropagateExpression parses the postfix `x?`. It binds as tightly as
+// selectors and calls, so `lib.load(name)?` propagates the call's result.
+func (p *Parser) parsePropagateExpression(left ast.Expression) ast.Expression {
+	return &ast.PropagateExpression{Token: p.currToken, Left: left}
+}
+
+func (p *Parser) parseTryExpression() ast.Expression {
+	exp := &ast.TryExpression{Token: p.currToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	exp.Block = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LPAREN) || !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		exp.Param = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+		if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		exp.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		exp.Finally = p.parseBlockStatement()
+	}
+
+	if exp.Catch == nil && exp.Finally == nil {
+		p.errors = append(p.errors, "try without catch or finally")
+		return nil
+	}
+
+	return exp
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.currToken}
 	block.Statements = []ast.Statement{}
@@ -351,13 +724,31 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 }
 
 func (p *Parser) parseFunctionExpression() ast.Expression {
-	fn := &ast.FunctionExpression{Token: p.currToken}
+	if fn := p.parseFunction(&ast.FunctionExpression{Token: p.currToken}); fn != nil {
+		return fn
+	}
 
+	return nil
+}
+
+// parseFunction parses the parameters, result type and body of fn, the
+// tokens after `fn` or after a method name.
+func (p *Parser) parseFunction(fn *ast.FunctionExpression) *ast.FunctionExpression {
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
 
-	fn.Parameters = p.parseFunctionParameters()
+	fn.Parameters, fn.ParameterTypes = p.parseFunctionParameters()
+
+	if p.peekTokenIs(token.RARROW) {
+		p.nextToken()
+		p.nextToken()
+
+		fn.ReturnType = p.parseType()
+		if fn.ReturnType == nil {
+			return nil
+		}
+	}
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
@@ -368,30 +759,184 @@ func (p *Parser) parseFunctionExpression() ast.Expression {
 	return fn
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	idents := []*ast.Identifier{}
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	macro := &ast.MacroLiteral{Token: p.currToken}
 
-	if p.peekTokenIs(token.RPAREN) {
-		p.nextToken()
-		return idents
+	if !p.expectPeek(token.LPAREN) {
+		return nil
 	}
 
-	p.nextToken()
-
-	idents = append(idents, &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal})
-
-	for p.peekTokenIs(token.COMMA) {
-		p.nextToken()
-		p.nextToken()
-
-		idents = append(idents, &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal})
-	}
+	macro.Parameters = p.parseIdentifierList(token.RPAREN)
 
-	if !p.expectPeek(token.RPAREN) {
+	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
-	return idents
+	macro.Body = p.parseBlockStatement()
+
+	return macro
+}
+
+// parseFunctionParameters parses identifiers and destructuring patterns up to
+// the closing parenthesis, along with their type annotations. The types are
+// nil when no parameter is annotated.
+func (p *Parser) parseFunctionParameters() ([]ast.Expression, []ast.TypeExpression) {
+	params := []ast.Expression{}
+
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return params, nil
+	}
+
+	var (
+		defaulted ast.Expression
+		types     []ast.TypeExpression
+		annotated bool
+	)
+
+	for {
+		p.nextToken()
+
+		var param ast.Expression
+		switch p.currToken.Type {
+		case token.IDENT:
+			param = p.parseIdentifier()
+		case token.LBRACKET, token.LBRACE:
+			param = p.parseBindingPattern()
+		case token.ELLIPSIS:
+			rest := &ast.SpreadExpression{Token: p.currToken}
+			if !p.expectPeek(token.IDENT) {
+				return nil, nil
+			}
+			rest.Value = p.parseIdentifier()
+
+			param = rest
+		default:
+			p.errors = append(p.errors, fmt.Sprintf("unexpected %s in parameter list", p.currToken.Type))
+		}
+
+		if param == nil {
+			return nil, nil
+		}
+
+		var typ ast.TypeExpression
+		if p.peekTokenIs(token.COLON) {
+			p.nextToken()
+			p.nextToken()
+
+			if typ = p.parseType(); typ == nil {
+				return nil, nil
+			}
+			annotated = true
+		}
+		types = append(types, typ)
+
+		if _, rest := param.(*ast.SpreadExpression); rest && !p.peekTokenIs(token.RPAREN) {
+			p.errors = append(p.errors, "rest parameter must be the last parameter")
+			return nil, nil
+		}
+
+		if p.peekTokenIs(token.ASSIGN) {
+			p.nextToken()
+			param = &ast.DefaultParameter{Token: p.currToken, Parameter: param}
+
+			p.nextToken()
+			param.(*ast.DefaultParameter).Value = p.parseExpression(LOWEST)
+			defaulted = param
+		} else if _, rest := param.(*ast.SpreadExpression); defaulted != nil && !rest {
+			p.errors = append(p.errors, fmt.Sprintf("parameter %s without a default follows %s", param, defaulted))
+			return nil, nil
+		}
+
+		params = append(params, param)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+
+		p.nextToken()
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil, nil
+	}
+
+	if !annotated {
+		types = nil
+	}
+
+	return params, types
+}
+
+// parseType parses a type annotation: a name such as int or any, `[T]`,
+// `{K: V}` or `fn(A, B) -> R`.
+func (p *Parser) parseType() ast.TypeExpression {
+	switch p.currToken.Type {
+	case token.IDENT:
+		return &ast.NamedType{Token: p.currToken, Name: p.currToken.Literal}
+	case token.LBRACKET:
+		typ := &ast.ArrayType{Token: p.currToken}
+
+		p.nextToken()
+		if typ.Element = p.parseType(); typ.Element == nil || !p.expectPeek(token.RBRACKET) {
+			return nil
+		}
+
+		return typ
+	case token.LBRACE:
+		typ := &ast.HashType{Token: p.currToken}
+
+		p.nextToken()
+		if typ.Key = p.parseType(); typ.Key == nil || !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		if typ.Value = p.parseType(); typ.Value == nil || !p.expectPeek(token.RBRACE) {
+			return nil
+		}
+
+		return typ
+	case token.FUNCTION:
+		typ := &ast.FunctionType{Token: p.currToken, Parameters: []ast.TypeExpression{}}
+
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+
+		for !p.peekTokenIs(token.RPAREN) {
+			p.nextToken()
+
+			param := p.parseType()
+			if param == nil {
+				return nil
+			}
+			typ.Parameters = append(typ.Parameters, param)
+
+			if !p.peekTokenIs(token.COMMA) {
+				break
+			}
+			p.nextToken()
+		}
+
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+
+		if p.peekTokenIs(token.RARROW) {
+			p.nextToken()
+			p.nextToken()
+
+			if typ.Result = p.parseType(); typ.Result == nil {
+				return nil
+			}
+		}
+
+		return typ
+	default:
+		p.errors = append(p.errors, fmt.Sprintf("expected a type, got %s instead", p.currToken.Type))
+		return nil
+	}
 }
 
 func (p *Parser) parseStringLiteral() ast.Expression {
@@ -406,8 +951,353 @@ func (p *Parser) parseListLiteral() ast.Expression {
 	return list
 }
 
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.currToken, Keys: []ast.Expression{}, Values: []ast.Expression{}}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+
+		hash.Keys = append(hash.Keys, key)
+		hash.Values = append(hash.Values, value)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return hash
+}
+
+// parseMatchExpression parses
+//
+//	match (subject) { pattern => value, pattern if guard => { block } }
+//
+// An arm's body is either a block or a single expression.
+func (p *Parser) parseMatchExpression() ast.Expression {
+	exp := &ast.MatchExpression{Token: p.currToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	exp.Subject = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+
+		exp.Arms = append(exp.Arms, arm)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	if len(exp.Arms) == 0 {
+		p.errors = append(p.errors, "match without arms")
+		return nil
+	}
+
+	return exp
+}
+
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	arm := &ast.MatchArm{Token: p.currToken}
+
+	arm.Pattern = p.parsePattern()
+	if arm.Pattern == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		arm.Guard = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(token.ARROW) {
+		return nil
+	}
+
+	p.nextToken()
+
+	if p.curTokenIs(token.LBRACE) {
+		arm.Body = p.parseBlockStatement()
+		return arm
+	}
+
+	stmt := &ast.ExpressionStatement{Token: p.currToken, Expression: p.parseExpression(LOWEST)}
+	arm.Body = &ast.BlockStatement{Token: p.currToken, Statements: []ast.Statement{stmt}}
+
+	return arm
+}
+
+// parsePattern parses the pattern of a match arm starting at the current
+// token.
+func (p *Parser) parsePattern() ast.Expression {
+	switch p.currToken.Type {
+	case token.IDENT:
+		if p.peekTokenIs(token.DOT) || p.peekTokenIs(token.LPAREN) {
+			return p.parseVariantPattern()
+		}
+		return p.parseIdentifier()
+	case token.INT, token.STRING, token.TRUE, token.FALSE:
+		return p.prefixParseFns[p.currToken.Type]()
+	case token.MINUS:
+		exp := &ast.PrefixExpression{Token: p.currToken, Operator: "-"}
+
+		if !p.expectPeek(token.INT) {
+			return nil
+		}
+
+		exp.Right = p.parseIntegerLiteral()
+
+		return exp
+	case token.LBRACKET:
+		return p.parseListPattern()
+	case token.LBRACE:
+		return p.parseHashPattern()
+	default:
+		p.errors = append(p.errors, fmt.Sprintf("unexpected %s in pattern", p.currToken.Type))
+		return nil
+	}
+}
+
+// parseVariantPattern parses the patterns of enum variants: `Shape.Empty`,
+// and `Shape.Circle(r)` or `Circle(r)` whose arguments are patterns of the
+// variant's fields. The enum can be selected from a module,
+// `shapes.Shape.Empty`.
+func (p *Parser) parseVariantPattern() ast.Expression {
+	var variant ast.Expression = p.parseIdentifier()
+
+	for i := 0; i < 2 && p.peekTokenIs(token.DOT); i++ {
+		p.nextToken()
+
+		variant = p.parseSelectorExpression(variant)
+		if variant == nil {
+			return nil
+		}
+	}
+
+	if !p.peekTokenIs(token.LPAREN) {
+		return variant
+	}
+
+	p.nextToken()
+
+	call := &ast.CallExpression{Token: p.currToken, Function: variant, Arguments: []ast.Expression{}}
+
+	for !p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+
+		arg := p.parsePattern()
+		if arg == nil {
+			return nil
+		}
+
+		call.Arguments = append(call.Arguments, arg)
+
+		if !p.peekTokenIs(token.RPAREN) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	p.nextToken()
+
+	return call
+}
+
+func (p *Parser) parseListPattern() ast.Expression {
+	list := &ast.ListLiteral{Token: p.currToken, Elements: []ast.Expression{}}
+
+	for !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+
+		if p.curTokenIs(token.ELLIPSIS) {
+			rest := &ast.SpreadExpression{Token: p.currToken}
+
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+
+			rest.Value = p.parseIdentifier()
+			list.Elements = append(list.Elements, rest)
+
+			if !p.peekTokenIs(token.RBRACKET) {
+				p.errors = append(p.errors, "rest pattern must be the last element")
+				return nil
+			}
+
+			break
+		}
+
+		element := p.parsePattern()
+		if element == nil {
+			return nil
+		}
+
+		list.Elements = append(list.Elements, element)
+
+		if !p.peekTokenIs(token.RBRACKET) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return list
+}
+
+func (p *Parser) parseHashPattern() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.currToken, Keys: []ast.Expression{}, Values: []ast.Expression{}}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+
+		var key, value ast.Expression
+
+		switch p.currToken.Type {
+		case token.IDENT:
+			// {name: n} and {name} select the string key "name"
+			key = &ast.StringLiteral{Token: p.currToken, Value: p.currToken.Literal}
+			if !p.peekTokenIs(token.COLON) {
+				value = p.parseIdentifier()
+			}
+		case token.STRING, token.INT, token.TRUE, token.FALSE:
+			key = p.parsePattern()
+		default:
+			p.errors = append(p.errors, fmt.Sprintf("unexpected %s as key of a hash pattern", p.currToken.Type))
+			return nil
+		}
+
+		if value == nil {
+			if !p.expectPeek(token.COLON) {
+				return nil
+			}
+
+			p.nextToken()
+
+			value = p.parsePattern()
+			if value == nil {
+				return nil
+			}
+		}
+
+		hash.Keys = append(hash.Keys, key)
+		hash.Values = append(hash.Values, value)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return hash
+}
+
+// parseBindingPattern parses the destructuring pattern of a let statement or
+// a parameter. Unlike the patterns of match arms they can not contain
+// literals, which could fail to match.
+func (p *Parser) parseBindingPattern() ast.Expression {
+	pat := p.parsePattern()
+	if pat == nil {
+		return nil
+	}
+
+	if literal := patternLiteral(pat); literal != nil {
+		p.errors = append(p.errors, fmt.Sprintf("literal %s in a destructuring pattern, only match arms can match literals", literal))
+		return nil
+	}
+
+	return pat
+}
+
+// patternLiteral returns the first literal pattern in pat, not counting the
+// keys of hash patterns.
+func patternLiteral(pat ast.Expression) ast.Expression {
+	switch pat := pat.(type) {
+	case *ast.Identifier, *ast.SpreadExpression:
+		return nil
+	case *ast.ListLiteral:
+		for _, e := range pat.Elements {
+			if literal := patternLiteral(e); literal != nil {
+				return literal
+			}
+		}
+		return nil
+	case *ast.HashLiteral:
+		for _, v := range pat.Values {
+			if literal := patternLiteral(v); literal != nil {
+				return literal
+			}
+		}
+		return nil
+	default:
+		return pat
+	}
+}
+
 //------------------------------- infix parse methods --------------------------
 
+// parses `x = value` and `p.x = value`. The value is parsed with the lowest
+// precedence so that assignments are right associative: `a = b = 1` assigns 1
+// to b first.
+func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
+	if sel, ok := left.(*ast.SelectorExpression); ok {
+		exp := &ast.FieldAssignExpression{Token: p.currToken, Target: sel}
+
+		p.nextToken()
+
+		exp.Value = p.parseExpression(LOWEST)
+
+		return exp
+	}
+
+	name, ok := left.(*ast.Identifier)
+	if !ok {
+		p.errors = append(p.errors, fmt.Sprintf("cannot assign to %s, only to a variable or a field", left))
+		return nil
+	}
+
+	exp := &ast.AssignExpression{Token: p.currToken, Name: name}
+
+	p.nextToken()
+
+	exp.Value = p.parseExpression(LOWEST)
+
+	return exp
+}
+
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	exp := &ast.InfixExpression{
 		Token:    p.currToken,
@@ -424,10 +1314,174 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.currToken, Function: function}
-	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	exp.Arguments = p.parseCallArguments()
 	return exp
 }
 
+// parseCallArguments parses the arguments of a call. Besides expressions
+// they can be spread arrays, `...args`, and named arguments, `y: 2`, which
+// come after all the others.
+func (p *Parser) parseCallArguments() []ast.Expression {
+	args := []ast.Expression{}
+
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return args
+	}
+
+	var named ast.Expression
+
+	for {
+		p.nextToken()
+
+		var arg ast.Expression
+		switch {
+		case p.curTokenIs(token.ELLIPSIS):
+			spread := &ast.SpreadExpression{Token: p.currToken}
+			p.nextToken()
+			spread.Value = p.parseExpression(LOWEST)
+			arg = spread
+		case p.curTokenIs(token.IDENT) && p.peekTokenIs(token.COLON):
+			name := p.parseIdentifier().(*ast.Identifier)
+			p.nextToken()
+			arg = &ast.NamedArgument{Token: p.currToken, Name: name}
+
+			p.nextToken()
+			arg.(*ast.NamedArgument).Value = p.parseExpression(LOWEST)
+			named = arg
+		default:
+			arg = p.parseExpression(LOWEST)
+		}
+
+		if _, ok := arg.(*ast.NamedArgument); named != nil && arg != nil && !ok {
+			p.errors = append(p.errors, fmt.Sprintf("argument %s follows the named argument %s", arg, named))
+			return nil
+		}
+
+		args = append(args, arg)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+
+		p.nextToken()
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return args
+}
+
+// parses `Point{x: 1, y: 2}`. Only a name, or a name selected from a module
+// like `shapes.Point`, can come before the brace.
+func (p *Parser) parseStructLiteral(left ast.Expression) ast.Expression {
+	if !isTypeName(left) {
+		p.errors = append(p.errors, fmt.Sprintf("cannot construct %s, only a struct type", left))
+		return nil
+	}
+
+	lit := &ast.StructLiteral{Token: p.currToken, Name: left, Fields: []*ast.Identifier{}, Values: []ast.Expression{}}
+	seen := map[string]bool{}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		field := &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+		if seen[field.Value] {
+			p.errors = append(p.errors, fmt.Sprintf("duplicate field %s in %s literal", field.Value, left))
+			return nil
+		}
+		seen[field.Value] = true
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+
+		lit.Fields = append(lit.Fields, field)
+		lit.Values = append(lit.Values, p.parseExpression(LOWEST))
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	p.nextToken()
+
+	return lit
+}
+
+// isTypeName reports whether exp names a type, `Point` or `shapes.Point`.
+func isTypeName(exp ast.Expression) bool {
+	if sel, ok := exp.(*ast.SelectorExpression); ok {
+		exp = sel.Left
+	}
+
+	_, ok := exp.(*ast.Identifier)
+
+	return ok
+}
+
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	exp := &ast.IndexExpression{Token: p.currToken, Left: left}
+
+	p.nextToken()
+	exp.Index = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return exp
+}
+
+func (p *Parser) parseSelectorExpression(left ast.Expression) ast.Expression {
+	exp := &ast.SelectorExpression{Token: p.currToken, Left: left}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	exp.Selector = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+	return exp
+}
+
+// parseIdentifierList parses comma separated identifiers up to end.
+func (p *Parser) parseIdentifierList(end token.TokenType) []*ast.Identifier {
+	idents := []*ast.Identifier{}
+
+	if p.peekTokenIs(end) {
+		p.nextToken()
+		return idents
+	}
+
+	for {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		idents = append(idents, &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal})
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+
+		p.nextToken()
+	}
+
+	if !p.expectPeek(end) {
+		return nil
+	}
+
+	return idents
+}
+
 func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	args := []ast.Expression{}
 
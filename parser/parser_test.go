@@ -298,6 +298,14 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		{"a + add(b * c) + d", "((a + add((b * c))) + d)"},
 		{"add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8))", "add(a, b, 1, (2 * 3), (4 + 5), add(6, (7 * 8)))"},
 		{"add(a + b + c * d / f + g)", "add((((a + b) + ((c * d) / f)) + g))"},
+
+		{"a + f(b)?", "(a + (f(b)?))"},
+		{"-a?", "(-(a?))"},
+		{"lib.load(a)??", "((lib.load(a)?)?)"},
+
+		{"a * [1, 2, 3, 4][b * c] * d", "((a * ([1, 2, 3, 4][(b * c)])) * d)"},
+		{"add(a * b[2], b[1], 2 * [1, 2][1])", "add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))"},
+		{"-lib.list[0]", "(-(lib.list[0]))"},
 	}
 
 	for _, tt := range tests {
@@ -559,3 +567,685 @@ func TestParsingIndexExpression(t *testing.T) {
 	testInfixExpression(t, list.Elements[1], 2, "*", 2)
 	testInfixExpression(t, list.Elements[2], 3, "+", 3)
 }
+
+func TestParsingIndexExpressions(t *testing.T) {
+	prog := testParserSetup(t, "myList[1 + 1]", 1)
+
+	stmt := prog.Statements[0].(*ast.ExpressionStatement)
+	index, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expression)
+	}
+
+	testIdentifier(t, index.Left, "myList")
+	testInfixExpression(t, index.Index, 1, "+", 1)
+}
+
+func TestParsingHashLiterals(t *testing.T) {
+	prog := testParserSetup(t, `{"one": 1, "two": 1 + 1, 3: three}`, 1)
+
+	stmt := prog.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if hash.String() != `{one: 1, two: (1 + 1), 3: three}` {
+		t.Errorf("hash.String() wrong. got=%q", hash.String())
+	}
+
+	prog = testParserSetup(t, `{}`, 1)
+	hash = prog.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.HashLiteral)
+	if len(hash.Keys) != 0 {
+		t.Errorf("hash.Keys has wrong length. got=%d", len(hash.Keys))
+	}
+}
+
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	prog := testParserSetup(t, input, 1)
+	stmt, ok := prog.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("statement is not ast.ExpressionStatement. got=%T", prog.Statements[0])
+	}
+
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d", len(macro.Parameters))
+	}
+
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statements. got=%d", len(macro.Body.Statements))
+	}
+
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T", macro.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
+func TestImportStatements(t *testing.T) {
+	tests := []struct {
+		input     string
+		names     []string
+		path      string
+		namespace string
+	}{
+		{`import "lib/math";`, nil, "lib/math", "math"},
+		{`import "./util.ngiri"`, nil, "./util.ngiri", "util"},
+		{`import {add, sub} from "math";`, []string{"add", "sub"}, "math", "math"},
+	}
+
+	for _, tt := range tests {
+		prog := testParserSetup(t, tt.input, 1)
+		stmt, ok := prog.Statements[0].(*ast.ImportStatement)
+		if !ok {
+			t.Fatalf("statement is not ast.ImportStatement. got=%T", prog.Statements[0])
+		}
+
+		if stmt.Path.Value != tt.path {
+			t.Errorf("import path wrong. want %q, got=%q", tt.path, stmt.Path.Value)
+		}
+
+		if stmt.Namespace() != tt.namespace {
+			t.Errorf("import namespace wrong. want %q, got=%q", tt.namespace, stmt.Namespace())
+		}
+
+		if tt.names == nil && stmt.Names != nil {
+			t.Fatalf("namespace import has names. got=%v", stmt.Names)
+		}
+
+		if len(stmt.Names) != len(tt.names) {
+			t.Fatalf("import names wrong. want %d, got=%d", len(tt.names), len(stmt.Names))
+		}
+
+		for i, name := range tt.names {
+			testLiteralExpression(t, stmt.Names[i], name)
+		}
+	}
+}
+
+func TestExportStatement(t *testing.T) {
+	prog := testParserSetup(t, `export let answer = 42;`, 1)
+	stmt, ok := prog.Statements[0].(*ast.ExportStatement)
+	if !ok {
+		t.Fatalf("statement is not ast.ExportStatement. got=%T", prog.Statements[0])
+	}
+
+	if !testLetStatement(t, stmt.Statement, "answer") {
+		return
+	}
+
+	testLiteralExpression(t, stmt.Statement.(*ast.LetStatement).Value, 42)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`export struct Point { x, y }`, `export struct Point { x, y }`},
+		{`export enum Shape { Circle(r), Empty };`, `export enum Shape { Circle(r), Empty }`},
+		{`export const pi = 3;`, `export const pi = 3;`},
+	}
+
+	for _, tt := range tests {
+		prog := testParserSetup(t, tt.input, 1)
+		if prog.String() != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, prog.String())
+		}
+	}
+}
+
+func TestSelectorExpression(t *testing.T) {
+	prog := testParserSetup(t, `math.add(1, 2)`, 1)
+	stmt := prog.Statements[0].(*ast.ExpressionStatement)
+
+	call, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T", stmt.Expression)
+	}
+
+	selector, ok := call.Function.(*ast.SelectorExpression)
+	if !ok {
+		t.Fatalf("call.Function is not ast.SelectorExpression. got=%T", call.Function)
+	}
+
+	testLiteralExpression(t, selector.Left, "math")
+	testLiteralExpression(t, selector.Selector, "add")
+}
+
+func TestImportErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import {a} form "math";`, "expected from after import list, got form instead"},
+		{`export 1;`, "expected next token to be LET, got INT instead"},
+	}
+
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. want %q first, got=%v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestThrowStatement(t *testing.T) {
+	prog := testParserSetup(t, `throw "boom";`, 1)
+	stmt, ok := prog.Statements[0].(*ast.ThrowStatement)
+	if !ok {
+		t.Fatalf("statement is not ast.ThrowStatement. got=%T", prog.Statements[0])
+	}
+
+	str, ok := stmt.Value.(*ast.StringLiteral)
+	if !ok || str.Value != "boom" {
+		t.Errorf("throw value is not \"boom\". got=%T (%+v)", stmt.Value, stmt.Value)
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	tests := []struct {
+		input      string
+		param      string
+		hasFinally bool
+	}{
+		{`try { x } catch (e) { e }`, "e", false},
+		{`try { x } finally { y }`, "", true},
+		{`try { x } catch (err) { err } finally { y }`, "err", true},
+	}
+
+	for _, tt := range tests {
+		prog := testParserSetup(t, tt.input, 1)
+		stmt := prog.Statements[0].(*ast.ExpressionStatement)
+
+		exp, ok := stmt.Expression.(*ast.TryExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.TryExpression. got=%T", stmt.Expression)
+		}
+
+		testIdentifier(t, exp.Block.Statements[0].(*ast.ExpressionStatement).Expression, "x")
+
+		if tt.param == "" {
+			if exp.Catch != nil {
+				t.Errorf("try has a catch block. got=%s", exp.Catch)
+			}
+		} else {
+			testIdentifier(t, exp.Param, tt.param)
+			testIdentifier(t, exp.Catch.Statements[0].(*ast.ExpressionStatement).Expression, tt.param)
+		}
+
+		if (exp.Finally != nil) != tt.hasFinally {
+			t.Errorf("finally block wrong. want %t, got=%v", tt.hasFinally, exp.Finally)
+		}
+	}
+}
+
+func TestTryErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { x }`, "try without catch or finally"},
+		{`try { x } catch { y }`, "expected next token to be (, got { instead"},
+		{`try { x } catch (1) { y }`, "expected next token to be IDENT, got INT instead"},
+	}
+
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. want %q first, got=%v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	input := `match (x) {
+	0 => "zero",
+	-1 => "minus one",
+	[h, ...t] => h,
+	{"k": v, 1: [_, true]} => v,
+	n if n > 10 => { let m = n; m },
+	_ => x
+}`
+
+	prog := testParserSetup(t, input, 1)
+
+	stmt := prog.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.MatchExpression. got=%T", stmt.Expression)
+	}
+
+	testIdentifier(t, exp.Subject, "x")
+
+	patterns := []string{"0", "(-1)", "[h, ...t]", "{k: v, 1: [_, true]}", "n", "_"}
+	if len(exp.Arms) != len(patterns) {
+		t.Fatalf("wrong number of arms. want=%d, got=%d", len(patterns), len(exp.Arms))
+	}
+
+	for i, arm := range exp.Arms {
+		if arm.Pattern.String() != patterns[i] {
+			t.Errorf("arms[%d] has wrong pattern. want=%q, got=%q", i, patterns[i], arm.Pattern.String())
+		}
+	}
+
+	testInfixExpression(t, exp.Arms[4].Guard, "n", ">", 10)
+
+	if len(exp.Arms[4].Body.Statements) != 2 {
+		t.Errorf("block body has wrong number of statements. got=%d", len(exp.Arms[4].Body.Statements))
+	}
+
+	if exp.Arms[5].Guard != nil || exp.Arms[5].Body.String() != "x" {
+		t.Errorf("wrong last arm. got=%q", exp.Arms[5].String())
+	}
+}
+
+func TestMatchErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match (x) {}`, "match without arms"},
+		{`match x { _ => 1 }`, "expected next token to be (, got IDENT instead"},
+		{`match (x) { a + 1 => 1 }`, "expected next token to be =>, got + instead"},
+		{`match (x) { f(a)(b) => 1 }`, "expected next token to be =>, got ( instead"},
+		{`match (x) { [...t, h] => 1 }`, "rest pattern must be the last element"},
+		{`match (x) { {[k]: 1} => 1 }`, "unexpected [ as key of a hash pattern"},
+		{`match (x) { fn() {} => 1 }`, "unexpected FUNCTION in pattern"},
+		{`match (x) { 1 => 1 2 => 2 }`, "expected next token to be ,, got INT instead"},
+	}
+
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. want %q first, got=%v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let [a, b, ...rest] = arr;`, `let [a, b, ...rest] = arr;`},
+		{`let {name, age} = person;`, `let {name: name, age: age} = person;`},
+		{`let {"name": n, 1: [_, x]} = person;`, `let {name: n, 1: [_, x]} = person;`},
+		{`let f = fn([a, b], {k}, c) { a };`, `let f = fn( [a, b], {k: k}, c) a;`},
+		{`let f = fn() { 1 };`, `let f = fn( ) 1;`},
+	}
+
+	for _, tt := range tests {
+		prog := testParserSetup(t, tt.input, 1)
+		if prog.String() != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, prog.String())
+		}
+	}
+
+	let := testParserSetup(t, `let [a, b] = f;`, 1).Statements[0].(*ast.LetStatement)
+	if let.Name != nil {
+		t.Errorf("destructuring let has a name: %s", let.Name)
+	}
+	if _, ok := let.Pattern.(*ast.ListLiteral); !ok {
+		t.Errorf("let.Pattern is not *ast.ListLiteral. got=%T", let.Pattern)
+	}
+}
+
+func TestDestructuringErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let [a, 1] = arr;`, "literal 1 in a destructuring pattern, only match arms can match literals"},
+		{`let {"k": "v"} = h;`, "literal v in a destructuring pattern, only match arms can match literals"},
+		{`let f = fn(a, [-1]) { a };`, "literal (-1) in a destructuring pattern, only match arms can match literals"},
+		{`let f = fn(a, 1) { a };`, "unexpected INT in parameter list"},
+		{`export let [a, b] = arr;`, "export of a destructuring let, export each name on its own"},
+		{`let [a, ...b, c] = arr;`, "rest pattern must be the last element"},
+	}
+
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. want %q first, got=%v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestCallArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let f = fn(x, y = 10) { x };`, `let f = fn( x, y = 10) x;`},
+		{`let f = fn(a, [b, c] = [1, 2], ...rest) { a };`, `let f = fn( a, [b, c] = [1, 2], ...rest) a;`},
+		{`let f = fn(x = 1, ...rest) { x };`, `let f = fn( x = 1, ...rest) x;`},
+		{`f(...args)`, `f(...args)`},
+		{`f(1, ...a + b, ...[2])`, `f(1, ...(a + b), ...[2])`},
+		{`f(y: 2, x: 1 + 1)`, `f(y: 2, x: (1 + 1))`},
+		{`f(1, ...a, z: 3)`, `f(1, ...a, z: 3)`},
+	}
+
+	for _, tt := range tests {
+		prog := testParserSetup(t, tt.input, 1)
+		if prog.String() != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, prog.String())
+		}
+	}
+
+	call := testParserSetup(t, `f(x: 1)`, 1).Statements[0].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	named, ok := call.Arguments[0].(*ast.NamedArgument)
+	if !ok {
+		t.Fatalf("argument is not *ast.NamedArgument. got=%T", call.Arguments[0])
+	}
+	if named.Name.Value != "x" {
+		t.Errorf("named.Name.Value is not x. got=%s", named.Name.Value)
+	}
+}
+
+func TestCallArgumentsErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let f = fn(x = 1, y) { x };`, "parameter y without a default follows x = 1"},
+		{`let f = fn(...rest, y) { y };`, "rest parameter must be the last parameter"},
+		{`let f = fn(...[a]) { a };`, "expected next token to be IDENT, got [ instead"},
+		{`f(x: 1, 2)`, "argument 2 follows the named argument x: 1"},
+		{`f(x: 1, ...a)`, "argument ...a follows the named argument x: 1"},
+	}
+
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. want %q first, got=%v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestConstAndAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`const x = 1;`, `const x = 1;`},
+		{`const [a, b] = pair;`, `const [a, b] = pair;`},
+		{`export const x = 1;`, `export const x = 1;`},
+		{`x = 1 + 2`, `(x = (1 + 2))`},
+		{`a = b = c`, `(a = (b = c))`},
+		{`x = x == 1`, `(x = (x == 1))`},
+		{`f(x = 1)`, `f((x = 1))`},
+	}
+
+	for _, tt := range tests {
+		prog := testParserSetup(t, tt.input, 1)
+		if prog.String() != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, prog.String())
+		}
+	}
+
+	let := testParserSetup(t, `const x = 1;`, 1).Statements[0].(*ast.LetStatement)
+	if !let.Const() {
+		t.Errorf("const statement is not const")
+	}
+
+	let = testParserSetup(t, `let x = 1;`, 1).Statements[0].(*ast.LetStatement)
+	if let.Const() {
+		t.Errorf("let statement is const")
+	}
+}
+
+func TestAssignmentErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`a[0] = 1`, "cannot assign to (a[0]), only to a variable or a field"},
+		{`1 + a = 2`, "cannot assign to (1 + a), only to a variable or a field"},
+		{`const = 1;`, "expected next token to be IDENT, got = instead"},
+	}
+
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. want %q first, got=%v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let x: int = 5;`, `let x: int = 5;`},
+		{`const [a, b]: [string] = pair;`, `const [a, b]: [string] = pair;`},
+		{`let h: {string: [int]} = {};`, `let h: {string: [int]} = {};`},
+		{`let f: fn(int, any) -> bool = g;`, `let f: fn(int, any) -> bool = g;`},
+		{`let f: fn() = g;`, `let f: fn() = g;`},
+		{`fn(a: int, b: string) -> bool { true }`, `fn( a: int, b: string) -> bool true`},
+		{`fn(a, b: int = 2, ...rest: [int]) { a }`, `fn( a, b: int = 2, ...rest: [int]) a`},
+		{`fn(x) -> fn(int) -> int { x }`, `fn( x) -> fn(int) -> int x`},
+	}
+
+	for _, tt := range tests {
+		prog := testParserSetup(t, tt.input, 1)
+		if prog.String() != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, prog.String())
+		}
+	}
+
+	fn := testParserSetup(t, `fn(a, b) { a }`, 1).Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionExpression)
+	if fn.ParameterTypes != nil || fn.ReturnType != nil {
+		t.Errorf("unannotated function has types %v -> %v", fn.ParameterTypes, fn.ReturnType)
+	}
+
+	fn = testParserSetup(t, `fn(a, b: int) { a }`, 1).Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionExpression)
+	if len(fn.ParameterTypes) != 2 || fn.ParameterTypes[0] != nil || fn.ParameterTypes[1].String() != "int" {
+		t.Errorf("wrong parameter types %v", fn.ParameterTypes)
+	}
+}
+
+func TestTypeAnnotationErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let x: = 5;`, "expected a type, got = instead"},
+		{`let x: [int = 5;`, "expected next token to be ], got = instead"},
+		{`let x: {int} = 5;`, "expected next token to be :, got } instead"},
+		{`fn(a: 1) { a }`, "expected a type, got INT instead"},
+		{`fn(a) -> 1 { a }`, "expected a type, got INT instead"},
+		{`fn(...a: [int], b) { a }`, "rest parameter must be the last parameter"},
+	}
+
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. want %q first, got=%v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestStructs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`struct Point { x, y }`, `struct Point { x, y }`},
+		{`struct Empty {};`, `struct Empty {  }`},
+		{`Point{x: 1, y: 2 + 3}`, `Point{x: 1, y: (2 + 3)}`},
+		{`Point{x: 1,}.x`, `Point{x: 1}.x`},
+		{`Point{}`, `Point{}`},
+		{`shapes.Point{x: 1}.x`, `shapes.Point{x: 1}.x`},
+		{`p.x = p.y = 3`, `(p.x = (p.y = 3))`},
+		{`a.b.c = 1 + 2`, `(a.b.c = (1 + 2))`},
+		{`if (p) { p.x } else { q }`, `ifp p.xelse q`},
+	}
+
+	for _, tt := range tests {
+		prog := testParserSetup(t, tt.input, 1)
+		if prog.String() != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, prog.String())
+		}
+	}
+
+	lit := testParserSetup(t, `Point{y: 2, x: 1}`, 1).Statements[0].(*ast.ExpressionStatement).Expression.(*ast.StructLiteral)
+	if lit.Name.String() != "Point" || len(lit.Fields) != 2 || lit.Fields[0].Value != "y" || lit.Values[1].String() != "1" {
+		t.Errorf("wrong struct literal %#v", lit)
+	}
+}
+
+func TestStructErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`struct { x }`, "expected next token to be IDENT, got { instead"},
+		{`struct P { x, x }`, "duplicate field x in struct P"},
+		{`struct P { 1 }`, "expected next token to be IDENT, got INT instead"},
+		{`P{x: 1, x: 2}`, "duplicate field x in P literal"},
+		{`P{x 1}`, "expected next token to be :, got INT instead"},
+		{`f(){x: 1}`, "cannot construct f(), only a struct type"},
+		{`a.b.C{x: 1}`, "cannot construct a.b.C, only a struct type"},
+		{`export impl P {}`, "expected next token to be LET, got IMPL instead"},
+	}
+
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. want %q first, got=%v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestImpl(t *testing.T) {
+	tests := []struct {
+		input      string
+		statements int
+		expected   string
+	}{
+		{`impl P { fn norm(self) { self.x } }`, 1, `impl P { fn norm( self) self.x }`},
+		{`impl P { fn a(self, k: int) -> int { k }; fn b(s) { s } };`, 1, `impl P { fn a( self, k: int) -> int k fn b( s) s }`},
+		{`impl P {}`, 1, `impl P {  }`},
+		{`p.norm(); "a".upper(1)`, 2, `p.norm()a.upper(1)`},
+	}
+
+	for _, tt := range tests {
+		prog := testParserSetup(t, tt.input, tt.statements)
+		if prog.String() != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, prog.String())
+		}
+	}
+
+	impl := testParserSetup(t, `impl P { fn norm(self) { 1 } }`, 1).Statements[0].(*ast.ImplStatement)
+	if impl.Name.Value != "P" || len(impl.Methods) != 1 || impl.Methods[0].Name != "norm" || impl.Methods[0].TokenLiteral() != "fn" {
+		t.Errorf("wrong impl statement %#v", impl)
+	}
+}
+
+func TestImplErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`impl { fn f(self) { 1 } }`, "expected next token to be IDENT, got { instead"},
+		{`impl P { let x = 1; }`, "expected next token to be FUNCTION, got LET instead"},
+		{`impl P { fn (self) { 1 } }`, "expected next token to be IDENT, got ( instead"},
+		{`impl P { fn f() { 1 } }`, "method f of P has no receiver parameter"},
+		{`impl P { fn f(self) { 1 } fn f(self) { 2 } }`, "duplicate method f in impl P"},
+	}
+
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. want %q first, got=%v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestEnums(t *testing.T) {
+	tests := []struct {
+		input      string
+		statements int
+		expected   string
+	}{
+		{`enum Shape { Circle(r), Rect(w, h), Empty }`, 1, `enum Shape { Circle(r), Rect(w, h), Empty }`},
+		{`enum E { A, B, };`, 1, `enum E { A, B }`},
+		{`Shape.Circle(3); Shape.Empty`, 2, `Shape.Circle(3)Shape.Empty`},
+		{`match (s) { Shape.Circle(r) => r, Rect(w, [h]) => h, Shape.Empty => 0 }`, 1, `match (s) {Shape.Circle(r) => r, Rect(w, [h]) => h, Shape.Empty => 0}`},
+		{`match (s) { Some() => 1, _ => 0 }`, 1, `match (s) {Some() => 1, _ => 0}`},
+		{`match (s) { shapes.Shape.Circle(r) => r, shapes.Shape.Empty => 0 }`, 1, `match (s) {shapes.Shape.Circle(r) => r, shapes.Shape.Empty => 0}`},
+	}
+
+	for _, tt := range tests {
+		prog := testParserSetup(t, tt.input, tt.statements)
+		if prog.String() != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, prog.String())
+		}
+	}
+
+	enum := testParserSetup(t, `enum Shape { Circle(r), Empty }`, 1).Statements[0].(*ast.EnumStatement)
+	if enum.Name.Value != "Shape" || len(enum.Variants) != 2 || len(enum.Variants[0].Fields) != 1 || len(enum.Variants[1].Fields) != 0 {
+		t.Errorf("wrong enum statement %#v", enum)
+	}
+
+	m := testParserSetup(t, `match (s) { Shape.Circle(r) => r }`, 1).Statements[0].(*ast.ExpressionStatement).Expression.(*ast.MatchExpression)
+	call, ok := m.Arms[0].Pattern.(*ast.CallExpression)
+	if !ok || call.Function.String() != "Shape.Circle" || len(call.Arguments) != 1 {
+		t.Errorf("wrong variant pattern %#v", m.Arms[0].Pattern)
+	}
+}
+
+func TestEnumErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`enum { A }`, "expected next token to be IDENT, got { instead"},
+		{`enum E {}`, "enum E has no variants"},
+		{`enum E { A, A(x) }`, "duplicate variant A in enum E"},
+		{`enum E { A(x, x) }`, "duplicate field x in variant E.A"},
+		{`enum E { A B }`, "expected next token to be ,, got IDENT instead"},
+		{`enum E { A(1) }`, "expected next token to be IDENT, got INT instead"},
+		{`match (s) { E.A(x + 1) => 1 }`, "expected next token to be ,, got + instead"},
+		{`match (s) { E.1 => 1 }`, "expected next token to be IDENT, got INT instead"},
+	}
+
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. want %q first, got=%v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
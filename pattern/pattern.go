@@ -0,0 +1,357 @@
+// Package pattern matches values against the patterns of match expressions.
+// The interpreter and the VM share it, so a pattern means the same thing
+// however a program is run.
+//
+// A pattern is an ast.Expression of one of these forms:
+//
+//	0, -1, "s", true    literals match equal values
+//	n                   an identifier matches anything and binds it to n
+//	_                   the wildcard matches anything and binds nothing
+//	[a, b]              arrays of exactly two elements matching a and b
+//	[h, ...t]           arrays of at least one element; t is bound to the rest
+//	{"k": v}            hashes with the key "k" whose value matches v
+//	{k: v}, {k}         the same, keys written as names are strings
+//	Shape.Circle(r)     values of the variant Circle of the enum Shape whose
+//	                    field matches r
+//	Circle(r)           the same, of any enum with a variant Circle
+//	Shape.Empty         values of the variant Empty, whatever their fields
+//	shapes.Shape.Empty  the same, of the enum Shape exported by a module
+//
+// Variants are matched by name, the names in a pattern are not looked up. The
+// module an enum is selected from is left out of the match.
+//
+// Let statements and function parameters take the patterns without literals,
+// see Destructure.
+package pattern
+
+import (
+	"fmt"
+
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/object"
+)
+
+// Wildcard is the identifier that matches without binding.
+const Wildcard = "_"
+
+// Bindings returns the identifiers p binds, in the order Match returns their
+// values.
+func Bindings(p ast.Expression) []*ast.Identifier {
+	var idents []*ast.Identifier
+
+	var collect func(p ast.Expression)
+	collect = func(p ast.Expression) {
+		switch p := p.(type) {
+		case *ast.Identifier:
+			if p.Value != Wildcard {
+				idents = append(idents, p)
+			}
+		case *ast.SpreadExpression:
+			collect(p.Value)
+		case *ast.DefaultParameter:
+			collect(p.Parameter)
+		case *ast.ListLiteral:
+			for _, e := range p.Elements {
+				collect(e)
+			}
+		case *ast.HashLiteral:
+			for _, v := range p.Values {
+				collect(v)
+			}
+		case *ast.CallExpression:
+			for _, a := range p.Arguments {
+				collect(a)
+			}
+		}
+	}
+
+	collect(p)
+
+	return idents
+}
+
+// Match reports whether value matches p and returns the values bound to the
+// identifiers listed by Bindings.
+func Match(p ast.Expression, value object.Object) ([]object.Object, bool) {
+	values, err := Destructure(p, value)
+
+	return values, err == nil
+}
+
+// Destructure is Match for let statements and parameters, which have no
+// other arm to try: when value does not match, the error says why.
+func Destructure(p ast.Expression, value object.Object) ([]object.Object, error) {
+	bound := []object.Object{}
+	if err := match(p, value, &bound); err != nil {
+		return nil, err
+	}
+
+	return bound, nil
+}
+
+func match(p ast.Expression, value object.Object, bound *[]object.Object) error {
+	switch p := p.(type) {
+	case *ast.Identifier:
+		if p.Value != Wildcard {
+			*bound = append(*bound, value)
+		}
+		return nil
+	case *ast.ListLiteral:
+		return matchArray(p, value, bound)
+	case *ast.HashLiteral:
+		return matchHash(p, value, bound)
+	case *ast.SelectorExpression:
+		_, err := matchVariant(p, p, value)
+		return err
+	case *ast.CallExpression:
+		return matchPayload(p, value, bound)
+	default:
+		if !equal(Literal(p), value) {
+			return fmt.Errorf("%s does not match %s", value.Inspect(), p)
+		}
+		return nil
+	}
+}
+
+func matchArray(p *ast.ListLiteral, value object.Object, bound *[]object.Object) error {
+	array, ok := value.(*object.Array)
+	if !ok {
+		return fmt.Errorf("can not destructure %s with %s, want ARRAY", value.Type(), p)
+	}
+
+	elements := p.Elements
+
+	var rest *ast.SpreadExpression
+	if n := len(elements); n > 0 {
+		if r, ok := elements[n-1].(*ast.SpreadExpression); ok {
+			rest, elements = r, elements[:n-1]
+		}
+	}
+
+	if rest != nil && len(array.Elements) < len(elements) {
+		return fmt.Errorf("%s needs at least %d elements, got %d", p, len(elements), len(array.Elements))
+	}
+
+	if rest == nil && len(array.Elements) != len(elements) {
+		return fmt.Errorf("%s needs %d elements, got %d", p, len(elements), len(array.Elements))
+	}
+
+	for i, e := range elements {
+		if err := match(e, array.Elements[i], bound); err != nil {
+			return err
+		}
+	}
+
+	if rest != nil {
+		tail := append([]object.Object{}, array.Elements[len(elements):]...)
+		return match(rest.Value, &object.Array{Elements: tail}, bound)
+	}
+
+	return nil
+}
+
+func matchHash(p *ast.HashLiteral, value object.Object, bound *[]object.Object) error {
+	hash, ok := value.(*object.Hash)
+	if !ok {
+		return fmt.Errorf("can not destructure %s with %s, want HASH", value.Type(), p)
+	}
+
+	for i, k := range p.Keys {
+		key, ok := Literal(k).(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", k)
+		}
+
+		pair, ok := hash.Pairs[key.HashKey()]
+		if !ok {
+			return fmt.Errorf("%s needs the key %s", p, k)
+		}
+
+		if err := match(p.Values[i], pair.Value, bound); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// matchVariant checks that value is a variant named like the selector or
+// identifier name, which p is or calls.
+func matchVariant(p, name ast.Expression, value object.Object) (*object.Variant, error) {
+	v, ok := value.(*object.Variant)
+	if !ok {
+		return nil, fmt.Errorf("can not destructure %s with %s, want VARIANT", value.Type(), p)
+	}
+
+	switch name := name.(type) {
+	case *ast.Identifier:
+		if v.VariantType.Name == name.Value {
+			return v, nil
+		}
+	case *ast.SelectorExpression:
+		enum, ok := enumName(name.Left)
+		if ok && v.VariantType.Enum.Name == enum && v.VariantType.Name == name.Selector.Value {
+			return v, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s does not match %s", value.Inspect(), p)
+}
+
+// enumName returns the name of the enum a variant is selected from, `Shape`
+// or `shapes.Shape`.
+func enumName(exp ast.Expression) (string, bool) {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		return exp.Value, true
+	case *ast.SelectorExpression:
+		if _, ok := exp.Left.(*ast.Identifier); ok {
+			return exp.Selector.Value, true
+		}
+	}
+
+	return "", false
+}
+
+func matchPayload(p *ast.CallExpression, value object.Object, bound *[]object.Object) error {
+	v, err := matchVariant(p, p.Function, value)
+	if err != nil {
+		return err
+	}
+
+	if len(v.Values) != len(p.Arguments) {
+		return fmt.Errorf("%s needs %d fields, got %d", p, len(p.Arguments), len(v.Values))
+	}
+
+	for i, a := range p.Arguments {
+		if err := match(a, v.Values[i], bound); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Literal returns the value of a literal pattern, or nil when p is not one.
+func Literal(p ast.Expression) object.Object {
+	switch p := p.(type) {
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: p.Value}
+	case *ast.StringLiteral:
+		return &object.String{Value: p.Value}
+	case *ast.Boolean:
+		if p.Value {
+			return object.True
+		}
+		return object.False
+	case *ast.PrefixExpression:
+		if i, ok := p.Right.(*ast.IntegerLiteral); ok && p.Operator == "-" {
+			return &object.Integer{Value: -i.Value}
+		}
+	}
+
+	return nil
+}
+
+func equal(a, b object.Object) bool {
+	switch a := a.(type) {
+	case *object.Integer:
+		b, ok := b.(*object.Integer)
+		return ok && a.Value == b.Value
+	case *object.String:
+		b, ok := b.(*object.String)
+		return ok && a.Value == b.Value
+	case *object.Boolean:
+		b, ok := b.(*object.Boolean)
+		return ok && a.Value == b.Value
+	default:
+		return false
+	}
+}
+
+// Exhaustive reports whether some arm of m matches every value: an arm
+// without a guard whose pattern is an identifier, or unguarded arms for both
+// true and false.
+func Exhaustive(m *ast.MatchExpression) bool {
+	booleans := map[bool]bool{}
+
+	for _, arm := range m.Arms {
+		if arm.Guard != nil {
+			continue
+		}
+
+		switch p := arm.Pattern.(type) {
+		case *ast.Identifier:
+			return true
+		case *ast.Boolean:
+			booleans[p.Value] = true
+		}
+	}
+
+	return booleans[true] && booleans[false]
+}
+
+// Covers reports whether the arms of m without a guard match every value of
+// the enum declared by e: every variant has an arm whose pattern only binds
+// its fields, if it looks at them at all.
+func Covers(m *ast.MatchExpression, e *ast.EnumStatement) bool {
+	covered := map[string]bool{}
+
+	for _, arm := range m.Arms {
+		if arm.Guard != nil {
+			continue
+		}
+
+		if name, ok := coveredVariant(arm.Pattern, e); ok {
+			covered[name] = true
+		}
+	}
+
+	for _, v := range e.Variants {
+		if !covered[v.Name.Value] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// coveredVariant returns the variant of e that p matches whatever its fields
+// are.
+func coveredVariant(p ast.Expression, e *ast.EnumStatement) (string, bool) {
+	call, called := p.(*ast.CallExpression)
+	if called {
+		for _, a := range call.Arguments {
+			if _, ok := a.(*ast.Identifier); !ok {
+				return "", false
+			}
+		}
+
+		p = call.Function
+	}
+
+	var name string
+	switch p := p.(type) {
+	case *ast.Identifier:
+		if !called {
+			return "", false
+		}
+		name = p.Value
+	case *ast.SelectorExpression:
+		enum, ok := enumName(p.Left)
+		if !ok || enum != e.Name.Value {
+			return "", false
+		}
+		name = p.Selector.Value
+	default:
+		return "", false
+	}
+
+	for _, v := range e.Variants {
+		if v.Name.Value == name {
+			return name, !called || len(call.Arguments) == len(v.Fields)
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,195 @@
+package pattern
+
+import (
+	"testing"
+
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/lexer"
+	"github.com/marmotini/ngiri-lang/object"
+	"github.com/marmotini/ngiri-lang/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func parseMatch(t *testing.T, input string) *ast.MatchExpression {
+	p := parser.NewParser(lexer.NewLexer(input))
+	prog := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+
+	return prog.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.MatchExpression)
+}
+
+func integers(values ...int64) *object.Array {
+	array := &object.Array{}
+	for _, v := range values {
+		array.Elements = append(array.Elements, &object.Integer{Value: v})
+	}
+
+	return array
+}
+
+func TestMatch(t *testing.T) {
+	hash := &object.Hash{Pairs: map[object.HashKey]object.HashPair{}}
+	key := &object.String{Value: "k"}
+	hash.Pairs[key.HashKey()] = object.HashPair{Key: key, Value: integers(1, 2)}
+
+	tests := []struct {
+		pattern  string
+		value    object.Object
+		bindings []string
+		bound    string
+		ok       bool
+	}{
+		{"1", &object.Integer{Value: 1}, nil, "[]", true},
+		{"1", &object.String{Value: "1"}, nil, "", false},
+		{"-1", &object.Integer{Value: -1}, nil, "[]", true},
+		{`"a"`, &object.String{Value: "a"}, nil, "[]", true},
+		{"false", object.False, nil, "[]", true},
+		{"_", object.True, nil, "[]", true},
+		{"n", object.True, []string{"n"}, "[true]", true},
+		{"[a, b]", integers(1, 2), []string{"a", "b"}, "[1, 2]", true},
+		{"[a, b]", integers(1, 2, 3), []string{"a", "b"}, "", false},
+		{"[h, ...t]", integers(1, 2, 3), []string{"h", "t"}, "[1, [2, 3]]", true},
+		{"[h, ...t]", integers(1), []string{"h", "t"}, "[1, []]", true},
+		{"[h, ...t]", integers(), []string{"h", "t"}, "", false},
+		{"[1, ..._]", integers(1, 2), nil, "[]", true},
+		{`{"k": [x, _]}`, hash, []string{"x"}, "[1]", true},
+		{`{"j": x}`, hash, []string{"x"}, "", false},
+		{`{"k": x}`, integers(), []string{"x"}, "", false},
+	}
+
+	for _, tt := range tests {
+		arm := parseMatch(t, "match (v) { "+tt.pattern+" => 1 }").Arms[0]
+
+		names := []string{}
+		for _, ident := range Bindings(arm.Pattern) {
+			names = append(names, ident.Value)
+		}
+		if tt.bindings == nil {
+			tt.bindings = []string{}
+		}
+		assert.Equal(t, tt.bindings, names, tt.pattern)
+
+		values, ok := Match(arm.Pattern, tt.value)
+		assert.Equal(t, tt.ok, ok, tt.pattern)
+		if ok {
+			assert.Equal(t, tt.bound, (&object.Array{Elements: values}).Inspect(), tt.pattern)
+		}
+	}
+}
+
+func TestExhaustive(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"match (v) { 1 => 1, _ => 2 }", true},
+		{"match (v) { 1 => 1, n => n }", true},
+		{"match (v) { true => 1, false => 2 }", true},
+		{"match (v) { true => 1 }", false},
+		{"match (v) { n if n > 1 => 1 }", false},
+		{"match (v) { [h, ...t] => 1, [] => 2 }", false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, Exhaustive(parseMatch(t, tt.input)), tt.input)
+	}
+}
+
+func TestDestructure(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   object.Object
+		err     string
+	}{
+		{"[a, b]", integers(1), "[a, b] needs 2 elements, got 1"},
+		{"[a, ...b]", integers(), "[a, ...b] needs at least 1 elements, got 0"},
+		{"[a]", &object.Integer{Value: 1}, "can not destructure INTEGER with [a], want ARRAY"},
+		{"{k}", integers(), "can not destructure ARRAY with {k: k}, want HASH"},
+		{"{k}", &object.Hash{Pairs: map[object.HashKey]object.HashPair{}}, "{k: k} needs the key k"},
+		{"[1]", integers(2), "2 does not match 1"},
+	}
+
+	for _, tt := range tests {
+		arm := parseMatch(t, "match (v) { "+tt.pattern+" => 1 }").Arms[0]
+
+		_, err := Destructure(arm.Pattern, tt.value)
+		assert.EqualError(t, err, tt.err, tt.pattern)
+	}
+}
+
+func TestMatchVariant(t *testing.T) {
+	shape := object.NewEnumType("Shape")
+	circle := shape.AddVariant("Circle", []string{"r"})
+	rect := shape.AddVariant("Rect", []string{"w", "h"})
+	empty := shape.AddVariant("Empty", nil)
+	other := object.NewEnumType("Other").AddVariant("Circle", []string{"r"})
+
+	c, _ := circle.New([]object.Object{&object.Integer{Value: 3}})
+	r, _ := rect.New([]object.Object{&object.Integer{Value: 1}, integers(2, 3)})
+	o, _ := other.New([]object.Object{&object.Integer{Value: 4}})
+
+	tests := []struct {
+		pattern string
+		value   object.Object
+		bound   string
+		ok      bool
+	}{
+		{"Shape.Circle(r)", c, "[3]", true},
+		{"Circle(r)", c, "[3]", true},
+		{"Circle(r)", o, "[4]", true},
+		{"Shape.Circle(r)", o, "", false},
+		{"Shape.Circle(3)", c, "[]", true},
+		{"Shape.Circle(4)", c, "", false},
+		{"Shape.Circle", c, "[]", true},
+		{"Shape.Rect(w, [a, b])", r, "[1, 2, 3]", true},
+		{"Shape.Rect(w)", r, "", false},
+		{"Shape.Rect(w, h)", c, "", false},
+		{"Shape.Empty", empty.Unit, "[]", true},
+		{"Shape.Empty", c, "", false},
+		{"Shape.Empty", &object.Integer{Value: 1}, "", false},
+		{"Circle(r)", integers(3), "", false},
+	}
+
+	for _, tt := range tests {
+		arm := parseMatch(t, "match (v) { "+tt.pattern+" => 1 }").Arms[0]
+
+		values, ok := Match(arm.Pattern, tt.value)
+		assert.Equal(t, tt.ok, ok, tt.pattern)
+		if ok {
+			assert.Equal(t, tt.bound, (&object.Array{Elements: values}).Inspect(), tt.pattern)
+		}
+	}
+
+	_, err := Destructure(parseMatch(t, "match (v) { Shape.Rect(w) => 1 }").Arms[0].Pattern, r)
+	assert.EqualError(t, err, "Shape.Rect(w) needs 1 fields, got 2")
+
+	_, err = Destructure(parseMatch(t, "match (v) { Shape.Empty => 1 }").Arms[0].Pattern, c)
+	assert.EqualError(t, err, "Shape.Circle(3) does not match Shape.Empty")
+
+	_, err = Destructure(parseMatch(t, "match (v) { Circle(r) => 1 }").Arms[0].Pattern, integers())
+	assert.EqualError(t, err, "can not destructure ARRAY with Circle(r), want VARIANT")
+}
+
+func TestCovers(t *testing.T) {
+	p := parser.NewParser(lexer.NewLexer("enum Shape { Circle(r), Rect(w, h), Empty }"))
+	enum := p.ParseProgram().Statements[0].(*ast.EnumStatement)
+
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"match (v) { Shape.Circle(r) => 1, Rect(w, _) => 2, Shape.Empty => 3 }", true},
+		{"match (v) { Shape.Circle => 1, Shape.Rect => 2, Shape.Empty => 3 }", true},
+		{"match (v) { Shape.Circle(r) => 1, Rect(w, _) => 2 }", false},
+		{"match (v) { Shape.Circle(1) => 1, Rect(w, h) => 2, Shape.Empty => 3 }", false},
+		{"match (v) { Shape.Circle(r) if r > 1 => 1, Rect(w, h) => 2, Shape.Empty => 3 }", false},
+		{"match (v) { Other.Circle(r) => 1, Rect(w, h) => 2, Shape.Empty => 3 }", false},
+		{"match (v) { Circle(r, s) => 1, Rect(w, h) => 2, Shape.Empty => 3 }", false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, Covers(parseMatch(t, tt.input), enum), tt.input)
+	}
+}
@@ -0,0 +1,433 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/token"
+)
+
+type Diagnostic struct {
+	Pos     token.Position
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s", d.Pos, d.Message)
+}
+
+// Info holds what the checker inferred about a program.
+type Info struct {
+	// Defs maps the identifiers bound by let statements, parameters and
+	// patterns to their types. Generic functions keep their type
+	// variables, `let id = fn(x) { x }` defines id as fn('a) -> 'a.
+	Defs map[*ast.Identifier]Type
+}
+
+// Check infers the types of prog and returns them together with the type
+// errors found, in source order.
+func Check(prog *ast.Program) (*Info, []Diagnostic) {
+	c := &checker{
+		scope: newScope(universe()),
+		info:  &Info{Defs: map[*ast.Identifier]Type{}},
+	}
+
+	c.statements(prog.Statements)
+
+	for ident, t := range c.info.Defs {
+		c.info.Defs[ident] = resolve(t, map[*Var]*Var{})
+	}
+
+	diagnostics := c.diagnostics
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i].Pos, diagnostics[j].Pos
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+
+		return a.Column < b.Column
+	})
+
+	return c.info, diagnostics
+}
+
+// binding is what a name stands for. The generic variables of a let-bound
+// function are replaced by fresh ones on every use of the name. Names of
+// struct and enum declarations also stand for the type of their values.
+type binding struct {
+	typ        Type
+	generic    []*Var
+	structType *Struct
+	enumType   *Enum
+}
+
+type scope struct {
+	outer *scope
+	names map[string]*binding
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{outer: outer, names: map[string]*binding{}}
+}
+
+func (s *scope) lookup(name string) *binding {
+	for ; s != nil; s = s.outer {
+		if b, ok := s.names[name]; ok {
+			return b
+		}
+	}
+
+	return nil
+}
+
+// universe holds the builtins. Results and options have no type of their
+// own, they are any.
+func universe() *scope {
+	s := newScope(nil)
+
+	fn := func(result Type, params ...Type) *binding {
+		return &binding{typ: &Func{Params: params, Required: len(params), Result: result}}
+	}
+	variadic := func(result Type) *binding {
+		return &binding{typ: &Func{Params: []Type{}, Rest: Any, Result: result}}
+	}
+
+	s.names = map[string]*binding{
+		"len":        fn(Int, Any),
+		"puts":       variadic(Null),
+		"read_file":  fn(String, String),
+		"write_file": fn(Null, String, String),
+		"getenv":     fn(String, String),
+		"now":        fn(Int),
+		"sleep":      fn(Null, Int),
+		"random":     fn(Int, Int),
+		"error":      variadic(Any),
+		"ok":         fn(Any, Any),
+		"err":        fn(Any, Any),
+		"some":       fn(Any, Any),
+		"none":       {typ: Any},
+		"unwrap":     fn(Any, Any),
+		"unwrap_or":  fn(Any, Any, Any),
+		"is_ok":      fn(Bool, Any),
+		"tag_of":     fn(String, Any),
+	}
+
+	return s
+}
+
+// function is the function literal being checked.
+type function struct {
+	// declared is the annotated result type, or nil.
+	declared Type
+	// result joins the types returned so far, nil before the first return.
+	result Type
+}
+
+type checker struct {
+	scope  *scope
+	fn     *function
+	level  int
+	nextID int
+
+	// receiver is the type of the first parameter of the method about to
+	// be inferred, see impl.
+	receiver Type
+
+	// trail records bound variables so that join can undo a failed
+	// unification.
+	trail []*Var
+
+	info        *Info
+	diagnostics []Diagnostic
+}
+
+func (c *checker) report(node ast.Node, format string, args ...interface{}) {
+	c.diagnostics = append(c.diagnostics, Diagnostic{Pos: node.Pos(), Message: fmt.Sprintf(format, args...)})
+}
+
+// expect reports a mismatch when got can not be used as want.
+func (c *checker) expect(node ast.Node, got, want Type, context string) {
+	if c.unify(got, want) {
+		return
+	}
+
+	names := map[*Var]*Var{}
+	c.report(node, "cannot use %s (%s) as %s %s", describe(node), resolve(got, names), resolve(want, names), context)
+}
+
+// describe shortens the source of node for messages.
+func describe(node ast.Node) string {
+	s := node.String()
+	if str, ok := node.(*ast.StringLiteral); ok {
+		s = strconv.Quote(str.Value)
+	}
+	if len(s) > 32 {
+		s = s[:29] + "..."
+	}
+
+	return s
+}
+
+func (c *checker) newVar() *Var {
+	c.nextID++
+
+	return &Var{id: c.nextID, level: c.level}
+}
+
+func (c *checker) pushScope() { c.scope = newScope(c.scope) }
+func (c *checker) popScope()  { c.scope = c.scope.outer }
+
+func (c *checker) declare(ident *ast.Identifier, t Type) {
+	c.declareBinding(ident, &binding{typ: t})
+}
+
+func (c *checker) declareBinding(ident *ast.Identifier, b *binding) {
+	c.scope.names[ident.Value] = b
+	c.info.Defs[ident] = b.typ
+}
+
+// unify makes a and b the same type by binding their variables. any unifies
+// with everything.
+func (c *checker) unify(a, b Type) bool {
+	a, b = prune(a), prune(b)
+	if a == b {
+		return true
+	}
+
+	if v, ok := a.(*Var); ok {
+		return c.bind(v, b)
+	}
+
+	if v, ok := b.(*Var); ok {
+		return c.bind(v, a)
+	}
+
+	if a == Any || b == Any {
+		return true
+	}
+
+	switch a := a.(type) {
+	case *Array:
+		b, ok := b.(*Array)
+		return ok && c.unify(a.Elem, b.Elem)
+	case *Hash:
+		b, ok := b.(*Hash)
+		return ok && c.unify(a.Key, b.Key) && c.unify(a.Value, b.Value)
+	case *Func:
+		b, ok := b.(*Func)
+		if !ok || len(a.Params) != len(b.Params) || (a.Rest == nil) != (b.Rest == nil) {
+			return false
+		}
+
+		for i := range a.Params {
+			if !c.unify(a.Params[i], b.Params[i]) {
+				return false
+			}
+		}
+
+		if a.Rest != nil && !c.unify(a.Rest, b.Rest) {
+			return false
+		}
+
+		return c.unify(a.Result, b.Result)
+	default:
+		return false
+	}
+}
+
+func (c *checker) bind(v *Var, t Type) bool {
+	if occurs(v, t) {
+		// recursive types can not be written down, fall back to any
+		t = Any
+	}
+
+	v.ref = t
+	c.trail = append(c.trail, v)
+
+	return true
+}
+
+// join is the type of a value that is either an a or a b, like the value of
+// an if with two branches. Types that do not unify join to any. A nil type
+// stands for a branch that never produces a value.
+func (c *checker) join(a, b Type) Type {
+	if a == nil {
+		return b
+	}
+
+	if b == nil {
+		return a
+	}
+
+	mark := len(c.trail)
+	if c.unify(a, b) {
+		return a
+	}
+
+	for _, v := range c.trail[mark:] {
+		v.ref = nil
+	}
+	c.trail = c.trail[:mark]
+
+	return Any
+}
+
+// generalize makes the variables t does not share with the enclosing scope
+// generic.
+func (c *checker) generalize(t Type) *binding {
+	b := &binding{typ: t}
+
+	var collect func(t Type)
+	collect = func(t Type) {
+		switch t := prune(t).(type) {
+		case *Var:
+			if t.level <= c.level {
+				return
+			}
+
+			for _, v := range b.generic {
+				if v == t {
+					return
+				}
+			}
+
+			b.generic = append(b.generic, t)
+		case *Array:
+			collect(t.Elem)
+		case *Hash:
+			collect(t.Key)
+			collect(t.Value)
+		case *Func:
+			for _, p := range t.Params {
+				collect(p)
+			}
+
+			if t.Rest != nil {
+				collect(t.Rest)
+			}
+
+			collect(t.Result)
+		}
+	}
+	collect(t)
+
+	return b
+}
+
+func (c *checker) instantiate(b *binding) Type {
+	if len(b.generic) == 0 {
+		return b.typ
+	}
+
+	fresh := map[*Var]*Var{}
+	for _, v := range b.generic {
+		fresh[v] = c.newVar()
+	}
+
+	var copyType func(t Type) Type
+	copyType = func(t Type) Type {
+		switch t := prune(t).(type) {
+		case *Var:
+			if v, ok := fresh[t]; ok {
+				return v
+			}
+
+			return t
+		case *Array:
+			return &Array{copyType(t.Elem)}
+		case *Hash:
+			return &Hash{copyType(t.Key), copyType(t.Value)}
+		case *Func:
+			f := &Func{Required: t.Required, Result: copyType(t.Result)}
+			for _, p := range t.Params {
+				f.Params = append(f.Params, copyType(p))
+			}
+
+			if t.Rest != nil {
+				f.Rest = copyType(t.Rest)
+			}
+
+			return f
+		default:
+			return t
+		}
+	}
+
+	return copyType(b.typ)
+}
+
+// resolve replaces bound variables by their types and renames the unbound
+// ones 'a, 'b, ... in the order they appear.
+func resolve(t Type, names map[*Var]*Var) Type {
+	switch t := prune(t).(type) {
+	case *Var:
+		if v, ok := names[t]; ok {
+			return v
+		}
+
+		v := &Var{id: len(names)}
+		names[t] = v
+
+		return v
+	case *Array:
+		return &Array{resolve(t.Elem, names)}
+	case *Hash:
+		return &Hash{resolve(t.Key, names), resolve(t.Value, names)}
+	case *Func:
+		f := &Func{Params: []Type{}, Required: t.Required}
+		for _, p := range t.Params {
+			f.Params = append(f.Params, resolve(p, names))
+		}
+
+		if t.Rest != nil {
+			f.Rest = resolve(t.Rest, names)
+		}
+
+		f.Result = resolve(t.Result, names)
+
+		return f
+	default:
+		return t
+	}
+}
+
+// typeOf converts an annotation.
+func (c *checker) typeOf(annotation ast.TypeExpression) Type {
+	switch a := annotation.(type) {
+	case *ast.NamedType:
+		if t, ok := basics[a.Name]; ok {
+			return t
+		}
+
+		if b := c.scope.lookup(a.Name); b != nil && b.structType != nil {
+			return b.structType
+		}
+
+		if b := c.scope.lookup(a.Name); b != nil && b.enumType != nil {
+			return b.enumType
+		}
+
+		c.report(a, "unknown type %s", a.Name)
+
+		return Any
+	case *ast.ArrayType:
+		return &Array{c.typeOf(a.Element)}
+	case *ast.HashType:
+		return &Hash{c.typeOf(a.Key), c.typeOf(a.Value)}
+	case *ast.FunctionType:
+		f := &Func{Params: []Type{}, Required: len(a.Parameters), Result: Any}
+		for _, p := range a.Parameters {
+			f.Params = append(f.Params, c.typeOf(p))
+		}
+
+		if a.Result != nil {
+			f.Result = c.typeOf(a.Result)
+		}
+
+		return f
+	default:
+		return Any
+	}
+}
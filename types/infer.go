@@ -0,0 +1,827 @@
+package types
+
+import (
+	"fmt"
+
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/pattern"
+)
+
+// statements checks list and returns the type of its value: the value of the
+// last expression statement, null when it ends in another statement and nil
+// when it ends by returning or throwing.
+func (c *checker) statements(list []ast.Statement) Type {
+	var t Type = Null
+
+	for _, s := range list {
+		switch s := s.(type) {
+		case *ast.ExpressionStatement:
+			t = Null
+			if s.Expression != nil {
+				t = c.expression(s.Expression)
+			}
+		case *ast.LetStatement:
+			c.let(s)
+			t = Null
+		case *ast.ExportStatement:
+			c.statements([]ast.Statement{s.Statement})
+			t = Null
+		case *ast.ImportStatement:
+			if s.Names == nil {
+				c.declare(&ast.Identifier{Token: s.Token, Value: s.Namespace()}, Any)
+			}
+
+			for _, name := range s.Names {
+				c.declare(name, Any)
+			}
+			t = Null
+		case *ast.ReturnStatement:
+			c.ret(s)
+			t = nil
+		case *ast.ThrowStatement:
+			c.expression(s.Value)
+			t = nil
+		case *ast.BlockStatement:
+			t = c.block(s)
+		case *ast.StructStatement:
+			st := &Struct{Name: s.Name.Value}
+			for _, f := range s.Fields {
+				st.Fields = append(st.Fields, f.Value)
+			}
+
+			c.scope.names[st.Name] = &binding{typ: Any, structType: st}
+			t = Null
+		case *ast.ImplStatement:
+			c.impl(s)
+			t = Null
+		case *ast.EnumStatement:
+			en := &Enum{Name: s.Name.Value, Variants: map[string][]string{}}
+			for _, v := range s.Variants {
+				fields := []string{}
+				for _, f := range v.Fields {
+					fields = append(fields, f.Value)
+				}
+
+				en.Variants[v.Name.Value] = fields
+			}
+
+			c.scope.names[en.Name] = &binding{typ: Any, enumType: en}
+			t = Null
+		}
+	}
+
+	return t
+}
+
+func (c *checker) block(b *ast.BlockStatement) Type {
+	c.pushScope()
+	defer c.popScope()
+
+	return c.statements(b.Statements)
+}
+
+func (c *checker) let(s *ast.LetStatement) {
+	var annotated Type
+	if s.Annotation != nil {
+		annotated = c.typeOf(s.Annotation)
+	}
+
+	// a function bound by name can call itself, and is generic in the
+	// variables it does not share with its scope
+	if fn, ok := s.Value.(*ast.FunctionExpression); ok && s.Name != nil {
+		if annotated != nil {
+			c.declare(s.Name, annotated)
+			c.function(fn, annotated)
+			return
+		}
+
+		c.level++
+		self := c.newVar()
+		c.declare(s.Name, self)
+		t := c.function(fn, nil)
+		c.unify(self, t)
+		c.level--
+
+		c.declareBinding(s.Name, c.generalize(t))
+
+		return
+	}
+
+	t := c.expression(s.Value)
+	if annotated != nil {
+		c.expect(s.Value, t, annotated, "in let statement")
+		t = annotated
+	}
+
+	if s.Pattern != nil {
+		c.destructure(s.Pattern, t)
+		return
+	}
+
+	c.declare(s.Name, t)
+}
+
+func (c *checker) ret(s *ast.ReturnStatement) {
+	var t Type = Null
+	if s.ReturnValue != nil {
+		t = c.expression(s.ReturnValue)
+	}
+
+	if c.fn == nil {
+		return
+	}
+
+	if c.fn.declared != nil {
+		if s.ReturnValue == nil {
+			c.expect(s, t, c.fn.declared, "in return statement")
+		} else {
+			c.expect(s.ReturnValue, t, c.fn.declared, "in return statement")
+		}
+		return
+	}
+
+	c.fn.result = c.join(c.fn.result, t)
+}
+
+// destructure declares the names of a let or parameter pattern, which has to
+// fit t.
+func (c *checker) destructure(p ast.Expression, t Type) {
+	switch p := p.(type) {
+	case *ast.Identifier:
+		if p.Value != pattern.Wildcard {
+			c.declare(p, t)
+		}
+	case *ast.ListLiteral:
+		var elem Type = c.newVar()
+		if !c.unify(t, &Array{elem}) {
+			c.report(p, "cannot destructure %s as an array", resolve(t, map[*Var]*Var{}))
+			elem = Any
+		}
+
+		for _, e := range p.Elements {
+			if rest, ok := e.(*ast.SpreadExpression); ok {
+				c.destructure(rest.Value, &Array{elem})
+				continue
+			}
+
+			c.destructure(e, elem)
+		}
+	case *ast.HashLiteral:
+		var value Type = c.newVar()
+		if !c.unify(t, &Hash{c.newVar(), value}) {
+			c.report(p, "cannot destructure %s as a hash", resolve(t, map[*Var]*Var{}))
+			value = Any
+		}
+
+		for _, v := range p.Values {
+			c.destructure(v, value)
+		}
+	}
+}
+
+// matchPattern declares the names of a match arm's pattern. A pattern that
+// does not fit the subject only fails to match, so nothing is reported.
+func (c *checker) matchPattern(p ast.Expression, t Type) {
+	switch p := p.(type) {
+	case *ast.Identifier:
+		if p.Value != pattern.Wildcard {
+			c.declare(p, t)
+		}
+	case *ast.ListLiteral:
+		var elem Type = Any
+		if a, ok := prune(t).(*Array); ok {
+			elem = a.Elem
+		}
+
+		for _, e := range p.Elements {
+			if rest, ok := e.(*ast.SpreadExpression); ok {
+				c.matchPattern(rest.Value, &Array{elem})
+				continue
+			}
+
+			c.matchPattern(e, elem)
+		}
+	case *ast.HashLiteral:
+		var value Type = Any
+		if h, ok := prune(t).(*Hash); ok {
+			value = h.Value
+		}
+
+		for _, v := range p.Values {
+			c.matchPattern(v, value)
+		}
+	case *ast.CallExpression:
+		for _, a := range p.Arguments {
+			c.matchPattern(a, Any)
+		}
+	}
+}
+
+func (c *checker) expression(e ast.Expression) Type {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.StringLiteral:
+		return String
+	case *ast.Boolean:
+		return Bool
+	case *ast.Identifier:
+		if b := c.scope.lookup(e.Value); b != nil {
+			return c.instantiate(b)
+		}
+
+		// undefined names are left to the compiler and vet
+		return Any
+	case *ast.PrefixExpression:
+		return c.prefix(e)
+	case *ast.InfixExpression:
+		return c.infix(e)
+	case *ast.AssignExpression:
+		t := c.expression(e.Value)
+		if b := c.scope.lookup(e.Name.Value); b != nil {
+			c.expect(e.Value, t, c.instantiate(b), "in assignment to "+e.Name.Value)
+		}
+
+		return t
+	case *ast.IfExpression:
+		c.expression(e.Condition)
+
+		var alternative Type = Null
+		consequence := c.block(e.Consequence)
+		if e.Alternative != nil {
+			alternative = c.block(e.Alternative)
+		}
+
+		return c.value(c.join(consequence, alternative))
+	case *ast.FunctionExpression:
+		return c.function(e, nil)
+	case *ast.CallExpression:
+		return c.call(e)
+	case *ast.ListLiteral:
+		return c.array(e.Elements)
+	case *ast.ArrayLiteral:
+		return c.array(e.Elements)
+	case *ast.HashLiteral:
+		return c.hash(e)
+	case *ast.IndexExpression:
+		return c.index(e)
+	case *ast.MatchExpression:
+		return c.match(e)
+	case *ast.TryExpression:
+		t := c.block(e.Block)
+
+		if e.Catch != nil {
+			c.pushScope()
+			c.declare(e.Param, Any)
+			t = c.join(t, c.statements(e.Catch.Statements))
+			c.popScope()
+		}
+
+		if e.Finally != nil {
+			c.block(e.Finally)
+		}
+
+		return c.value(t)
+	case *ast.SelectorExpression:
+		return c.field(e, false)
+	case *ast.StructLiteral:
+		return c.structLiteral(e)
+	case *ast.FieldAssignExpression:
+		t := c.expression(e.Value)
+		c.field(e.Target, true)
+
+		return t
+	case *ast.PropagateExpression:
+		c.expression(e.Left)
+		return Any
+	case *ast.SpreadExpression:
+		c.expression(e.Value)
+		return Any
+	case *ast.NamedArgument:
+		c.expression(e.Value)
+		return Any
+	default:
+		// macros and quoted code are not checked
+		return Any
+	}
+}
+
+// value turns the nil type of code that never produces a value into a
+// variable, which fits wherever the value is used.
+func (c *checker) value(t Type) Type {
+	if t == nil {
+		return c.newVar()
+	}
+
+	return t
+}
+
+func (c *checker) prefix(e *ast.PrefixExpression) Type {
+	right := c.expression(e.Right)
+
+	switch e.Operator {
+	case "!":
+		return Bool
+	case "-":
+		before := resolve(right, map[*Var]*Var{})
+		if !c.unify(right, Int) {
+			c.report(e, "invalid operation: -%s", before)
+			return Any
+		}
+
+		return Int
+	default:
+		return Any
+	}
+}
+
+func (c *checker) infix(e *ast.InfixExpression) Type {
+	left := c.expression(e.Left)
+	right := c.expression(e.Right)
+
+	names := map[*Var]*Var{}
+	invalid := fmt.Sprintf("invalid operation: %s %s %s", resolve(left, names), e.Operator, resolve(right, names))
+
+	switch e.Operator {
+	case "==", "!=":
+		// every two values can be compared for equality
+		return Bool
+	case "+":
+		operand := c.addOperand(left, right)
+		if operand == nil || !c.unify(left, operand) || !c.unify(right, operand) {
+			c.report(e, "%s", invalid)
+			return Any
+		}
+
+		return operand
+	case "-", "*", "/":
+		if !c.unify(left, Int) || !c.unify(right, Int) {
+			// any keeps the error from being reported again where the
+			// result is used
+			c.report(e, "%s", invalid)
+			return Any
+		}
+
+		return Int
+	case "<", ">":
+		if !c.unify(left, Int) || !c.unify(right, Int) {
+			c.report(e, "%s", invalid)
+		}
+
+		return Bool
+	default:
+		return Any
+	}
+}
+
+// addOperand is the type both operands of + have to be: ints and strings
+// can be added, each only to its own kind. It returns nil when neither can.
+func (c *checker) addOperand(left, right Type) Type {
+	left, right = prune(left), prune(right)
+
+	for _, t := range []Type{left, right} {
+		if t == Int || t == String {
+			return t
+		}
+	}
+
+	if left == Any || right == Any {
+		return Any
+	}
+
+	_, lv := left.(*Var)
+	_, rv := right.(*Var)
+	if lv && rv {
+		return left
+	}
+
+	return nil
+}
+
+// function infers the type of a function literal. When the literal is bound
+// to an annotated name, expected is the annotation; the parameters and the
+// result take their types from it before the body is checked.
+func (c *checker) function(fn *ast.FunctionExpression, expected Type) Type {
+	c.pushScope()
+	defer c.popScope()
+
+	ft := &Func{Params: []Type{}}
+	defaulted := false
+
+	receiver := c.receiver
+	c.receiver = nil
+
+	for i, p := range fn.Parameters {
+		var t Type
+		if fn.ParameterTypes != nil && fn.ParameterTypes[i] != nil {
+			t = c.typeOf(fn.ParameterTypes[i])
+		} else if i == 0 {
+			t = receiver
+		}
+
+		switch p := p.(type) {
+		case *ast.SpreadExpression:
+			if t == nil {
+				t = &Array{c.newVar()}
+			}
+
+			rest, ok := prune(t).(*Array)
+			if !ok {
+				if t != Any {
+					c.report(p, "rest parameter %s must be an array, got %s", p.Value, t)
+				}
+				rest = &Array{Any}
+			}
+
+			ft.Rest = rest.Elem
+			c.destructure(p.Value, rest)
+
+			continue
+		case *ast.DefaultParameter:
+			defaulted = true
+
+			value := c.expression(p.Value)
+			if t == nil {
+				t = value
+			} else {
+				c.expect(p.Value, value, t, "as default of "+p.Parameter.String())
+			}
+
+			c.destructure(p.Parameter, t)
+		default:
+			if t == nil {
+				t = c.newVar()
+			}
+
+			if !defaulted {
+				ft.Required++
+			}
+
+			c.destructure(p, t)
+		}
+
+		ft.Params = append(ft.Params, t)
+	}
+
+	fc := &function{}
+	if fn.ReturnType != nil {
+		fc.declared = c.typeOf(fn.ReturnType)
+		ft.Result = fc.declared
+	} else {
+		ft.Result = c.newVar()
+	}
+
+	if expected != nil {
+		c.expect(fn, ft, expected, "in let statement")
+		if f, ok := prune(expected).(*Func); ok && fc.declared == nil {
+			fc.declared = f.Result
+		}
+	}
+
+	outer := c.fn
+	c.fn = fc
+	defer func() { c.fn = outer }()
+
+	body := c.statements(fn.Body.Statements)
+
+	if fc.declared != nil {
+		if body == nil {
+			return ft
+		}
+
+		if n := len(fn.Body.Statements); n > 0 {
+			if last, ok := fn.Body.Statements[n-1].(*ast.ExpressionStatement); ok && last.Expression != nil {
+				c.expect(last.Expression, body, fc.declared, "in function result")
+				return ft
+			}
+		}
+
+		if !c.unify(Null, fc.declared) {
+			c.report(fn.Body, "function ends without a value, want %s", resolve(fc.declared, map[*Var]*Var{}))
+		}
+
+		return ft
+	}
+
+	c.unify(ft.Result, c.value(c.join(fc.result, body)))
+
+	return ft
+}
+
+func (c *checker) call(e *ast.CallExpression) Type {
+	callee := c.expression(e.Function)
+
+	args := make([]Type, len(e.Arguments))
+	plain := true
+	for i, a := range e.Arguments {
+		switch a.(type) {
+		case *ast.SpreadExpression, *ast.NamedArgument:
+			// the arguments can not be lined up with the parameters
+			plain = false
+		}
+
+		args[i] = c.expression(a)
+	}
+
+	switch f := prune(callee).(type) {
+	case *Var:
+		if !plain {
+			return Any
+		}
+
+		ft := &Func{Params: args, Required: len(args), Result: c.newVar()}
+		c.unify(f, ft)
+
+		return ft.Result
+	case *Func:
+		if plain {
+			c.arguments(e, f, args)
+		}
+
+		return f.Result
+	default:
+		if f != Any {
+			c.report(e, "cannot call non-function %s (%s)", describe(e.Function), f)
+		}
+
+		return Any
+	}
+}
+
+func (c *checker) arguments(e *ast.CallExpression, f *Func, args []Type) {
+	if len(args) < f.Required || (f.Rest == nil && len(args) > len(f.Params)) {
+		want := fmt.Sprint(f.Required)
+		if f.Rest != nil {
+			want = "at least " + want
+		} else if f.Required < len(f.Params) {
+			want = fmt.Sprintf("%d to %d", f.Required, len(f.Params))
+		}
+
+		c.report(e, "wrong number of arguments to %s: want %s, got %d", describe(e.Function), want, len(args))
+
+		return
+	}
+
+	for i, arg := range args {
+		want := f.Rest
+		if i < len(f.Params) {
+			want = f.Params[i]
+		}
+
+		c.expect(e.Arguments[i], arg, want, "in argument to "+describe(e.Function))
+	}
+}
+
+func (c *checker) array(elements []ast.Expression) Type {
+	var elem Type
+
+	for _, e := range elements {
+		if spread, ok := e.(*ast.SpreadExpression); ok {
+			spreadElem := c.newVar()
+			c.expect(spread.Value, c.expression(spread.Value), &Array{spreadElem}, "in spread")
+			elem = c.join(elem, spreadElem)
+			continue
+		}
+
+		elem = c.join(elem, c.expression(e))
+	}
+
+	return &Array{c.value(elem)}
+}
+
+func (c *checker) hash(h *ast.HashLiteral) Type {
+	var key, value Type
+
+	for i, k := range h.Keys {
+		kt := c.expression(k)
+		if !hashable(kt) {
+			c.report(k, "unusable as hash key: %s (%s)", describe(k), kt)
+			kt = Any
+		}
+
+		key = c.join(key, kt)
+		value = c.join(value, c.expression(h.Values[i]))
+	}
+
+	return &Hash{c.value(key), c.value(value)}
+}
+
+// hashable reports whether t may be the type of a hash key.
+func hashable(t Type) bool {
+	switch t := prune(t).(type) {
+	case *Var:
+		return true
+	default:
+		return t == Int || t == String || t == Bool || t == Any
+	}
+}
+
+func (c *checker) index(e *ast.IndexExpression) Type {
+	left := c.expression(e.Left)
+	index := c.expression(e.Index)
+
+	switch t := prune(left).(type) {
+	case *Array:
+		c.expect(e.Index, index, Int, "in array index")
+		return t.Elem
+	case *Hash:
+		c.expect(e.Index, index, t.Key, "in hash index")
+		return t.Value
+	case *Var:
+		// could be either an array or a hash
+		return Any
+	default:
+		if t != Any {
+			c.report(e, "cannot index %s (%s)", describe(e.Left), t)
+		}
+
+		return Any
+	}
+}
+
+func (c *checker) match(e *ast.MatchExpression) Type {
+	subject := c.expression(e.Subject)
+
+	var t Type
+	for _, arm := range e.Arms {
+		c.pushScope()
+		c.matchPattern(arm.Pattern, subject)
+		if arm.Guard != nil {
+			c.expression(arm.Guard)
+		}
+		t = c.join(t, c.statements(arm.Body.Statements))
+		c.popScope()
+	}
+
+	return c.value(t)
+}
+
+// structLiteral checks a struct literal. Types exported by modules are not
+// known, their literals are any.
+func (c *checker) structLiteral(e *ast.StructLiteral) Type {
+	var b *binding
+
+	switch name := e.Name.(type) {
+	case *ast.Identifier:
+		b = c.scope.lookup(name.Value)
+		if b != nil && b.structType == nil {
+			c.report(name, "%s is not a struct type", name.Value)
+		}
+	default:
+		c.expression(name)
+	}
+
+	for i, f := range e.Fields {
+		c.expression(e.Values[i])
+
+		if b != nil && b.structType != nil && !b.structType.hasField(f.Value) {
+			c.report(f, "struct %s has no field %s", b.structType.Name, f.Value)
+		}
+	}
+
+	if b == nil || b.structType == nil {
+		return Any
+	}
+
+	return b.structType
+}
+
+// field checks that the value selected from has the field or method, and
+// returns its type. The fields of structs are any, as are the fields of
+// errors and the exports of modules. Only fields can be assigned.
+func (c *checker) field(e *ast.SelectorExpression, assigned bool) Type {
+	name := e.Selector.Value
+
+	if ident, ok := e.Left.(*ast.Identifier); ok {
+		if b := c.scope.lookup(ident.Value); b != nil && b.enumType != nil {
+			return c.variant(e, b.enumType, assigned)
+		}
+	}
+
+	switch t := prune(c.expression(e.Left)).(type) {
+	case *Struct:
+		if t.hasField(name) {
+			return Any
+		}
+
+		if b, ok := t.methods[name]; ok && !assigned {
+			return bind(c.instantiate(b))
+		}
+
+		if assigned {
+			c.report(e.Selector, "struct %s has no field %s", t.Name, name)
+		} else {
+			c.report(e.Selector, "struct %s has no field or method %s", t.Name, name)
+		}
+	case *Enum:
+		if assigned {
+			c.report(e.Selector, "cannot set %s on enum %s, variants can not be changed", name, t.Name)
+		} else if !t.hasField(name) {
+			c.report(e.Selector, "no variant of enum %s has a field %s", t.Name, name)
+		}
+	case *Var:
+	default:
+		if !assigned {
+			if f, ok := c.builtinMethod(t, name); ok {
+				return f
+			}
+		}
+
+		if t != Any {
+			c.report(e.Selector, "cannot select %s from %s (%s)", name, describe(e.Left), resolve(t, map[*Var]*Var{}))
+		}
+	}
+
+	return Any
+}
+
+// variant returns the type of a variant selected from its enum: the enum
+// for variants without fields, a constructor for the others.
+func (c *checker) variant(e *ast.SelectorExpression, en *Enum, assigned bool) Type {
+	fields, ok := en.Variants[e.Selector.Value]
+	switch {
+	case assigned:
+		c.report(e.Selector, "cannot set %s on enum %s, variants can not be changed", e.Selector.Value, en.Name)
+		return Any
+	case !ok:
+		c.report(e.Selector, "enum %s has no variant %s", en.Name, e.Selector.Value)
+		return Any
+	case len(fields) == 0:
+		return en
+	}
+
+	f := &Func{Params: []Type{}, Required: len(fields), Result: en}
+	for range fields {
+		f.Params = append(f.Params, Any)
+	}
+
+	return f
+}
+
+// impl infers the methods of an impl block, with the struct as the type of
+// their receivers. Like functions bound by let, the methods can call each
+// other and are generic in the variables they do not share with their
+// scope.
+func (c *checker) impl(s *ast.ImplStatement) {
+	b := c.scope.lookup(s.Name.Value)
+	if b != nil && b.structType == nil {
+		c.report(s.Name, "%s is not a struct type", s.Name.Value)
+	}
+
+	var st *Struct
+	if b != nil {
+		st = b.structType
+	}
+
+	c.level++
+
+	methods := make([]*Var, len(s.Methods))
+	for i, m := range s.Methods {
+		methods[i] = c.newVar()
+
+		if st == nil {
+			continue
+		}
+
+		if st.hasField(m.Name) {
+			c.report(m, "struct %s already has a field %s", st.Name, m.Name)
+		}
+
+		if st.methods == nil {
+			st.methods = map[string]*binding{}
+		}
+		st.methods[m.Name] = &binding{typ: methods[i]}
+	}
+
+	for i, m := range s.Methods {
+		if st != nil {
+			c.receiver = st
+		}
+
+		c.unify(methods[i], c.function(m, nil))
+	}
+
+	c.level--
+
+	if st != nil {
+		for i, m := range s.Methods {
+			st.methods[m.Name] = c.generalize(methods[i])
+		}
+	}
+}
+
+// bind is the type of a method selected from its receiver, the function
+// without its first parameter.
+func bind(t Type) Type {
+	f, ok := prune(t).(*Func)
+	if !ok || len(f.Params) == 0 {
+		return t
+	}
+
+	bound := &Func{Params: f.Params[1:], Required: f.Required - 1, Rest: f.Rest, Result: f.Result}
+	if bound.Required < 0 {
+		bound.Required = 0
+	}
+
+	return bound
+}
@@ -0,0 +1,53 @@
+package types
+
+// builtinMethod returns the type of the builtin method name of the values of
+// type t, like those of package builtin.
+func (c *checker) builtinMethod(t Type, name string) (*Func, bool) {
+	fn := func(result Type, params ...Type) *Func {
+		return &Func{Params: params, Required: len(params), Result: result}
+	}
+
+	switch t := t.(type) {
+	case *Basic:
+		if t != String {
+			return nil, false
+		}
+
+		switch name {
+		case "len":
+			return fn(Int), true
+		case "upper", "lower", "trim":
+			return fn(String), true
+		case "split":
+			return fn(&Array{String}, String), true
+		case "contains":
+			return fn(Bool, String), true
+		}
+	case *Array:
+		switch name {
+		case "len":
+			return fn(Int), true
+		case "push":
+			return &Func{Params: []Type{}, Rest: t.Elem, Result: t}, true
+		case "map":
+			result := c.newVar()
+			return fn(&Array{result}, fn(result, t.Elem)), true
+		case "filter":
+			return fn(t, fn(c.newVar(), t.Elem)), true
+		case "reduce":
+			acc := c.newVar()
+			return fn(acc, fn(acc, acc, t.Elem), acc), true
+		}
+	case *Hash:
+		switch name {
+		case "len":
+			return fn(Int), true
+		case "keys":
+			return fn(&Array{t.Key}), true
+		case "values":
+			return fn(&Array{t.Value}), true
+		}
+	}
+
+	return nil, false
+}
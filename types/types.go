@@ -0,0 +1,200 @@
+// Package types is an optional static checker for ngiri programs. It infers
+// the types of unannotated code Hindley-Milner style and checks them against
+// the annotations a program does have, so that `5 + true` is reported before
+// the program runs instead of by the VM.
+//
+// The checking is gradual: any is compatible with every type, and where the
+// inference can not give an expression a single type, like an if whose
+// branches evaluate to an int and a string, the expression is any rather than
+// an error. Annotated code gets the most out of the checker.
+package types
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Type is one of *Basic, *Array, *Hash, *Func, *Struct, *Enum and *Var.
+type Type interface {
+	String() string
+}
+
+type Basic struct {
+	Name string
+}
+
+func (b *Basic) String() string { return b.Name }
+
+var (
+	Int    = &Basic{"int"}
+	String = &Basic{"string"}
+	Bool   = &Basic{"bool"}
+	Null   = &Basic{"null"}
+	// Any is the type of values the checker knows nothing about. It is
+	// compatible with every other type.
+	Any = &Basic{"any"}
+)
+
+// basics are the types an annotation can name.
+var basics = map[string]*Basic{
+	"int":    Int,
+	"string": String,
+	"bool":   Bool,
+	"null":   Null,
+	"any":    Any,
+}
+
+type Array struct {
+	Elem Type
+}
+
+func (a *Array) String() string { return "[" + a.Elem.String() + "]" }
+
+type Hash struct {
+	Key   Type
+	Value Type
+}
+
+func (h *Hash) String() string { return "{" + h.Key.String() + ": " + h.Value.String() + "}" }
+
+// Struct is the type of the structs of a struct declaration. Struct types
+// are nominal, every declaration has its own. The fields are not typed, the
+// methods of impl blocks are.
+type Struct struct {
+	Name   string
+	Fields []string
+
+	methods map[string]*binding
+}
+
+func (s *Struct) String() string { return s.Name }
+
+func (s *Struct) hasField(name string) bool {
+	for _, f := range s.Fields {
+		if f == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Enum is the type of the values of an enum declaration. Like struct types
+// enum types are nominal. Variants maps the names of the variants to their
+// fields, which are not typed.
+type Enum struct {
+	Name     string
+	Variants map[string][]string
+}
+
+func (e *Enum) String() string { return e.Name }
+
+// hasField reports whether some variant of the enum has the field name.
+func (e *Enum) hasField(name string) bool {
+	for _, fields := range e.Variants {
+		for _, f := range fields {
+			if f == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Func is the type of functions. The first Required parameters have no
+// default. Rest is the element type of the rest parameter, or nil.
+type Func struct {
+	Params   []Type
+	Required int
+	Rest     Type
+	Result   Type
+}
+
+func (f *Func) String() string {
+	params := []string{}
+
+	for _, p := range f.Params {
+		params = append(params, p.String())
+	}
+
+	if f.Rest != nil {
+		params = append(params, "..."+(&Array{f.Rest}).String())
+	}
+
+	return "fn(" + strings.Join(params, ", ") + ") -> " + f.Result.String()
+}
+
+// Var is a type variable. Unification binds it to the type it stands for;
+// an unbound variable in a let-bound function makes the function generic.
+type Var struct {
+	id    int
+	level int
+	ref   Type
+}
+
+func (v *Var) String() string {
+	if v.ref != nil {
+		return v.ref.String()
+	}
+
+	return "'" + varName(v.id)
+}
+
+// varName names variables a, b, ..., z, a1, b1, ...
+func varName(id int) string {
+	name := string(rune('a' + id%26))
+	if id >= 26 {
+		name += strconv.Itoa(id / 26)
+	}
+
+	return name
+}
+
+// prune follows bound variables to the type they stand for.
+func prune(t Type) Type {
+	for {
+		v, ok := t.(*Var)
+		if !ok || v.ref == nil {
+			return t
+		}
+
+		t = v.ref
+	}
+}
+
+// occurs reports whether v appears in t, and lowers the level of the free
+// variables of t to v's so that binding v does not let them be generalized
+// too early.
+func occurs(v *Var, t Type) bool {
+	switch t := prune(t).(type) {
+	case *Var:
+		if t == v {
+			return true
+		}
+
+		if t.level > v.level {
+			t.level = v.level
+		}
+
+		return false
+	case *Array:
+		return occurs(v, t.Elem)
+	case *Hash:
+		return occurs(v, t.Key) || occurs(v, t.Value)
+	case *Func:
+		for _, p := range t.Params {
+			if occurs(v, p) {
+				return true
+			}
+		}
+
+		if t.Rest != nil && occurs(v, t.Rest) {
+			return true
+		}
+
+		return occurs(v, t.Result)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,188 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/lexer"
+	"github.com/marmotini/ngiri-lang/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.NewParser(lexer.NewLexer(input))
+	prog := p.ParseProgram()
+
+	assert.Empty(t, p.Errors(), "parser errors")
+
+	return prog
+}
+
+func diagnostics(t *testing.T, input string) []string {
+	_, diags := Check(parse(t, input))
+
+	out := []string{}
+	for _, d := range diags {
+		out = append(out, d.String())
+	}
+
+	return out
+}
+
+// defs returns the inferred types of the names top level lets bind.
+func defs(t *testing.T, input string) map[string]string {
+	prog := parse(t, input)
+	info, _ := Check(prog)
+
+	out := map[string]string{}
+	for _, s := range prog.Statements {
+		if let, ok := s.(*ast.LetStatement); ok && let.Name != nil {
+			out[let.Name.Value] = info.Defs[let.Name].String()
+		}
+	}
+
+	return out
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`5 + true`, []string{"1:3: invalid operation: int + bool"}},
+		{`"a" - "b"; -"c"; 1 < "2"`, []string{
+			"1:5: invalid operation: string - string",
+			"1:12: invalid operation: -string",
+			"1:20: invalid operation: int < string",
+		}},
+		{`1 == "1"; true != 2; !5`, []string{}},
+		{`let x: int = "a";`, []string{`1:14: cannot use "a" (string) as int in let statement`}},
+		{`let x: any = "a"; let y: [int] = [1, 2]; let z: {string: bool} = {"a": true};`, []string{}},
+		{`let xs: [int] = ["1"]; let ys: [int] = [1, "2"];`, []string{`1:17: cannot use [1] ([string]) as [int] in let statement`}},
+		{`let x: number = 1;`, []string{"1:8: unknown type number"}},
+		{`let add = fn(a: int, b: int) -> int { a + b }; add(1, "2"); add(1)`, []string{
+			`1:55: cannot use "2" (string) as int in argument to add`,
+			"1:64: wrong number of arguments to add: want 2, got 1",
+		}},
+		{`let f = fn(a, b = 1) { a + b }; f(1, 2, 3); f("a")`, []string{
+			"1:34: wrong number of arguments to f: want 1 to 2, got 3",
+			`1:47: cannot use "a" (string) as int in argument to f`,
+		}},
+		{`let f = fn(...xs: [int]) { xs }; f(1, "a"); f(...[1], "a")`, []string{`1:39: cannot use "a" (string) as int in argument to f`}},
+		{`let f = fn(...xs: int) { xs };`, []string{"1:12: rest parameter xs must be an array, got int"}},
+		{`let f = fn(a: int = "x") { a };`, []string{`1:21: cannot use "x" (string) as int as default of a`}},
+		{`let f = fn() -> int { "s" };`, []string{`1:23: cannot use "s" (string) as int in function result`}},
+		{`let f = fn(x) -> int { if (x) { return "s" } 1 };`, []string{`1:40: cannot use "s" (string) as int in return statement`}},
+		{`let f = fn() -> int { let a = 1; };`, []string{"1:21: function ends without a value, want int"}},
+		{`let f = fn() -> int { throw "no" };`, []string{}},
+		{`let f: fn(string) -> string = fn(x) { x - 1 };`, []string{"1:41: invalid operation: string - int"}},
+		{`let f: fn(int) -> int = fn(a, b) { a };`, []string{"1:25: cannot use fn( a, b) a (fn('a, 'b) -> 'c) as fn(int) -> int in let statement"}},
+		{`let fact = fn(n) { if (n < 2) { return 1 } n * fact(n - 1) }; fact("x")`, []string{`1:68: cannot use "x" (string) as int in argument to fact`}},
+		{`let id = fn(x) { x }; id(1) + id("s")`, []string{"1:29: invalid operation: int + string"}},
+		{`let f = fn(g) { g(1) + 1 }; f(fn(x) { x + "a" })`, []string{`1:31: cannot use fn( x) (x + a) (fn(string) -> string) as fn(int) -> int in argument to f`}},
+		{`let x = 1; x = "s";`, []string{`1:16: cannot use "s" (string) as int in assignment to x`}},
+		{`1(2); let y = 5; y[0]; [1][true]; {"a": 1}[1]`, []string{
+			"1:2: cannot call non-function 1 (int)",
+			"1:19: cannot index y (int)",
+			"1:28: cannot use true (bool) as int in array index",
+			"1:44: cannot use 1 (int) as string in hash index",
+		}},
+		{`let h = {[1]: 2};`, []string{"1:10: unusable as hash key: [1] ([int])"}},
+		{`let [a, b] = 5; let {k} = [1];`, []string{
+			"1:5: cannot destructure int as an array",
+			"1:21: cannot destructure [int] as a hash",
+		}},
+		{`let [a, ...rest] = [1, 2]; a + rest`, []string{"1:30: invalid operation: int + [int]"}},
+		{`let x = if (true) { 1 } else { "a" }; x + true`, []string{}},
+		{`let x = if (true) { 1 }; x + 1`, []string{}},
+		{`match ([1, 2]) { [a, ...b] => a + b, {"k": v} => v, _ => 0 }`, []string{"1:33: invalid operation: int + [int]"}},
+		{`let r = try { 1 } catch (e) { e + 1 }; r + 1`, []string{}},
+		{`import "lib"; lib.sum(1) + 1; let a = len("s") + puts(1);`, []string{"1:48: invalid operation: int + null"}},
+		{`let f = fn(a) { a + 1 }; f(...[1]); f(a: "x")`, []string{}},
+		{`struct P { x, y }; let p: P = P{x: 1, z: 2}; p.x + p.w; p.y = 1; let q: int = p;`, []string{
+			"1:39: struct P has no field z",
+			"1:54: struct P has no field or method w",
+			"1:79: cannot use p (P) as int in let statement",
+		}},
+		{`struct P { x }; struct Q { x }; let f = fn(p: P) { p.x }; f(Q{x: 1}); let a = 1; a.x; A{}; a{}`, []string{
+			"1:62: cannot use Q{x: 1} (Q) as P in argument to f",
+			"1:84: cannot select x from a (int)",
+			"1:92: a is not a struct type",
+		}},
+		{`struct P { x }; impl P { fn add(self, n: int) { self.x + n } fn x(self) { 1 } }; let p = P{x: 1}; p.add("a"); p.nope(); p.add = 1`, []string{
+			"1:62: struct P already has a field x",
+			`1:105: cannot use "a" (string) as int in argument to p.add`,
+			"1:113: struct P has no field or method nope",
+			"1:123: struct P has no field add",
+		}},
+		{`let Q = 1; impl Q { fn f(self) { self.y } }; "a".upper(1); [1].map(fn(x) { x + "s" }); "a".nope`, []string{
+			"1:17: Q is not a struct type",
+			"1:55: wrong number of arguments to a.upper: want 0, got 1",
+			`1:68: cannot use fn( x) (x + s) (fn(string) -> string) as fn(int) -> 'a in argument to [1].map`,
+			`1:92: cannot select nope from "a" (string)`,
+		}},
+		{`enum S { A(x), B }; S.C; S.A(1, 2); let s: S = 1; S.A(1).y; S.B.x = 1; S.A = 1; let n: int = S.B;`, []string{
+			"1:23: enum S has no variant C",
+			"1:29: wrong number of arguments to S.A: want 1, got 2",
+			"1:48: cannot use 1 (int) as S in let statement",
+			"1:58: no variant of enum S has a field y",
+			"1:65: cannot set x on enum S, variants can not be changed",
+			"1:74: cannot set A on enum S, variants can not be changed",
+			"1:95: cannot use S.B (S) as int in let statement",
+		}},
+		{`export struct P { x }; export enum S { A }; P{y: 1}; S.B; import "m"; m.P{x: 1}.y`, []string{
+			"1:47: struct P has no field y",
+			"1:56: enum S has no variant B",
+		}},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, diagnostics(t, tt.input), tt.input)
+	}
+}
+
+func TestInference(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected map[string]string
+	}{
+		{`let a = 1; let s = "s"; let b = !a; let n = -a;`, map[string]string{"a": "int", "s": "string", "b": "bool", "n": "int"}},
+		{`let xs = [1, 2]; let e = []; let h = {"a": [true]}; let m = {"a": 1, "b": "c"};`, map[string]string{
+			"xs": "[int]", "e": "['a]", "h": "{string: [bool]}", "m": "{string: any}",
+		}},
+		{`let id = fn(x) { x }; let a = id(1); let b = id("s");`, map[string]string{
+			"id": "fn('a) -> 'a", "a": "int", "b": "string",
+		}},
+		{`let add = fn(a, b) { a + b }; let inc = fn(a) { a + 1 };`, map[string]string{
+			"add": "fn('a, 'a) -> 'a", "inc": "fn(int) -> int",
+		}},
+		{`let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };`, map[string]string{"fib": "fn(int) -> int"}},
+		{`let twice = fn(f, x) { f(f(x)) };`, map[string]string{"twice": "fn(fn('a) -> 'a, 'a) -> 'a"}},
+		{`let first = fn([h, ...t]) { h }; let keys = fn({k}) { k };`, map[string]string{
+			"first": "fn(['a]) -> 'a", "keys": "fn({'a: 'b}) -> 'b",
+		}},
+		{`let f = fn(a, b = "x", ...c) { c };`, map[string]string{"f": "fn('a, string, ...['b]) -> ['b]"}},
+		{`let f = fn(x) { if (x) { return 1 } "a" }; let g = fn() { throw 1 };`, map[string]string{
+			"f": "fn('a) -> any", "g": "fn() -> 'a",
+		}},
+		{`let x: any = 1; let y = x + 1; let f: fn(int) = fn(a) { a };`, map[string]string{
+			"x": "any", "y": "int", "f": "fn(int) -> any",
+		}},
+		{`let s = len("abc") + now(); let p = puts("a"); let v = unwrap(ok(1));`, map[string]string{
+			"s": "int", "p": "null", "v": "any",
+		}},
+		{`struct P { x }; let p = P{x: 1}; let f = fn(q: P) { q.x }; let x = p.x;`, map[string]string{
+			"p": "P", "f": "fn(P) -> any", "x": "any",
+		}},
+		{`struct P { x }; impl P { fn id(self, v) { v } fn get(self) { self.x } }; let p = P{}; let a = p.id(1); let b = p.id("s"); let g = p.get; let s = "a b".upper().split(" "); let n = [1, 2].map(fn(x) { x > 1 }); let r = [1].reduce(fn(acc, x) { acc + x }, 0); let k = {"a": true}.keys();`, map[string]string{
+			"p": "P", "a": "int", "b": "string", "g": "fn() -> any", "s": "[string]", "n": "[bool]", "r": "int", "k": "[string]",
+		}},
+		{`enum S { A(x), B }; let a = S.A(1); let b = S.B; let c = S.A; let t = tag_of(a); let f = fn(s: S) { match (s) { A(x) => x, S.B => 0 } };`, map[string]string{
+			"a": "S", "b": "S", "c": "fn(any) -> S", "t": "string", "f": "fn(S) -> any",
+		}},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, defs(t, tt.input), tt.input)
+	}
+}
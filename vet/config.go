@@ -0,0 +1,53 @@
+package vet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// DefaultConfigFile is looked up in the working directory when no config file
+// is given explicitly.
+const DefaultConfigFile = ".ngirivet.json"
+
+// Config switches rules on or off by ID. Rules missing from the file keep
+// their default, which is enabled.
+//
+//	{"rules": {"shadow": false, "unused-param": true}}
+type Config struct {
+	Rules map[string]bool `json:"rules"`
+}
+
+func LoadConfig(filename string) (*Config, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseConfig(b)
+}
+
+func ParseConfig(data []byte) (*Config, error) {
+	conf := &Config{}
+	if err := json.Unmarshal(data, conf); err != nil {
+		return nil, fmt.Errorf("invalid vet config: %s", err)
+	}
+
+	for id := range conf.Rules {
+		if _, ok := Lookup(id); !ok {
+			return nil, fmt.Errorf("invalid vet config: unknown rule %q", id)
+		}
+	}
+
+	return conf, nil
+}
+
+func (c *Config) Enabled(id string) bool {
+	if c == nil {
+		return true
+	}
+
+	enabled, ok := c.Rules[id]
+
+	return !ok || enabled
+}
@@ -0,0 +1,311 @@
+package vet
+
+import (
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/compiler"
+	"github.com/marmotini/ngiri-lang/pattern"
+)
+
+type BindingKind int
+
+const (
+	LetBinding BindingKind = iota
+	ParamBinding
+	ImportBinding
+	CatchBinding
+	PatternBinding
+	StructBinding
+	ReceiverBinding
+	EnumBinding
+)
+
+// Binding is a single declaration of a name, by `let`, as a function
+// parameter, by `import`, as the error of a catch block, in the pattern of a
+// match arm, by `struct` or `enum` or as the receiver of a method, together
+// with what the rules need to know about it.
+type Binding struct {
+	Name   string
+	Kind   BindingKind
+	Ident  *ast.Identifier
+	Symbol compiler.Symbol
+
+	// Value is the right hand side of a let binding, nil for parameters.
+	Value ast.Expression
+
+	// Exported is set for let bindings of export statements.
+	Exported bool
+
+	// Uses counts the identifiers resolved to this binding.
+	Uses int
+
+	// Assigned is set when an assignment changes the value of the binding,
+	// which then is not always Value.
+	Assigned bool
+
+	// Shadows is the binding of an enclosing block, function or the global
+	// scope that this one hides, if any.
+	Shadows *Binding
+}
+
+type Info struct {
+	Bindings []*Binding
+	Uses     map[*ast.Identifier]*Binding
+}
+
+// scope mirrors a compiler.SymbolTable and remembers the binding behind every
+// symbol so uses can be attributed to the declaration they resolve to.
+type scope struct {
+	table    *compiler.SymbolTable
+	bindings map[string]*Binding
+	outer    *scope
+}
+
+func newScope(outer *scope) *scope {
+	s := &scope{bindings: make(map[string]*Binding), outer: outer}
+
+	if outer == nil {
+		s.table = compiler.NewSymbolTable()
+	} else {
+		s.table = compiler.NewEnclosedSymbolTable(outer.table)
+	}
+
+	return s
+}
+
+func newBlockScope(outer *scope) *scope {
+	return &scope{
+		table:    compiler.NewBlockSymbolTable(outer.table),
+		bindings: make(map[string]*Binding),
+		outer:    outer,
+	}
+}
+
+func (s *scope) lookup(name string) *Binding {
+	if _, ok := s.table.Resolve(name); !ok {
+		return nil
+	}
+
+	for sc := s; sc != nil; sc = sc.outer {
+		if b, ok := sc.bindings[name]; ok {
+			return b
+		}
+	}
+
+	return nil
+}
+
+type resolver struct {
+	info  *Info
+	scope *scope
+}
+
+func resolve(prog *ast.Program) *Info {
+	r := &resolver{
+		info:  &Info{Uses: make(map[*ast.Identifier]*Binding)},
+		scope: newScope(nil),
+	}
+
+	ast.Walk(r, prog)
+
+	return r.info
+}
+
+func (r *resolver) define(ident *ast.Identifier, kind BindingKind, value ast.Expression) {
+	b := &Binding{Name: ident.Value, Kind: kind, Ident: ident, Value: value}
+
+	if _, ok := r.scope.bindings[ident.Value]; !ok && r.scope.outer != nil {
+		b.Shadows = r.scope.outer.lookup(ident.Value)
+	}
+
+	b.Symbol = r.scope.table.Define(ident.Value)
+	r.scope.bindings[ident.Value] = b
+	r.info.Bindings = append(r.info.Bindings, b)
+}
+
+// walkBody resolves the statements of block in the current scope, which
+// holds the names bound for the block, like the parameters of a function.
+func (r *resolver) walkBody(block *ast.BlockStatement) {
+	for _, s := range block.Statements {
+		if s != nil {
+			ast.Walk(r, s)
+		}
+	}
+}
+
+func (r *resolver) Visit(node ast.Node) ast.Visitor {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		r.scope = newBlockScope(r.scope)
+		r.walkBody(node)
+		r.scope = r.scope.outer
+
+		return nil
+	case *ast.AssignExpression:
+		// Assigning a binding does not read it.
+		ast.Walk(r, node.Value)
+		if b := r.scope.lookup(node.Name.Value); b != nil {
+			b.Assigned = true
+		}
+
+		return nil
+	case *ast.LetStatement:
+		if node.Pattern != nil {
+			if node.Value != nil {
+				ast.Walk(r, node.Value)
+			}
+			for _, ident := range pattern.Bindings(node.Pattern) {
+				r.define(ident, LetBinding, nil)
+			}
+
+			return nil
+		}
+
+		// Function values are bound before their body is resolved so that
+		// recursive calls find the binding, like they do at runtime.
+		if _, _, ok := signature(node.Value); ok {
+			r.define(node.Name, LetBinding, node.Value)
+			ast.Walk(r, node.Value)
+			return nil
+		}
+
+		if node.Value != nil {
+			ast.Walk(r, node.Value)
+		}
+		r.define(node.Name, LetBinding, node.Value)
+
+		return nil
+	case *ast.ExportStatement:
+		ast.Walk(r, node.Statement)
+		r.scope.bindings[node.Name().Value].Exported = true
+
+		return nil
+	case *ast.ImportStatement:
+		if node.Names == nil {
+			namespace := &ast.Identifier{Token: node.Token, Value: node.Namespace()}
+			r.define(namespace, ImportBinding, nil)
+		}
+
+		for _, name := range node.Names {
+			r.define(name, ImportBinding, nil)
+		}
+
+		return nil
+	case *ast.SelectorExpression:
+		// The selector names an export of another module or a field, not a
+		// binding.
+		ast.Walk(r, node.Left)
+
+		return nil
+	case *ast.StructStatement:
+		r.define(node.Name, StructBinding, nil)
+
+		return nil
+	case *ast.EnumStatement:
+		r.define(node.Name, EnumBinding, nil)
+
+		return nil
+	case *ast.StructLiteral:
+		ast.Walk(r, node.Name)
+		for _, v := range node.Values {
+			ast.Walk(r, v)
+		}
+
+		return nil
+	case *ast.ImplStatement:
+		ast.Walk(r, node.Name)
+
+		for _, m := range node.Methods {
+			mark := len(r.info.Bindings)
+			ast.Walk(r, m)
+
+			// Every method has a receiver, whether it uses it or not.
+			for _, b := range r.info.Bindings[mark:] {
+				if b.Ident == m.Parameters[0] {
+					b.Kind = ReceiverBinding
+				}
+			}
+		}
+
+		return nil
+	case *ast.TryExpression:
+		ast.Walk(r, node.Block)
+
+		if node.Catch != nil {
+			r.scope = newBlockScope(r.scope)
+			r.define(node.Param, CatchBinding, nil)
+			r.walkBody(node.Catch)
+			r.scope = r.scope.outer
+		}
+
+		if node.Finally != nil {
+			ast.Walk(r, node.Finally)
+		}
+
+		return nil
+	case *ast.MatchExpression:
+		ast.Walk(r, node.Subject)
+
+		for _, arm := range node.Arms {
+			r.scope = newBlockScope(r.scope)
+
+			for _, ident := range pattern.Bindings(arm.Pattern) {
+				r.define(ident, PatternBinding, nil)
+			}
+
+			if arm.Guard != nil {
+				ast.Walk(r, arm.Guard)
+			}
+			r.walkBody(arm.Body)
+
+			r.scope = r.scope.outer
+		}
+
+		return nil
+	case *ast.Identifier:
+		if b := r.scope.lookup(node.Value); b != nil {
+			b.Uses++
+			r.info.Uses[node] = b
+		}
+
+		return nil
+	case *ast.FunctionExpression, *ast.MacroLiteral:
+		params, body, _ := signature(node.(ast.Expression))
+
+		r.scope = newScope(r.scope)
+
+		// A default value sees the parameters before it, like at runtime.
+		for _, p := range params {
+			if d, ok := p.(*ast.DefaultParameter); ok {
+				ast.Walk(r, d.Value)
+			}
+
+			for _, ident := range pattern.Bindings(p) {
+				r.define(ident, ParamBinding, nil)
+			}
+		}
+
+		r.walkBody(body)
+
+		r.scope = r.scope.outer
+
+		return nil
+	}
+
+	return r
+}
+
+// signature returns the parameters and body of function and macro literals.
+func signature(exp ast.Expression) ([]ast.Expression, *ast.BlockStatement, bool) {
+	switch exp := exp.(type) {
+	case *ast.FunctionExpression:
+		return exp.Parameters, exp.Body, true
+	case *ast.MacroLiteral:
+		params := make([]ast.Expression, len(exp.Parameters))
+		for i, p := range exp.Parameters {
+			params[i] = p
+		}
+		return params, exp.Body, true
+	}
+
+	return nil, nil, false
+}
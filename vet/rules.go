@@ -0,0 +1,268 @@
+package vet
+
+import (
+	"strings"
+
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/object"
+	"github.com/marmotini/ngiri-lang/pattern"
+)
+
+func init() {
+	Register(&Rule{
+		ID:  "unused-let",
+		Doc: "reports let bindings that are never read",
+		Run: checkUnusedLet,
+	})
+	Register(&Rule{
+		ID:  "unused-param",
+		Doc: "reports function parameters that are never read",
+		Run: checkUnusedParam,
+	})
+	Register(&Rule{
+		ID:  "shadow",
+		Doc: "reports bindings that hide a binding of an enclosing scope",
+		Run: checkShadow,
+	})
+	Register(&Rule{
+		ID:  "unreachable",
+		Doc: "reports statements following a return or throw in the same block",
+		Run: checkUnreachable,
+	})
+	Register(&Rule{
+		ID:  "arg-count",
+		Doc: "reports calls to known functions with the wrong number of arguments",
+		Run: checkArgCount,
+	})
+	Register(&Rule{
+		ID:  "incompatible-compare",
+		Doc: "reports comparisons between literals of different types",
+		Run: checkIncompatibleCompare,
+	})
+	Register(&Rule{
+		ID:  "if-value",
+		Doc: "reports if expressions without else whose value is used",
+		Run: checkIfValue,
+	})
+	Register(&Rule{
+		ID:  "non-exhaustive-match",
+		Doc: "reports match expressions that have no arm for some values",
+		Run: checkNonExhaustiveMatch,
+	})
+}
+
+// names starting with an underscore are deliberately unused
+func ignored(name string) bool {
+	return strings.HasPrefix(name, "_")
+}
+
+func checkUnusedLet(pass *Pass) {
+	for _, b := range pass.Info.Bindings {
+		if b.Kind == LetBinding && b.Uses == 0 && !b.Exported && !ignored(b.Name) {
+			pass.Reportf(b.Ident, "%s declared but not used", b.Name)
+		}
+	}
+}
+
+func checkUnusedParam(pass *Pass) {
+	for _, b := range pass.Info.Bindings {
+		if b.Kind == ParamBinding && b.Uses == 0 && !ignored(b.Name) {
+			pass.Reportf(b.Ident, "parameter %s is never used", b.Name)
+		}
+	}
+}
+
+func checkShadow(pass *Pass) {
+	for _, b := range pass.Info.Bindings {
+		if b.Shadows != nil {
+			pass.Reportf(b.Ident, "declaration of %s shadows declaration at %s", b.Name, b.Shadows.Ident.Pos())
+		}
+	}
+}
+
+func checkUnreachable(pass *Pass) {
+	check := func(statements []ast.Statement) {
+		for i := 0; i < len(statements)-1; i++ {
+			switch statements[i].(type) {
+			case *ast.ReturnStatement, *ast.ThrowStatement:
+				pass.Reportf(statements[i+1], "unreachable code")
+				return
+			}
+		}
+	}
+
+	ast.Inspect(pass.Program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.Program:
+			check(node.Statements)
+		case *ast.BlockStatement:
+			check(node.Statements)
+		}
+
+		return true
+	})
+}
+
+// arity of the builtins that take a fixed number of arguments
+var builtinArity = map[string]int{
+	"len":       1,
+	"ok":        1,
+	"err":       1,
+	"some":      1,
+	"unwrap":    1,
+	"unwrap_or": 2,
+	"is_ok":     1,
+	"tag_of":    1,
+}
+
+func checkArgCount(pass *Pass) {
+	ast.Inspect(pass.Program, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpression)
+		if !ok {
+			return true
+		}
+
+		// The number of arguments a spread array passes is only known at
+		// runtime.
+		for _, a := range call.Arguments {
+			if _, ok := a.(*ast.SpreadExpression); ok {
+				return true
+			}
+		}
+
+		var name string
+		var min, max int
+
+		switch fn := call.Function.(type) {
+		case *ast.FunctionExpression:
+			name = "function literal"
+			min, max = object.NewSignature("", fn.Parameters).Arity()
+		case *ast.Identifier:
+			b, ok := pass.Info.Uses[fn]
+			if !ok {
+				arity, ok := builtinArity[fn.Value]
+				if !ok {
+					return true
+				}
+
+				name, min, max = fn.Value, arity, arity
+				break
+			}
+
+			params, _, ok := signature(b.Value)
+			if !ok || b.Assigned {
+				return true
+			}
+
+			name = fn.Value
+			min, max = object.NewSignature(fn.Value, params).Arity()
+		default:
+			return true
+		}
+
+		got := len(call.Arguments)
+
+		switch {
+		case min == max && got != min:
+			pass.Reportf(call, "%s called with %d arguments, want %d", name, got, min)
+		case max < 0 && got < min:
+			pass.Reportf(call, "%s called with %d arguments, want at least %d", name, got, min)
+		case max >= 0 && (got < min || got > max):
+			pass.Reportf(call, "%s called with %d arguments, want %d to %d", name, got, min, max)
+		}
+
+		return true
+	})
+}
+
+func literalKind(exp ast.Expression) string {
+	switch exp.(type) {
+	case *ast.IntegerLiteral:
+		return "integer"
+	case *ast.StringLiteral:
+		return "string"
+	case *ast.Boolean:
+		return "boolean"
+	case *ast.ListLiteral:
+		return "list"
+	case *ast.FunctionExpression:
+		return "function"
+	}
+
+	return ""
+}
+
+func checkIncompatibleCompare(pass *Pass) {
+	ast.Inspect(pass.Program, func(node ast.Node) bool {
+		infix, ok := node.(*ast.InfixExpression)
+		if !ok {
+			return true
+		}
+
+		switch infix.Operator {
+		case "==", "!=", "<", ">":
+		default:
+			return true
+		}
+
+		left, right := literalKind(infix.Left), literalKind(infix.Right)
+		if left != "" && right != "" && left != right {
+			pass.Reportf(infix, "comparison of %s literal with %s literal", left, right)
+		}
+
+		return true
+	})
+}
+
+func checkIfValue(pass *Pass) {
+	statements := map[*ast.IfExpression]bool{}
+
+	ast.Inspect(pass.Program, func(node ast.Node) bool {
+		if es, ok := node.(*ast.ExpressionStatement); ok {
+			if ie, ok := es.Expression.(*ast.IfExpression); ok {
+				statements[ie] = true
+			}
+		}
+
+		return true
+	})
+
+	ast.Inspect(pass.Program, func(node ast.Node) bool {
+		ie, ok := node.(*ast.IfExpression)
+		if ok && ie.Alternative == nil && !statements[ie] {
+			pass.Reportf(ie, "if without else used as a value evaluates to null when the condition is false")
+		}
+
+		return true
+	})
+}
+
+func checkNonExhaustiveMatch(pass *Pass) {
+	enums := []*ast.EnumStatement{}
+	ast.Inspect(pass.Program, func(node ast.Node) bool {
+		if e, ok := node.(*ast.EnumStatement); ok {
+			enums = append(enums, e)
+		}
+
+		return true
+	})
+
+	ast.Inspect(pass.Program, func(node ast.Node) bool {
+		if m, ok := node.(*ast.MatchExpression); ok && !pattern.Exhaustive(m) && !coversEnum(m, enums) {
+			pass.Reportf(m, "match is not exhaustive; add a _ arm")
+		}
+
+		return true
+	})
+}
+
+// coversEnum reports whether m has an arm for every variant of one of enums.
+func coversEnum(m *ast.MatchExpression, enums []*ast.EnumStatement) bool {
+	for _, e := range enums {
+		if pattern.Covers(m, e) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,97 @@
+// reports suspicious constructs in a parsed program. Each check is a Rule
+// identified by a short ID so it can be switched off through a Config.
+package vet
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/token"
+)
+
+type Diagnostic struct {
+	Pos     token.Position
+	Rule    string
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: [%s] %s", d.Pos, d.Rule, d.Message)
+}
+
+type Rule struct {
+	ID  string
+	Doc string
+	Run func(pass *Pass)
+}
+
+// Pass is handed to every enabled rule. It gives access to the program, the
+// resolved bindings and a way to report findings.
+type Pass struct {
+	Program *ast.Program
+	Info    *Info
+
+	rule        *Rule
+	diagnostics []Diagnostic
+}
+
+func (p *Pass) Reportf(node ast.Node, format string, args ...interface{}) {
+	p.diagnostics = append(p.diagnostics, Diagnostic{
+		Pos:     node.Pos(),
+		Rule:    p.rule.ID,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+var rules = map[string]*Rule{}
+
+// Register makes a rule available to Check. Registering an ID twice replaces
+// the previous rule.
+func Register(r *Rule) {
+	rules[r.ID] = r
+}
+
+func Lookup(id string) (*Rule, bool) {
+	r, ok := rules[id]
+	return r, ok
+}
+
+// Rules returns the registered rules ordered by ID.
+func Rules() []*Rule {
+	out := make([]*Rule, 0, len(rules))
+	for _, r := range rules {
+		out = append(out, r)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+
+	return out
+}
+
+// Check runs every rule enabled by conf over prog and returns the findings in
+// source order. A nil conf enables all rules.
+func Check(prog *ast.Program, conf *Config) []Diagnostic {
+	pass := &Pass{Program: prog, Info: resolve(prog)}
+
+	for _, r := range Rules() {
+		if !conf.Enabled(r.ID) {
+			continue
+		}
+
+		pass.rule = r
+		r.Run(pass)
+	}
+
+	diagnostics := pass.diagnostics
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i].Pos, diagnostics[j].Pos
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+
+		return a.Column < b.Column
+	})
+
+	return diagnostics
+}
@@ -0,0 +1,118 @@
+package vet
+
+import (
+	"testing"
+
+	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/lexer"
+	"github.com/marmotini/ngiri-lang/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.NewParser(lexer.NewLexer(input))
+	prog := p.ParseProgram()
+
+	assert.Empty(t, p.Errors(), "parser errors")
+
+	return prog
+}
+
+func diagnostics(t *testing.T, input string, conf *Config) []string {
+	out := []string{}
+	for _, d := range Check(parse(t, input), conf) {
+		out = append(out, d.String())
+	}
+
+	return out
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		rule     string
+		input    string
+		expected []string
+	}{
+		{"unused-let", "let a = 1; let b = 2; b", []string{"1:5: [unused-let] a declared but not used"}},
+		{"unused-let", "let f = fn() { let _tmp = 1; 2 }; f()", []string{}},
+		{"unused-let", "let f = fn(n) { f(n) }; f(1)", []string{}},
+		{"unused-let", "export let a = 1;", []string{}},
+		{"unused-let", `export struct P { x }; export enum E { A }; import "lib"; let p = lib.P{x: 1}; p`, []string{}},
+		{"unused-let", `import "lib"; let a = lib.a; lib.b`, []string{"1:19: [unused-let] a declared but not used"}},
+		{"unused-param", "let f = fn(a, b) { a }; f(1, 2)", []string{"1:15: [unused-param] parameter b is never used"}},
+		{"shadow", "let x = 1; let f = fn(x) { x }; f(x)", []string{"1:23: [shadow] declaration of x shadows declaration at 1:5"}},
+		{"shadow", "let x = 1; let x = 2; x", []string{}},
+		{"unreachable", "let f = fn() { return 1; 2 }; f()", []string{"1:26: [unreachable] unreachable code"}},
+		{"unreachable", "return 1;\nlet a = 2;", []string{"2:1: [unreachable] unreachable code"}},
+		{"unreachable", "let f = fn() { throw 1; 2 }; f()", []string{"1:25: [unreachable] unreachable code"}},
+		{"shadow", "let e = 1; let f = fn() { try { e } catch (e) { e } }; f()", []string{"1:44: [shadow] declaration of e shadows declaration at 1:5"}},
+		{"arg-count", "let f = fn(a, b) { a + b }; f(1)", []string{"1:30: [arg-count] f called with 1 arguments, want 2"}},
+		{"arg-count", "len(\"a\", \"b\")", []string{"1:4: [arg-count] len called with 2 arguments, want 1"}},
+		{"arg-count", "fn(a) { a }(1, 2)", []string{"1:12: [arg-count] function literal called with 2 arguments, want 1"}},
+		{"arg-count", "let f = fn(len) { len(1, 2) }; f(1)", []string{}},
+		{"arg-count", "let f = fn(a, b = 1) { a + b }; f(1); f(1, 2, 3)", []string{"1:40: [arg-count] f called with 3 arguments, want 1 to 2"}},
+		{"arg-count", "let f = fn(a, ...b) { b }; f(); f(1, 2, 3)", []string{"1:29: [arg-count] f called with 0 arguments, want at least 1"}},
+		{"arg-count", "let f = fn(a, b) { a + b }; f(...[1]); f(b: 1, a: 2)", []string{}},
+		{"unused-param", "let f = fn(a, b = a) { b }; f(1)", []string{}},
+		{"incompatible-compare", `1 == "1"; 1 < 2; true != 3`, []string{
+			"1:3: [incompatible-compare] comparison of integer literal with string literal",
+			"1:23: [incompatible-compare] comparison of boolean literal with integer literal",
+		}},
+		{"if-value", "let a = if (true) { 1 }; if (true) { 2 }; a", []string{"1:9: [if-value] if without else used as a value evaluates to null when the condition is false"}},
+		{"if-value", "let a = if (true) { 1 } else { 2 }; a", []string{}},
+		{"unused-let", "let [a, ...b] = [1]; b", []string{"1:6: [unused-let] a declared but not used"}},
+		{"unused-param", "let f = fn(n, {k, v}) { n + k }; f(1, {})", []string{"1:19: [unused-param] parameter v is never used"}},
+		{"non-exhaustive-match", "match (1) { 0 => 1, n if n > 0 => 2 }", []string{"1:1: [non-exhaustive-match] match is not exhaustive; add a _ arm"}},
+		{"non-exhaustive-match", "match (1) { 0 => 1, n => n }; match (true) { true => 1, false => 2 }", []string{}},
+		{"shadow", "let h = 1; let f = fn(x) { match (x) { [h, ..._] => h, _ => 0 } }; f(h)", []string{"1:41: [shadow] declaration of h shadows declaration at 1:5"}},
+		{"unused-let", "let h = 1; match ([1]) { [h] => h, _ => 0 }", []string{"1:5: [unused-let] h declared but not used"}},
+		{"shadow", "let x = 1; if (true) { let x = 2; x }; x", []string{"1:28: [shadow] declaration of x shadows declaration at 1:5"}},
+		{"unused-let", "let x = 1; if (true) { x = 2 }", []string{"1:5: [unused-let] x declared but not used"}},
+		{"arg-count", "let f = fn(a) { a }; f = fn(a, b) { a + b }; f(1, 2)", []string{}},
+		{"unused-let", "let x = 1; let y = 2; struct P { x, y }; let p = P{x: y}; p.y = 3", []string{"1:5: [unused-let] x declared but not used"}},
+		{"unused-param", "struct P { x }; impl P { fn zero(self) { 0 } fn add(self, n) { self.x } }", []string{"1:59: [unused-param] parameter n is never used"}},
+		{"unused-let", "struct P { x }; let k = 1; impl P { fn get(self) { k } }", []string{}},
+		{"non-exhaustive-match", "enum S { A(x), B }; let f = fn(s) { match (s) { S.A(x) => x, S.B => 0 } }; match (S.B) { A(x) => x, S.B => 0 }", []string{}},
+		{"non-exhaustive-match", "enum S { A(x), B }; match (S.B) { S.A(1) => 1, S.B => 0 }; match (S.B) { S.A(x) => x }", []string{
+			"1:21: [non-exhaustive-match] match is not exhaustive; add a _ arm",
+			"1:60: [non-exhaustive-match] match is not exhaustive; add a _ arm",
+		}},
+		{"shadow", "enum S { A(x) }; let x = 1; match (S.A(x)) { S.A(x) => x }", []string{"1:50: [shadow] declaration of x shadows declaration at 1:22"}},
+		{"arg-count", "enum S { A(x) }; tag_of(S.A(1), 2)", []string{"1:24: [arg-count] tag_of called with 2 arguments, want 1"}},
+	}
+
+	for _, tt := range tests {
+		conf := &Config{Rules: map[string]bool{}}
+		for _, r := range Rules() {
+			conf.Rules[r.ID] = r.ID == tt.rule
+		}
+
+		assert.Equal(t, tt.expected, diagnostics(t, tt.input, conf), tt.input)
+	}
+}
+
+func TestCheckOrdersDiagnostics(t *testing.T) {
+	input := `let f = fn(a) {
+	return 1;
+	f(1, 2)
+};`
+
+	expected := []string{
+		"1:12: [unused-param] parameter a is never used",
+		"3:2: [unreachable] unreachable code",
+		"3:3: [arg-count] f called with 2 arguments, want 1",
+	}
+
+	assert.Equal(t, expected, diagnostics(t, input, nil))
+}
+
+func TestParseConfig(t *testing.T) {
+	conf, err := ParseConfig([]byte(`{"rules": {"shadow": false}}`))
+	assert.NoError(t, err)
+
+	assert.False(t, conf.Enabled("shadow"))
+	assert.True(t, conf.Enabled("unused-let"))
+
+	_, err = ParseConfig([]byte(`{"rules": {"no-such-rule": true}}`))
+	assert.EqualError(t, err, `invalid vet config: unknown rule "no-such-rule"`)
+}
@@ -0,0 +1,120 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/marmotini/ngiri-lang/object"
+)
+
+// Error is an error raised by the program that no try expression caught.
+type Error struct {
+	Object *object.Error
+}
+
+// Error returns the message of runtime errors as it is, errors of other
+// kinds are prefixed with their kind.
+func (e *Error) Error() string {
+	if e.Object.Kind == object.RuntimeError {
+		return e.Object.Message
+	}
+
+	return e.Object.Inspect()
+}
+
+// StackOverflowError ends a run that nested more calls than the limits or
+// the Config allow, or ran out of stack.
+type StackOverflowError struct {
+	// Depth is the number of calls on the call stack.
+	Depth int
+	// Trace names the innermost of them, innermost first, at most
+	// Config.TraceSize.
+	Trace []string
+}
+
+func (e *StackOverflowError) Error() string {
+	msg := fmt.Sprintf("stack overflow at call depth %d", e.Depth)
+	if len(e.Trace) == 0 {
+		return msg
+	}
+
+	msg += " in " + strings.Join(e.Trace, ", ")
+	if more := e.Depth - len(e.Trace); more > 0 {
+		msg += fmt.Sprintf(" and %d more", more)
+	}
+
+	return msg
+}
+
+// Is reports the error as ErrStackOverflow, so errors.Is finds it the same
+// for the VM and the interpreter.
+func (e *StackOverflowError) Is(target error) bool {
+	return target == ErrStackOverflow
+}
+
+// stackOverflow returns the StackOverflowError of the current call stack.
+func (vm *VM) stackOverflow() error {
+	err := &StackOverflowError{Depth: vm.frameIndex - 1}
+
+	for i := vm.frameIndex - 1; i > 0 && len(err.Trace) < vm.config.TraceSize; i-- {
+		name := vm.frames[i].fn.Name
+		if name == "" {
+			name = "fn"
+		}
+		err.Trace = append(err.Trace, name)
+	}
+
+	return err
+}
+
+// handler is an active try expression: code.OpTry pushes it, code.OpEndTry
+// pops it once the try block is done.
+type handler struct {
+	catch      int
+	frameIndex int
+	sp         int
+}
+
+// throw unwinds the frames up to the innermost active handler and continues
+// at its catch block with the error on the stack. Errors of the execution
+// limits, and errors without a handler, are returned. Only the handlers of
+// the frames above floor are tried, see run.
+func (vm *VM) throw(err error, floor int) error {
+	switch err {
+	case ErrBudgetExceeded, ErrTimeout, ErrCancelled, ErrStackOverflow:
+		return err
+	}
+
+	thrown, ok := err.(*Error)
+	if !ok {
+		thrown = &Error{Object: &object.Error{Message: err.Error(), Kind: object.RuntimeError, Thrown: true}}
+	}
+
+	if len(vm.handlers) == 0 || vm.handlers[len(vm.handlers)-1].frameIndex <= floor {
+		for vm.frameIndex > floor && vm.frameIndex > 1 {
+			vm.budget.Leave()
+			thrown.Object.Unwind(vm.popFrame().fn.Name)
+		}
+		return thrown
+	}
+
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+	for vm.frameIndex > h.frameIndex {
+		vm.budget.Leave()
+		thrown.Object.Unwind(vm.popFrame().fn.Name)
+	}
+
+	vm.sp = h.sp
+	vm.currentFrame().ip = h.catch - 1
+
+	return vm.push(thrown.Object.Catch())
+}
+
+// dropHandlers removes the handlers of the frame that is about to return.
+func (vm *VM) dropHandlers() {
+	for len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].frameIndex >= vm.frameIndex {
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	}
+}
@@ -0,0 +1,104 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/marmotini/ngiri-lang/compiler"
+)
+
+func runInspectTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		comp := compiler.NewCompiler()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error for %q: %s", tt.input, err)
+		}
+
+		vm := NewVM(comp.Bytecode(), Config{})
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+
+		if got := vm.LastPoppedStackElem().Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %q. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestArraysAndHashes(t *testing.T) {
+	runInspectTests(t, []vmTestCase{
+		{`[]`, "[]"},
+		{`[1, 2 * 2, 3 + 3]`, "[1, 4, 6]"},
+		{`[1, 2, 3][1]`, "2"},
+		{`let i = 0; [1][i]`, "1"},
+		{`[1, 2, 3][3]`, "null"},
+		{`[1, 2, 3][-1]`, "null"},
+		{`{"one": 1, "two": 2}["two"]`, "2"},
+		{`{1: "a", true: "b"}[true]`, "b"},
+		{`{"one": 1}["two"]`, "null"},
+		{`let h = {"a": [1, 2]}; h["a"][1]`, "2"},
+		{`len({"a": 1, "b": 2})`, "2"},
+		{`"a" == "a"`, "true"},
+		{`"a" != "a"`, "false"},
+		{`try { 1[0] } catch (e) { e.message }`, "index operator not supported: INTEGER"},
+		{`try { [1]["a"] } catch (e) { e.message }`, "array index must be INTEGER, got STRING"},
+		{`try { {fn(x) { x }: 1} } catch (e) { e.message }`, "unusable as hash key: COMPILED_FUNCTION_OBJ"},
+	})
+}
+
+func TestMatch(t *testing.T) {
+	classify := `let classify = fn(x) {
+	match (x) {
+		0 => "zero",
+		-1 => "minus one",
+		"s" => "string",
+		true => "true",
+		[] => "empty",
+		[h] => "one " + h,
+		[h, ...t] => t,
+		{"k": v} => "k is " + v,
+		_ => "other"
+	}
+};`
+
+	runInspectTests(t, []vmTestCase{
+		{classify + `classify(0)`, "zero"},
+		{classify + `classify(-1)`, "minus one"},
+		{classify + `classify("s")`, "string"},
+		{classify + `classify(true)`, "true"},
+		{classify + `classify(false)`, "other"},
+		{classify + `classify([])`, "empty"},
+		{classify + `classify(["a"])`, "one a"},
+		{classify + `classify(["a", "b", "c"])`, "[b, c]"},
+		{classify + `classify({"k": "v", "j": 1})`, "k is v"},
+		{classify + `classify({"j": 1})`, "other"},
+		{`match (11) { n if n > 10 => "big", _ => "small" }`, "big"},
+		{`match (10) { n if n > 10 => "big", _ => "small" }`, "small"},
+		{`match ([1, [2, 3]]) { [a, [b, ...c]] => a + b + len(c) }`, "4"},
+		{`match ([1, 2]) { [_, ...rest] => rest }`, "[2]"},
+		{`match ([1, 2]) { [a] => a, [a, b] => a + b }`, "3"},
+		{`match (5) { n => { let m = n * 2; m } }`, "10"},
+		{`let f = fn(x) { match (x) { 1 => { return 10 } }; 20 }; f(1)`, "10"},
+		{`match (1) { 1 => {} }`, "null"},
+		{`match (match (2) { 2 => 3 }) { 3 => 4 }`, "4"},
+		{`try { match (5) { 1 => 1 } } catch (e) { e.message }`, "no match arm matches 5"},
+		{`let f = fn(x) { match (x) { 1 => 1 } }; try { f(5) } catch (e) { e.stack }`, "[f]"},
+	})
+}
+
+func TestDestructuring(t *testing.T) {
+	runInspectTests(t, []vmTestCase{
+		{`let [a, b, ...rest] = [1, 2, 3, 4]; a + b + len(rest)`, "5"},
+		{`let [a, ...rest] = [1]; rest`, "[]"},
+		{`let {name, age} = {"name": "ann", "age": 3, "x": 0}; name`, "ann"},
+		{`let {"p": [x, y], 1: z} = {"p": [1, 2], 1: 3}; x + y + z`, "6"},
+		{`let f = fn([a, b], {k}) { a * b + k }; f([2, 3], {"k": 4})`, "10"},
+		{`let f = fn(n, [h, ..._]) { let m = 1; n + h + m }; f(1, [2, 3])`, "4"},
+		{`let f = fn() { let [a, b] = [1, 2]; a - b }; f()`, "-1"},
+		{`try { let [a, b] = [1]; a } catch (e) { e.message }`, "[a, b] needs 2 elements, got 1"},
+		{`try { let [a] = 1; a } catch (e) { e.message }`, "can not destructure INTEGER with [a], want ARRAY"},
+		{`try { let {name} = {"age": 1}; name } catch (e) { e.message }`, "{name: name} needs the key name"},
+		{`let f = fn([a]) { a }; try { f(1) } catch (e) { e.stack }`, "[f]"},
+	})
+}
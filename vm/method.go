@@ -0,0 +1,194 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/marmotini/ngiri-lang/builtin"
+	"github.com/marmotini/ngiri-lang/object"
+)
+
+// methodCache holds what the name of a code.OpCallMethod call site resolved
+// to for the type of the receiver the site saw last: a struct type, as long
+// as its methods are not redefined, or the type of other values.
+type methodCache struct {
+	name       string
+	structType *object.StructType
+	generation int
+	objType    object.ObjectType
+
+	// field is the slot of the struct field the name selects, or -1.
+	field int
+	// method is the method the name selects, nil when there is none.
+	method object.Object
+}
+
+// lookupMethod returns the method cache of site, refreshed for recv.
+func (vm *VM) lookupMethod(recv object.Object, name string, site int) *methodCache {
+	if site >= len(vm.methodCaches) {
+		vm.methodCaches = append(vm.methodCaches, make([]methodCache, site+1-len(vm.methodCaches))...)
+	}
+
+	mc := &vm.methodCaches[site]
+
+	if s, ok := recv.(*object.Struct); ok {
+		t := s.StructType
+		if mc.structType == t && mc.generation == t.Generation && mc.name == name {
+			return mc
+		}
+
+		*mc = methodCache{name: name, structType: t, generation: t.Generation, field: -1}
+		if i, ok := t.FieldIndex(name); ok {
+			mc.field = i
+		} else if m, ok := t.Methods[name]; ok {
+			mc.method = m
+		}
+
+		return mc
+	}
+
+	if mc.structType == nil && mc.objType == recv.Type() && mc.name == name {
+		return mc
+	}
+
+	*mc = methodCache{name: name, objType: recv.Type(), field: -1}
+	if m, ok := builtin.LookupMethod(recv, name); ok {
+		mc.method = m
+	}
+
+	return mc
+}
+
+// executeCallMethod calls the method name of the receiver below the numArgs
+// arguments on top of the stack. A struct field of that name is called
+// instead, like `p.f(x)` would call the function in the field f.
+func (vm *VM) executeCallMethod(name string, numArgs, site int) error {
+	base := vm.sp - 1 - numArgs
+	recv := vm.stack[base]
+
+	mc := vm.lookupMethod(recv, name, site)
+
+	switch method := mc.method.(type) {
+	case nil:
+		if mc.field >= 0 {
+			vm.stack[base] = recv.(*object.Struct).Fields[mc.field]
+			return vm.callFunction(numArgs, nil)
+		}
+
+		// Errors and what can not be selected from, see executeGetField.
+		if err := vm.executeSelect(base, name); err != nil {
+			return err
+		}
+		return vm.callFunction(numArgs, nil)
+	case *object.BuiltinMethod:
+		return vm.callBuiltinMethod(method, recv, numArgs)
+	default:
+		if err := vm.insertCallee(method, numArgs+1); err != nil {
+			return err
+		}
+		return vm.callFunction(numArgs+1, nil)
+	}
+}
+
+// executeSelect replaces the value at index of the stack by its field name.
+func (vm *VM) executeSelect(index int, name string) error {
+	sp := vm.sp
+	vm.sp = index + 1
+
+	if err := vm.executeGetField(name, 0); err != nil {
+		return err
+	}
+
+	vm.sp = sp
+
+	return nil
+}
+
+// callBoundMethod calls the method bound in fn with the receiver as its
+// first argument.
+func (vm *VM) callBoundMethod(fn *object.BoundMethod, numArgs int, names []string) error {
+	if m, ok := fn.Method.(*object.BuiltinMethod); ok {
+		if len(names) > 0 {
+			return fmt.Errorf("builtin methods take no named arguments")
+		}
+		return vm.callBuiltinMethod(m, fn.Receiver, numArgs)
+	}
+
+	vm.stack[vm.sp-1-numArgs] = fn.Receiver
+	if err := vm.insertCallee(fn.Method, numArgs+1); err != nil {
+		return err
+	}
+
+	return vm.callFunction(numArgs+1, names)
+}
+
+// insertCallee puts fn below the numArgs values on top of the stack.
+func (vm *VM) insertCallee(fn object.Object, numArgs int) error {
+	if err := vm.push(nil); err != nil {
+		return err
+	}
+
+	base := vm.sp - 1 - numArgs
+	copy(vm.stack[base+1:vm.sp], vm.stack[base:vm.sp-1])
+	vm.stack[base] = fn
+
+	return nil
+}
+
+// callBuiltinMethod runs a builtin method on recv, replacing the numArgs
+// arguments on top of the stack and the value below them by its result.
+func (vm *VM) callBuiltinMethod(m *object.BuiltinMethod, recv object.Object, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	result, err := m.FN(vm.callValue, recv, args...)
+	if err != nil {
+		return err
+	}
+	vm.sp = vm.sp - numArgs - 1
+
+	return vm.pushResult(result)
+}
+
+// callValue calls fn for a builtin method like map. A compiled function
+// runs in a nested run that ends once it returns; the errors it does not
+// catch end that run too, and are returned to be raised again where the
+// method was called.
+func (vm *VM) callValue(fn object.Object, args ...object.Object) (object.Object, error) {
+	sp, floor := vm.sp, vm.frameIndex
+
+	if err := vm.push(fn); err != nil {
+		return nil, err
+	}
+
+	for _, a := range args {
+		if err := vm.push(a); err != nil {
+			return nil, err
+		}
+	}
+
+	err := vm.callFunction(len(args), nil)
+	for err == nil && vm.frameIndex > floor {
+		if err = vm.run(floor); err != nil {
+			err = vm.throw(err, floor)
+		}
+	}
+
+	if err != nil {
+		vm.sp = sp
+		return nil, err
+	}
+
+	return vm.pop(), nil
+}
+
+// executeDefineMethod pops a function and defines it as the method name of
+// the struct type on top of the stack.
+func (vm *VM) executeDefineMethod(name string) error {
+	fn := vm.pop()
+
+	t, ok := vm.StackTop().(*object.StructType)
+	if !ok {
+		return fmt.Errorf("can not define method %s on %s", name, vm.StackTop().Type())
+	}
+
+	return t.DefineMethod(name, fn)
+}
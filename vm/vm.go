@@ -2,29 +2,51 @@ package vm
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 
+	"github.com/marmotini/ngiri-lang/builtin"
 	"github.com/marmotini/ngiri-lang/code"
 	"github.com/marmotini/ngiri-lang/compiler"
+	"github.com/marmotini/ngiri-lang/limit"
 	"github.com/marmotini/ngiri-lang/object"
+	"github.com/marmotini/ngiri-lang/pattern"
 )
 
-const StackSize = 2048
 const GlobalsSize = 65536
-const MaxFrames = 1024
 
-var True = &object.Boolean{Value: true}
-var False = &object.Boolean{Value: false}
+// Defaults of the Config fields that are zero.
+const (
+	DefaultMaxStackSize = 1 << 20
+	DefaultMaxFrames    = 1 << 16
+	DefaultTraceSize    = 10
+)
+
+// The stacks start with room for these many values and frames, and double
+// whenever they are full.
+const (
+	initialStackSize = 256
+	initialFrames    = 32
+)
+
+var True = object.True
+var False = object.False
 var Null = &object.Null{}
 
-var ErrStackOverflow = errors.New("stack overflow")
+var ErrStackOverflow = limit.ErrStackOverflow
 var ErrStackUnderflow = errors.New("stack underflow")
+var ErrBudgetExceeded = limit.ErrBudgetExceeded
+var ErrTimeout = limit.ErrTimeout
+var ErrCancelled = limit.ErrCancelled
 
 type VM struct {
 	constants    []object.Object
 	instructions code.Instructions
 
+	// bytecode is verified before the first run.
+	bytecode *compiler.Bytecode
+
 	stack []object.Object
 	sp    int
 
@@ -32,31 +54,77 @@ type VM struct {
 
 	frames     []*Frame
 	frameIndex int
+
+	handlers []handler
+
+	// methodCaches are those of the code.OpCallMethod call sites, by the
+	// number the compiler gave them. They grow as the sites run.
+	methodCaches []methodCache
+
+	limits limit.Limits
+	budget *limit.Budget
+
+	config Config
+}
+
+// Config sets up a VM, its zero value uses the defaults.
+type Config struct {
+	// MaxStackSize is the number of values the stack can grow to, the
+	// arguments and locals of all calls and the operands of the
+	// instructions in between.
+	MaxStackSize int
+
+	// MaxFrames is the number of nested calls the call stack can grow to.
+	// Limits.MaxDepth, see SetLimits, usually stops a run before.
+	MaxFrames int
+
+	// TraceSize is the number of functions a StackOverflowError names.
+	TraceSize int
+
+	// Globals is the globals store, a new one when nil. Sharing it lets
+	// programs compiled one after the other, like the lines of a REPL,
+	// see the globals of those before.
+	Globals []object.Object
 }
 
-func NewVM(bytecode *compiler.Bytecode) *VM {
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+func NewVM(bytecode *compiler.Bytecode, config Config) *VM {
+	if config.MaxStackSize == 0 {
+		config.MaxStackSize = DefaultMaxStackSize
+	}
+
+	if config.MaxFrames == 0 {
+		config.MaxFrames = DefaultMaxFrames
+	}
+
+	if config.TraceSize == 0 {
+		config.TraceSize = DefaultTraceSize
+	}
+
+	if config.Globals == nil {
+		config.Globals = make([]object.Object, GlobalsSize)
+	}
+
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, Handlers: bytecode.Handlers}
 	mainFrame := NewFrame(mainFn, 0)
 
-	frames := make([]*Frame, MaxFrames)
+	frames := make([]*Frame, 1, initialFrames)
 	frames[0] = mainFrame
 
 	return &VM{
-		stack:        make([]object.Object, StackSize),
+		stack:        make([]object.Object, initialStackSize),
 		sp:           0,
-		globals:      make([]object.Object, GlobalsSize),
+		globals:      config.Globals,
 		constants:    bytecode.Constants,
 		instructions: bytecode.Instructions,
+		bytecode:     bytecode,
 		frames:       frames,
 		frameIndex:   1,
+		config:       config,
 	}
 }
 
 func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
-	vm := NewVM(bytecode)
-	vm.globals = s
-
-	return vm
+	return NewVM(bytecode, Config{Globals: s})
 }
 
 func (vm *VM) StackTop() object.Object {
@@ -71,9 +139,54 @@ func (vm *VM) LastPoppedStackElem() object.Object {
 	return vm.stack[vm.sp]
 }
 
+// SetLimits bounds the resources of the following runs. The call depth can
+// not exceed Config.MaxFrames.
+func (vm *VM) SetLimits(limits limit.Limits) {
+	vm.limits = limits
+}
+
 // Run contains the fetch-decode-execute cycle
 func (vm *VM) Run() error {
-	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+	return vm.RunContext(context.Background())
+}
+
+// RunContext runs until the program ends, ctx is done or a limit is hit. It
+// returns ErrCancelled, ErrBudgetExceeded, ErrTimeout or a
+// *StackOverflowError, which errors.Is reports as ErrStackOverflow, in the
+// latter cases. Runtime errors the program does not catch are returned as
+// *Error. Bytecode that does not pass compiler.Bytecode.Verify is not run,
+// its *code.VerifyError is returned.
+func (vm *VM) RunContext(ctx context.Context) error {
+	if err := vm.bytecode.Verify(); err != nil {
+		return err
+	}
+
+	vm.budget = limit.NewBudget(ctx, vm.limits)
+	vm.handlers = vm.handlers[:0]
+
+	for {
+		err := vm.run(0)
+		if err == nil {
+			return nil
+		}
+
+		if err = vm.throw(err, 0); err != nil {
+			if err == ErrStackOverflow {
+				return vm.stackOverflow()
+			}
+			return err
+		}
+	}
+}
+
+// run executes instructions until the program ends or, for the nested runs
+// of callValue, until the frames above floor have returned.
+func (vm *VM) run(floor int) error {
+	for vm.frameIndex > floor && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		if err := vm.budget.Step(); err != nil {
+			return err
+		}
+
 		vm.currentFrame().ip++
 
 		ins := vm.currentFrame().Instructions()
@@ -160,25 +273,211 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[vm.currentFrame().ip+1:])
+			vm.currentFrame().ip += 1
+
+			err := vm.push(builtin.Builtins[builtinIndex].Object)
+			if err != nil {
+				return err
+			}
 		case code.OpCall:
 			numArgs := int(code.ReadUint8(ins[vm.currentFrame().ip+1:]))
 			vm.currentFrame().ip += 1
 
-			fn, ok := vm.stack[vm.sp-1-numArgs].(*object.CompiledFunction)
+			err := vm.callFunction(numArgs, nil)
+			if err != nil {
+				return err
+			}
+		case code.OpTailCall:
+			numArgs := int(code.ReadUint8(ins[vm.currentFrame().ip+1:]))
+			vm.currentFrame().ip += 1
+
+			err := vm.tailCall(numArgs)
+			if err != nil {
+				return err
+			}
+		case code.OpAddLocalConst:
+			localIndex := code.ReadUint8(ins[vm.currentFrame().ip+1:])
+			constIndex := code.ReadUint16(ins[vm.currentFrame().ip+2:])
+			vm.currentFrame().ip += 3
+
+			err := vm.localConstOperation(code.OpAdd, int(localIndex), int(constIndex))
+			if err != nil {
+				return err
+			}
+		case code.OpSubLocalConst:
+			localIndex := code.ReadUint8(ins[vm.currentFrame().ip+1:])
+			constIndex := code.ReadUint16(ins[vm.currentFrame().ip+2:])
+			vm.currentFrame().ip += 3
+
+			err := vm.localConstOperation(code.OpSub, int(localIndex), int(constIndex))
+			if err != nil {
+				return err
+			}
+		case code.OpJumpIfNotGreater:
+			pos := int(code.ReadUint16(ins[vm.currentFrame().ip+1:]))
+			vm.currentFrame().ip += 2
+
+			greater, err := vm.greaterThan()
+			if err != nil {
+				return err
+			}
+
+			if !greater {
+				vm.currentFrame().ip = pos - 1
+			}
+		case code.OpCallShaped:
+			numArgs := int(code.ReadUint8(ins[vm.currentFrame().ip+1:]))
+			shapeIndex := code.ReadUint16(ins[vm.currentFrame().ip+2:])
+			vm.currentFrame().ip += 3
+
+			err := vm.callShaped(numArgs, vm.constants[shapeIndex].(*object.CallShape))
+			if err != nil {
+				return err
+			}
+		case code.OpJumpIfBound:
+			local := code.ReadUint8(ins[vm.currentFrame().ip+1:])
+			pos := int(code.ReadUint16(ins[vm.currentFrame().ip+2:]))
+			vm.currentFrame().ip += 3
+
+			if vm.stack[vm.currentFrame().basePointer+int(local)] != nil {
+				vm.currentFrame().ip = pos - 1
+			}
+		case code.OpTry:
+			index := code.ReadUint16(ins[vm.currentFrame().ip+1:])
+			vm.currentFrame().ip += 2
+
+			vm.handlers = append(vm.handlers, handler{
+				catch:      vm.currentFrame().fn.Handlers[index].Catch,
+				frameIndex: vm.frameIndex,
+				sp:         vm.sp,
+			})
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case code.OpThrow:
+			return &Error{Object: object.ThrowValue(vm.pop())}
+		case code.OpGetField:
+			nameIndex := code.ReadUint16(ins[vm.currentFrame().ip+1:])
+			slot := code.ReadUint8(ins[vm.currentFrame().ip+3:])
+			vm.currentFrame().ip += 3
+
+			err := vm.executeGetField(vm.constants[nameIndex].(*object.String).Value, int(slot))
+			if err != nil {
+				return err
+			}
+		case code.OpSetField:
+			nameIndex := code.ReadUint16(ins[vm.currentFrame().ip+1:])
+			slot := code.ReadUint8(ins[vm.currentFrame().ip+3:])
+			vm.currentFrame().ip += 3
+
+			err := vm.executeSetField(vm.constants[nameIndex].(*object.String).Value, int(slot))
+			if err != nil {
+				return err
+			}
+		case code.OpStruct:
+			shapeIndex := code.ReadUint16(ins[vm.currentFrame().ip+1:])
+			vm.currentFrame().ip += 2
+
+			err := vm.executeStruct(vm.constants[shapeIndex].(*object.StructShape))
+			if err != nil {
+				return err
+			}
+		case code.OpCallMethod:
+			nameIndex := code.ReadUint16(ins[vm.currentFrame().ip+1:])
+			numArgs := code.ReadUint8(ins[vm.currentFrame().ip+3:])
+			site := code.ReadUint16(ins[vm.currentFrame().ip+4:])
+			vm.currentFrame().ip += 5
+
+			err := vm.executeCallMethod(vm.constants[nameIndex].(*object.String).Value, int(numArgs), int(site))
+			if err != nil {
+				return err
+			}
+		case code.OpDefineMethod:
+			nameIndex := code.ReadUint16(ins[vm.currentFrame().ip+1:])
+			vm.currentFrame().ip += 2
+
+			err := vm.executeDefineMethod(vm.constants[nameIndex].(*object.String).Value)
+			if err != nil {
+				return err
+			}
+		case code.OpPropagate:
+			pos := int(code.ReadUint16(ins[vm.currentFrame().ip+1:]))
+			vm.currentFrame().ip += 2
+
+			value, failed, ok := object.Unwrap(vm.pop())
 			if !ok {
-				return fmt.Errorf("calling non-function")
+				return fmt.Errorf("operator ? not supported for %s", vm.stack[vm.sp].Type())
+			}
+
+			err := vm.push(value)
+			if err != nil {
+				return err
+			}
+
+			if !failed {
+				vm.currentFrame().ip = pos - 1
+			}
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[vm.currentFrame().ip+1:]))
+			vm.currentFrame().ip += 2
+
+			err := vm.executeArray(numElements)
+			if err != nil {
+				return err
 			}
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[vm.currentFrame().ip+1:]))
+			vm.currentFrame().ip += 2
+
+			err := vm.executeHash(numElements)
+			if err != nil {
+				return err
+			}
+		case code.OpWide:
+			err := vm.executeWide(ins)
+			if err != nil {
+				return err
+			}
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			err := vm.executeIndexExpression(left, index)
+			if err != nil {
+				return err
+			}
+		case code.OpMatch:
+			patternIndex := code.ReadUint16(ins[vm.currentFrame().ip+1:])
+			vm.currentFrame().ip += 2
 
-			if numArgs != fn.NumParameters {
-				return fmt.Errorf("wrong number of arguments: want=%d, got=%d", fn.NumParameters, numArgs)
+			err := vm.executeMatch(vm.constants[patternIndex].(*object.Pattern))
+			if err != nil {
+				return err
 			}
+		case code.OpDestructure:
+			patternIndex := code.ReadUint16(ins[vm.currentFrame().ip+1:])
+			vm.currentFrame().ip += 2
 
-			frame := NewFrame(fn, vm.sp-numArgs)
-			vm.pushFrame(frame)
-			vm.sp = frame.basePointer + fn.NumLocals
+			err := vm.executeDestructure(vm.constants[patternIndex].(*object.Pattern))
+			if err != nil {
+				return err
+			}
+		case code.OpNoMatch:
+			return fmt.Errorf("no match arm matches %s", vm.pop().Inspect())
 		case code.OpReturnValue:
 			returnValue := vm.pop()
 
+			// Returning from the main program ends it, with the returned
+			// value as its last popped element.
+			if vm.frameIndex == 1 {
+				vm.handlers = vm.handlers[:0]
+				vm.currentFrame().ip = len(ins) - 1
+				break
+			}
+
+			vm.budget.Leave()
+			vm.dropHandlers()
 			frame := vm.popFrame()
 			vm.sp = frame.basePointer - 1
 
@@ -187,6 +486,8 @@ func (vm *VM) Run() error {
 				return err
 			}
 		case code.OpReturn:
+			vm.budget.Leave()
+			vm.dropHandlers()
 			frame := vm.popFrame()
 			vm.sp = frame.basePointer - 1
 
@@ -200,6 +501,365 @@ func (vm *VM) Run() error {
 	return nil
 }
 
+// callFunction calls the function below the numArgs arguments on top of
+// the stack. The last len(names) arguments are passed by name.
+func (vm *VM) callFunction(numArgs int, names []string) error {
+	switch fn := vm.stack[vm.sp-1-numArgs].(type) {
+	case *object.CompiledFunction:
+		base := vm.sp - numArgs
+
+		if vm.frameIndex >= vm.config.MaxFrames {
+			return ErrStackOverflow
+		}
+
+		if err := vm.growStack(base + fn.NumLocals + 1); err != nil {
+			return err
+		}
+
+		args, err := fn.Signature.Bind(vm.stack[base:vm.sp], names)
+		if err != nil {
+			// Like errors of destructured parameters, the error is
+			// raised by the callee.
+			thrown := &object.Error{Message: err.Error(), Kind: object.RuntimeError, Thrown: true}
+			thrown.Unwind(fn.Name)
+			return &Error{Object: thrown}
+		}
+		copy(vm.stack[base:], args)
+
+		if err := vm.budget.Enter(); err != nil {
+			return err
+		}
+
+		if err := vm.budget.Alloc(frameSize + 8*int64(fn.NumLocals)); err != nil {
+			return err
+		}
+
+		frame := NewFrame(fn, base)
+		vm.pushFrame(frame)
+		vm.sp = frame.basePointer + fn.NumLocals
+
+		return nil
+	case *object.BuiltIn:
+		if len(names) > 0 {
+			return fmt.Errorf("builtin functions take no named arguments")
+		}
+		return vm.callBuiltIn(fn, numArgs)
+	case *object.BoundMethod:
+		return vm.callBoundMethod(fn, numArgs, names)
+	case *object.VariantType:
+		if len(names) > 0 {
+			return fmt.Errorf("variant constructors take no named arguments")
+		}
+
+		v, err := fn.New(vm.stack[vm.sp-numArgs : vm.sp])
+		if err != nil {
+			return err
+		}
+		vm.sp = vm.sp - numArgs - 1
+
+		return vm.pushNew(v)
+	default:
+		return fmt.Errorf("calling non-function")
+	}
+}
+
+// tailCall makes a call whose value the current function returns. The
+// frame of the function is popped and the callee and its arguments take its
+// place on the stack, so that the callee returns straight to the caller and
+// recursion in tail position runs in constant stack.
+func (vm *VM) tailCall(numArgs int) error {
+	vm.budget.Leave()
+	vm.dropHandlers()
+	frame := vm.popFrame()
+
+	copy(vm.stack[frame.basePointer-1:], vm.stack[vm.sp-1-numArgs:vm.sp])
+	vm.sp = frame.basePointer + numArgs
+
+	return vm.callFunction(numArgs, nil)
+}
+
+// callShaped calls a function with spread or named arguments. The elements
+// of spread arrays replace them on the stack before the call.
+func (vm *VM) callShaped(numArgs int, shape *object.CallShape) error {
+	base := vm.sp - numArgs
+	spreads := shape.Spreads
+
+	args := make([]object.Object, 0, numArgs)
+	for i, arg := range vm.stack[base:vm.sp] {
+		if len(spreads) == 0 || spreads[0] != i {
+			args = append(args, arg)
+			continue
+		}
+		spreads = spreads[1:]
+
+		array, ok := arg.(*object.Array)
+		if !ok {
+			return fmt.Errorf("can not spread %s, want ARRAY", arg.Type())
+		}
+		args = append(args, array.Elements...)
+	}
+
+	if err := vm.growStack(base + len(args) + 1); err != nil {
+		return err
+	}
+
+	copy(vm.stack[base:], args)
+	vm.sp = base + len(args)
+
+	return vm.callFunction(len(args), shape.Names)
+}
+
+// callBuiltIn runs a Go function. A thrown error object returned by it is
+// raised like any other runtime error.
+func (vm *VM) callBuiltIn(fn *object.BuiltIn, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	result := fn.FN(args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	return vm.pushResult(result)
+}
+
+// pushResult pushes the result of a Go function, raising it if it is a
+// thrown error object.
+func (vm *VM) pushResult(result object.Object) error {
+	if err, ok := result.(*object.Error); ok && err.Thrown {
+		return &Error{Object: err.Throw()}
+	}
+
+	if result == nil {
+		return vm.push(Null)
+	}
+
+	return vm.pushNew(result)
+}
+
+// executeWide runs an instruction with the code.OpWide prefix. Those are
+// rare enough to be decoded apart from the others.
+func (vm *VM) executeWide(ins code.Instructions) error {
+	frame := vm.currentFrame()
+
+	op, operands, read, err := code.ReadInstruction(ins[frame.ip:])
+	if err != nil {
+		return err
+	}
+	frame.ip += read - 1
+
+	switch op {
+	case code.OpConstant:
+		return vm.push(vm.constants[operands[0]])
+	case code.OpGetLocal:
+		return vm.push(vm.stack[frame.basePointer+operands[0]])
+	case code.OpSetLocal:
+		vm.stack[frame.basePointer+operands[0]] = vm.pop()
+		return nil
+	case code.OpArray:
+		return vm.executeArray(operands[0])
+	case code.OpHash:
+		return vm.executeHash(operands[0])
+	case code.OpCall:
+		return vm.callFunction(operands[0], nil)
+	case code.OpTailCall:
+		return vm.tailCall(operands[0])
+	case code.OpCallShaped:
+		return vm.callShaped(operands[0], vm.constants[operands[1]].(*object.CallShape))
+	case code.OpGetField:
+		return vm.executeGetField(vm.constants[operands[0]].(*object.String).Value, operands[1])
+	case code.OpSetField:
+		return vm.executeSetField(vm.constants[operands[0]].(*object.String).Value, operands[1])
+	case code.OpStruct:
+		return vm.executeStruct(vm.constants[operands[0]].(*object.StructShape))
+	case code.OpCallMethod:
+		return vm.executeCallMethod(vm.constants[operands[0]].(*object.String).Value, operands[1], operands[2])
+	case code.OpDefineMethod:
+		return vm.executeDefineMethod(vm.constants[operands[0]].(*object.String).Value)
+	case code.OpMatch:
+		return vm.executeMatch(vm.constants[operands[0]].(*object.Pattern))
+	case code.OpDestructure:
+		return vm.executeDestructure(vm.constants[operands[0]].(*object.Pattern))
+	default:
+		return fmt.Errorf("unknown wide instruction: %d", op)
+	}
+}
+
+func (vm *VM) executeArray(numElements int) error {
+	elements := make([]object.Object, numElements)
+	copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+	vm.sp -= numElements
+
+	return vm.pushNew(&object.Array{Elements: elements})
+}
+
+func (vm *VM) executeHash(numElements int) error {
+	hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+	if err != nil {
+		return err
+	}
+	vm.sp -= numElements
+
+	return vm.pushNew(hash)
+}
+
+// executeDestructure replaces the value on top of the stack with the values
+// p binds in it.
+func (vm *VM) executeDestructure(p *object.Pattern) error {
+	values, err := pattern.Destructure(p.Node, vm.pop())
+	if err != nil {
+		return err
+	}
+
+	for _, v := range values {
+		if err := vm.push(v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// executeGetField selects the field name. The field of a struct is looked
+// for in slot first, where the compiler expects it. Selecting a method
+// binds it to the receiver.
+func (vm *VM) executeGetField(name string, slot int) error {
+	obj := vm.pop()
+
+	switch obj := obj.(type) {
+	case *object.Struct:
+		if slot < len(obj.Fields) && obj.StructType.Fields[slot] == name {
+			return vm.push(obj.Fields[slot])
+		}
+
+		if val, ok := obj.Field(name); ok {
+			return vm.push(val)
+		}
+
+		method, ok := obj.StructType.Methods[name]
+		if !ok {
+			return fmt.Errorf("struct %s has no field or method %s", obj.StructType.Name, name)
+		}
+		return vm.pushNew(&object.BoundMethod{Receiver: obj, Name: name, Method: method})
+	case *object.Error:
+		val, ok := obj.Field(name)
+		if !ok {
+			return fmt.Errorf("error has no field %s", name)
+		}
+		return vm.pushNew(val)
+	case *object.EnumType:
+		val, err := obj.Select(name)
+		if err != nil {
+			return err
+		}
+		return vm.push(val)
+	case *object.Variant:
+		val, ok := obj.Field(name)
+		if !ok {
+			return fmt.Errorf("variant %s has no field %s", obj.VariantType.Inspect(), name)
+		}
+		return vm.push(val)
+	default:
+		method, ok := builtin.LookupMethod(obj, name)
+		if !ok {
+			return fmt.Errorf("can not select %s from %s", name, obj.Type())
+		}
+		return vm.pushNew(&object.BoundMethod{Receiver: obj, Name: name, Method: method})
+	}
+}
+
+// executeSetField pops a struct and the value to set its field name to, and
+// pushes the value.
+func (vm *VM) executeSetField(name string, slot int) error {
+	obj := vm.pop()
+	value := vm.pop()
+
+	s, ok := obj.(*object.Struct)
+	if !ok {
+		return fmt.Errorf("can not set %s on %s", name, obj.Type())
+	}
+
+	if slot < len(s.Fields) && s.StructType.Fields[slot] == name {
+		s.Fields[slot] = value
+	} else if !s.SetField(name, value) {
+		return fmt.Errorf("struct %s has no field %s", s.StructType.Name, name)
+	}
+
+	return vm.push(value)
+}
+
+func (vm *VM) executeStruct(shape *object.StructShape) error {
+	numValues := len(shape.Slots)
+	s := shape.New(vm.stack[vm.sp-numValues:vm.sp], Null)
+	vm.sp -= numValues
+
+	return vm.pushNew(s)
+}
+
+func (vm *VM) buildHash(start, end int) (object.Object, error) {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	for i := start; i < end; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashable, ok := key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+
+		pairs[hashable.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: pairs}, nil
+}
+
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return fmt.Errorf("array index must be INTEGER, got %s", index.Type())
+		}
+
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return vm.push(Null)
+		}
+
+		return vm.push(left.Elements[i.Value])
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+
+		pair, ok := left.Pairs[key.HashKey()]
+		if !ok {
+			return vm.push(Null)
+		}
+
+		return vm.push(pair.Value)
+	default:
+		return fmt.Errorf("index operator not supported: %s", left.Type())
+	}
+}
+
+// executeMatch pops the subject of a match arm, stores the values p binds
+// when it matches and pushes whether it did.
+func (vm *VM) executeMatch(p *object.Pattern) error {
+	values, ok := pattern.Match(p.Node, vm.pop())
+	if !ok {
+		return vm.push(False)
+	}
+
+	for i, slot := range p.Slots {
+		if p.Local {
+			vm.stack[vm.currentFrame().basePointer+slot] = values[i]
+		} else {
+			vm.globals[slot] = values[i]
+		}
+	}
+
+	return vm.push(True)
+}
+
 func (vm *VM) executeMinusOperator() error {
 	operand := vm.pop()
 
@@ -208,7 +868,7 @@ func (vm *VM) executeMinusOperator() error {
 	}
 
 	value := operand.(*object.Integer).Value
-	return vm.push(&object.Integer{Value: -value})
+	return vm.pushNew(&object.Integer{Value: -value})
 }
 
 func (vm *VM) executeBangOperator() error {
@@ -234,16 +894,66 @@ func (vm *VM) executeComparison(op code.OpCode) error {
 		return vm.executeIntegerComparison(op, left, right)
 	}
 
+	if right.Type() == object.STRING_OBJ && left.Type() == object.STRING_OBJ {
+		return vm.executeStringComparison(op, left, right)
+	}
+
 	switch op {
 	case code.OpEqual:
-		return vm.push(nativeToBooleanObject(right == left))
+		return vm.push(nativeToBooleanObject(object.Equal(left, right)))
 	case code.OpNotEqual:
-		return vm.push(nativeToBooleanObject(right != left))
+		return vm.push(nativeToBooleanObject(!object.Equal(left, right)))
 	default:
 		return fmt.Errorf("unknown operator: %d (%s %s)", op, left.Type(), right.Type())
 	}
 }
 
+// localConstOperation runs OpAddLocalConst and OpSubLocalConst, applying op,
+// OpAdd or OpSub, to integers without pushing them and to anything else like
+// op would.
+func (vm *VM) localConstOperation(op code.OpCode, local, constant int) error {
+	left := vm.stack[vm.currentFrame().basePointer+local]
+	right := vm.constants[constant]
+
+	l, ok := left.(*object.Integer)
+	r, ok2 := right.(*object.Integer)
+	if ok && ok2 {
+		if op == code.OpSub {
+			return vm.pushNew(&object.Integer{Value: l.Value - r.Value})
+		}
+		return vm.pushNew(&object.Integer{Value: l.Value + r.Value})
+	}
+
+	if err := vm.push(left); err != nil {
+		return err
+	}
+	if err := vm.push(right); err != nil {
+		return err
+	}
+
+	return vm.executeBinaryOperation(op)
+}
+
+// greaterThan pops two operands for OpJumpIfNotGreater and reports whether
+// OpGreaterThan would have pushed a truthy value.
+func (vm *VM) greaterThan() (bool, error) {
+	right := vm.stack[vm.sp-1]
+	left := vm.stack[vm.sp-2]
+
+	l, ok := left.(*object.Integer)
+	r, ok2 := right.(*object.Integer)
+	if ok && ok2 {
+		vm.sp -= 2
+		return l.Value > r.Value, nil
+	}
+
+	if err := vm.executeComparison(code.OpGreaterThan); err != nil {
+		return false, err
+	}
+
+	return isTruthy(vm.pop()), nil
+}
+
 func nativeToBooleanObject(result bool) object.Object {
 	if result {
 		return True
@@ -268,6 +978,20 @@ func (vm *VM) executeIntegerComparison(op code.OpCode, left, right object.Object
 	}
 }
 
+func (vm *VM) executeStringComparison(op code.OpCode, left, right object.Object) error {
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeToBooleanObject(leftValue != rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %d (%s %s)", op, left.Type(), right.Type())
+	}
+}
+
 func (vm *VM) executeBinaryOperation(op code.OpCode) error {
 	right := vm.pop()
 	left := vm.pop()
@@ -293,7 +1017,7 @@ func (vm *VM) executeBinaryStringOperation(op code.OpCode, left, right object.Ob
 	leftValue := left.(*object.String).Value
 	rightValue := right.(*object.String).Value
 
-	return vm.push(&object.String{Value: leftValue + rightValue})
+	return vm.pushNew(&object.String{Value: leftValue + rightValue})
 }
 
 func (vm *VM) executeBinaryIntegerOperation(op code.OpCode, left, right object.Object) error {
@@ -310,17 +1034,22 @@ func (vm *VM) executeBinaryIntegerOperation(op code.OpCode, left, right object.O
 	case code.OpMul:
 		result = leftValue * rightValue
 	case code.OpDiv:
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero")
+		}
 		result = leftValue / rightValue
 	default:
 		return fmt.Errorf("unknown integer operator: %d", op)
 	}
 
-	return vm.push(&object.Integer{Value: result})
+	return vm.pushNew(&object.Integer{Value: result})
 }
 
 func (vm *VM) push(o object.Object) error {
-	if vm.sp >= StackSize {
-		return ErrStackOverflow
+	if vm.sp >= len(vm.stack) {
+		if err := vm.growStack(vm.sp + 1); err != nil {
+			return err
+		}
 	}
 
 	vm.stack[vm.sp] = o
@@ -329,6 +1058,45 @@ func (vm *VM) push(o object.Object) error {
 	return nil
 }
 
+// frameSize estimates the bytes of a call frame without its locals.
+const frameSize = 32
+
+// growStack makes room for size values on the stack. It doubles the stack
+// until it does, up to Config.MaxStackSize.
+func (vm *VM) growStack(size int) error {
+	if size <= len(vm.stack) {
+		return nil
+	}
+
+	if size > vm.config.MaxStackSize {
+		return ErrStackOverflow
+	}
+
+	n := len(vm.stack)
+	for n < size {
+		n *= 2
+	}
+	if n > vm.config.MaxStackSize {
+		n = vm.config.MaxStackSize
+	}
+
+	stack := make([]object.Object, n)
+	copy(stack, vm.stack)
+	vm.stack = stack
+
+	return nil
+}
+
+// pushNew pushes an object that has just been allocated, charging it to the
+// memory budget.
+func (vm *VM) pushNew(o object.Object) error {
+	if err := vm.budget.Alloc(object.SizeOf(o)); err != nil {
+		return err
+	}
+
+	return vm.push(o)
+}
+
 func (vm *VM) pop() object.Object {
 	if vm.sp < 1 {
 		return nil
@@ -358,7 +1126,11 @@ func (vm *VM) currentFrame() *Frame {
 }
 
 func (vm *VM) pushFrame(frame *Frame) {
-	vm.frames[vm.frameIndex] = frame
+	if vm.frameIndex == len(vm.frames) {
+		vm.frames = append(vm.frames, frame)
+	} else {
+		vm.frames[vm.frameIndex] = frame
+	}
 	vm.frameIndex++
 }
 
@@ -1,12 +1,22 @@
 package vm
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/marmotini/ngiri-lang/ast"
+	"github.com/marmotini/ngiri-lang/code"
 	"github.com/marmotini/ngiri-lang/compiler"
+	"github.com/marmotini/ngiri-lang/interpreter"
 	"github.com/marmotini/ngiri-lang/lexer"
+	"github.com/marmotini/ngiri-lang/limit"
 	"github.com/marmotini/ngiri-lang/object"
 	"github.com/marmotini/ngiri-lang/parser"
 )
@@ -53,11 +63,50 @@ func TestCallingFunctionWithoutArguments(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestCallArguments(t *testing.T) {
+	runInspectTests(t, []vmTestCase{
+		{`let f = fn(x, y = 10) { x + y }; f(1)`, "11"},
+		{`let f = fn(x, y = 10) { x + y }; f(1, 2)`, "3"},
+		{`let f = fn(x, y = x * 2) { y }; f(4)`, "8"},
+		{`let x = 1; let f = fn(x = x + 1) { x }; f()`, "2"},
+		{`let f = fn(a, [b, c] = [2, 3]) { a + b + c }; f(1)`, "6"},
+		{`let f = fn(first, ...rest) { rest }; f(1, 2, 3)`, "[2, 3]"},
+		{`let f = fn(first, ...rest) { rest }; f(1)`, "[]"},
+		{`let f = fn(x, y, z) { x * 100 + y * 10 + z }; let args = [2, 3]; f(1, ...args)`, "123"},
+		{`let f = fn(...xs) { len(xs) }; f(...[1, 2], 3, ...[])`, "3"},
+		{`len(...["abc"])`, "3"},
+		{`let f = fn(x, y) { x - y }; f(y: 2, x: 1)`, "-1"},
+		{`let f = fn(x, y = 2, z = 3) { x + y * 10 + z * 100 }; f(1, z: 5)`, "521"},
+		{`let f = fn(x, y) { x }; try { f(1, 2, 3) } catch (e) { e.message }`, "f(x, y) takes 2 arguments, got 3"},
+		{`let f = fn(x, y = 1) { x }; try { f() } catch (e) { e.message }`, "f(x, y = 1) is missing the argument x"},
+		{`let f = fn(x, y = 1) { x }; try { f(1, 2, 3) } catch (e) { e.message }`, "f(x, y = 1) takes at most 2 arguments, got 3"},
+		{`let f = fn(x) { x }; try { f(z: 1) } catch (e) { e.message }`, "f(x) has no parameter z"},
+		{`let f = fn(x) { x }; try { f(1, x: 1) } catch (e) { e.message }`, "f(x) got the argument x twice"},
+		{`try { fn(x) { x }(...1) } catch (e) { e.message }`, "can not spread INTEGER, want ARRAY"},
+		{`try { len(x: "a") } catch (e) { e.message }`, "builtin functions take no named arguments"},
+		{`let f = fn(x, y) { x }; try { f(1) } catch (e) { e.stack }`, "[f]"},
+	})
+}
+
+func TestTailCalls(t *testing.T) {
+	runInspectTests(t, []vmTestCase{
+		{`let loop = fn(n, acc) { if (n == 0) { acc } else { loop(n - 1, acc + n) } }; loop(100000, 0)`, "5000050000"},
+		{`let loop = fn(n) { if (n == 0) { return "done" } return loop(n - 1) }; loop(100000)`, "done"},
+		{`let loop = fn(n) { match (n) { 0 => "done", _ => loop(n - 1) } }; loop(100000)`, "done"},
+		{`let loop = fn(n, acc = 0) { if (n == 0) { acc } else { loop(n - 1, acc + 1) } }; loop(100000)`, "100000"},
+		{`let odd = fn(n, even) { if (n == 0) { false } else { even(n - 1) } }; let even = fn(n) { if (n == 0) { true } else { odd(n - 1, even) } }; even(100001)`, "false"},
+		{`let f = fn(a) { len(a) }; f([1, 2])`, "2"},
+		{`let g = fn() { throw "g" }; let f = fn() { try { g() } catch (e) { e.message } }; f()`, "g"},
+		{`let g = fn() { throw "g" }; let f = fn() { try { return g() } catch (e) { e.stack } }; f()`, "[g]"},
+		{`let g = fn() { 1 }; let f = fn() { try { return g() } finally { throw "f" } }; try { f() } catch (e) { e.message }`, "f"},
+	})
+}
+
 func TestStringExpression(t *testing.T) {
 	tests := []vmTestCase{
 		{`"ngiri"`, "ngiri"},
-		{`"mon" + "key"`, "ngiri"},
-		{`"mon" + "key" + "banana"`, "ngiribanana"},
+		{`"ng" + "iri"`, "ngiri"},
+		{`"ng" + "iri" + "banana"`, "ngiribanana"},
 	}
 
 	runVmTests(t, tests)
@@ -145,6 +194,322 @@ func TestIntegerArithmetic(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestExpandedMacros(t *testing.T) {
+	input := `
+	let unless = macro(condition, consequence, alternative) {
+		quote(if (!(unquote(condition))) { unquote(consequence) } else { unquote(alternative) });
+	};
+	let double = macro(x) { quote(unquote(x) * 2) };
+	unless(10 > 5, 1, double(21));`
+
+	program := parse(input)
+	env := object.NewEnvironment()
+	interpreter.DefineMacros(program, env)
+
+	expanded, err := interpreter.ExpandMacros(program, env)
+	if err != nil {
+		t.Fatalf("macro expansion error: %s", err)
+	}
+
+	comp := compiler.NewCompiler()
+	if err := comp.Compile(expanded); err != nil {
+		t.Fatalf("Compiler error: %s", err)
+	}
+
+	vm := NewVM(comp.Bytecode(), Config{})
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	testExpectedObject(t, 42, vm.LastPoppedStackElem())
+}
+
+func TestImports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ngiri-modules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	modules := map[string]string{
+		"math.ngiri":  "let base = 10; export let add = fn(a, b) { a + b }; export let addBase = fn(a) { add(a, base) };",
+		"greet.ngiri": `import {addBase} from "math"; let base = 1; export let eleven = addBase(base);`,
+		"shapes.ngiri": `export struct Point { x, y }; impl Point { fn sum(self) { self.x + self.y } };
+		export enum Shape { Circle(r), Empty };`,
+	}
+	for name, content := range modules {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []vmTestCase{
+		{`import "math"; let base = 5; math.add(base, 2)`, 7},
+		{`import {add} from "math"; import "greet"; add(greet.eleven, 1)`, 12},
+		{`import "shapes"; let p = shapes.Point{x: 1, y: 2}; p.sum() + p.y`, 5},
+		{`import {Point} from "shapes"; Point{y: 4}.y`, 4},
+		{`import "shapes"; match (shapes.Shape.Circle(3)) { shapes.Shape.Empty => 0, shapes.Shape.Circle(r) => r }`, 3},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.NewCompiler()
+		comp.SetModulePath(filepath.Join(dir, "main.ngiri"))
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("Compiler error: %s", err)
+		}
+
+		vm := NewVM(comp.Bytecode(), Config{})
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`let l = fn(s) { len(s) }; l("ngiri")`, 5},
+		{`puts("hello")`, Null},
+	}
+
+	runVmTests(t, tests)
+
+	comp := compiler.NewCompiler()
+	if err := comp.Compile(parse(`len(1)`)); err != nil {
+		t.Fatalf("Compiler error: %s", err)
+	}
+
+	err := NewVM(comp.Bytecode(), Config{}).Run()
+	if err == nil || err.Error() != "argument to `len` not supported, got INTEGER" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []vmTestCase{
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { throw "boom"; 1 } catch (e) { 2 }`, 2},
+		{`try { throw "boom" } catch (e) { e.message }`, "boom"},
+		{`try { throw 42 } catch (e) { e.kind }`, "Error"},
+		{`try { 1 + true } catch (e) { e.message }`, "unsupported types for binary operation: INTEGER BOOLEAN"},
+		{`try { len(1) } catch (e) { e.kind }`, "RuntimeError"},
+		{`try { 1 / 0 } catch (e) { e.message }`, "division by zero"},
+		{`let f = fn(n) { 10 / n }; try { f(0) } catch (e) { e.kind }`, "RuntimeError"},
+		{`try { throw error("IOError", "disk full") } catch (e) { e.kind }`, "IOError"},
+		{`let e = error("boom"); e.message`, "boom"},
+		{`let f = fn() { throw "boom" }; let g = fn() { 1 + f() }; 1 + try { g() } catch (e) { len(e.stack) }`, 3},
+		{`let f = fn() { try { throw "a" } catch (e) { 1 } }; let g = fn() { f() + 1 }; g()`, 2},
+		{`let f = fn(n) { try { if (n == 0) { throw "zero" } else { n } } catch (e) { 0 } }; f(1) + f(0) + f(2)`, 3},
+		{`let x = 0; try { throw "a" } catch (e) { x = 1 } finally { x = x + 10 }; x`, 11},
+		{`let x = 0; try { 1 } finally { x = 5 }; x`, 5},
+		{`try { 1 } finally { 2 }`, 1},
+		{`try { try { throw "inner" } finally { 1 } } catch (e) { e.message }`, "inner"},
+		{`try { try { throw "a" } catch (e) { throw e.message + "b" } } catch (e) { e.message }`, "ab"},
+		{`try { try { throw "a" } catch (e) { throw e } finally { 1 } } catch (e) { e.message }`, "a"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestUncaughtErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		stack    []string
+	}{
+		{`1 + true`, "unsupported types for binary operation: INTEGER BOOLEAN", nil},
+		{`let f = fn(n) { 1 / n }; f(0)`, "division by zero", []string{"f"}},
+		{`throw "boom"`, "Error: boom", nil},
+		{`let f = fn() { throw error("IOError", "disk full") }; let g = fn() { f(); 1 }; g()`, "IOError: disk full", []string{"f", "g"}},
+		{`let f = fn() { throw "tail" }; let g = fn() { f() }; g()`, "Error: tail", []string{"f"}},
+		{`try { throw "a" } finally { 1 }`, "Error: a", nil},
+		{`try { 1 } catch (e) { 2 }; throw "b"`, "Error: b", nil},
+		{`let f = fn(x) { x? }; f(1)`, "operator ? not supported for INTEGER", []string{"f"}},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.NewCompiler()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("Compiler error: %s", err)
+		}
+
+		err := NewVM(comp.Bytecode(), Config{}).Run()
+
+		uncaught, ok := err.(*Error)
+		if !ok {
+			t.Fatalf("error is not *Error for %q. got=%T (%v)", tt.input, err, err)
+		}
+
+		if uncaught.Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, uncaught.Error())
+		}
+
+		if fmt.Sprint(uncaught.Object.Stack) != fmt.Sprint(tt.stack) {
+			t.Errorf("wrong stack for %q. want=%v, got=%v", tt.input, tt.stack, uncaught.Object.Stack)
+		}
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{`let f = fn() { return 1; 2 }; f()`, 1},
+		{`let f = fn(n) { if (n > 0) { return n } 0 }; f(3) + f(-1)`, 3},
+		{`let f = fn() { try { return 1 } catch (e) { 2 } }; f()`, 1},
+		{`let f = fn() { try { return 1 } finally { 2 } }; f()`, 1},
+		{`let f = fn() { try { try { return 1 } finally { throw "a" } } catch (e) { 2 } }; f()`, 2},
+		{`return 1; 2`, 1},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestPropagate(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let f = fn(r) { r? + 1 }; f(ok(1))`, "2"},
+		{`let f = fn(r) { r? + 1 }; f(err("bad"))`, "err(bad)"},
+		{`let f = fn(o) { some(o? * 2) }; f(some(2))`, "some(4)"},
+		{`let f = fn(o) { some(o? * 2) }; f(none)`, "none"},
+		{`let check = fn(n) { if (n > 0) { ok(n) } else { err("negative") } };
+		  let sum = fn(a, b) { ok(check(a)? + check(b)?) };
+		  sum(1, -1)`, "err(negative)"},
+		{`let f = fn() { let x = err(1)?; 2 }; f()`, "err(1)"},
+		{`let f = fn() { try { err(1)? } finally { 2 } }; f()`, "err(1)"},
+		{`none?; 1`, "none"},
+		{`unwrap_or(err(1), 2) + unwrap(some(1))`, "3"},
+		{`is_ok(ok(1)) == true`, "true"},
+		{`try { unwrap(err(error("boom"))) } catch (e) { e.message }`, "boom"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.NewCompiler()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("Compiler error: %s", err)
+		}
+
+		vm := NewVM(comp.Bytecode(), Config{})
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+
+		if got := vm.LastPoppedStackElem().Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %q. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	countdown := `let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; `
+	tail := `let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; `
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		input    string
+		ctx      context.Context
+		limits   limit.Limits
+		expected error
+	}{
+		{countdown + "f(500)", context.Background(), limit.Limits{}, nil},
+		{countdown + "f(500)", context.Background(), limit.Limits{Steps: 100}, ErrBudgetExceeded},
+		{countdown + "f(500)", context.Background(), limit.Limits{Timeout: time.Nanosecond}, ErrTimeout},
+		{countdown + "f(500)", context.Background(), limit.Limits{MaxDepth: 10}, &StackOverflowError{}},
+		{countdown + "f(500)", cancelled, limit.Limits{}, ErrCancelled},
+		{countdown + "f(5000)", context.Background(), limit.Limits{}, &StackOverflowError{}},
+		{countdown + "f(50000)", context.Background(), limit.Limits{MaxDepth: 100000}, nil},
+		{`let f = fn(s) { f(s + "abcdefgh") }; f("")`, context.Background(), limit.Limits{Memory: 1000}, ErrBudgetExceeded},
+		{`let f = fn() { 1 + f() }; f()`, context.Background(), limit.Limits{MaxDepth: 5000}, &StackOverflowError{}},
+		{`let f = fn() { 1 + f() }; try { f() } catch (e) { 1 }`, context.Background(), limit.Limits{}, &StackOverflowError{}},
+		{tail + "f(100000)", context.Background(), limit.Limits{MaxDepth: 10}, nil},
+		{`let f = fn() { f() }; f()`, context.Background(), limit.Limits{Steps: 10000}, ErrBudgetExceeded},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.NewCompiler()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("Compiler error: %s", err)
+		}
+
+		vm := NewVM(comp.Bytecode(), Config{})
+		vm.SetLimits(tt.limits)
+
+		err := vm.RunContext(tt.ctx)
+		if _, ok := tt.expected.(*StackOverflowError); ok {
+			if _, ok := err.(*StackOverflowError); !ok {
+				t.Errorf("wrong error for %s (%+v). want=stack overflow, got=%v", tt.input, tt.limits, err)
+			}
+			continue
+		}
+
+		if err != tt.expected {
+			t.Errorf("wrong error for %s (%+v). want=%v, got=%v", tt.input, tt.limits, tt.expected, err)
+		}
+	}
+}
+
+func TestStackOverflowErrorIs(t *testing.T) {
+	input := `let f = fn() { 1 + f() }; f()`
+
+	comp := compiler.NewCompiler()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("Compiler error: %s", err)
+	}
+
+	err := NewVM(comp.Bytecode(), Config{}).Run()
+	if !errors.Is(err, ErrStackOverflow) || !errors.Is(err, limit.ErrStackOverflow) {
+		t.Errorf("vm error is not a stack overflow. got=%v", err)
+	}
+
+	_, err = interpreter.EvalContext(context.Background(), parse(input), object.NewEnvironment(), limit.Limits{})
+	if !errors.Is(err, limit.ErrStackOverflow) {
+		t.Errorf("interpreter error is not a stack overflow. got=%v", err)
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	countdown := `let countdown = fn(n) { if (n == 0) { 0 } else { 1 + countdown(n - 1) } }; countdown(500)`
+
+	tests := []struct {
+		config   Config
+		limits   limit.Limits
+		expected string
+		depth    int
+	}{
+		{Config{}, limit.Limits{MaxDepth: 10}, "stack overflow at call depth 10 in countdown, countdown, countdown, countdown, countdown, countdown, countdown, countdown, countdown, countdown", 10},
+		{Config{TraceSize: 2}, limit.Limits{MaxDepth: 10}, "stack overflow at call depth 10 in countdown, countdown and 8 more", 10},
+		{Config{MaxFrames: 21, TraceSize: 1}, limit.Limits{}, "stack overflow at call depth 20 in countdown and 19 more", 20},
+		{Config{MaxStackSize: 300, TraceSize: 1}, limit.Limits{}, "stack overflow at call depth 100 in countdown and 99 more", 100},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.NewCompiler()
+		if err := comp.Compile(parse(countdown)); err != nil {
+			t.Fatalf("Compiler error: %s", err)
+		}
+
+		vm := NewVM(comp.Bytecode(), tt.config)
+		vm.SetLimits(tt.limits)
+
+		err, ok := vm.Run().(*StackOverflowError)
+		if !ok {
+			t.Fatalf("no stack overflow for %+v", tt.config)
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong message for %+v. want=%q, got=%q", tt.config, tt.expected, err.Error())
+		}
+
+		if err.Depth != tt.depth {
+			t.Errorf("wrong depth for %+v. want=%d, got=%d", tt.config, tt.depth, err.Depth)
+		}
+	}
+}
+
 func runVmTests(t *testing.T, tests []vmTestCase) {
 	t.Helper()
 
@@ -157,7 +522,7 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 
 		//fmt.Println(comp.Bytecode().String())
 
-		vm := NewVM(comp.Bytecode())
+		vm := NewVM(comp.Bytecode(), Config{})
 		err = vm.Run()
 		if err != nil {
 			t.Fatalf("vm error: %s", err)
@@ -237,3 +602,366 @@ func testIntegerObject(expected int64, actual object.Object) error {
 
 	return nil
 }
+
+func TestOptimizedPrograms(t *testing.T) {
+	inputs := []string{
+		"1 + 2 * 3 - 4 / 2",
+		"-(5 - 10) * -1",
+		`"mon" + "key" == "monkey"`,
+		"!(1 < 2) != !!false",
+		"if (1 > 2) { 10 } else { 20 }",
+		"if (false) { 10 }",
+		"if (true) { let x = 5; x * 2 }",
+		"let f = fn(n) { if (2 > 1) { n * (3 + 4) } }; f(6)",
+		`match (2 + 3) { 5 => "five", _ => "other" }`,
+		`try { throw "bo" + "om" } catch (e) { e.message }`,
+		"let sum = fn(n, acc) { if (n < 1) { acc } else { sum(n - 1, acc + n) } }; sum(100, 0)",
+		"let f = fn(x) { x; 1; x + 1 }; f(41)",
+		`let f = fn(x) { x + "!" }; f("hi")`,
+		`let f = fn(a, b) { if (a > b) { a } else { b } }; [f(1, 2), f(3, 2), f(-4, -4)]`,
+		"let f = fn(x) { let y = if (x > 0) { if (x > 10) { 2 } else { 1 } } else { 0 }; y }; [f(-1), f(5), f(50)]",
+		`let f = fn(x) { try { if (x > 1) { throw x + 1 } else { x } } catch (e) { e.message } }; [f(1), f(5)]`,
+		"let f = fn(x) { let n = 1; if (x > 0) { n = n + x; let n = 100; n } ; n }; [f(-1), f(5)]",
+		"let f = fn(x) { let a = x; let b = a = a * 2; [a, b] }; f(3)",
+		"struct P { x, y }; let f = fn(p) { p.x = p.x + p.y * 2; p }; f(P{y: 3, x: 1 + 2})",
+		"struct P { x }; impl P { fn scale(self, k) { P{x: self.x * k} } }; let f = fn(p) { p.scale(2).x + [1, 2].map(fn(v) { v + 1 })[1] }; f(P{x: 3})",
+		"enum S { A(x), B }; let f = fn(s) { match (s) { S.A(x) if x > 1 => x * 2, A(x) => x, S.B => 0 } }; [f(S.A(1 + 2)), f(S.A(1)), f(S.B), tag_of(S.A(0))]",
+		"let g = 1; let h = fn() { g = 10 }; let f = fn() { let a = g; h(); a + g }; f()",
+		"quote(1 + 2 * 3)",
+	}
+
+	for _, input := range inputs {
+		var results []object.Object
+
+		for level := 0; level <= 3; level++ {
+			comp := compiler.NewCompiler()
+			comp.SetOptimization(level)
+			if err := comp.Compile(parse(input)); err != nil {
+				t.Fatalf("%s: compiler error at -O%d: %s", input, level, err)
+			}
+
+			vm := NewVM(comp.Bytecode(), Config{})
+			if err := vm.Run(); err != nil {
+				t.Fatalf("%s: vm error at -O%d: %s", input, level, err)
+			}
+
+			results = append(results, vm.LastPoppedStackElem())
+		}
+
+		for level, result := range results {
+			if result.Inspect() != results[0].Inspect() {
+				t.Errorf("%s: got %s at -O%d, want %s", input, result.Inspect(), level, results[0].Inspect())
+			}
+		}
+	}
+}
+
+// BenchmarkOptimization runs the same program compiled at every
+// optimization level:
+//
+//	go test ./vm -run XXX -bench Optimization
+func BenchmarkOptimization(b *testing.B) {
+	input := `
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+let sum = fn(n, acc) { if (n > 0) { sum(n - 1, acc + n) } else { acc } };
+fib(18) + sum(5000, 0);
+`
+
+	for level := 0; level <= 3; level++ {
+		comp := compiler.NewCompiler()
+		comp.SetOptimization(level)
+		if err := comp.Compile(parse(input)); err != nil {
+			b.Fatalf("compiler error: %s", err)
+		}
+		bytecode := comp.Bytecode()
+
+		b.Run(fmt.Sprintf("O%d", level), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := NewVM(bytecode, Config{}).Run(); err != nil {
+					b.Fatalf("vm error: %s", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkMethodCall compares method calls with calls of the same
+// function:
+//
+//	go test ./vm -run XXX -bench MethodCall
+func BenchmarkMethodCall(b *testing.B) {
+	inputs := map[string]string{
+		"function": "struct C { n }; let inc = fn(c, k) { c.n + k }; let c = C{n: 1}; let loop = fn(i) { if (i > 0) { inc(c, 1); loop(i - 1) } }; loop(5000)",
+		"method":   "struct C { n }; impl C { fn inc(self, k) { self.n + k } }; let c = C{n: 1}; let loop = fn(i) { if (i > 0) { c.inc(1); loop(i - 1) } }; loop(5000)",
+	}
+
+	for _, name := range []string{"function", "method"} {
+		comp := compiler.NewCompiler()
+		if err := comp.Compile(parse(inputs[name])); err != nil {
+			b.Fatalf("compiler error: %s", err)
+		}
+		bytecode := comp.Bytecode()
+
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := NewVM(bytecode, Config{}).Run(); err != nil {
+					b.Fatalf("vm error: %s", err)
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidBytecode(t *testing.T) {
+	var instructions code.Instructions
+	instructions = append(instructions, code.Make(code.OpJump, 4)...)
+	instructions = append(instructions, code.Make(code.OpConstant, 0)...)
+
+	bytecode := &compiler.Bytecode{Instructions: instructions, Constants: []object.Object{&object.Integer{Value: 1}}}
+
+	err, ok := NewVM(bytecode, Config{}).Run().(*code.VerifyError)
+	if !ok {
+		t.Fatalf("invalid bytecode was run")
+	}
+
+	expected := "invalid bytecode in main at 0000: OpJump jumps to 4, which is not an instruction"
+	if err.Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%q", expected, err.Error())
+	}
+}
+
+func TestBytecodeVerifiedOnce(t *testing.T) {
+	comp := compiler.NewCompiler()
+	if err := comp.Compile(parse("let inc = fn(x) { x + 1 }; inc(1)")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	if err := NewVM(bytecode, Config{}).Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	var fn *object.CompiledFunction
+	for _, c := range bytecode.Constants {
+		if f, ok := c.(*object.CompiledFunction); ok {
+			fn = f
+		}
+	}
+
+	if fn == nil || !fn.Verified {
+		t.Fatalf("function was not marked as verified")
+	}
+
+	// A later program sharing the function does not verify it again, or
+	// it would find it has no return now.
+	fn.Instructions = code.Instructions(code.Make(code.OpNull))
+	main := append(code.Make(code.OpNull), code.Make(code.OpPop)...)
+	later := &compiler.Bytecode{Instructions: main, Constants: bytecode.Constants}
+
+	if err := NewVM(later, Config{}).Run(); err != nil {
+		t.Errorf("verified function was checked again: %s", err)
+	}
+}
+
+func TestWideOperands(t *testing.T) {
+	var names, lets, numbers []string
+	for i := 0; i < 300; i++ {
+		name := fmt.Sprintf("v_%c%c", 'a'+i/26, 'a'+i%26)
+		names = append(names, name)
+		lets = append(lets, fmt.Sprintf("let %s = %d", name, i))
+		numbers = append(numbers, fmt.Sprint(i))
+	}
+
+	var constants []string
+	for i := 0; i < 65600; i++ {
+		constants = append(constants, fmt.Sprint(i))
+	}
+
+	params := strings.Join(names, ", ")
+	args := strings.Join(numbers, ", ")
+
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{fmt.Sprintf("let f = fn() { %s; v_aa + v_ln }; f()", strings.Join(lets, "; ")), 299},
+		{fmt.Sprintf("let f = fn(%s) { v_ln - v_jw }; f(%s)", params, args), 43},
+		{fmt.Sprintf("let f = fn(%s) { v_ln - v_aa }; let g = fn() { f(%s) }; g()", params, args), 299},
+		{fmt.Sprintf("let a = [%s]; a[65599] - a[65535]", strings.Join(constants, ", ")), 64},
+	}
+
+	for _, tt := range tests {
+		for level := 0; level <= 3; level++ {
+			comp := compiler.NewCompiler()
+			comp.SetOptimization(level)
+			if err := comp.Compile(parse(tt.input)); err != nil {
+				t.Fatalf("compiler error at -O%d: %s", level, err)
+			}
+
+			vm := NewVM(comp.Bytecode(), Config{})
+			if err := vm.Run(); err != nil {
+				t.Fatalf("vm error at -O%d: %s", level, err)
+			}
+
+			if err := testIntegerObject(tt.expected, vm.LastPoppedStackElem()); err != nil {
+				t.Errorf("wrong result at -O%d: %s", level, err)
+			}
+		}
+	}
+}
+
+func TestBlockScopes(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x = 1; if (true) { let x = 2; x }; x", 1},
+		{"let x = 1; if (true) { let x = 2; x }", 2},
+		{"let x = 1; if (true) { x = 2 }; x", 2},
+		{"let x = 1; x = x + 1", 2},
+		{"let x = 1; let f = fn() { x = x * 10 }; f(); f(); x", 100},
+		{"let f = fn(n) { let a = 0; if (n > 0) { a = n; let a = 5 }; a }; f(7)", 7},
+		{"let x = 1; match (2) { x => x }; x", 1},
+		{"let e = 1; try { throw 2 } catch (e) { e.message }; e", 1},
+		{"const x = 5; let f = fn() { let x = 1; x = x + 1; x }; f() + x", 7},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStructs(t *testing.T) {
+	tests := []vmTestCase{
+		{"struct Point { x, y }; let p = Point{x: 1, y: 2}; p.x + p.y", 3},
+		{"struct Point { x, y }; Point{y: 2, x: 1}.x", 1},
+		{"struct Point { x, y }; Point{x: 1}.y", Null},
+		{"struct Point { x, y }; let p = Point{x: 1, y: 2}; p.x = 5; p.x * p.y", 10},
+		{"struct Point { x, y }; let p = Point{}; p.x = p.y = 3", 3},
+		{"struct A { a, v }; struct B { v }; let f = fn(s) { s.v }; f(A{v: 1}) + f(B{v: 2})", 3},
+		{"struct P { x }; let f = fn() { let p = P{x: 1}; p.x = p.x + 1; p }; f().x", 2},
+		{"let f = fn() { struct P { x, y }; P{x: 1, y: 2}.y }; f()", 2},
+		{"struct P { x, y }; P{x: 1, y: [1]} == P{x: 1, y: [1]}", false},
+		{"struct P { x, y }; P{x: 1, y: \"a\"} == P{x: 1, y: \"a\"}", true},
+		{"struct P { x, y }; P{x: 1, y: 2} != P{x: 1, y: 3}", true},
+		{"struct P { x }; struct Q { x }; P{x: 1} == Q{x: 1}", false},
+		{"struct P { x }; let p = P{x: P{x: 1}}; p.x.x = 2; p == P{x: P{x: 2}}", true},
+		{"struct P { x }; try { P{x: 1}.y } catch (e) { e.message }", "struct P has no field or method y"},
+		{"struct P { x }; try { let a = 1; a.x = 2 } catch (e) { e.message }", "can not set x on INTEGER"},
+	}
+
+	runVmTests(t, tests)
+
+	comp := compiler.NewCompiler()
+	if err := comp.Compile(parse("struct Point { x, y }; Point{y: 2, x: 1}")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := NewVM(comp.Bytecode(), Config{})
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	if inspect := vm.LastPoppedStackElem().Inspect(); inspect != "Point{x: 1, y: 2}" {
+		t.Errorf("wrong struct. want=%q, got=%q", "Point{x: 1, y: 2}", inspect)
+	}
+}
+
+func TestMethods(t *testing.T) {
+	tests := []vmTestCase{
+		{"struct P { x, y }; impl P { fn sum(self) { self.x + self.y } }; P{x: 1, y: 2}.sum()", 3},
+		{"struct P { x }; impl P { fn add(self, n) { self.x + n } fn twice(self) { self.add(self.x) } }; P{x: 4}.twice()", 8},
+		{"struct P { x }; impl P { fn get(self) { self.x } }; let f = P{x: 7}.get; f()", 7},
+		{"struct P { x }; impl P { fn set(self, v) { self.x = v } }; let p = P{x: 1}; p.set(5); p.x", 5},
+		{"struct P { f }; P{f: fn(a) { a * 2 }}.f(21)", 42},
+		{"struct P { x }; impl P { fn add(self, a, b = 10) { self.x + a + b } }; P{x: 1}.add(b: 1, a: 1)", 3},
+		{"struct P { x }; impl P { fn add(self, a, b) { self.x + a + b } }; P{x: 1}.add(...[2, 3])", 6},
+		{"struct A { v }; struct B { v }; impl A { fn get(self) { self.v } }; impl B { fn get(self) { self.v * 10 } }; let f = fn(s) { s.get() }; f(A{v: 1}) + f(B{v: 2}) + f(A{v: 3})", 24},
+		{"struct P { x }; impl P { fn get(self) { 1 } }; let f = fn(p) { p.get() }; let a = f(P{}); impl P { fn get(self) { 2 } }; a + f(P{})", 3},
+		{"struct P { x }; try { P{x: 1}.nope() } catch (e) { e.message }", "struct P has no field or method nope"},
+		{"try { 1.nope() } catch (e) { e.message }", "can not select nope from INTEGER"},
+		{"try { throw error(\"boom\") } catch (e) { e.message.upper() }", "BOOM"},
+		{"\"abc\".upper()", "ABC"},
+		{"\" a b \".trim().split(\" \").len()", 2},
+		{"\"abc\".contains(\"bc\")", true},
+		{"let up = \"abc\".upper; up()", "ABC"},
+		{"[1, 2, 3].map(fn(x) { x * 2 }).reduce(fn(acc, x) { acc + x }, 0)", 12},
+		{"[1, 2, 3, 4].filter(fn(x) { x > 2 }).len()", 2},
+		{"let xs = [1]; let ys = xs.push(2, 3); xs.len() * 10 + ys.len()", 13},
+		{"{\"b\": 2, \"a\": 1}.keys()[0]", "a"},
+		{"{\"b\": 2, \"a\": 1}.values()[1]", 2},
+		{"let g = fn(y) { y * 3 }; [1, 2].map(fn(x) { [x].map(g)[0] })[1]", 6},
+		{"try { [1, 2].map(fn(x) { throw \"no\" }) } catch (e) { e.message }", "no"},
+		{"[1, 2].map(fn(x) { try { if (x > 1) { throw \"big\" } x } catch (e) { 10 } })[1]", 10},
+		{"try { \"a\".upper(1) } catch (e) { e.message }", "wrong number of arguments. got=1, want=0"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestMethodErrorTrace(t *testing.T) {
+	program := parse(`let f = fn(x) { throw "no" }; [1].map(f)`)
+
+	comp := compiler.NewCompiler()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := NewVM(comp.Bytecode(), Config{})
+	err := vm.Run()
+	if err == nil || err.Error() != "Error: no" {
+		t.Fatalf("wrong error. got=%v", err)
+	}
+
+	if vm.frameIndex != 1 {
+		t.Errorf("frames not unwound. got=%d", vm.frameIndex)
+	}
+}
+
+func TestEnums(t *testing.T) {
+	tests := []vmTestCase{
+		{"enum Shape { Circle(r), Rect(w, h) }; let s = Shape.Rect(2, 5); s.w * s.h", 10},
+		{"enum Shape { Circle(r), Empty }; tag_of(Shape.Circle(1)) + tag_of(Shape.Empty)", "CircleEmpty"},
+		{"enum Shape { Circle(r), Empty }; Shape.Circle(1) == Shape.Circle(1)", true},
+		{"enum Shape { Circle(r), Empty }; Shape.Circle(1) == Shape.Circle(2)", false},
+		{"enum Shape { Circle(r), Empty }; Shape.Empty == Shape.Empty", true},
+		{"enum A { X(v) }; enum B { X(v) }; A.X(1) == B.X(1)", false},
+		{"enum Shape { Circle(r) }; [1, 2].map(Shape.Circle)[1].r", 2},
+		{"enum Shape { Circle(r) }; let c = Shape.Circle; c(4).r", 4},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; let area = fn(s) { match (s) { Shape.Circle(r) => 3 * r * r, Rect(w, h) => w * h, Shape.Empty => 0 } }; area(Shape.Circle(2)) + area(Shape.Rect(2, 5)) + area(Shape.Empty)", 22},
+		{"enum T { Leaf, Node(l, v, r) }; let sum = fn(t) { match (t) { T.Leaf => 0, T.Node(l, v, r) => sum(l) + v + sum(r) } }; sum(T.Node(T.Node(T.Leaf, 1, T.Leaf), 2, T.Leaf))", 3},
+		{"enum O { Some(v), None }; match (O.Some(5)) { Some(1) => 1, Some(n) if n > 2 => n * 2, _ => 0 }", 10},
+		{"let f = fn() { enum S { A(x) }; S.A(1) }; f().x", 1},
+		{"enum Shape { Circle(r) }; let f = fn(n) { Shape.Circle(n) }; f(3).r", 3},
+		{"enum Shape { Circle(r), Empty }; try { Shape.Circle(1, 2) } catch (e) { e.message }", "wrong number of arguments for Shape.Circle. got=2, want=1"},
+		{"enum Shape { Circle(r), Empty }; try { Shape.Square } catch (e) { e.message }", "enum Shape has no variant Square"},
+		{"enum Shape { Circle(r), Empty }; try { Shape.Square(1) } catch (e) { e.message }", "enum Shape has no variant Square"},
+		{"enum Shape { Circle(r), Empty }; try { Shape.Circle(1).x } catch (e) { e.message }", "variant Shape.Circle has no field x"},
+		{"enum Shape { Circle(r), Empty }; try { Shape.Circle(1).r = 2 } catch (e) { e.message }", "can not set r on VARIANT"},
+		{"enum Shape { Circle(r), Empty }; try { Shape.Circle(r: 1) } catch (e) { e.message }", "variant constructors take no named arguments"},
+		{"enum Shape { Circle(r), Empty }; try { match (Shape.Empty) { Shape.Circle(r) => r } } catch (e) { e.message }", "no match arm matches Shape.Empty"},
+		{"try { tag_of(1) } catch (e) { e.message }", "argument to `tag_of` must be VARIANT, got INTEGER"},
+	}
+
+	runVmTests(t, tests)
+
+	inspected := []struct {
+		input    string
+		expected string
+	}{
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Shape.Circle(3)", "Shape.Circle(3)"},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; [Shape.Rect(1, \"a\"), Shape.Empty]", "[Shape.Rect(1, a), Shape.Empty]"},
+		{"enum Shape { Circle(r), Empty }; [Shape, Shape.Circle]", "[enum Shape, Shape.Circle]"},
+	}
+
+	for _, tt := range inspected {
+		comp := compiler.NewCompiler()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := NewVM(comp.Bytecode(), Config{})
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		if inspect := vm.LastPoppedStackElem().Inspect(); inspect != tt.expected {
+			t.Errorf("wrong value for %q. want=%q, got=%q", tt.input, tt.expected, inspect)
+		}
+	}
+}